@@ -3,20 +3,35 @@ package api
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/replit/upm/internal/config"
 )
 
 var HttpClient = &UpmHttpClient{}
 
 type UpmHttpClient struct {
 	http.Client
+
+	// CacheDir is the directory that responses are cached in,
+	// see httpcache.go. If empty, a directory under the user's
+	// cache directory is used.
+	CacheDir string
 }
 
 func (c *UpmHttpClient) Do(req *http.Request) (*http.Response, error) {
 	req.Header.Set("User-Agent", "upm (+https://github.com/replit/upm)")
+	if config.PreferOffline && cacheable(req) {
+		if resp, ok := c.readCache(req); ok {
+			return resp, nil
+		}
+	}
 	resp, err := c.Client.Do(req)
 	if resp == nil && err == nil {
 		panic(fmt.Errorf("no response and no error %v", req))
 	}
+	if err == nil && config.PreferOffline && cacheable(req) {
+		err = c.writeCache(req, resp)
+	}
 
 	return resp, err
 }
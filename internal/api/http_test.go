@@ -0,0 +1,118 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// countingTransport answers every request with the number of
+// requests it has seen so far.
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	status := http.StatusOK
+	if strings.HasSuffix(req.URL.Path, "/missing") {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(strings.Repeat("x", t.requests))),
+		Request:    req,
+	}, nil
+}
+
+func setPreferOffline(t *testing.T, preferOffline bool) {
+	previous := config.PreferOffline
+	config.PreferOffline = preferOffline
+	t.Cleanup(func() { config.PreferOffline = previous })
+}
+
+func get(t *testing.T, client *UpmHttpClient, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHttpCachePreferOffline(t *testing.T) {
+	transport := &countingTransport{}
+	client := &UpmHttpClient{Client: http.Client{Transport: transport}, CacheDir: t.TempDir()}
+
+	// Without --prefer-offline, every request goes to the network,
+	// and nothing is cached.
+	setPreferOffline(t, false)
+	if _, body := get(t, client, "https://registry.example/a"); body != "x" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if _, body := get(t, client, "https://registry.example/a"); body != "xx" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// With it, a miss goes to the network, and is cached for the
+	// next request.
+	setPreferOffline(t, true)
+	if _, body := get(t, client, "https://registry.example/a"); body != "xxx" {
+		t.Errorf("expected a miss, got %q", body)
+	}
+	if _, body := get(t, client, "https://registry.example/a"); body != "xxx" {
+		t.Errorf("expected the cached body, got %q", body)
+	}
+	if transport.requests != 3 {
+		t.Errorf("expected one request on a miss, but %d requests were made", transport.requests)
+	}
+
+	// A request for the same URL that accepts something else isn't
+	// answered from the cache of the first.
+	req, err := http.NewRequest("GET", "https://registry.example/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/vnd.npm.install-v1+json")
+	for i := 0; i < 2; i++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "xxxx" {
+			t.Errorf("expected a body of its own, got %q", body)
+		}
+	}
+	if transport.requests != 4 {
+		t.Errorf("expected one request for the other Accept header, but %d requests were made", transport.requests)
+	}
+}
+
+func TestHttpCacheErrorsNotCached(t *testing.T) {
+	transport := &countingTransport{}
+	client := &UpmHttpClient{Client: http.Client{Transport: transport}, CacheDir: t.TempDir()}
+
+	setPreferOffline(t, true)
+	for i := 0; i < 2; i++ {
+		if status, _ := get(t, client, "https://registry.example/missing"); status != http.StatusNotFound {
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if transport.requests != 2 {
+		t.Errorf("expected errors not to be cached, but %d requests were made", transport.requests)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// The HTTP cache
+//
+// With --prefer-offline, successful responses to GET requests made
+// through HttpClient are saved under the user's cache directory, and a
+// cached response is used as it is, however stale, so that the network
+// is only accessed on a miss. Without it, the cache is neither read
+// nor written. Responses are cached by URL and Accept header, since
+// registries such as npm's answer the same URL with a different
+// document depending on what is accepted.
+
+// maxCachedBody is the size of the largest response body that is
+// cached, so that downloads of whole package indexes aren't kept in
+// memory to be saved.
+const maxCachedBody = 16 << 20
+
+// httpCacheEntry is a response saved in the HTTP cache.
+type httpCacheEntry struct {
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// defaultHTTPCacheDir returns the directory that the HTTP cache is
+// kept in, or an empty string if there is no cache directory.
+func defaultHTTPCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "upm", "http")
+}
+
+// cachePath returns the file that the response to req, a GET, is
+// cached in, or an empty string if responses aren't cached.
+func (c *UpmHttpClient) cachePath(req *http.Request) string {
+	dir := c.CacheDir
+	if dir == "" {
+		dir = defaultHTTPCacheDir()
+		if dir == "" {
+			return ""
+		}
+	}
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCache returns the cached response to req, if there is one.
+func (c *UpmHttpClient) readCache(req *http.Request) (*http.Response, bool) {
+	path := c.cachePath(req)
+	if path == "" {
+		return nil, false
+	}
+	contentsB, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry httpCacheEntry
+	if err := json.Unmarshal(contentsB, &entry); err != nil || entry.URL != req.URL.String() {
+		return nil, false
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}, true
+}
+
+// writeCache saves resp, the response to req, in the cache if it was
+// successful, replacing its body with one that can still be read.
+// Failing to write the cache isn't an error, since it is only an
+// optimization.
+func (c *UpmHttpClient) writeCache(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	path := c.cachePath(req)
+	if path == "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if len(body) > maxCachedBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	contentsB, err := json.Marshal(httpCacheEntry{
+		URL:    req.URL.String(),
+		Header: resp.Header,
+		Body:   body,
+	})
+	if err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return nil
+	}
+	_, err = tmp.Write(contentsB)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+	return nil
+}
+
+// cacheable reports whether the response to req may be cached.
+func cacheable(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Authorization") == ""
+}
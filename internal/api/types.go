@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/util"
 )
 
@@ -74,11 +75,174 @@ type PkgInfo struct {
 	// them into one string.
 	License string `json:"license,omitempty" pretty:"License"`
 
+	// Keywords and categories under which the registry files the
+	// package, e.g. "web" or "command-line-utilities", to help
+	// when searching. For PyPI, the topic classifiers are
+	// included as they are, e.g. "Topic :: Internet :: WWW/HTTP".
+	Keywords []string `json:"keywords,omitempty" pretty:"Keywords"`
+
 	// Names of packages which are dependencies of this package.
 	// There is no way to distinguish between a package that has
 	// no dependencies and a package whose language backend did
 	// not provide dependency information.
 	Dependencies []string `json:"dependencies,omitempty" pretty:"Dependencies"`
+
+	// Peer dependencies, which the package expects the project
+	// to provide, e.g. "react ^18.0.0". Those that the package
+	// works without (such as npm's peerDependenciesMeta optional
+	// peers) are listed separately, since they needn't be
+	// installed.
+	PeerDependencies         []string `json:"peerDependencies,omitempty" pretty:"Peer dependencies"`
+	OptionalPeerDependencies []string `json:"optionalPeerDependencies,omitempty" pretty:"Optional peer dependencies"`
+
+	// Total number of downloads of the package, as a decimal
+	// string, e.g. "1204332". Empty if the registry doesn't
+	// report it.
+	Downloads string `json:"downloads,omitempty" pretty:"Downloads"`
+
+	// When the package was first published, as an RFC 3339
+	// timestamp, e.g. "2010-04-06T12:33:10Z". Empty if the
+	// registry doesn't report it.
+	FirstPublished string `json:"firstPublished,omitempty" pretty:"First published"`
+
+	// The versions of Python that the latest version of the
+	// package supports, as a PEP 440 specifier, e.g. ">=3.8".
+	// Empty if the package doesn't say.
+	RequiresPython string `json:"requiresPython,omitempty" pretty:"Requires Python"`
+
+	// Why the latest version of the package is deprecated, as
+	// given by its authors, e.g. "request has been deprecated,
+	// see https://github.com/request/request/issues/3142". Empty
+	// if it isn't deprecated or the registry doesn't say.
+	Deprecated string `json:"deprecated,omitempty" pretty:"Deprecated"`
+
+	// Size of the latest version of the package in bytes, e.g.
+	// 53214: unpacked for npm, and that of the largest wheel for
+	// PyPI. Only filled in by 'upm info --size'.
+	Size int64 `json:"size,omitempty" pretty:"Size"`
+
+	// The following fields describe the copy of the package that
+	// is installed in the project, if any, as opposed to the
+	// latest one in the registry. They are empty if the package
+	// isn't installed or the backend doesn't report them.
+
+	// Version of the installed copy, e.g. "4.18.2".
+	InstalledVersion string `json:"installedVersion,omitempty" pretty:"Installed version"`
+
+	// Main entry point of the package, e.g. "index.js".
+	Main string `json:"main,omitempty" pretty:"Main"`
+
+	// Entry point for ES module consumers, e.g. "dist/index.mjs".
+	Module string `json:"module,omitempty" pretty:"Module"`
+
+	// The exported entry points, one per subpath and set of
+	// conditions, e.g. "./utils (import) -> ./dist/utils.mjs".
+	Exports []string `json:"exports,omitempty" pretty:"Exports"`
+
+	// Supported engine versions, e.g. "node >=18".
+	Engines []string `json:"engines,omitempty" pretty:"Engines"`
+
+	// Executables provided by the package, e.g.
+	// "tsc -> ./bin/tsc".
+	Executables []string `json:"executables,omitempty" pretty:"Executables"`
+}
+
+// Conflict describes a dependency constraint which prevents a
+// requested package version from being installed. The field tags
+// are used the same way as for PkgInfo.
+type Conflict struct {
+	// The name of the package whose requirement blocks the
+	// requested version.
+	Blocker string `json:"blocker" pretty:"Required by"`
+
+	// The version of the blocking package, if known.
+	BlockerVersion string `json:"blockerVersion,omitempty" pretty:"Version"`
+
+	// The constraint the blocking package places on the
+	// requested package, e.g. "^17.0.2".
+	Constraint string `json:"constraint" pretty:"Constraint"`
+}
+
+// CatalogUpgrade describes an entry of a catalog, which declares the
+// version of a package once for all the members of a workspace, that
+// upm upgrade --catalog bumped. The pretty tags are used as titles by
+// upm schema.
+type CatalogUpgrade struct {
+	// The name of the package.
+	Name string `json:"name" pretty:"Name"`
+
+	// The spec of the package in the catalog before and after.
+	From string `json:"from" pretty:"From"`
+	To   string `json:"to" pretty:"To"`
+}
+
+// PackageLicense is the license of a package in the lockfile, as
+// reported by upm licenses. The pretty tags are used as titles by
+// upm schema.
+type PackageLicense struct {
+	// The name of the package.
+	Name string `json:"name" pretty:"Name"`
+
+	// The version of the package in the lockfile.
+	Version string `json:"version" pretty:"Version"`
+
+	// The license of the package, preferably as an SPDX license
+	// expression, or empty if unknown.
+	License string `json:"license" pretty:"License"`
+}
+
+// LicenseConflict describes a package that depends, directly or
+// through other packages, on one whose license is incompatible with
+// its own, as reported by upm licenses --conflicts. The pretty tags
+// are used as titles by upm schema.
+type LicenseConflict struct {
+	// The name of the dependent package, which may be the project
+	// itself, and its license.
+	Package string `json:"package" pretty:"Package"`
+	License string `json:"license" pretty:"License"`
+
+	// The name of the package it depends on, and its license.
+	Dependency        string `json:"dependency" pretty:"Dependency"`
+	DependencyLicense string `json:"dependencyLicense" pretty:"Dependency license"`
+
+	// The packages through which the dependency is pulled in, in
+	// order, or none if it is a direct dependency.
+	Through []string `json:"through" pretty:"Through"`
+
+	// Why the licenses are incompatible.
+	Reason string `json:"reason" pretty:"Reason"`
+}
+
+// SharedDependency describes a package in the lockfile which more
+// than one direct dependency pulls in, as reported by upm why --all.
+// The pretty tags are used as titles by upm schema.
+type SharedDependency struct {
+	// The name of the package.
+	Name string `json:"name" pretty:"Name"`
+
+	// The number of direct dependencies that pull the package
+	// in.
+	Count int `json:"count" pretty:"Count"`
+
+	// The names of the direct dependencies that pull the package
+	// in, sorted.
+	PulledInBy []string `json:"pulledInBy" pretty:"Pulled in by"`
+}
+
+// PolicyViolation describes a package in the lockfile which the
+// policy of the project configuration file forbids, as reported by
+// upm policy-check. The pretty tags are used as titles by upm schema.
+type PolicyViolation struct {
+	// The name of the package, and its version in the lockfile.
+	Name    string `json:"name" pretty:"Name"`
+	Version string `json:"version" pretty:"Version"`
+
+	// Why the policy forbids the package.
+	Reason string `json:"reason" pretty:"Reason"`
+
+	// The sorted names of the direct dependencies that pull the
+	// package in, or none if it is only a direct dependency itself.
+	PulledInBy []string `json:"pulledInBy" pretty:"Pulled in by"`
 }
 
 // Quirks is a bitmask enum used to indicate how specific language
@@ -86,7 +250,7 @@ type PkgInfo struct {
 // therefore require some different treatment by the command-line
 // interface layer. See the constants of this type for more
 // information.
-type Quirks uint8
+type Quirks uint16
 
 // Constants of type Quirks, used to denote whether a language backend
 // follows the expected abstractions of UPM or if it needs special
@@ -125,6 +289,60 @@ const (
 	// This constant indicates that remove cannot be performed
 	// without a lockfile.
 	QuirkRemoveNeedsLockfile
+
+	// This constant indicates that add honors config.Extra,
+	// making the added optional dependencies part of the given
+	// extra. Without it, upm add --extra is rejected.
+	QuirksAddSupportsExtras
+
+	// This constant indicates that add honors config.GitHub,
+	// sourcing the added package from the given GitHub
+	// repository. Without it, upm add --github is rejected.
+	QuirksAddSupportsGitHub
+
+	// This constant indicates that add honors config.VCS,
+	// declaring the given version control repository and
+	// sourcing the added package from it. Without it, upm add
+	// --vcs is rejected.
+	QuirksAddSupportsVCS
+
+	// This constant indicates that add honors config.Omit,
+	// skipping the installation of the given kinds of
+	// dependencies. Without it, upm add --omit is ignored with a
+	// warning.
+	QuirksAddSupportsOmit
+
+	// This constant indicates that add honors config.Registry,
+	// sourcing the added packages from the given alternative
+	// registry. Without it, upm add --registry is rejected.
+	QuirksAddSupportsRegistry
+)
+
+// SpecSyntax identifies how a package manager reads the version
+// constraints of package specs, where package managers disagree about
+// the same syntax. See the constants of this type.
+type SpecSyntax uint8
+
+// Constants of type SpecSyntax.
+const (
+	// npm's syntax, in which a bare version, or one after =, is
+	// exact if it is complete and stands for its whole series if
+	// it is partial, so that "1.2" is 1.2.x.
+	SpecSyntaxNpm SpecSyntax = iota
+
+	// Cargo's syntax, in which a bare version is a caret
+	// requirement, so that "1.2" is ^1.2.
+	SpecSyntaxCargo
+
+	// The syntax of Poetry, pip, Bundler, Pub and Hex, in which a
+	// bare version, or one after = or ==, pins exactly that
+	// version, so that "2.1" is 2.1.0 only.
+	SpecSyntaxExact
+
+	// Composer's syntax, which pins bare versions like
+	// SpecSyntaxExact but reads "~1.2" like "~>1.2", as >=1.2 and
+	// <2.
+	SpecSyntaxComposer
 )
 
 // LanguageBackend is the core abstraction of UPM. It represents an
@@ -195,6 +413,13 @@ type LanguageBackend struct {
 	// This field is optional, and defaults to QuirksNone.
 	Quirks Quirks
 
+	// How the package manager reads the version constraints of
+	// package specs, such as when upm add checks whether a spec
+	// would downgrade a locked package.
+	//
+	// This field is optional, and defaults to SpecSyntaxNpm.
+	SpecSyntax SpecSyntax
+
 	// Function that normalizes a package name. This is used to
 	// prevent duplicate packages getting added to the specfile.
 	// For example, in Python the package names "flask" and
@@ -208,6 +433,43 @@ type LanguageBackend struct {
 	// which packages are installed. The path need not exist.
 	GetPackageDir func() string
 
+	// Return true if the installed packages are missing or no
+	// longer match the lockfile, for example because the package
+	// directory was deleted or a link into a shared package store
+	// is dangling. This is consulted in addition to the cached
+	// lockfile hash, so that packages are reinstalled even when
+	// the lockfile itself hasn't changed.
+	//
+	// This field is optional, and defaults to always returning
+	// false.
+	IsInstallNeeded func() bool
+
+	// Spot-check the installed packages against the lockfile,
+	// returning false and a description of each discrepancy if
+	// the installation is broken or incomplete, for example
+	// because a package is missing or was only partly written.
+	// The lockfile is guaranteed to exist already. This is used
+	// by upm doctor.
+	//
+	// This field is optional.
+	InstallHealth func(context.Context) (bool, []string)
+
+	// Return the path (relative to the project directory) of the
+	// directory holding the executables that the installed
+	// packages provide, e.g. "node_modules/.bin". This is used by
+	// 'upm exec'. The path need not exist.
+	//
+	// This field is optional.
+	BinPath func(ctx context.Context) string
+
+	// Return the command that downloads the package providing
+	// bin, without adding it to the project, and runs bin with
+	// args, e.g. "npx --yes". This is used by 'upm exec --fetch'
+	// when bin isn't installed.
+	//
+	// This field is optional.
+	FetchCmd func(bin string, args []string) []string
+
 	// Apply a sensible heuristic for sorting search results
 	// if we know we want to surface some packages over others.
 	SortPackages func(query string, packages []PkgInfo) []PkgInfo
@@ -228,6 +490,23 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Info func(PkgName) PkgInfo
 
+	// Return the size in bytes of the given version of the
+	// package, or of the latest one if version is empty, as
+	// reported by the registry, ideally once unpacked, and
+	// whether it does report one. This is used by 'upm info
+	// --size' and 'upm list --size', which call it concurrently
+	// for several packages.
+	//
+	// This field is optional.
+	PackageSize func(ctx context.Context, name PkgName, version PkgVersion) (int64, bool)
+
+	// Return the names of the most popular packages in the
+	// backend's registry. upm add --registry-check uses these to
+	// flag names that look like typos of a popular package.
+	//
+	// This field is optional.
+	PopularPackages func() []PkgName
+
 	// Add packages to the specfile. The map is guaranteed to have
 	// at least one package, and all of the packages are
 	// guaranteed to not already be in the specfile (according to
@@ -248,6 +527,56 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Add func(context.Context, map[PkgName]PkgSpec, string)
 
+	// Add packages to the specfile by editing it directly,
+	// without contacting the registry, resolving, locking or
+	// installing anything. The same guarantees hold as for Add,
+	// but the specs are written exactly as given, with a
+	// permissive default (such as "*") for empty ones. This
+	// implements upm add --write-only; the lockfile is brought up
+	// to date by the next lock or install.
+	//
+	// This field is optional.
+	AddToSpecfile func(context.Context, map[PkgName]PkgSpec, string)
+
+	// Return contents, those of the specfile (empty if it doesn't
+	// exist yet), with the packages added as AddToSpecfile would
+	// add them, without writing anything. upm add uses this to
+	// preview its change to the specfile before confirming.
+	//
+	// This field is optional. Without it, upm add doesn't show
+	// the change.
+	AddToSpecfileContents func(contents []byte, pkgs map[PkgName]PkgSpec, projectName string) ([]byte, error)
+
+	// The kinds of dependency, besides regular ones, that Add and
+	// AddToSpecfile can declare packages as, according to
+	// config.Dependency. upm add rejects any other kind before
+	// calling them.
+	//
+	// This field is optional.
+	DependencyTypes []config.DependencyType
+
+	// Turn a URL, or the path of a local archive (such as a .tgz
+	// or .whl file), that was given to upm add into the name of
+	// the package it contains and a spec that refers to it
+	// directly, for Add and AddToSpecfile to declare. The name is
+	// the one given along with the URL (as in upm add "NAME
+	// URL"), or empty, in which case it is worked out from the
+	// URL or the archive if possible.
+	//
+	// This field is optional. Without it, upm add refuses URLs
+	// and paths.
+	DirectReference func(name PkgName, ref string) (PkgName, PkgSpec, error)
+
+	// Return the language runtime that the project targets
+	// ("python", "nodejs", "ruby" or "php") and the version
+	// constraint it places on the runtime, as declared in the
+	// specfile, for upm doctor to compare against the end-of-life
+	// dates of the runtime's releases. The constraint is empty if
+	// the project declares none.
+	//
+	// This field is optional.
+	RuntimeConstraint func() (runtime string, constraint string)
+
 	// Remove packages from the specfile. The map is guaranteed to
 	// have at least one package, and all of the packages are
 	// guaranteed to already be in the specfile (according to
@@ -261,6 +590,17 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Remove func(context.Context, map[PkgName]bool)
 
+	// Sort the dependency sections of the specfile by package
+	// name, and normalize its formatting where that can be done
+	// without changing what it declares. The specfile is
+	// guaranteed to exist already. This is called after Add,
+	// AddToSpecfile and Remove when sort_on_write is enabled in
+	// the project configuration, so it must not affect the
+	// lockfile.
+	//
+	// This field is optional.
+	SortSpecfile func(context.Context)
+
 	// Generate the lockfile from the specfile. The specfile is
 	// guaranteed to already exist. This method must create the
 	// lockfile if it does not exist already.
@@ -271,6 +611,19 @@ type LanguageBackend struct {
 	// which case this field *may* not be specified.
 	Lock func(context.Context)
 
+	// Report whether the lockfile is up to date with the
+	// specfile, i.e. whether Lock would leave it unchanged,
+	// without modifying any file in the project. The specfile
+	// and the lockfile are guaranteed to exist already. This
+	// implements upm lock --check, typically with the package
+	// manager's own check mode.
+	//
+	// This field is optional. Without it, upm lock --check isn't
+	// supported. Lock can't simply be run on a copy of the
+	// specfile and lockfile instead, since for many backends it
+	// also installs, or needs other files of the project.
+	IsLockfileCurrent func(context.Context) bool
+
 	// Install packages from the lockfile. The specfile and
 	// lockfile are guaranteed to already exist, unless
 	// QuirksNotReproducible in which case only the specfile is
@@ -279,6 +632,18 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Install func(context.Context)
 
+	// Install only the given packages, as for 'upm install
+	// PACKAGE...', without changing the specfile or lockfile.
+	// Unless QuirksNotReproducible, the packages are guaranteed
+	// to be in the lockfile, and the versions it records are
+	// installed; otherwise they are guaranteed to be in the
+	// specfile. A package manager that can't install part of the
+	// lockfile, such as npm, may also install other packages
+	// that are missing.
+	//
+	// This field is optional.
+	InstallPackages func(context.Context, map[PkgName]bool)
+
 	// List the packages in the specfile. Names and specs should
 	// be returned in a format suitable for the Add method. The
 	// specfile is guaranteed to exist already.
@@ -286,11 +651,65 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	ListSpecfile func() map[PkgName]PkgSpec
 
+	// Return additional attributes of the packages in the
+	// specfile, such as whether they are optional or which
+	// extras they belong to. The keys of the outer map are names
+	// as returned by ListSpecfile; packages without attributes
+	// may be omitted. The specfile is guaranteed to exist
+	// already. upm list shows each attribute as a column.
+	//
+	// The "group" attribute, if present, names the dependency
+	// groups that declare the package, separated by ", ", such
+	// as "dev" or the name of a Poetry group. The main
+	// dependencies are called "prod", and packages without a
+	// "group" attribute belong to them alone. upm list --groups
+	// organizes packages by it.
+	//
+	// This field is optional.
+	ListSpecfileAttributes func() map[PkgName]map[string]string
+
+	// Return the project-level settings declared in the
+	// specfile, such as the package indexes to use, keyed by
+	// name. The specfile is guaranteed to exist already. upm list
+	// --verbose shows them after the packages.
+	//
+	// This field is optional.
+	ListSpecfileSettings func() map[string]string
+
 	// List the packages in the lockfile. Names should be returned
 	// in a format suitable for the Add method. The lockfile is
 	// guaranteed to exist already.
 	ListLockfile func() map[PkgName]PkgVersion
 
+	// List the dependencies of each package in the lockfile, by
+	// name, as recorded there. Every package in the lockfile
+	// should have an entry, even if it has no dependencies. The
+	// lockfile is guaranteed to exist already. This is used by
+	// upm why.
+	//
+	// This field is optional.
+	ListLockfileDependencies func() map[PkgName][]PkgName
+
+	// Bump the entries of the named catalog ("default" for the
+	// default one), through which the members of a workspace share
+	// the specs of packages, to the latest versions, returning
+	// those that were behind. With dryRun, only return them.
+	// Terminate the process if there is no such catalog. The
+	// lockfile is not updated. This also makes upm add
+	// --save-catalog available.
+	//
+	// This field is optional.
+	UpgradeCatalog func(ctx context.Context, catalog string, dryRun bool) []CatalogUpgrade
+
+	// Return a software bill of materials for the packages in
+	// the lockfile, in the given format (see pkg.SBOM), with
+	// their versions, licenses where known, package URLs and
+	// dependencies. The lockfile is guaranteed to exist already.
+	// Return an error if the format isn't supported.
+	//
+	// This field is optional.
+	SBOM func(ctx context.Context, format string) ([]byte, error)
+
 	// Regexps used to determine if the Guess method really needs
 	// to be invoked, or if its previous return value can be
 	// re-used.
@@ -330,6 +749,25 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Guess func(ctx context.Context) (map[PkgName]bool, bool)
 
+	// Return the package that the given one only provides type
+	// definitions or stubs for, such as express for @types/express
+	// or requests for types-requests, so that upm remove --unused
+	// keeps it while that package is imported. The second value is
+	// false if the package isn't one of those.
+	//
+	// This field is optional.
+	TypesFor func(name PkgName) (PkgName, bool)
+
+	// Explain why the given version of a package cannot be
+	// installed. The backend should run its resolver in a dry
+	// run for the requested version and return the constraints
+	// that block it. If the version can be installed, return an
+	// empty slice. If the resolver fails for a reason that can't
+	// be explained as a conflict, terminate the process.
+	//
+	// This field is optional.
+	WhyNot func(ctx context.Context, name PkgName, version PkgVersion) []Conflict
+
 	// Installs system dependencies into replit.nix for supported
 	// languages.
 	InstallReplitNixSystemDependencies func(context.Context, []PkgName)
@@ -379,6 +817,30 @@ func (b *LanguageBackend) Setup() {
 		util.Panicf("language backend %s is incomplete or invalid: %s", b.Name, reasons)
 	}
 
+	if b.IsInstallNeeded == nil {
+		b.IsInstallNeeded = func() bool {
+			return false
+		}
+	}
+
+	if b.ListSpecfileAttributes == nil {
+		b.ListSpecfileAttributes = func() map[PkgName]map[string]string {
+			return map[PkgName]map[string]string{}
+		}
+	}
+
+	if b.ListSpecfileSettings == nil {
+		b.ListSpecfileSettings = func() map[string]string {
+			return map[string]string{}
+		}
+	}
+
+	if b.PopularPackages == nil {
+		b.PopularPackages = func() []PkgName {
+			return []PkgName{}
+		}
+	}
+
 	if b.NormalizePackageName == nil {
 		b.NormalizePackageName = func(name PkgName) PkgName {
 			return name
@@ -1,5 +1,7 @@
 package api
 
+import "github.com/replit/upm/internal/config"
+
 // QuirksIsNotReproducible returns true if the language backend
 // specifies QuirksNotReproducible, i.e. the package manager doesn't
 // support a lockfile and one must be generated after install.
@@ -62,3 +64,53 @@ func (b *LanguageBackend) QuirksDoesLockNotAlsoInstall() bool {
 func (b *LanguageBackend) QuirkRemoveNeedsLockfile() bool {
 	return (b.Quirks & QuirkRemoveNeedsLockfile) != 0
 }
+
+// QuirksDoesAddSupportExtras returns true if the language backend
+// specifies QuirksAddSupportsExtras, i.e. add can make optional
+// dependencies part of an extra.
+func (b *LanguageBackend) QuirksDoesAddSupportExtras() bool {
+	return (b.Quirks & QuirksAddSupportsExtras) != 0
+}
+
+// QuirksDoesAddSupportGitHub returns true if the language backend
+// specifies QuirksAddSupportsGitHub, i.e. add can source a package
+// from a GitHub repository.
+func (b *LanguageBackend) QuirksDoesAddSupportGitHub() bool {
+	return (b.Quirks & QuirksAddSupportsGitHub) != 0
+}
+
+// QuirksDoesAddSupportVCS returns true if the language backend
+// specifies QuirksAddSupportsVCS, i.e. add can source a package from
+// a version control repository.
+func (b *LanguageBackend) QuirksDoesAddSupportVCS() bool {
+	return (b.Quirks & QuirksAddSupportsVCS) != 0
+}
+
+// QuirksDoesAddSupportOmit returns true if the language backend
+// specifies QuirksAddSupportsOmit, i.e. add can skip installing some
+// kinds of dependencies.
+func (b *LanguageBackend) QuirksDoesAddSupportOmit() bool {
+	return (b.Quirks & QuirksAddSupportsOmit) != 0
+}
+
+// QuirksDoesAddSupportRegistry returns true if the language backend
+// specifies QuirksAddSupportsRegistry, i.e. add can source packages
+// from an alternative registry.
+func (b *LanguageBackend) QuirksDoesAddSupportRegistry() bool {
+	return (b.Quirks & QuirksAddSupportsRegistry) != 0
+}
+
+// SupportsDependencyType returns true if add can declare packages as
+// the given kind of dependency, i.e. it is a regular dependency or
+// it is listed in DependencyTypes.
+func (b *LanguageBackend) SupportsDependencyType(t config.DependencyType) bool {
+	if t == config.DependencyRegular {
+		return true
+	}
+	for _, supported := range b.DependencyTypes {
+		if supported == t {
+			return true
+		}
+	}
+	return false
+}
@@ -4,12 +4,18 @@ package backends
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/replit/upm/internal/api"
 	"github.com/replit/upm/internal/backends/dart"
 	"github.com/replit/upm/internal/backends/dotnet"
 	"github.com/replit/upm/internal/backends/elisp"
+	"github.com/replit/upm/internal/backends/external"
+	"github.com/replit/upm/internal/backends/gleam"
 	"github.com/replit/upm/internal/backends/java"
 	"github.com/replit/upm/internal/backends/nodejs"
 	"github.com/replit/upm/internal/backends/php"
@@ -17,6 +23,7 @@ import (
 	"github.com/replit/upm/internal/backends/rlang"
 	"github.com/replit/upm/internal/backends/ruby"
 	"github.com/replit/upm/internal/backends/rust"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
@@ -29,6 +36,7 @@ import (
 var languageBackends = []api.LanguageBackend{
 	python.PythonPoetryBackend,
 	python.PythonPipBackend,
+	python.PythonPipToolsBackend,
 	nodejs.BunBackend,
 	nodejs.NodejsNPMBackend,
 	nodejs.NodejsPNPMBackend,
@@ -41,14 +49,56 @@ var languageBackends = []api.LanguageBackend{
 	dotnet.DotNetBackend,
 	rust.RustBackend,
 	php.PhpComposerBackend,
+	gleam.GleamBackend,
+}
+
+// languageAliases maps informal names that people give languages in
+// --lang to the parts of backend names they stand for. Each
+// hyphen-separated part of a --lang value is looked up here, so
+// --lang=py-poetry means --lang=python-poetry.
+var languageAliases = map[string]string{
+	"py":         "python",
+	"py3":        "python3",
+	"js":         "nodejs",
+	"javascript": "nodejs",
+	"ts":         "nodejs",
+	"typescript": "nodejs",
+	"node":       "nodejs",
+	"rb":         "ruby",
+	"gem":        "ruby",
+	"rs":         "rust",
+	"cargo":      "rust",
+	"cs":         "dotnet",
+	"csharp":     "dotnet",
+	"fsharp":     "dotnet",
+	"r":          "rlang",
+	"emacs":      "elisp",
+	"el":         "elisp",
+	"mvn":        "maven",
+	"flutter":    "dart",
+}
+
+// resolveLanguageAliases returns the --lang value with each of its
+// parts that is an informal name, per languageAliases, replaced by
+// what it stands for.
+func resolveLanguageAliases(language string) string {
+	parts := strings.Split(language, "-")
+	for i, part := range parts {
+		if canonical, ok := languageAliases[strings.ToLower(part)]; ok {
+			parts[i] = canonical
+		}
+	}
+	return strings.Join(parts, "-")
 }
 
 // matchesLanguage checks if a language backend matches a value for
 // the --lang argument. For example, the python-python3-poetry backend
 // will match --lang=python-poetry and --lang=python3 but not
-// --lang=python2. This is used to filter the available language
-// backends before trying to guess which one should be used.
+// --lang=python2. Informal names such as --lang=py are resolved first
+// (see languageAliases). This is used to filter the available
+// language backends before trying to guess which one should be used.
 func matchesLanguage(b api.LanguageBackend, language string) bool {
+	language = resolveLanguageAliases(language)
 	bParts := map[string]bool{}
 	for _, bPart := range strings.Split(b.Name, "-") {
 		bParts[bPart] = true
@@ -75,12 +125,20 @@ func matchesLanguage(b api.LanguageBackend, language string) bool {
 }
 
 // GetBackend returns the language backend for a given --lang argument
-// value. If none is applicable, it exits the process.
+// value. If none is applicable, it exits the process. The default
+// environment variables of the backend (see defaultEnv) are set for
+// the commands that upm runs from then on.
 func GetBackend(ctx context.Context, language string) api.LanguageBackend {
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "GetBackend")
 	defer span.Finish()
-	backends := languageBackends
+	return useDefaultEnv(getBackend(language))
+}
+
+// getBackend implements GetBackend, without setting the default
+// environment variables of the backend.
+func getBackend(language string) api.LanguageBackend {
+	backends := append(externalBackends(), languageBackends...)
 	if language != "" {
 		filteredBackends := []api.LanguageBackend{}
 		for _, b := range backends {
@@ -98,42 +156,222 @@ func GetBackend(ctx context.Context, language string) api.LanguageBackend {
 		}
 
 	}
-	for _, b := range backends {
-		if util.Exists(b.Specfile) &&
-			util.Exists(b.Lockfile) {
-			return b
+	key := newDetectionKey(language)
+	if b, ok := cachedBackend(key, backends); ok {
+		return b
+	}
+	b, ok := detectBackend(backends)
+	if ok {
+		detectionMu.Lock()
+		detectionCache[key] = b.Name
+		detectionMu.Unlock()
+		return b
+	}
+	if language == "" {
+		util.Die("could not autodetect a language for your project")
+	}
+	return backends[0]
+}
+
+// externalBackends returns the external backend declared in the
+// project configuration file, if any, to be considered ahead of the
+// others. It exits the process if the declaration is incomplete.
+func externalBackends() []api.LanguageBackend {
+	if config.External == nil {
+		return nil
+	}
+	b, err := external.CommandTemplateBackend(*config.External)
+	if err != nil {
+		util.Die("%s", err)
+	}
+	return []api.LanguageBackend{b}
+}
+
+// detectBackend picks the one of backends that the files in the
+// current directory suggest, returning false if none applies. Each
+// file and pattern is looked for at most once, however many backends
+// share it.
+func detectBackend(backends []api.LanguageBackend) (api.LanguageBackend, bool) {
+	hint := replitLanguageHint()
+	found := map[string]bool{}
+	has := func(filename string) bool {
+		if present, ok := found[filename]; ok {
+			return present
 		}
+		found[filename] = exists(filename)
+		return found[filename]
+	}
+	hasBoth := func(b api.LanguageBackend) bool {
+		return has(b.Specfile) && has(b.Lockfile)
+	}
+	if b, ok := firstMatchingBackend(backends, hint, hasBoth); ok {
+		return b, true
+	}
+	hasEither := func(b api.LanguageBackend) bool {
+		return has(b.Specfile) || has(b.Lockfile)
+	}
+	if b, ok := firstMatchingBackend(backends, hint, hasEither); ok {
+		return preferDetectedNodejsBackend(backends, b), true
+	}
+	matched := map[string]bool{}
+	hasSources := func(b api.LanguageBackend) bool {
+		for _, p := range b.FilenamePatterns {
+			present, ok := matched[p]
+			if !ok {
+				present = patternExists(p)
+				matched[p] = present
+			}
+			if present {
+				return true
+			}
+		}
+		return false
+	}
+	if b, ok := firstMatchingBackend(backends, hint, hasSources); ok {
+		return preferDetectedNodejsBackend(backends, b), true
+	}
+	return api.LanguageBackend{}, false
+}
+
+// exists, patternExists and evalSymlinks are how GetBackend looks at
+// the filesystem, so that tests can see how often it does.
+var exists = util.Exists
+var patternExists = util.PatternExists
+var evalSymlinks = filepath.EvalSymlinks
+
+// detectionKey identifies a backend detection by the directory it was
+// made in, with symlinks resolved, the modification time of that
+// directory, which changes whenever a file is added to it or removed
+// from it, and the --lang value it was made for.
+type detectionKey struct {
+	root     string
+	modified time.Time
+	language string
+}
+
+// detectionCache remembers the names of the backends detected so far
+// in this process, so that calling GetBackend again for the same
+// directory, as a batch of subcommands or a recursive operation over
+// a monorepo may, doesn't look for the files of the backends again.
+// resolvedRoots likewise remembers the directory that each working
+// directory resolves to.
+var (
+	detectionMu    sync.Mutex
+	detectionCache = map[detectionKey]string{}
+	resolvedRoots  = map[string]string{}
+)
+
+// newDetectionKey returns the detectionKey for the current directory
+// and language.
+func newDetectionKey(language string) detectionKey {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		util.Die("couldn't get working directory: %s", err)
+	}
+	key := detectionKey{root: cwd, language: language}
+	if info, err := os.Stat(cwd); err == nil {
+		key.modified = info.ModTime()
+	}
+
+	detectionMu.Lock()
+	defer detectionMu.Unlock()
+	if root, ok := resolvedRoots[cwd]; ok {
+		key.root = root
+	} else if resolved, err := evalSymlinks(cwd); err == nil {
+		resolvedRoots[cwd] = resolved
+		key.root = resolved
+	}
+	return key
+}
+
+// cachedBackend returns the backend that was detected for key, if
+// there is one among backends.
+func cachedBackend(key detectionKey, backends []api.LanguageBackend) (api.LanguageBackend, bool) {
+	detectionMu.Lock()
+	name, ok := detectionCache[key]
+	detectionMu.Unlock()
+	if !ok {
+		return api.LanguageBackend{}, false
 	}
 	for _, b := range backends {
-		if util.Exists(b.Specfile) ||
-			util.Exists(b.Lockfile) {
-			return b
+		if b.Name == name {
+			return b, true
 		}
 	}
+	return api.LanguageBackend{}, false
+}
+
+// firstMatchingBackend returns the first of backends for which
+// matches returns true. If several do, the first of them that matches
+// hint (a --lang value, see replitLanguageHint) is preferred, so that
+// the hint only breaks ties.
+func firstMatchingBackend(backends []api.LanguageBackend, hint string, matches func(api.LanguageBackend) bool) (api.LanguageBackend, bool) {
+	matching := []api.LanguageBackend{}
 	for _, b := range backends {
-		for _, p := range b.FilenamePatterns {
-			if util.PatternExists(p) {
-				return b
+		if matches(b) {
+			matching = append(matching, b)
+		}
+	}
+	if len(matching) == 0 {
+		return api.LanguageBackend{}, false
+	}
+	if hint != "" {
+		for _, b := range matching {
+			if matchesLanguage(b, hint) {
+				return b, true
 			}
 		}
 	}
-	if language == "" {
-		util.Die("could not autodetect a language for your project")
+	return matching[0], true
+}
+
+// nodejsBackends is the set of names of the backends which share
+// package.json as their specfile, and so can't be told apart by it.
+var nodejsBackends = map[string]bool{
+	nodejs.BunBackend.Name:        true,
+	nodejs.NodejsNPMBackend.Name:  true,
+	nodejs.NodejsPNPMBackend.Name: true,
+	nodejs.NodejsYarnBackend.Name: true,
+}
+
+// preferDetectedNodejsBackend returns b, unless it is a Node.js
+// backend that was only picked for coming first among them. In that
+// case it returns the backend chosen by nodejs.DetectBackendName
+// instead, if that one is among backends.
+func preferDetectedNodejsBackend(backends []api.LanguageBackend, b api.LanguageBackend) api.LanguageBackend {
+	if !nodejsBackends[b.Name] {
+		return b
 	}
-	return backends[0]
+	cwd, err := os.Getwd()
+	if err != nil {
+		util.Die("couldn't get working directory: %s", err)
+	}
+	detected := nodejs.DetectBackendName(cwd)
+	for _, candidate := range backends {
+		if candidate.Name == detected {
+			return candidate
+		}
+	}
+	return b
 }
 
+// BackendInfo describes a language backend, as listed by 'upm
+// list-languages'.
 type BackendInfo struct {
-	Name      string
-	Available bool
+	// The canonical name of the backend.
+	Name string `json:"name"`
+
+	// Whether the backend's tools are installed.
+	Available bool `json:"available"`
 }
 
 // GetBackendNames returns a slice of the canonical names (e.g.
 // python-python3-poetry, not just python3) for all the backends
-// listed in languageBackends.
+// listed in languageBackends, preceded by the external backend of the
+// project configuration file, if any.
 func GetBackendNames() []BackendInfo {
 	var backendNames []BackendInfo
-	for _, b := range languageBackends {
+	for _, b := range append(externalBackends(), languageBackends...) {
 		backendNames = append(backendNames, BackendInfo{Name: b.Name, Available: b.IsAvailable()})
 	}
 	return backendNames
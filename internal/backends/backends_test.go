@@ -5,6 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/replit/upm/internal/util"
 )
 
 func TestGetBackends(t *testing.T) {
@@ -42,3 +46,211 @@ func TestGetBackends(t *testing.T) {
 		os.Remove(tmpfile)
 	}
 }
+
+func TestReplitLanguageHint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{"no hint", map[string]string{}, "python3-pip"},
+		{"language", map[string]string{
+			".replit": "language = \"python3\"\nrun = \"python main.py\"\n",
+		}, "python3-pip"},
+		{"module", map[string]string{
+			".replit": "modules = [\"go-1.20\", \"nodejs-20:v8-20230920-bd784b9\"]\n",
+		}, "nodejs-npm"},
+		{"replit.nix", map[string]string{
+			"replit.nix": "{ pkgs }: {\n  deps = [\n    pkgs.cowsay\n    pkgs.cargo\n    pkgs.rustc\n  ];\n}\n",
+		}, "rust"},
+		{".replit over replit.nix", map[string]string{
+			".replit":    "modules = [\"python-3.10:v18-20230807-322e88b\"]\n",
+			"replit.nix": "{ pkgs }: {\n  deps = [ pkgs.nodejs-18_x ];\n}\n",
+		}, "python3-pip"},
+		{"unknown language", map[string]string{
+			".replit": "language = \"haskell\"\n",
+		}, "python3-pip"},
+	}
+	for _, tc := range testCases {
+		// A directory matching the pip, npm and Cargo backends.
+		dir := t.TempDir()
+		files := map[string]string{
+			"requirements.txt": "",
+			"package.json":     "{}",
+			"Cargo.toml":       "",
+		}
+		for name, contents := range tc.files {
+			files[name] = contents
+		}
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Chdir(t, dir)
+
+		actualBackend := GetBackend(context.Background(), "")
+		if tc.expected != actualBackend.Name {
+			t.Errorf("%s: expected backend %s but got %s", tc.name, tc.expected, actualBackend.Name)
+		}
+	}
+}
+
+func TestLanguageAliases(t *testing.T) {
+	testCases := []struct {
+		language string
+		files    []string
+		expected string
+	}{
+		{"rb", nil, "ruby-bundler"},
+		{"rs", nil, "rust"},
+		{"RS", nil, "rust"},
+		{"r", nil, "rlang"},
+		{"el", nil, "elisp-cask"},
+		{"csharp", nil, "dotnet"},
+		{"mvn", nil, "java-maven"},
+		{"py-pip", nil, "python3-pip"},
+		{"py3-poetry", nil, "python3-poetry"},
+		{"node-pnpm", nil, "nodejs-pnpm"},
+		{"ts-yarn", nil, "nodejs-yarn"},
+		// Ambiguous aliases fall through to detection from the
+		// project's files, and to the first backend without any.
+		{"py", nil, "python3-poetry"},
+		{"py", []string{"requirements.txt"}, "python3-pip"},
+		{"js", nil, "nodejs-npm"},
+		{"js", []string{"package.json", "yarn.lock"}, "nodejs-yarn"},
+		{"node", []string{"package.json", "pnpm-lock.yaml"}, "nodejs-pnpm"},
+	}
+	for _, tc := range testCases {
+		dir := t.TempDir()
+		for _, name := range tc.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Chdir(t, dir)
+
+		actualBackend := GetBackend(context.Background(), tc.language)
+		if tc.expected != actualBackend.Name {
+			t.Errorf("--lang=%s with %v: expected backend %s but got %s", tc.language, tc.files, tc.expected, actualBackend.Name)
+		}
+	}
+}
+
+func TestGetBackendCachesDetection(t *testing.T) {
+	probes := map[string]int{}
+	origExists, origPatternExists, origEvalSymlinks := exists, patternExists, evalSymlinks
+	exists = func(filename string) bool {
+		probes[filename]++
+		return origExists(filename)
+	}
+	patternExists = func(pattern string) bool {
+		probes[pattern]++
+		return origPatternExists(pattern)
+	}
+	evalSymlinks = func(path string) (string, error) {
+		probes["EvalSymlinks "+path]++
+		return origEvalSymlinks(path)
+	}
+	t.Cleanup(func() { exists, patternExists, evalSymlinks = origExists, origPatternExists, origEvalSymlinks })
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Cargo.toml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, dir)
+	for i := 0; i < 4; i++ {
+		if b := GetBackend(context.Background(), ""); b.Name != "rust" {
+			t.Fatalf("expected rust, got %s", b.Name)
+		}
+	}
+	// Each file is looked for once, by the first detection, and
+	// the directory resolved once; later calls only look at the
+	// modification time of the directory.
+	if len(probes) == 0 {
+		t.Fatal("expected the first detection to look for files")
+	}
+	for probe, n := range probes {
+		if n != 1 {
+			t.Errorf("expected %s to be probed once, got %d", probe, n)
+		}
+	}
+
+	// Another directory is detected afresh, as is one whose files
+	// have changed.
+	other := t.TempDir()
+	if err := os.WriteFile(filepath.Join(other, "pom.xml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, other)
+	if b := GetBackend(context.Background(), ""); b.Name != "java-maven" {
+		t.Errorf("expected java-maven, got %s", b.Name)
+	}
+	testutil.Chdir(t, dir)
+	if err := os.Rename("Cargo.toml", "pom.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if b := GetBackend(context.Background(), ""); b.Name != "java-maven" {
+		t.Errorf("expected java-maven after Cargo.toml was replaced, got %s", b.Name)
+	}
+}
+
+func TestGetBackendDefaultEnv(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	defaults := config.DefaultEnv
+	t.Cleanup(func() { config.DefaultEnv = defaults })
+	for _, key := range []string{"POETRY_VIRTUALENVS_IN_PROJECT", "npm_config_fund", "npm_config_audit"} {
+		t.Setenv(key, "")
+		if err := os.Unsetenv(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	printEnv := []string{"sh", "-c", "echo $POETRY_VIRTUALENVS_IN_PROJECT $npm_config_fund $npm_config_audit"}
+
+	GetBackend(context.Background(), "python3-poetry")
+	if output := string(util.GetCmdOutput(printEnv)); output != "1\n" {
+		t.Errorf("expected poetry's defaults in the subprocess environment, got %q", output)
+	}
+
+	GetBackend(context.Background(), "nodejs-npm")
+	if output := string(util.GetCmdOutput(printEnv)); output != "false false\n" {
+		t.Errorf("expected only npm's defaults in the subprocess environment, got %q", output)
+	}
+
+	t.Setenv("npm_config_audit", "true")
+	if output := string(util.GetCmdOutput(printEnv)); output != "false true\n" {
+		t.Errorf("expected the environment to override npm's defaults, got %q", output)
+	}
+}
+
+func TestGetBackendExternal(t *testing.T) {
+	dir := t.TempDir()
+	testutil.Chdir(t, dir)
+	previous := config.External
+	t.Cleanup(func() { config.External = previous })
+	config.External = &config.ExternalBackend{
+		Name:     "haxe-haxelib",
+		Specfile: "haxelib.json",
+		Add:      "haxelib install {name} {spec}",
+		Remove:   "haxelib remove {packages}",
+		Install:  "haxelib install {specfile}",
+		List:     "haxelib list",
+	}
+
+	// The external backend is picked for its specfile, even where a
+	// built-in backend would also match.
+	for _, filename := range []string{"haxelib.json", "package.json"} {
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b := GetBackend(context.Background(), ""); b.Name != "haxe-haxelib" {
+		t.Errorf("expected the external backend to be detected, got %s", b.Name)
+	}
+	if b := GetBackend(context.Background(), "haxe"); b.Name != "haxe-haxelib" {
+		t.Errorf("expected --lang=haxe to pick the external backend, got %s", b.Name)
+	}
+	if b := GetBackend(context.Background(), "nodejs-npm"); b.Name != "nodejs-npm" {
+		t.Errorf("expected --lang=nodejs-npm to pick npm, got %s", b.Name)
+	}
+}
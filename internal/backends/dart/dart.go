@@ -307,10 +307,12 @@ var DartPubBackend = api.LanguageBackend{
 	IsAvailable:      dartIsAvailable,
 	FilenamePatterns: []string{"*.dart"},
 	Quirks:           api.QuirksLockAlsoInstalls,
+	SpecSyntax:       api.SpecSyntaxExact,
 	GetPackageDir:    dartGetPackageDir,
 	Search:           dartSearch,
 	Info:             dartInfo,
 	Add:              dartAdd,
+	AddToSpecfile:    dartAdd,
 	Remove:           dartRemove,
 	Lock: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
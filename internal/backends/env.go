@@ -0,0 +1,46 @@
+package backends
+
+import (
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+// defaultEnv maps the names of backends to the environment variables
+// that are set by default for the commands upm runs with them, to
+// keep their package managers quiet and predictable in a sandbox.
+// Variables set in the environment or in the env table of the
+// project configuration file take precedence.
+//
+// They are all listed here, rather than with each backend, so that
+// they can be reviewed in one place.
+var defaultEnv = map[string]map[string]string{
+	"python3-pip": {
+		// Don't ask PyPI whether a newer pip is available.
+		"PIP_DISABLE_PIP_VERSION_CHECK": "1",
+	},
+	"python3-pip-tools": {
+		"PIP_DISABLE_PIP_VERSION_CHECK": "1",
+	},
+	"python3-poetry": {
+		// Keep the virtualenv in .venv, next to the project,
+		// rather than in a cache directory outside of it.
+		"POETRY_VIRTUALENVS_IN_PROJECT": "1",
+	},
+	"nodejs-npm": {
+		// Don't print funding messages or run a security audit
+		// on every install.
+		"npm_config_fund":  "false",
+		"npm_config_audit": "false",
+	},
+}
+
+// useDefaultEnv makes b's defaultEnv the config.DefaultEnv of the
+// commands upm runs from now on.
+func useDefaultEnv(b api.LanguageBackend) api.LanguageBackend {
+	env := map[string]string{}
+	for key, value := range defaultEnv[b.Name] {
+		env[key] = value
+	}
+	config.DefaultEnv = env
+	return b
+}
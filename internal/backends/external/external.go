@@ -0,0 +1,183 @@
+// Package external provides a backend for ecosystems that upm has no
+// backend for, driven by shell commands from the project
+// configuration file.
+package external
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// CommandTemplateBackend returns the backend that runs the commands
+// of cfg, or an error if cfg lacks any that are required.
+func CommandTemplateBackend(cfg config.ExternalBackend) (api.LanguageBackend, error) {
+	missing := []string{}
+	for _, field := range []struct{ key, value string }{
+		{"specfile", cfg.Specfile},
+		{"add", cfg.Add},
+		{"remove", cfg.Remove},
+		{"install", cfg.Install},
+		{"list", cfg.List},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.key)
+		}
+	}
+	if len(missing) > 0 {
+		return api.LanguageBackend{}, fmt.Errorf("external backend is missing %s", strings.Join(missing, ", "))
+	}
+	hasLockfile := cfg.Lockfile != "" || cfg.Lock != "" || cfg.ListLockfile != ""
+	if hasLockfile && (cfg.Lockfile == "" || cfg.Lock == "" || cfg.ListLockfile == "") {
+		return api.LanguageBackend{}, fmt.Errorf("external backend needs all of lockfile, lock and list_lockfile, or none of them")
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = "external"
+	}
+	if len(cfg.FilenamePatterns) == 0 {
+		cfg.FilenamePatterns = []string{cfg.Specfile}
+	}
+	if cfg.PackageDir == "" {
+		cfg.PackageDir = "."
+	}
+
+	b := api.LanguageBackend{
+		Name:             cfg.Name,
+		Specfile:         cfg.Specfile,
+		Lockfile:         cfg.Lockfile,
+		FilenamePatterns: cfg.FilenamePatterns,
+		Quirks:           api.QuirksNotReproducible,
+		IsAvailable: func() bool {
+			fields := strings.Fields(cfg.Install)
+			_, err := exec.LookPath(fields[0])
+			return err == nil
+		},
+		GetPackageDir: func() string {
+			return cfg.PackageDir
+		},
+		Search: func(query string) []api.PkgInfo {
+			util.Die("the %s backend does not support search", cfg.Name)
+			return nil
+		},
+		Info: func(name api.PkgName) api.PkgInfo {
+			util.Die("the %s backend does not support info", cfg.Name)
+			return api.PkgInfo{}
+		},
+		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "external add")
+			defer span.Finish()
+			runTemplate(cfg, cfg.Add, pkgs)
+		},
+		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "external remove")
+			defer span.Finish()
+			specs := map[api.PkgName]api.PkgSpec{}
+			for name := range pkgs {
+				specs[name] = ""
+			}
+			runTemplate(cfg, cfg.Remove, specs)
+		},
+		Install: func(ctx context.Context) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "external install")
+			defer span.Finish()
+			runTemplate(cfg, cfg.Install, nil)
+		},
+		ListSpecfile: func() map[api.PkgName]api.PkgSpec {
+			pkgs := map[api.PkgName]api.PkgSpec{}
+			for name, spec := range listTemplate(cfg, cfg.List) {
+				pkgs[name] = api.PkgSpec(spec)
+			}
+			return pkgs
+		},
+	}
+	if hasLockfile {
+		b.Quirks = api.QuirksNone
+		b.Lock = func(ctx context.Context) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "external lock")
+			defer span.Finish()
+			runTemplate(cfg, cfg.Lock, nil)
+		}
+		b.ListLockfile = func() map[api.PkgName]api.PkgVersion {
+			pkgs := map[api.PkgName]api.PkgVersion{}
+			for name, version := range listTemplate(cfg, cfg.ListLockfile) {
+				pkgs[name] = api.PkgVersion(version)
+			}
+			return pkgs
+		}
+	}
+	b.Setup()
+	return b, nil
+}
+
+// expandTemplate returns template with the placeholders for the files
+// of cfg, and those in vars, replaced by their shell-quoted values.
+func expandTemplate(cfg config.ExternalBackend, template string, vars map[string]string) string {
+	oldnew := []string{
+		"{specfile}", shellquote.Join(cfg.Specfile),
+		"{lockfile}", shellquote.Join(cfg.Lockfile),
+	}
+	for key, value := range vars {
+		oldnew = append(oldnew, "{"+key+"}", value)
+	}
+	return strings.NewReplacer(oldnew...).Replace(template)
+}
+
+// isPerPackage reports whether template is run once for each package,
+// rather than once for all of them.
+func isPerPackage(template string) bool {
+	return strings.Contains(template, "{name}") || strings.Contains(template, "{spec}")
+}
+
+// runTemplate runs the command template with the given packages,
+// once for each of them in order of name if it is per-package,
+// exiting the process if it fails.
+func runTemplate(cfg config.ExternalBackend, template string, pkgs map[api.PkgName]api.PkgSpec) {
+	names := []string{}
+	for name := range pkgs {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	if !isPerPackage(template) {
+		cmd := expandTemplate(cfg, template, map[string]string{
+			"packages": shellquote.Join(names...),
+		})
+		util.RunCmd([]string{"sh", "-c", cmd})
+		return
+	}
+	for _, name := range names {
+		cmd := expandTemplate(cfg, template, map[string]string{
+			"name": shellquote.Join(name),
+			"spec": shellquote.Join(string(pkgs[api.PkgName(name)])),
+		})
+		util.RunCmd([]string{"sh", "-c", cmd})
+	}
+}
+
+// listTemplate runs the list command template and returns the
+// packages it prints, with their specs or versions.
+func listTemplate(cfg config.ExternalBackend, template string) map[api.PkgName]string {
+	outputB := util.GetCmdOutput([]string{"sh", "-c", expandTemplate(cfg, template, nil)})
+	pkgs := map[api.PkgName]string{}
+	for _, line := range strings.Split(string(outputB), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pkgs[api.PkgName(fields[0])] = strings.Join(fields[1:], " ")
+	}
+	return pkgs
+}
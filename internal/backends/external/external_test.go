@@ -0,0 +1,126 @@
+package external
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+)
+
+// fakeConfig is an external backend that keeps its packages in
+// deps.txt, one "name spec" line each, and locks every package to
+// version 1.0.0.
+var fakeConfig = config.ExternalBackend{
+	Name:         "fake",
+	Specfile:     "deps.txt",
+	Lockfile:     "deps.lock",
+	Add:          "echo {name} {spec} >> {specfile}",
+	Remove:       `for p in {packages}; do awk -v p="$p" '$1 != p' {specfile} > {specfile}.new && mv {specfile}.new {specfile}; done`,
+	Install:      "mkdir -p libs && cp {lockfile} libs/installed",
+	Lock:         `sort {specfile} | awk '{ print $1, "1.0.0" }' > {lockfile}`,
+	List:         "cat {specfile}",
+	ListLockfile: "cat {lockfile}",
+}
+
+// chdirTemp changes into an empty temporary directory for the rest of
+// the test.
+func chdirTemp(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+}
+
+func TestCommandTemplateBackend(t *testing.T) {
+	chdirTemp(t)
+	b, err := CommandTemplateBackend(fakeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "fake" || !b.QuirksIsReproducible() {
+		t.Fatalf("expected a reproducible backend named fake, got %s with quirks %d", b.Name, b.Quirks)
+	}
+	ctx := context.Background()
+
+	b.Add(ctx, map[api.PkgName]api.PkgSpec{"foo": ">=1.2", "bar": ""}, "")
+	expected := map[api.PkgName]api.PkgSpec{"foo": ">=1.2", "bar": ""}
+	if pkgs := b.ListSpecfile(); !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("expected %v in the specfile, got %v", expected, pkgs)
+	}
+
+	b.Lock(ctx)
+	expectedLocked := map[api.PkgName]api.PkgVersion{"foo": "1.0.0", "bar": "1.0.0"}
+	if pkgs := b.ListLockfile(); !reflect.DeepEqual(pkgs, expectedLocked) {
+		t.Errorf("expected %v in the lockfile, got %v", expectedLocked, pkgs)
+	}
+
+	b.Install(ctx)
+	if _, err := os.Stat("libs/installed"); err != nil {
+		t.Errorf("expected install to run: %s", err)
+	}
+
+	b.Remove(ctx, map[api.PkgName]bool{"foo": true})
+	expected = map[api.PkgName]api.PkgSpec{"bar": ""}
+	if pkgs := b.ListSpecfile(); !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("expected %v in the specfile after removing foo, got %v", expected, pkgs)
+	}
+}
+
+func TestCommandTemplateBackendQuoting(t *testing.T) {
+	chdirTemp(t)
+	b, err := CommandTemplateBackend(fakeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Names and specs are passed to the shell as single words.
+	b.Add(context.Background(), map[api.PkgName]api.PkgSpec{"foo;touch pwned": "$(touch pwned)"}, "")
+	if _, err := os.Stat("pwned"); err == nil {
+		t.Error("expected the package to be quoted, but the shell ran part of it")
+	}
+	contents, err := os.ReadFile("deps.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "foo;touch pwned $(touch pwned)\n" {
+		t.Errorf("expected the package to be added verbatim, got %q", contents)
+	}
+}
+
+func TestCommandTemplateBackendConfig(t *testing.T) {
+	b, err := CommandTemplateBackend(config.ExternalBackend{
+		Specfile: "deps.txt",
+		Add:      "add {name}",
+		Remove:   "remove {packages}",
+		Install:  "install",
+		List:     "cat {specfile}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "external" || b.QuirksIsReproducible() || b.GetPackageDir() != "." {
+		t.Errorf("expected the defaults of an external backend without a lockfile, got %s with quirks %d and package dir %s", b.Name, b.Quirks, b.GetPackageDir())
+	}
+	if !reflect.DeepEqual(b.FilenamePatterns, []string{"deps.txt"}) {
+		t.Errorf("expected the specfile to be the filename pattern, got %v", b.FilenamePatterns)
+	}
+
+	for _, tc := range []struct {
+		cfg      config.ExternalBackend
+		expected string
+	}{
+		{
+			config.ExternalBackend{Specfile: "deps.txt", Add: "add {name}"},
+			"external backend is missing remove, install, list",
+		},
+		{
+			config.ExternalBackend{Specfile: "deps.txt", Add: "add", Remove: "remove", Install: "install", List: "list", Lock: "lock"},
+			"external backend needs all of lockfile, lock and list_lockfile, or none of them",
+		},
+	} {
+		if _, err := CommandTemplateBackend(tc.cfg); err == nil || err.Error() != tc.expected {
+			t.Errorf("expected error %q, got %v", tc.expected, err)
+		}
+	}
+}
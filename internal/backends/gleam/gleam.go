@@ -0,0 +1,264 @@
+// Package gleam provides a backend for Gleam (https://gleam.run),
+// whose packages are published to Hex (https://hex.pm).
+package gleam
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/nix"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// gleamToml represents the dependency tables of a gleam.toml file.
+// A dependency is either a Hex version requirement or a table
+// giving a path or git source.
+type gleamToml struct {
+	Dependencies    map[string]interface{} `toml:"dependencies"`
+	DevDependencies map[string]interface{} `toml:"dev-dependencies"`
+}
+
+// gleamManifest represents the packages in a manifest.toml file.
+type gleamManifest struct {
+	Packages []struct {
+		Name    string `toml:"name"`
+		Version string `toml:"version"`
+	} `toml:"packages"`
+}
+
+// shortVersion matches the version forms that gleam add accepts
+// after an @, which it turns into a requirement of its own.
+var shortVersion = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+func gleamIsAvailable() bool {
+	_, err := exec.LookPath("gleam")
+	return err == nil
+}
+
+// parseSpec returns the requirement of a gleam.toml dependency, or
+// its source for a path or git dependency.
+func parseSpec(spec interface{}) api.PkgSpec {
+	switch spec := spec.(type) {
+	case string:
+		return api.PkgSpec(spec)
+	case map[string]interface{}:
+		if path, ok := spec["path"].(string); ok {
+			return api.PkgSpec("path:" + path)
+		}
+		if git, ok := spec["git"].(string); ok {
+			return api.PkgSpec("git:" + git)
+		}
+		if version, ok := spec["version"].(string); ok {
+			return api.PkgSpec(version)
+		}
+	}
+	return ""
+}
+
+func listSpecfile() map[api.PkgName]api.PkgSpec {
+	contents, err := os.ReadFile("gleam.toml")
+	if err != nil {
+		util.Die("gleam.toml: %s", err)
+	}
+	var cfg gleamToml
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		util.Die("gleam.toml: %s", err)
+	}
+
+	pkgs := map[api.PkgName]api.PkgSpec{}
+	for name, spec := range cfg.Dependencies {
+		pkgs[api.PkgName(name)] = parseSpec(spec)
+	}
+	for name, spec := range cfg.DevDependencies {
+		pkgs[api.PkgName(name)] = parseSpec(spec)
+	}
+	return pkgs
+}
+
+func listLockfile() map[api.PkgName]api.PkgVersion {
+	contents, err := os.ReadFile("manifest.toml")
+	if err != nil {
+		util.Die("manifest.toml: %s", err)
+	}
+	var manifest gleamManifest
+	if _, err := toml.Decode(string(contents), &manifest); err != nil {
+		util.Die("manifest.toml: %s", err)
+	}
+
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, p := range manifest.Packages {
+		pkgs[api.PkgName(p.Name)] = api.PkgVersion(p.Version)
+	}
+	return pkgs
+}
+
+// dependencyTable returns the gleam.toml table that packages are
+// added to for config.Dependency.
+func dependencyTable() string {
+	if config.Dependency == config.DependencyDev {
+		return "dev-dependencies"
+	}
+	return "dependencies"
+}
+
+// requirements returns the TOML values of the packages' specs, keyed
+// by name. When all is false, only the specs that gleam add can't
+// take, such as ">= 1.2.0 and < 1.4.0", are returned; otherwise
+// packages without a spec get ">= 0.0.0".
+func requirements(pkgs map[api.PkgName]api.PkgSpec, all bool) map[string]string {
+	entries := map[string]string{}
+	for name, spec := range pkgs {
+		switch {
+		case all && spec == "":
+			spec = ">= 0.0.0"
+		case !all && (spec == "" || shortVersion.MatchString(string(spec))):
+			continue
+		}
+		entries[string(name)] = strconv.Quote(string(spec))
+	}
+	return entries
+}
+
+// writeRequirements sets the given entries in the dependency table
+// of gleam.toml for config.Dependency.
+func writeRequirements(entries map[string]string) {
+	contents, err := os.ReadFile("gleam.toml")
+	if err != nil {
+		util.Die("gleam.toml: %s", err)
+	}
+	contents, err = util.SetTOMLTableEntries(contents, dependencyTable(), entries)
+	if err != nil {
+		util.Die("gleam.toml: %s", err)
+	}
+	util.TryWriteAtomic("gleam.toml", contents)
+}
+
+// gleamAddCmd returns the gleam add command for the packages that
+// have no spec or one that gleam add accepts, or nil if there are
+// none.
+func gleamAddCmd(pkgs map[api.PkgName]api.PkgSpec) []string {
+	cmd := []string{"gleam", "add"}
+	if config.Dependency == config.DependencyDev {
+		cmd = append(cmd, "--dev")
+	}
+	args := 0
+	for name, spec := range pkgs {
+		arg := string(name)
+		if spec != "" {
+			if !shortVersion.MatchString(string(spec)) {
+				continue
+			}
+			arg += "@" + string(spec)
+		}
+		cmd = append(cmd, arg)
+		args++
+	}
+	if args == 0 {
+		return nil
+	}
+	return cmd
+}
+
+func gleamRemoveCmd(pkgs map[api.PkgName]bool) []string {
+	cmd := []string{"gleam", "remove"}
+	for name := range pkgs {
+		cmd = append(cmd, string(name))
+	}
+	return cmd
+}
+
+func add(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "gleam add")
+	defer span.Finish()
+	if !util.Exists("gleam.toml") {
+		util.Die("gleam.toml does not exist; create a project with gleam new")
+	}
+
+	// Requirements that gleam add can't express go straight into
+	// gleam.toml, and are resolved along with the rest.
+	if entries := requirements(pkgs, false); len(entries) > 0 {
+		writeRequirements(entries)
+	}
+	if cmd := gleamAddCmd(pkgs); cmd != nil {
+		util.RunCmd(cmd)
+	} else {
+		util.RunCmd([]string{"gleam", "deps", "download"})
+	}
+}
+
+// addToSpecfile implements AddToSpecfile, writing the packages
+// straight into [dependencies] or [dev-dependencies] of gleam.toml.
+func addToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "gleam add to specfile")
+	defer span.Finish()
+	if !util.Exists("gleam.toml") {
+		util.Die("gleam.toml does not exist; create a project with gleam new")
+	}
+	writeRequirements(requirements(pkgs, true))
+}
+
+// addToSpecfileContents implements AddToSpecfileContents.
+func addToSpecfileContents(contents []byte, pkgs map[api.PkgName]api.PkgSpec, projectName string) ([]byte, error) {
+	return util.SetTOMLTableEntries(contents, dependencyTable(), requirements(pkgs, true))
+}
+
+// gleamGuess stub.
+func gleamGuess(context.Context) (map[api.PkgName]bool, bool) {
+	util.NotImplemented()
+
+	return nil, false
+}
+
+// GleamBackend is a UPM backend for Gleam that uses Hex.
+var GleamBackend = api.LanguageBackend{
+	Name:             "gleam",
+	Specfile:         "gleam.toml",
+	Lockfile:         "manifest.toml",
+	IsAvailable:      gleamIsAvailable,
+	FilenamePatterns: []string{"*.gleam"},
+	Quirks: api.QuirksAddRemoveAlsoLocks |
+		api.QuirksAddRemoveAlsoInstalls |
+		api.QuirksLockAlsoInstalls,
+	SpecSyntax: api.SpecSyntaxExact,
+	GetPackageDir: func() string {
+		return "build/packages"
+	},
+	Search:                search,
+	Info:                  info,
+	Add:                   add,
+	AddToSpecfile:         addToSpecfile,
+	AddToSpecfileContents: addToSpecfileContents,
+	DependencyTypes:       []config.DependencyType{config.DependencyDev},
+	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "gleam remove")
+		defer span.Finish()
+		util.RunCmd(gleamRemoveCmd(pkgs))
+	},
+	Lock: func(ctx context.Context) {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "gleam deps download")
+		defer span.Finish()
+		util.RunCmd([]string{"gleam", "deps", "download"})
+	},
+	Install: func(ctx context.Context) {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "gleam deps download")
+		defer span.Finish()
+		util.RunCmd([]string{"gleam", "deps", "download"})
+	},
+	ListSpecfile:                       listSpecfile,
+	ListLockfile:                       listLockfile,
+	Guess:                              gleamGuess,
+	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+}
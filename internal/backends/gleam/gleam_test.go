@@ -0,0 +1,104 @@
+package gleam
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// project copies the testdata project into a temporary directory
+// and changes to it.
+func project(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"gleam.toml", "manifest.toml"} {
+		contents, err := os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), contents, 0o644))
+	}
+	testutil.Chdir(t, dir)
+}
+
+func TestListSpecfile(t *testing.T) {
+	project(t)
+
+	require.Equal(t, map[api.PkgName]api.PkgSpec{
+		"gleam_stdlib": ">= 0.34.0 and < 2.0.0",
+		"gleam_http":   ">= 3.6.0 and < 4.0.0",
+		"shared":       "path:../shared",
+		"gleeunit":     ">= 1.0.0 and < 2.0.0",
+	}, GleamBackend.ListSpecfile())
+}
+
+func TestListLockfile(t *testing.T) {
+	project(t)
+
+	require.Equal(t, map[api.PkgName]api.PkgVersion{
+		"gleam_http":   "3.7.0",
+		"gleam_stdlib": "0.44.0",
+		"gleeunit":     "1.2.0",
+		"shared":       "0.1.0",
+	}, GleamBackend.ListLockfile())
+}
+
+func TestGleamAddCmd(t *testing.T) {
+	require.Equal(t, []string{"gleam", "add", "lustre@4.2"}, gleamAddCmd(map[api.PkgName]api.PkgSpec{
+		"lustre": "4.2",
+		"wisp":   ">= 1.0.0 and < 1.2.0",
+	}))
+	require.Nil(t, gleamAddCmd(map[api.PkgName]api.PkgSpec{"wisp": ">= 1.0.0 and < 1.2.0"}))
+
+	config.Dependency = config.DependencyDev
+	t.Cleanup(func() { config.Dependency = config.DependencyRegular })
+	require.Equal(t, []string{"gleam", "add", "--dev", "birdie"}, gleamAddCmd(map[api.PkgName]api.PkgSpec{"birdie": ""}))
+}
+
+func TestAddToSpecfile(t *testing.T) {
+	project(t)
+
+	GleamBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"gleam_json": "",
+		"gleam_http": ">= 3.7.0 and < 4.0.0",
+	}, "")
+	config.Dependency = config.DependencyDev
+	t.Cleanup(func() { config.Dependency = config.DependencyRegular })
+	GleamBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{"birdie": "1.1.0"}, "")
+
+	specs := GleamBackend.ListSpecfile()
+	require.Equal(t, api.PkgSpec(">= 0.0.0"), specs["gleam_json"])
+	require.Equal(t, api.PkgSpec(">= 3.7.0 and < 4.0.0"), specs["gleam_http"])
+	require.Equal(t, api.PkgSpec("1.1.0"), specs["birdie"])
+
+	contents, err := os.ReadFile("gleam.toml")
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "[dev-dependencies]\ngleeunit = \">= 1.0.0 and < 2.0.0\"\nbirdie = \"1.1.0\"\n")
+}
+
+func TestHex(t *testing.T) {
+	testutil.ServeFiles(t, map[string]string{
+		"https://hex.pm/api/packages/gleam_http":                              "testdata/infoResponse.json",
+		"https://hex.pm/api/packages?sort=recent_downloads&search=gleam_http": "testdata/searchResponse.json",
+	})
+
+	require.Equal(t, api.PkgInfo{
+		Name:             "gleam_http",
+		Description:      "Types and functions for HTTP clients and servers!",
+		Version:          "3.7.0",
+		HomepageURL:      "https://hex.pm/packages/gleam_http",
+		DocumentationURL: "https://hexdocs.pm/gleam_http/",
+		SourceCodeURL:    "https://github.com/gleam-lang/http",
+		License:          "Apache-2.0",
+	}, GleamBackend.Info("gleam_http"))
+	require.Equal(t, api.PkgInfo{}, GleamBackend.Info("no_such_package"))
+
+	names := []string{}
+	for _, result := range GleamBackend.Search("gleam_http") {
+		names = append(names, result.Name)
+	}
+	require.Equal(t, []string{"gleam_http", "gleam_httpc"}, names)
+}
@@ -0,0 +1,115 @@
+package gleam
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// hexBaseURL is the Hex API, which Gleam packages are published to.
+const hexBaseURL = "https://hex.pm/api"
+
+// hexPackage is a package as returned by the Hex API, from both
+// /packages and /packages/<name>.
+type hexPackage struct {
+	Name                string `json:"name"`
+	HTMLURL             string `json:"html_url"`
+	DocsHTMLURL         string `json:"docs_html_url"`
+	LatestVersion       string `json:"latest_version"`
+	LatestStableVersion string `json:"latest_stable_version"`
+	Meta                struct {
+		Description string            `json:"description"`
+		Licenses    []string          `json:"licenses"`
+		Links       map[string]string `json:"links"`
+	} `json:"meta"`
+}
+
+func (p hexPackage) toPkgInfo() api.PkgInfo {
+	version := p.LatestStableVersion
+	if version == "" {
+		version = p.LatestVersion
+	}
+	info := api.PkgInfo{
+		Name:             p.Name,
+		Description:      p.Meta.Description,
+		Version:          version,
+		HomepageURL:      p.HTMLURL,
+		DocumentationURL: p.DocsHTMLURL,
+		License:          strings.Join(p.Meta.Licenses, ", "),
+	}
+	// Links are named freely by package authors, though most use
+	// one of a handful of names for the repository.
+	for name, link := range p.Meta.Links {
+		switch strings.ToLower(name) {
+		case "github", "gitlab", "repository", "source":
+			info.SourceCodeURL = link
+		case "website", "homepage":
+			info.HomepageURL = link
+		}
+	}
+	return info
+}
+
+func search(query string) []api.PkgInfo {
+	endpoint := hexBaseURL + "/packages?sort=recent_downloads&search=" + url.QueryEscape(query)
+
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		util.Die("hex.pm: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		util.Die("hex.pm: HTTP status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		util.Die("hex.pm: could not read response: %s", err)
+	}
+
+	var packages []hexPackage
+	if err := json.Unmarshal(body, &packages); err != nil {
+		util.Die("hex.pm: %s", err)
+	}
+
+	results := []api.PkgInfo{}
+	for _, p := range packages {
+		results = append(results, p.toPkgInfo())
+	}
+	return results
+}
+
+func info(name api.PkgName) api.PkgInfo {
+	endpoint := hexBaseURL + "/packages/" + url.PathEscape(string(name))
+
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		util.Die("hex.pm: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		break
+	case 404:
+		return api.PkgInfo{}
+	default:
+		util.Die("hex.pm: HTTP status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		util.Die("hex.pm: could not read response: %s", err)
+	}
+
+	var p hexPackage
+	if err := json.Unmarshal(body, &p); err != nil {
+		util.Die("hex.pm: %s", err)
+	}
+	return p.toPkgInfo()
+}
@@ -10,6 +10,7 @@ import (
 	"regexp"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -116,6 +117,38 @@ func readProjectOrMakeEmpty(path string) Project {
 
 const pomdotxml = "pom.xml"
 
+// notDownloadedRegexp matches Maven's complaint, in offline mode,
+// about an artifact missing from the local repository, capturing the
+// artifact's coordinates.
+var notDownloadedRegexp = regexp.MustCompile(`artifact (\S+) has not been downloaded from it before`)
+
+// mavenCmd returns the mvn command line with the given arguments,
+// passing --offline in offline mode so that Maven only uses artifacts
+// from the local repository.
+func mavenCmd(args ...string) []string {
+	cmd := append([]string{"mvn"}, args...)
+	if config.Offline {
+		cmd = append(cmd, "--offline")
+	}
+	return cmd
+}
+
+// runMaven runs mvn with the given arguments, exiting the process on
+// failure. In offline mode, a failure to resolve an artifact that
+// isn't in the local repository is reported as such.
+func runMaven(args ...string) {
+	output, err := util.RunCmdFallible(mavenCmd(args...))
+	if err == nil {
+		return
+	}
+	if config.Offline {
+		if match := notDownloadedRegexp.FindSubmatch(output); match != nil {
+			util.Die("%s is not in the local Maven repository; run without --offline to download it", match[1])
+		}
+	}
+	util.Die("%s", err)
+}
+
 func isAvailable() bool {
 	_, err := exec.LookPath("mvn")
 	return err == nil
@@ -152,6 +185,19 @@ func addPackages(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectN
 			continue
 		}
 
+		// In offline mode there is no way to look up the
+		// packaging type, so a versioned package is assumed to
+		// be a jar, which is by far the most common case.
+		if config.Offline && pkgSpec != "" {
+			newDependencies = append(newDependencies, Dependency{
+				GroupId:     groupId,
+				ArtifactId:  artifactId,
+				Version:     string(pkgSpec),
+				PackageType: "jar",
+			})
+			continue
+		}
+
 		var query string
 		if pkgSpec == "" {
 			query = fmt.Sprintf("g:%s AND a:%s", groupId, artifactId)
@@ -159,6 +205,13 @@ func addPackages(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectN
 			query = fmt.Sprintf("g:%s AND a:%s AND v:%s", groupId, artifactId, pkgSpec)
 		}
 		searchDocs, err := Search(query)
+		if err == ErrOffline {
+			util.Die(
+				"can't find the latest version of %s:%s in offline mode; specify a version",
+				groupId,
+				artifactId,
+			)
+		}
 		if err != nil {
 			util.Die(
 				"error searching maven for latest version of %s:%s: %s",
@@ -271,6 +324,9 @@ func listLockfile() map[api.PkgName]api.PkgVersion {
 
 func search(query string) []api.PkgInfo {
 	searchDocs, err := Search(query)
+	if err == ErrOffline {
+		util.Die("%s", err)
+	}
 	if err != nil {
 		util.Die("error searching maven %s", err)
 	}
@@ -287,7 +343,9 @@ func search(query string) []api.PkgInfo {
 
 func info(pkgName api.PkgName) api.PkgInfo {
 	searchDoc, err := Info(string(pkgName))
-
+	if err == ErrOffline {
+		util.Die("%s", err)
+	}
 	if err != nil {
 		util.Die("error searching maven %s", err)
 	}
@@ -322,11 +380,10 @@ var JavaBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "Maven install")
 		defer span.Finish()
-		util.RunCmd([]string{
-			"mvn",
+		runMaven(
 			"de.qaware.maven:go-offline-maven-plugin:resolve-dependencies",
 			"dependency:copy-dependencies",
-		})
+		)
 	},
 	ListSpecfile:                       listSpecfile,
 	ListLockfile:                       listLockfile,
@@ -0,0 +1,71 @@
+package java
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func setOffline(t *testing.T, offline bool) {
+	previous := config.Offline
+	config.Offline = offline
+	t.Cleanup(func() { config.Offline = previous })
+}
+
+func TestMavenCmd(t *testing.T) {
+	setOffline(t, false)
+	if cmd := strings.Join(mavenCmd("dependency:copy-dependencies"), " "); cmd != "mvn dependency:copy-dependencies" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+
+	setOffline(t, true)
+	if cmd := strings.Join(mavenCmd("dependency:copy-dependencies"), " "); cmd != "mvn dependency:copy-dependencies --offline" {
+		t.Errorf("unexpected offline command %q", cmd)
+	}
+}
+
+func TestInstallOffline(t *testing.T) {
+	// A stand-in for mvn that records its arguments.
+	bin := t.TempDir()
+	args := filepath.Join(bin, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "mvn"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	setOffline(t, true)
+	JavaBackend.Install(context.Background())
+
+	recorded, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(recorded), "--offline") {
+		t.Errorf("mvn was run without --offline: %q", recorded)
+	}
+}
+
+func TestNotDownloaded(t *testing.T) {
+	output := "[ERROR] Failed to execute goal on project myartifactid: Could not resolve dependencies: " +
+		"Cannot access central (https://repo.maven.apache.org/maven2) in offline mode and the artifact " +
+		"junit:junit:jar:4.13.2 has not been downloaded from it before. -> [Help 1]"
+	match := notDownloadedRegexp.FindStringSubmatch(output)
+	if match == nil || match[1] != "junit:junit:jar:4.13.2" {
+		t.Errorf("unexpected match %q", match)
+	}
+}
+
+func TestSearchOffline(t *testing.T) {
+	setOffline(t, true)
+	if _, err := Search("junit"); err != ErrOffline {
+		t.Errorf("Search returned %v in offline mode", err)
+	}
+	if _, err := Info("junit:junit"); err != ErrOffline {
+		t.Errorf("Info returned %v in offline mode", err)
+	}
+}
@@ -25,18 +25,24 @@ package java
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 )
 
 const (
 	mavenURL string = "https://search.maven.org/solrsearch/select?q="
 )
 
+// ErrOffline is returned by Search and Info in offline mode, rather
+// than querying Maven Central.
+var ErrOffline = errors.New("can't search Maven Central in offline mode")
+
 type SearchDoc struct {
 	Group          string `json:"g"`
 	Artifact       string `json:"a"`
@@ -74,12 +80,18 @@ func mavenSearch(searchURL string) ([]SearchDoc, error) {
 }
 
 func Search(keyword string) ([]SearchDoc, error) {
+	if config.Offline {
+		return []SearchDoc{}, ErrOffline
+	}
 	searchURL := mavenURL + url.QueryEscape(keyword)
 
 	return mavenSearch(searchURL)
 }
 
 func Info(name string) (SearchDoc, error) {
+	if config.Offline {
+		return SearchDoc{}, ErrOffline
+	}
 	parts := strings.Split(string(name), ":")
 
 	var searchURL string
@@ -0,0 +1,219 @@
+package nodejs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// bunWorkspace describes the Bun workspace that the current
+// directory is the root or a member of.
+type bunWorkspace struct {
+	// The name of the member package in the current directory,
+	// or "" at the root.
+	member string
+	// The catalogs of the root package.json, keyed by name, with
+	// "" for the default catalog. Each maps package names to
+	// specs.
+	catalogs map[string]map[string]string
+	// The version of each member package, keyed by its name.
+	versions map[string]string
+}
+
+// bunCatalogFields represents the catalog fields of a root
+// package.json, which Bun accepts either at the top level or in the
+// workspaces object.
+type bunCatalogFields struct {
+	Catalog  map[string]string            `json:"catalog"`
+	Catalogs map[string]map[string]string `json:"catalogs"`
+}
+
+// readBunCatalogs returns the catalogs declared in the root
+// package.json in dir, keyed as in bunWorkspace.catalogs.
+func readBunCatalogs(dir string) (map[string]map[string]string, error) {
+	contentsB, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		bunCatalogFields
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return nil, fmt.Errorf("package.json: %s", err)
+	}
+	fields := []bunCatalogFields{cfg.bunCatalogFields}
+	if bytes.HasPrefix(bytes.TrimSpace(cfg.Workspaces), []byte("{")) {
+		var object bunCatalogFields
+		if err := json.Unmarshal(cfg.Workspaces, &object); err != nil {
+			return nil, fmt.Errorf("package.json: workspaces: %s", err)
+		}
+		fields = append(fields, object)
+	}
+
+	catalogs := map[string]map[string]string{}
+	add := func(name string, catalog map[string]string) {
+		if catalogs[name] == nil {
+			catalogs[name] = map[string]string{}
+		}
+		for pkg, spec := range catalog {
+			catalogs[name][pkg] = spec
+		}
+	}
+	for _, f := range fields {
+		add("", f.Catalog)
+		for name, catalog := range f.Catalogs {
+			if name == "default" {
+				name = ""
+			}
+			add(name, catalog)
+		}
+	}
+	return catalogs, nil
+}
+
+// findBunWorkspace returns the Bun workspace that the current
+// directory belongs to, looking for a package.json whose workspaces
+// include it in the current directory and each of its parents, or nil
+// if there is none.
+func findBunWorkspace() (*bunWorkspace, error) {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return nil, err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if util.Exists(filepath.Join(dir, "package.json")) {
+			members, err := nodejsWorkspaces(dir)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(dir, cwd)
+			if err != nil {
+				return nil, err
+			}
+			rel = filepath.ToSlash(rel)
+			isMember := false
+			for _, member := range members {
+				isMember = isMember || member == rel
+			}
+			if len(members) > 0 && (rel == "." || isMember) {
+				return loadBunWorkspace(dir, members, rel)
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			return nil, nil
+		}
+	}
+}
+
+// loadBunWorkspace reads the catalogs and member packages of the Bun
+// workspace rooted at dir, of which current is the current directory
+// relative to it.
+func loadBunWorkspace(dir string, members []string, current string) (*bunWorkspace, error) {
+	catalogs, err := readBunCatalogs(dir)
+	if err != nil {
+		return nil, err
+	}
+	workspace := &bunWorkspace{catalogs: catalogs, versions: map[string]string{}}
+	for _, member := range members {
+		path := filepath.Join(dir, filepath.FromSlash(member), "package.json")
+		contentsB, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var cfg struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(contentsB, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if cfg.Name == "" {
+			continue
+		}
+		workspace.versions[cfg.Name] = cfg.Version
+		if member == current {
+			workspace.member = cfg.Name
+		}
+	}
+	return workspace, nil
+}
+
+// resolve returns the spec that a dependency of a package in the
+// workspace stands for. A catalog: reference is replaced by the spec
+// in that catalog, and a workspace: reference to a member by the
+// range it is published with, e.g. ^1.2.0 for workspace:^ when the
+// member is at 1.2.0. Other specs, and references that can't be
+// resolved, are returned as is.
+func (w *bunWorkspace) resolve(name api.PkgName, spec api.PkgSpec) api.PkgSpec {
+	switch {
+	case strings.HasPrefix(string(spec), "catalog:"):
+		catalog := strings.TrimPrefix(string(spec), "catalog:")
+		if catalog == "default" {
+			catalog = ""
+		}
+		resolved, ok := w.catalogs[catalog][string(name)]
+		if !ok {
+			util.Warn(context.Background(), util.Warning{
+				Code:    util.WarningCatalog,
+				Message: fmt.Sprintf("%s: %s is not in the catalog", name, spec),
+				Package: string(name),
+			})
+			return spec
+		}
+		return api.PkgSpec(resolved)
+	case strings.HasPrefix(string(spec), "workspace:"):
+		version, ok := w.versions[string(name)]
+		if !ok {
+			return spec
+		}
+		switch rangeStr := strings.TrimPrefix(string(spec), "workspace:"); rangeStr {
+		case "*", "":
+			return api.PkgSpec(version)
+		case "^", "~":
+			return api.PkgSpec(rangeStr + version)
+		default:
+			return api.PkgSpec(rangeStr)
+		}
+	}
+	return spec
+}
+
+// bunListSpecfile implements ListSpecfile for Bun, resolving the
+// catalog: and workspace: references of a Bun workspace.
+func bunListSpecfile() map[api.PkgName]api.PkgSpec {
+	pkgs := nodejsListSpecfile()
+	workspace, err := findBunWorkspace()
+	if err != nil {
+		util.Die("%s", err)
+	}
+	if workspace == nil {
+		return pkgs
+	}
+	for name, spec := range pkgs {
+		pkgs[name] = workspace.resolve(name, spec)
+	}
+	return pkgs
+}
+
+// withBunFilter appends to cmd the --filter flag that restricts it to
+// the member package in the current directory, if it is a member of
+// a Bun workspace, so that adding or installing there doesn't touch
+// the rest of the workspace.
+func withBunFilter(cmd []string) []string {
+	workspace, err := findBunWorkspace()
+	if err != nil {
+		util.Die("%s", err)
+	}
+	if workspace == nil || workspace.member == "" {
+		return cmd
+	}
+	return append(cmd, "--filter", workspace.member)
+}
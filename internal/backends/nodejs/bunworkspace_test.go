@@ -0,0 +1,126 @@
+package nodejs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+// bunWorkspaceProject copies testdata/bun-workspace into a fresh
+// directory and changes into member, relative to its root.
+func bunWorkspaceProject(t *testing.T, member string) {
+	t.Helper()
+	root := t.TempDir()
+	err := filepath.WalkDir("testdata/bun-workspace", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel("testdata/bun-workspace", path)
+		if err != nil {
+			return err
+		}
+		contentsB, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(rel)), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(root, rel), contentsB, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, filepath.Join(root, filepath.FromSlash(member)))
+}
+
+func TestBunListSpecfile(t *testing.T) {
+	bunWorkspaceProject(t, "packages/app")
+	expected := map[api.PkgName]api.PkgSpec{
+		"@acme/utils": "^1.4.0",
+		"react":       "^18.3.1",
+		"zod":         "^3.23.0",
+		"left-pad":    "^1.3.0",
+		"vitest":      "^2.1.0",
+	}
+	if pkgs := BunBackend.ListSpecfile(); !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+
+	// At the root, references that aren't in the catalog are
+	// left alone.
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[api.PkgName]api.PkgSpec{"typescript": "catalog:"}
+	if pkgs := BunBackend.ListSpecfile(); !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+}
+
+func TestBunWorkspaceResolve(t *testing.T) {
+	workspace := &bunWorkspace{
+		catalogs: map[string]map[string]string{"": {"react": "^18.3.1"}},
+		versions: map[string]string{"@acme/utils": "1.4.0"},
+	}
+	testCases := []struct {
+		name     api.PkgName
+		spec     api.PkgSpec
+		expected api.PkgSpec
+	}{
+		{"react", "catalog:", "^18.3.1"},
+		{"react", "catalog:default", "^18.3.1"},
+		{"@acme/utils", "workspace:*", "1.4.0"},
+		{"@acme/utils", "workspace:~", "~1.4.0"},
+		{"@acme/utils", "workspace:^1.2.0", "^1.2.0"},
+		{"@acme/other", "workspace:*", "workspace:*"},
+		{"left-pad", "^1.3.0", "^1.3.0"},
+	}
+	for _, tc := range testCases {
+		if spec := workspace.resolve(tc.name, tc.spec); spec != tc.expected {
+			t.Errorf("%s %s: expected %q, got %q", tc.name, tc.spec, tc.expected, spec)
+		}
+	}
+}
+
+func TestBunAddFilter(t *testing.T) {
+	setDevDependencyConfig(t, false, "")
+	bunWorkspaceProject(t, "packages/app")
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binDir := t.TempDir()
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+	writeFile(t, filepath.Join(binDir, "bun"), "#!/bin/sh\nprintf '%s\\n' \"$@\" > args.txt\n")
+	if err := os.Chmod(filepath.Join(binDir, "bun"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// In a member, the command is restricted to it.
+	BunBackend.Add(context.Background(), map[api.PkgName]api.PkgSpec{"left-pad": "^1.3.0"}, "")
+	contentsB, err := os.ReadFile("args.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"add", "left-pad@^1.3.0", "--filter", "@acme/app"}
+	if args := strings.Fields(string(contentsB)); !reflect.DeepEqual(expected, args) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	// At the root, it isn't.
+	if err := os.Chdir(filepath.Join(dir, "..", "..")); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"bun", "install"}
+	if cmd := withBunFilter([]string{"bun", "install"}); !reflect.DeepEqual(expected, cmd) {
+		t.Errorf("expected %v, got %v", expected, cmd)
+	}
+}
@@ -0,0 +1,237 @@
+package nodejs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/yaml.v2"
+)
+
+// readPnpmCatalogs returns the catalogs declared in the
+// pnpm-workspace.yaml in dir, keyed by name, with "" for the default
+// catalog. Each maps package names to specs.
+//
+// See https://pnpm.io/catalogs
+func readPnpmCatalogs(dir string) (map[string]map[string]string, error) {
+	contentsB, err := os.ReadFile(filepath.Join(dir, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var cfg pnpmWorkspaceYAML
+	if err := yaml.Unmarshal(contentsB, &cfg); err != nil {
+		return nil, fmt.Errorf("pnpm-workspace.yaml: %s", err)
+	}
+	catalogs := map[string]map[string]string{}
+	add := func(name string, catalog map[string]string) {
+		if catalogs[name] == nil {
+			catalogs[name] = map[string]string{}
+		}
+		for pkg, spec := range catalog {
+			catalogs[name][pkg] = spec
+		}
+	}
+	if cfg.Catalog != nil {
+		add("", cfg.Catalog)
+	}
+	for name, catalog := range cfg.Catalogs {
+		if name == "default" {
+			name = ""
+		}
+		add(name, catalog)
+	}
+	return catalogs, nil
+}
+
+// findPnpmWorkspaceRoot returns the directory of the
+// pnpm-workspace.yaml that applies to the current directory: the
+// nearest one in it or its parents.
+func findPnpmWorkspaceRoot() (string, error) {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return "", err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if util.Exists(filepath.Join(dir, "pnpm-workspace.yaml")) {
+			return dir, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return "", fmt.Errorf("no pnpm-workspace.yaml in %s or its parents", cwd)
+		}
+	}
+}
+
+// catalogSpec matches the catalog specs that catalogUpgrades can
+// bump: a version, optionally after a ^, ~ or = and a v.
+var catalogSpec = regexp.MustCompile(`^([~^=]?v?)([0-9]+(?:\.[0-9]+){0,2})$`)
+
+// catalogUpgrades returns the entries of catalog whose spec names an
+// older version than the latest one, as returned by latest, with the
+// spec that names the latest one instead, keeping its ^ or ~. Specs
+// that aren't a single version, such as ranges or tags, are left
+// alone, as are those of packages whose latest version is unknown.
+func catalogUpgrades(catalog map[string]string, latest func(name string) string) []api.CatalogUpgrade {
+	names := []string{}
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	upgrades := []api.CatalogUpgrade{}
+	for _, name := range names {
+		spec := catalog[name]
+		match := catalogSpec.FindStringSubmatch(spec)
+		if match == nil {
+			continue
+		}
+		current, err := version.NewVersion(match[2])
+		if err != nil {
+			continue
+		}
+		latestStr := latest(name)
+		latestVersion, err := version.NewVersion(latestStr)
+		if err != nil || !latestVersion.GreaterThan(current) {
+			continue
+		}
+		upgrades = append(upgrades, api.CatalogUpgrade{
+			Name: name,
+			From: spec,
+			To:   strings.TrimSuffix(match[1], "v") + latestStr,
+		})
+	}
+	return upgrades
+}
+
+// yamlEntry matches a line of a YAML block mapping, capturing its
+// indentation, key (which may be quoted), the separator, and its
+// value up to a trailing comment.
+var yamlEntry = regexp.MustCompile(`^(\s*)('[^']*'|"[^"]*"|[^\s#'"][^:#]*?)(:\s*)([^#]*?)(\s+#.*)?$`)
+
+// setPnpmCatalogSpecs returns the contents of a pnpm-workspace.yaml
+// with the specs of the given packages in the named catalog ("" for
+// the default one) replaced, leaving the rest of the file, including
+// comments and quoting, as it was. Packages that aren't in the
+// catalog are an error.
+func setPnpmCatalogSpecs(contentsB []byte, catalog string, specs map[string]string) ([]byte, error) {
+	// The keys of the block mappings enclosing each line, with
+	// their indentation.
+	type parent struct {
+		indent int
+		key    string
+	}
+	parents := []parent{}
+	pending := map[string]bool{}
+	for name := range specs {
+		pending[name] = true
+	}
+
+	lines := strings.Split(string(contentsB), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		m := yamlEntry.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+		key := strings.Trim(m[2], `'"`)
+		if m[4] == "" {
+			parents = append(parents, parent{indent, key})
+			continue
+		}
+
+		path := []string{}
+		for _, p := range parents {
+			path = append(path, p.key)
+		}
+		inCatalog := false
+		switch strings.Join(path, "\n") {
+		case "catalog":
+			inCatalog = catalog == ""
+		case "catalogs\n" + catalog:
+			inCatalog = true
+		case "catalogs\ndefault":
+			inCatalog = catalog == ""
+		}
+		spec, ok := specs[key]
+		if !inCatalog || !ok {
+			continue
+		}
+		value := spec
+		if quote := m[4][0]; quote == '\'' || quote == '"' {
+			value = string(quote) + spec + string(quote)
+		}
+		lines[i] = m[1] + m[2] + m[3] + value + m[5]
+		delete(pending, key)
+	}
+	if len(pending) > 0 {
+		missing := []string{}
+		for name := range pending {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("not in the catalog: %s", strings.Join(missing, ", "))
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// pnpmUpgradeCatalog implements UpgradeCatalog for nodejs-pnpm,
+// bumping the entries of the named catalog in the pnpm-workspace.yaml
+// of the workspace to the latest versions in the registry.
+func pnpmUpgradeCatalog(ctx context.Context, catalog string, dryRun bool) []api.CatalogUpgrade {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pnpmUpgradeCatalog")
+	defer span.Finish()
+	root, err := findPnpmWorkspaceRoot()
+	if err != nil {
+		util.Die("%s", err)
+	}
+	catalogs, err := readPnpmCatalogs(root)
+	if err != nil {
+		util.Die("%s", err)
+	}
+	key := catalog
+	if key == "default" {
+		key = ""
+	}
+	entries, ok := catalogs[key]
+	if !ok {
+		util.Die("pnpm-workspace.yaml has no catalog named %s", catalog)
+	}
+
+	upgrades := catalogUpgrades(entries, func(name string) string {
+		return nodejsInfo(api.PkgName(name)).Version
+	})
+	if len(upgrades) == 0 || dryRun {
+		return upgrades
+	}
+	specs := map[string]string{}
+	for _, upgrade := range upgrades {
+		specs[upgrade.Name] = upgrade.To
+	}
+	path := filepath.Join(root, "pnpm-workspace.yaml")
+	contentsB, err := os.ReadFile(path)
+	if err != nil {
+		util.Die("%s", err)
+	}
+	contentsB, err = setPnpmCatalogSpecs(contentsB, key, specs)
+	if err != nil {
+		util.Die("pnpm-workspace.yaml: %s", err)
+	}
+	util.ProgressMsg("write pnpm-workspace.yaml")
+	util.TryWriteAtomic(path, contentsB)
+	return upgrades
+}
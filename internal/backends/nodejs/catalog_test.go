@@ -0,0 +1,156 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+// registryDocuments returns the routes of a registry that has the
+// given versions of packages, for testutil.Serve.
+func registryDocuments(packages map[string][]string) map[string]string {
+	routes := map[string]string{}
+	for name, versions := range packages {
+		entries := []string{}
+		for _, v := range versions {
+			entries = append(entries, `"`+v+`": {"name": "`+name+`", "version": "`+v+`"}`)
+		}
+		routes["https://registry.npmjs.org/"+name] = `{"name": "` + name + `", "versions": {` + strings.Join(entries, ", ") + `}}`
+	}
+	return routes
+}
+
+const catalogWorkspaceYAML = `packages:
+  - 'packages/*'
+
+# Versions shared by every package.
+catalog:
+  react: ^18.2.0 # keep in sync with react-dom
+  'react-dom': '^18.2.0'
+  left-pad: 1.3.0
+  typescript: '>=5'
+
+catalogs:
+  legacy:
+    react: ~16.14.0
+`
+
+func TestCatalogUpgrades(t *testing.T) {
+	latest := map[string]string{
+		"react":      "18.3.1",
+		"left-pad":   "1.3.0",
+		"typescript": "5.6.2",
+		"lodash":     "4.17.21",
+	}
+	catalog := map[string]string{
+		"react":      "^18.2.0",
+		"left-pad":   "1.3.0",
+		"typescript": ">=5",
+		"lodash":     "v4.17.0",
+		"unknown":    "^1.0.0",
+	}
+	upgrades := catalogUpgrades(catalog, func(name string) string {
+		return latest[name]
+	})
+	expected := []api.CatalogUpgrade{
+		{Name: "lodash", From: "v4.17.0", To: "4.17.21"},
+		{Name: "react", From: "^18.2.0", To: "^18.3.1"},
+	}
+	if !reflect.DeepEqual(expected, upgrades) {
+		t.Errorf("expected upgrades %+v, got %+v", expected, upgrades)
+	}
+}
+
+func TestSetPnpmCatalogSpecs(t *testing.T) {
+	contents, err := setPnpmCatalogSpecs([]byte(catalogWorkspaceYAML), "", map[string]string{
+		"react":     "^18.3.1",
+		"react-dom": "^18.3.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.NewReplacer(
+		"react: ^18.2.0 # keep", "react: ^18.3.1 # keep",
+		"'react-dom': '^18.2.0'", "'react-dom': '^18.3.1'",
+	).Replace(catalogWorkspaceYAML)
+	if string(contents) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, contents)
+	}
+
+	contents, err = setPnpmCatalogSpecs([]byte(catalogWorkspaceYAML), "legacy", map[string]string{
+		"react": "~16.14.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Replace(catalogWorkspaceYAML, "~16.14.0", "~16.14.1", 1)
+	if string(contents) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, contents)
+	}
+
+	_, err = setPnpmCatalogSpecs([]byte(catalogWorkspaceYAML), "legacy", map[string]string{
+		"left-pad": "1.3.1",
+	})
+	if err == nil || !strings.Contains(err.Error(), "left-pad") {
+		t.Errorf("expected an error about left-pad, got %v", err)
+	}
+}
+
+func TestPnpmUpgradeCatalog(t *testing.T) {
+	offlineProject(t)
+	writeFile(t, "pnpm-workspace.yaml", catalogWorkspaceYAML)
+	testutil.Serve(t, registryDocuments(map[string][]string{
+		"react":     {"16.14.0", "18.2.0", "18.3.1", "19.0.0-rc.1"},
+		"react-dom": {"18.2.0", "18.3.1"},
+		"left-pad":  {"1.3.0"},
+	}))
+	expected := []api.CatalogUpgrade{
+		{Name: "react", From: "^18.2.0", To: "^18.3.1"},
+		{Name: "react-dom", From: "^18.2.0", To: "^18.3.1"},
+	}
+
+	// A dry run reports the entries that are behind, and leaves
+	// the file alone.
+	upgrades := pnpmUpgradeCatalog(context.Background(), "default", true)
+	if !reflect.DeepEqual(expected, upgrades) {
+		t.Errorf("expected upgrades %+v, got %+v", expected, upgrades)
+	}
+	contents, err := os.ReadFile("pnpm-workspace.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != catalogWorkspaceYAML {
+		t.Errorf("dry run changed pnpm-workspace.yaml:\n%s", contents)
+	}
+
+	upgrades = pnpmUpgradeCatalog(context.Background(), "default", false)
+	if !reflect.DeepEqual(expected, upgrades) {
+		t.Errorf("expected upgrades %+v, got %+v", expected, upgrades)
+	}
+	catalogs, err := readPnpmCatalogs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCatalogs := map[string]map[string]string{
+		"": {
+			"react":      "^18.3.1",
+			"react-dom":  "^18.3.1",
+			"left-pad":   "1.3.0",
+			"typescript": ">=5",
+		},
+		"legacy": {"react": "~16.14.0"},
+	}
+	if !reflect.DeepEqual(expectedCatalogs, catalogs) {
+		t.Errorf("expected catalogs %v, got %v", expectedCatalogs, catalogs)
+	}
+
+	// Now nothing is behind.
+	if upgrades := pnpmUpgradeCatalog(context.Background(), "default", true); len(upgrades) != 0 {
+		t.Errorf("expected no upgrades, got %+v", upgrades)
+	}
+}
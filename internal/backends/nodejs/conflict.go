@@ -0,0 +1,76 @@
+package nodejs
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmLogPrefixRegexp matches the prefix npm puts in front of every
+// line of error output ("npm ERR!" in npm <= 9, "npm error" after).
+var npmLogPrefixRegexp = regexp.MustCompile(`^npm (?:ERR!|error) ?`)
+
+// npmEdgeRegexp matches a dependency edge in ERESOLVE output, e.g.
+//
+//	peer react@"^17.0.2" from react-dom@17.0.2
+var npmEdgeRegexp = regexp.MustCompile(`^(?:peer |peerOptional |dev |optional )?(@?[^@\s]+)@"([^"]*)" from (.+)$`)
+
+// npmNodeRegexp splits a package node such as "react-dom@17.0.2"
+// into its name and version.
+var npmNodeRegexp = regexp.MustCompile(`^(@?[^@\s]+)@(\S+)$`)
+
+// parseNpmConflicts extracts the constraints placed on the package
+// name from the ERESOLVE report in npm's output.
+func parseNpmConflicts(output string, name api.PkgName) []api.Conflict {
+	conflicts := []api.Conflict{}
+	seen := map[api.Conflict]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(npmLogPrefixRegexp.ReplaceAllString(line, ""))
+		match := npmEdgeRegexp.FindStringSubmatch(line)
+		if match == nil || match[1] != string(name) {
+			continue
+		}
+		// Requirements declared by the project itself are
+		// what the user is trying to change, so they don't
+		// count as blockers.
+		if match[3] == "the root project" {
+			continue
+		}
+		conflict := api.Conflict{
+			Blocker:    match[3],
+			Constraint: match[2],
+		}
+		if node := npmNodeRegexp.FindStringSubmatch(match[3]); node != nil {
+			conflict.Blocker = node[1]
+			conflict.BlockerVersion = node[2]
+		}
+		if !seen[conflict] {
+			seen[conflict] = true
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+// npmWhyNot implements WhyNot for nodejs-npm.
+func npmWhyNot(ctx context.Context, name api.PkgName, version api.PkgVersion) []api.Conflict {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npm install --dry-run")
+	defer span.Finish()
+	output, err := util.GetCmdCombinedOutputFallible([]string{
+		"npm", "install", "--dry-run", "--no-audit", "--no-fund",
+		string(name) + "@" + string(version),
+	})
+	if err == nil {
+		return []api.Conflict{}
+	}
+	conflicts := parseNpmConflicts(string(output), name)
+	if len(conflicts) == 0 {
+		util.Die("npm install --dry-run: %s\n%s", err, output)
+	}
+	return conflicts
+}
@@ -0,0 +1,51 @@
+package nodejs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestParseNpmConflicts(t *testing.T) {
+	tcs := []struct {
+		fixture  string
+		name     api.PkgName
+		expected []api.Conflict
+	}{
+		{
+			fixture: "testdata/npm-eresolve.txt",
+			name:    "react",
+			expected: []api.Conflict{
+				{Blocker: "react-dom", BlockerVersion: "17.0.2", Constraint: "^17.0.2"},
+			},
+		},
+		{
+			fixture: "testdata/npm-eresolve-scoped.txt",
+			name:    "@types/react",
+			expected: []api.Conflict{
+				{Blocker: "@testing-library/react", BlockerVersion: "12.1.5", Constraint: "<18.0.0"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.fixture, func(t *testing.T) {
+			output, err := os.ReadFile(tc.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conflicts := parseNpmConflicts(string(output), tc.name)
+			if len(conflicts) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, conflicts)
+			}
+			for i := range tc.expected {
+				if conflicts[i] != tc.expected[i] {
+					t.Errorf("expected %v, got %v", tc.expected[i], conflicts[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packageManagerSignal associates a file which indicates that a
+// project uses some package manager with the name of the
+// corresponding backend.
+type packageManagerSignal struct {
+	filename string
+	backend  string
+}
+
+// lockfileSignals are the lockfiles written by each package manager.
+// When several are present in the same directory, the first one
+// listed wins, matching the order of the backends in GetBackend.
+var lockfileSignals = []packageManagerSignal{
+	{"bun.lockb", "bun"},
+	{"bun.lock", "bun"},
+	{"package-lock.json", "nodejs-npm"},
+	{"npm-shrinkwrap.json", "nodejs-npm"},
+	{"pnpm-lock.yaml", "nodejs-pnpm"},
+	{"yarn.lock", "nodejs-yarn"},
+}
+
+// markerSignals are configuration files that only make sense for a
+// particular package manager. They are weaker signals than
+// lockfiles.
+var markerSignals = []packageManagerSignal{
+	{"bunfig.toml", "bun"},
+	{"pnpm-workspace.yaml", "nodejs-pnpm"},
+	{".yarnrc.yml", "nodejs-yarn"},
+}
+
+// packageManagerBackends maps the package manager names used in the
+// packageManager field of package.json to backend names.
+var packageManagerBackends = map[string]string{
+	"bun":  "bun",
+	"npm":  "nodejs-npm",
+	"pnpm": "nodejs-pnpm",
+	"yarn": "nodejs-yarn",
+}
+
+// packageManagerJSON represents the packageManager field of
+// package.json, as used by Corepack, e.g. "pnpm@8.6.0".
+type packageManagerJSON struct {
+	PackageManager string `json:"packageManager"`
+}
+
+// DetectBackendName returns the name of the Node.js backend which
+// the project in dir most likely uses. The packageManager field of
+// package.json takes precedence. Otherwise, dir and each of its
+// parents are searched for a lockfile, and failing that, for a
+// configuration file specific to one package manager, with the
+// nearest directory winning. The search stops at the root of the
+// repository (the first directory containing .git). If there are no
+// signals at all, as in a fresh clone that hasn't been installed yet,
+// npm is assumed, being the most common.
+func DetectBackendName(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	if contentsB, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var cfg packageManagerJSON
+		if err := json.Unmarshal(contentsB, &cfg); err == nil && cfg.PackageManager != "" {
+			name, _, _ := strings.Cut(cfg.PackageManager, "@")
+			if backend, ok := packageManagerBackends[name]; ok {
+				return backend
+			}
+		}
+	}
+
+	for current := dir; ; {
+		for _, signals := range [][]packageManagerSignal{lockfileSignals, markerSignals} {
+			for _, signal := range signals {
+				if _, err := os.Stat(filepath.Join(current, signal.filename)); err == nil {
+					return signal.backend
+				}
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+
+	return "nodejs-npm"
+}
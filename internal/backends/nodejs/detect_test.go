@@ -0,0 +1,102 @@
+package nodejs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupMonorepo creates a repository root containing a nested
+// package, both with a package.json, and returns the paths of both.
+// The .git directory at the root keeps the search from looking at
+// directories outside of the test.
+func setupMonorepo(t *testing.T) (string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	pkg := filepath.Join(root, "packages", "app")
+	for _, dir := range []string{filepath.Join(root, ".git"), pkg} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(root, "package.json"), `{"private": true}`)
+	writeFile(t, filepath.Join(pkg, "package.json"), `{"name": "app"}`)
+	return root, pkg
+}
+
+func TestDetectBackendNameAmbiguous(t *testing.T) {
+	_, pkg := setupMonorepo(t)
+
+	if backend := DetectBackendName(pkg); backend != "nodejs-npm" {
+		t.Errorf("expected the fallback to be nodejs-npm, got %s", backend)
+	}
+}
+
+func TestDetectBackendNameLockfile(t *testing.T) {
+	cases := map[string]string{
+		"bun.lockb":         "bun",
+		"package-lock.json": "nodejs-npm",
+		"pnpm-lock.yaml":    "nodejs-pnpm",
+		"yarn.lock":         "nodejs-yarn",
+	}
+	for lockfile, expected := range cases {
+		root, pkg := setupMonorepo(t)
+		writeFile(t, filepath.Join(root, lockfile), "")
+
+		if backend := DetectBackendName(pkg); backend != expected {
+			t.Errorf("%s in a parent directory: expected %s, got %s", lockfile, expected, backend)
+		}
+	}
+}
+
+func TestDetectBackendNameMarker(t *testing.T) {
+	cases := map[string]string{
+		".yarnrc.yml":         "nodejs-yarn",
+		"pnpm-workspace.yaml": "nodejs-pnpm",
+	}
+	for marker, expected := range cases {
+		root, pkg := setupMonorepo(t)
+		writeFile(t, filepath.Join(root, marker), "")
+
+		if backend := DetectBackendName(pkg); backend != expected {
+			t.Errorf("%s in a parent directory: expected %s, got %s", marker, expected, backend)
+		}
+	}
+}
+
+func TestDetectBackendNamePackageManagerField(t *testing.T) {
+	root, pkg := setupMonorepo(t)
+	writeFile(t, filepath.Join(pkg, "package.json"), `{"name": "app", "packageManager": "pnpm@8.6.0"}`)
+	// The packageManager field beats a lockfile of another
+	// package manager further up the tree.
+	writeFile(t, filepath.Join(root, "yarn.lock"), "")
+
+	if backend := DetectBackendName(pkg); backend != "nodejs-pnpm" {
+		t.Errorf("expected nodejs-pnpm, got %s", backend)
+	}
+}
+
+func TestDetectBackendNameNearestWins(t *testing.T) {
+	root, pkg := setupMonorepo(t)
+	writeFile(t, filepath.Join(root, "pnpm-lock.yaml"), "")
+	writeFile(t, filepath.Join(pkg, ".yarnrc.yml"), "")
+
+	if backend := DetectBackendName(pkg); backend != "nodejs-yarn" {
+		t.Errorf("expected the nearest signal to win, got %s", backend)
+	}
+}
+
+func TestDetectBackendNameStopsAtRepositoryRoot(t *testing.T) {
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "yarn.lock"), "")
+	root := filepath.Join(outside, "repo")
+	if err := os.MkdirAll(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "package.json"), "{}")
+
+	if backend := DetectBackendName(root); backend != "nodejs-npm" {
+		t.Errorf("expected lockfiles outside the repository to be ignored, got %s", backend)
+	}
+}
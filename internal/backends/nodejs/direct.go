@@ -0,0 +1,132 @@
+package nodejs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// tarballFilenamePattern matches the filename of a tarball made by
+// npm pack or served by the registry, capturing the package name
+// (without its scope).
+var tarballFilenamePattern = regexp.MustCompile(`^(.+)-v?\d+\.\d+\.\d+[^/]*\.tgz$`)
+
+// nodejsDirectReference implements DirectReference for the Node.js
+// backends. A URL is used as the spec as it is, and a local tarball
+// becomes a file: spec relative to the project, the way npm writes
+// it. Unless given, the name is read from the package.json in a
+// local tarball, or taken from a tarball URL in the layout of the
+// npm registry (.../NAME/-/NAME-VERSION.tgz) or named like the output
+// of npm pack.
+func nodejsDirectReference(name api.PkgName, ref string) (api.PkgName, api.PkgSpec, error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		if name != "" {
+			return name, api.PkgSpec(ref), nil
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			return "", "", err
+		}
+		if name, ok := tarballURLName(u.Path); ok {
+			return name, api.PkgSpec(ref), nil
+		}
+		return "", "", fmt.Errorf("can't tell the name of the package at %s; pass it as \"NAME %s\"", ref, ref)
+	}
+
+	if !strings.HasSuffix(ref, ".tgz") && !strings.HasSuffix(ref, ".tar.gz") {
+		return "", "", fmt.Errorf("%s: only tarballs can be added", ref)
+	}
+	if name == "" {
+		tarballName, err := readTarballName(ref)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %s", ref, err)
+		}
+		name = tarballName
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	abs, err := filepath.Abs(ref)
+	if err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return name, api.PkgSpec("file:" + filepath.ToSlash(rel)), nil
+}
+
+// tarballURLName returns the name of the package whose tarball is at
+// the given URL path, if it can be told from the path.
+func tarballURLName(urlPath string) (api.PkgName, bool) {
+	segments := strings.Split(urlPath, "/")
+	// The registry serves tarballs from /NAME/-/FILE and
+	// /@SCOPE/NAME/-/FILE.
+	for i := len(segments) - 2; i >= 1; i-- {
+		if segments[i] != "-" {
+			continue
+		}
+		name := segments[i-1]
+		if i >= 2 && strings.HasPrefix(segments[i-2], "@") {
+			name = segments[i-2] + "/" + name
+		}
+		return api.PkgName(name), true
+	}
+	if match := tarballFilenamePattern.FindStringSubmatch(path.Base(urlPath)); match != nil {
+		return api.PkgName(match[1]), true
+	}
+	return "", false
+}
+
+// readTarballName returns the name declared by the package.json at
+// the top of the given gzipped tarball, as made by npm pack.
+func readTarballName(filename string) (api.PkgName, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("no package.json found")
+		} else if err != nil {
+			return "", err
+		}
+		// The files are in a single top-level directory,
+		// usually package/.
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) != 2 || parts[1] != "package.json" {
+			continue
+		}
+		var cfg struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(archive).Decode(&cfg); err != nil {
+			return "", fmt.Errorf("package.json: %s", err)
+		}
+		if cfg.Name == "" {
+			return "", fmt.Errorf("package.json has no name")
+		}
+		return api.PkgName(cfg.Name), nil
+	}
+}
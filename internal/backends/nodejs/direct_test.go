@@ -0,0 +1,27 @@
+package nodejs
+
+import (
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestTarballURLName(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected api.PkgName
+		ok       bool
+	}{
+		{"/left-pad/-/left-pad-1.3.0.tgz", "left-pad", true},
+		{"/@types/node/-/node-20.11.0.tgz", "@types/node", true},
+		{"/npm/@babel/core/-/core-7.24.0.tgz", "@babel/core", true},
+		{"/releases/download/v2.0.0/my-tool-2.0.0.tgz", "my-tool", true},
+		{"/downloads/latest.tgz", "", false},
+	}
+	for _, tc := range testCases {
+		name, ok := tarballURLName(tc.path)
+		if name != tc.expected || ok != tc.ok {
+			t.Errorf("%s: expected %q (%v), got %q (%v)", tc.path, tc.expected, tc.ok, name, ok)
+		}
+	}
+}
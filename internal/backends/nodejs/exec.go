@@ -0,0 +1,37 @@
+package nodejs
+
+import (
+	"context"
+	"path/filepath"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// nodejsBinPath implements BinPath for the Node.js backends. Each of
+// the package managers links the executables of the installed
+// packages into node_modules/.bin.
+func nodejsBinPath(ctx context.Context) string {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "nodejsBinPath")
+	defer span.Finish()
+	return filepath.Join(nodejsGetPackageDir(), ".bin")
+}
+
+// makeFetchCmd returns a FetchCmd that runs bin, with args, using
+// the given command of a package manager, such as "npx --yes".
+func makeFetchCmd(runner ...string) func(bin string, args []string) []string {
+	return func(bin string, args []string) []string {
+		cmd := append([]string{}, runner...)
+		cmd = append(cmd, bin)
+		return append(cmd, args...)
+	}
+}
+
+// yarnFetchCmd implements FetchCmd for nodejs-yarn. Yarn 1 has no
+// way to run a package without adding it, so npx is used instead.
+func yarnFetchCmd(bin string, args []string) []string {
+	if yarnIsBerry() {
+		return makeFetchCmd("yarn", "dlx")(bin, args)
+	}
+	return makeFetchCmd("npx", "--yes")(bin, args)
+}
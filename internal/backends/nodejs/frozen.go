@@ -0,0 +1,100 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// lockfileDriftMessages are what each package manager prints when a
+// frozen install fails because the lockfile is out of date with
+// package.json.
+var lockfileDriftMessages = []string{
+	// npm ci
+	"can only install packages when your package.json and package-lock.json",
+	// Yarn 1 with --frozen-lockfile
+	"Your lockfile needs to be updated",
+	// Yarn 2 and later with --immutable (YN0028)
+	"The lockfile would have been modified by this install, which is explicitly forbidden",
+	// pnpm with --frozen-lockfile
+	"ERR_PNPM_OUTDATED_LOCKFILE",
+	// bun with --frozen-lockfile
+	"lockfile had changes, but lockfile is frozen",
+}
+
+// isLockfileDrift reports whether the output of a failed install
+// says that it failed because the lockfile is out of date.
+func isLockfileDrift(output []byte) bool {
+	for _, message := range lockfileDriftMessages {
+		if strings.Contains(string(output), message) {
+			return true
+		}
+	}
+	return false
+}
+
+// yarnIsBerry reports whether the project uses Yarn 2 or later, which
+// is configured by .yarnrc.yml or pinned by the packageManager field
+// of package.json.
+func yarnIsBerry() bool {
+	if util.Exists(".yarnrc.yml") {
+		return true
+	}
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		return false
+	}
+	var cfg packageManagerJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return false
+	}
+	name, version, _ := strings.Cut(cfg.PackageManager, "@")
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	return name == "yarn" && err == nil && n >= 2
+}
+
+// withFrozenLockfileFlag appends flag, which makes a package manager
+// fail rather than update the lockfile, to cmd if --frozen was
+// given.
+func withFrozenLockfileFlag(cmd []string, flag string) []string {
+	if config.Frozen {
+		cmd = append(cmd, flag)
+	}
+	return cmd
+}
+
+func yarnFrozenInstallCmd() []string {
+	flag := "--frozen-lockfile"
+	if yarnIsBerry() {
+		flag = "--immutable"
+	}
+	return withFrozenLockfileFlag(yarnInstallCmd(), flag)
+}
+
+func pnpmFrozenInstallCmd() []string {
+	return withFrozenLockfileFlag(pnpmInstallCmd(), "--frozen-lockfile")
+}
+
+func bunFrozenInstallCmd() []string {
+	return withFrozenLockfileFlag(bunInstallCmd(), "--frozen-lockfile")
+}
+
+// runNodejsInstall runs an install command for one of the Node.js
+// backends. If it fails because the lockfile is out of date, as npm
+// ci always does and the other package managers do with --frozen, the
+// same error is reported whichever package manager it is.
+func runNodejsInstall(cmd []string, lockfile string) {
+	output, err := util.RunCmdFallible(cmd)
+	if err == nil {
+		return
+	}
+	if isLockfileDrift(output) {
+		util.Die("%s is out of date with package.json; run upm lock to update it", lockfile)
+	}
+	util.Die("%s", err)
+}
@@ -0,0 +1,95 @@
+package nodejs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func setFrozen(t *testing.T, frozen bool) {
+	t.Helper()
+	orig := config.Frozen
+	config.Frozen = frozen
+	t.Cleanup(func() { config.Frozen = orig })
+}
+
+func TestFrozenInstallCmd(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, false, "")
+	offlineProject(t)
+
+	tcs := map[string]map[bool][]string{"npm": {}, "yarn": {}, "pnpm": {}, "bun": {}}
+	for _, frozen := range []bool{false, true} {
+		setFrozen(t, frozen)
+		tcs["npm"][frozen] = npmInstallCmd("ci")
+		tcs["yarn"][frozen] = yarnFrozenInstallCmd()
+		tcs["pnpm"][frozen] = pnpmFrozenInstallCmd()
+		tcs["bun"][frozen] = bunFrozenInstallCmd()
+	}
+
+	// npm ci never updates the lockfile, so it needs no flag.
+	expected := map[string]map[bool][]string{
+		"npm": {
+			false: {"npm", "ci"},
+			true:  {"npm", "ci"},
+		},
+		"yarn": {
+			false: {"yarn", "install"},
+			true:  {"yarn", "install", "--frozen-lockfile"},
+		},
+		"pnpm": {
+			false: {"pnpm", "install"},
+			true:  {"pnpm", "install", "--frozen-lockfile"},
+		},
+		"bun": {
+			false: {"bun", "install"},
+			true:  {"bun", "install", "--frozen-lockfile"},
+		},
+	}
+	for name, cmds := range tcs {
+		for frozen, cmd := range cmds {
+			if !reflect.DeepEqual(cmd, expected[name][frozen]) {
+				t.Errorf("%s (frozen=%v): expected %v, got %v", name, frozen, expected[name][frozen], cmd)
+			}
+		}
+	}
+}
+
+func TestFrozenInstallCmd_YarnBerry(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, true, "")
+	setFrozen(t, true)
+
+	offlineProject(t)
+	writeFile(t, "package.json", `{"packageManager": "yarn@4.1.0"}`)
+	if cmd := yarnFrozenInstallCmd(); !reflect.DeepEqual(cmd, []string{"yarn", "install", "--immutable"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+
+	offlineProject(t)
+	writeFile(t, "package.json", `{"packageManager": "yarn@1.22.19"}`)
+	writeFile(t, ".yarnrc.yml", "nodeLinker: node-modules\n")
+	if cmd := yarnFrozenInstallCmd(); !reflect.DeepEqual(cmd, []string{"yarn", "install", "--immutable"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
+
+func TestIsLockfileDrift(t *testing.T) {
+	drift := map[string]string{
+		"npm":    "npm ERR! `npm ci` can only install packages when your package.json and package-lock.json or npm-shrinkwrap.json are in sync. Please update your lock file with `npm install` before continuing.",
+		"yarn 1": "error Your lockfile needs to be updated, but yarn was run with `--frozen-lockfile`.",
+		"yarn 4": "➤ YN0028: │ The lockfile would have been modified by this install, which is explicitly forbidden.",
+		"pnpm":   " ERR_PNPM_OUTDATED_LOCKFILE  Cannot install with \"frozen-lockfile\" because pnpm-lock.yaml is not up to date with package.json",
+		"bun":    "error: lockfile had changes, but lockfile is frozen",
+	}
+	for name, output := range drift {
+		if !isLockfileDrift([]byte(output)) {
+			t.Errorf("%s: expected lockfile drift to be detected in %q", name, output)
+		}
+	}
+
+	if isLockfileDrift([]byte("npm ERR! code E404\nnpm ERR! 404 Not Found - GET https://registry.npmjs.org/nonexistent")) {
+		t.Errorf("expected a registry error not to be taken for lockfile drift")
+	}
+}
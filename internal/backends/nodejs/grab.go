@@ -56,6 +56,19 @@ var internalModules = []string{
 	"zlib",
 }
 
+// nodejsTypesFor implements TypesFor for the Node.js backends. The
+// DefinitelyTyped package of @scope/name is @types/scope__name.
+func nodejsTypesFor(name api.PkgName) (api.PkgName, bool) {
+	typed, ok := strings.CutPrefix(string(name), "@types/")
+	if !ok || typed == "" {
+		return "", false
+	}
+	if scope, rest, found := strings.Cut(typed, "__"); found {
+		typed = "@" + scope + "/" + rest
+	}
+	return api.PkgName(typed), true
+}
+
 // nodejsGuess implements Guess for nodejs-yarn, nodejs-pnpm and nodejs-npm.
 func nodejsGuess(ctx context.Context) (map[api.PkgName]bool, bool) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "nodejsGuess")
@@ -80,11 +93,17 @@ func findImports(ctx context.Context, dir string) (map[string]bool, error) {
 (import_statement
   source: (string) @import)
 
+(export_statement
+  source: (string) @import)
+
 ((call_expression
-     function: [(identifier) @function
-		            (import)]
+     function: (identifier) @function
      arguments: (arguments . [(string) @import (template_string) @import] .))
  (#eq? @function "require"))
+
+(call_expression
+  function: (import)
+  arguments: (arguments . [(string) @import (template_string) @import] .))
 `
 
 	foundImportPaths := map[string]bool{}
@@ -3,6 +3,7 @@ package nodejs
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -71,3 +72,100 @@ process.exit(1);
 		t.Errorf("Missing imports: %v", expected)
 	}
 }
+
+func TestParseFileTrickySyntax(t *testing.T) {
+	expected := map[string]bool{
+		"react":        true,
+		"lodash":       true,
+		"./local":      true,
+		"chalk":        true,
+		"node-fetch":   true,
+		"@scope/thing": true,
+		"debug":        true,
+	}
+
+	content := `
+import React, {
+	useState,
+	useEffect,
+} from "react";
+import {
+	map,
+	filter
+} from 'lodash';
+export { helper } from "./local";
+export * from "chalk";
+
+async function load() {
+	if (typeof window === "undefined") {
+		const { default: fetch } = await import("node-fetch");
+		return fetch;
+	}
+}
+
+const thing = process.env.SCOPED
+	? require("@scope/thing")
+	: null;
+
+try {
+	require("debug");
+} catch (e) {}
+`
+
+	testDir := t.TempDir()
+	testFile := testDir + "/index.js"
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+
+	found, err := findImports(context.Background(), testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+
+	for path := range found {
+		if _, ok := expected[path]; ok {
+			delete(expected, path)
+		} else {
+			t.Errorf("Unexpected import %s", path)
+		}
+	}
+
+	if len(expected) > 0 {
+		t.Errorf("Missing imports: %v", expected)
+	}
+}
+
+func TestFindImportsSkipsSubmodules(t *testing.T) {
+	gitmodules, err := os.ReadFile("testdata/submodules/.gitmodules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDir := t.TempDir()
+	files := map[string]string{
+		".gitmodules":                   string(gitmodules),
+		"index.js":                      `const express = require("express");`,
+		"third_party/left-pad/index.js": `const tape = require("tape");`,
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(testDir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(testDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := findImports(context.Background(), testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+
+	if !found["express"] {
+		t.Errorf("expected express to be imported, got %v", found)
+	}
+	if found["tape"] {
+		t.Errorf("expected the imports of the third_party/left-pad submodule to be skipped, got %v", found)
+	}
+}
@@ -0,0 +1,148 @@
+package nodejs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// installedPackageJSON represents the fields of an installed
+// package's package.json that describe how it can be loaded.
+type installedPackageJSON struct {
+	Version string            `json:"version"`
+	Main    string            `json:"main"`
+	Module  string            `json:"module"`
+	Exports json.RawMessage   `json:"exports"`
+	Engines map[string]string `json:"engines"`
+	Bin     json.RawMessage   `json:"bin"`
+}
+
+// addInstalledInfo fills in the fields of info that describe the
+// installed copy of the named package, read from its package.json in
+// pkgDir. If the package isn't installed, info is left alone.
+func addInstalledInfo(info *api.PkgInfo, pkgDir string, name api.PkgName) {
+	contentsB, err := os.ReadFile(filepath.Join(pkgDir, string(name), "package.json"))
+	if err != nil {
+		return
+	}
+	var cfg installedPackageJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return
+	}
+
+	info.InstalledVersion = cfg.Version
+	info.Main = cfg.Main
+	info.Module = cfg.Module
+
+	exports := []string{}
+	if len(cfg.Exports) > 0 {
+		flattenExports(".", nil, cfg.Exports, &exports)
+	}
+	info.Exports = exports
+
+	engines := []string{}
+	for engine, constraint := range cfg.Engines {
+		engines = append(engines, engine+" "+constraint)
+	}
+	sort.Strings(engines)
+	info.Engines = engines
+
+	executables := []string{}
+	var bin string
+	var bins map[string]string
+	if json.Unmarshal(cfg.Bin, &bin) == nil && bin != "" {
+		// A single executable is named after the package,
+		// without its scope.
+		executables = append(executables, path.Base(string(name))+" -> "+bin)
+	} else if json.Unmarshal(cfg.Bin, &bins) == nil {
+		for command, file := range bins {
+			executables = append(executables, command+" -> "+file)
+		}
+		sort.Strings(executables)
+	}
+	info.Executables = executables
+}
+
+// flattenExports appends to out one line for each target of the
+// exports field of package.json (or part of it, for the given
+// subpath and conditions). Conditions are kept in the order they
+// are declared, since Node.js tries them in that order.
+func flattenExports(subpath string, conditions []string, value json.RawMessage, out *[]string) {
+	prefix := subpath
+	if len(conditions) > 0 {
+		prefix += " (" + strings.Join(conditions, ", ") + ")"
+	}
+
+	value = bytes.TrimSpace(value)
+	switch {
+	case bytes.HasPrefix(value, []byte("{")):
+		keys, values, err := decodeOrderedObject(value)
+		if err != nil {
+			return
+		}
+		for i, key := range keys {
+			// Keys are either all subpaths or all
+			// conditions.
+			if strings.HasPrefix(key, ".") {
+				flattenExports(key, conditions, values[i], out)
+			} else {
+				flattenExports(subpath, append(append([]string{}, conditions...), key), values[i], out)
+			}
+		}
+
+	case bytes.HasPrefix(value, []byte("[")):
+		// An array lists fallbacks, tried in order.
+		var targets []json.RawMessage
+		if err := json.Unmarshal(value, &targets); err != nil {
+			return
+		}
+		for _, target := range targets {
+			flattenExports(subpath, conditions, target, out)
+		}
+
+	case bytes.Equal(value, []byte("null")):
+		*out = append(*out, prefix+" -> (not exported)")
+
+	default:
+		var target string
+		if err := json.Unmarshal(value, &target); err != nil {
+			return
+		}
+		*out = append(*out, fmt.Sprintf("%s -> %s", prefix, target))
+	}
+}
+
+// decodeOrderedObject parses a JSON object into its keys and values,
+// in the order they appear.
+func decodeOrderedObject(contents json.RawMessage) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	keys := []string{}
+	values := []json.RawMessage{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected a key, got %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
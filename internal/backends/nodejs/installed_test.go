@@ -0,0 +1,80 @@
+package nodejs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+func TestAddInstalledInfo(t *testing.T) {
+	info := api.PkgInfo{Name: "dual-pkg", Version: "2.2.0"}
+	addInstalledInfo(&info, "testdata/installed/node_modules", "dual-pkg")
+
+	expected := api.PkgInfo{
+		Name:             "dual-pkg",
+		Version:          "2.2.0",
+		InstalledVersion: "2.1.0",
+		Main:             "./dist/index.cjs",
+		Module:           "./dist/index.mjs",
+		Exports: []string{
+			". (types) -> ./dist/index.d.ts",
+			". (import) -> ./dist/index.mjs",
+			". (require) -> ./dist/index.cjs",
+			"./utils (node, import) -> ./dist/utils.node.mjs",
+			"./utils (default) -> ./dist/utils.js",
+			"./internal/* -> (not exported)",
+			"./package.json -> ./package.json",
+		},
+		Engines:     []string{"node >=18", "npm >=9"},
+		Executables: []string{"dual -> ./bin/dual.js", "dual-init -> ./bin/init.js"},
+	}
+	if !reflect.DeepEqual(expected, info) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestAddInstalledInfoScoped(t *testing.T) {
+	info := api.PkgInfo{}
+	addInstalledInfo(&info, "testdata/installed/node_modules", "@acme/cli")
+
+	if info.InstalledVersion != "0.3.0" || info.Main != "lib/index.js" {
+		t.Errorf("unexpected version or main: %+v", info)
+	}
+	if !reflect.DeepEqual([]string{". -> ./lib/index.js"}, info.Exports) {
+		t.Errorf("unexpected exports: %v", info.Exports)
+	}
+	if !reflect.DeepEqual([]string{"cli -> ./bin/cli.js"}, info.Executables) {
+		t.Errorf("unexpected executables: %v", info.Executables)
+	}
+	if len(info.Engines) != 0 {
+		t.Errorf("expected no engines, got %v", info.Engines)
+	}
+}
+
+func TestAddInstalledInfoNotInstalled(t *testing.T) {
+	info := api.PkgInfo{Name: "left-pad"}
+	addInstalledInfo(&info, "testdata/installed/node_modules", "left-pad")
+
+	if !reflect.DeepEqual(api.PkgInfo{Name: "left-pad"}, info) {
+		t.Errorf("expected info to be left alone, got %+v", info)
+	}
+}
+
+func TestNodejsInfoInstalledOnly(t *testing.T) {
+	testutil.Chdir(t, "testdata/installed")
+
+	testutil.Serve(t, nil)
+
+	// A package that the registry doesn't know about, e.g. one
+	// from a private registry, is still described.
+	info := nodejsInfo("@acme/cli")
+	if info.Name != "@acme/cli" || info.InstalledVersion != "0.3.0" {
+		t.Errorf("expected the installed copy to be described, got %+v", info)
+	}
+
+	if info := nodejsInfo("left-pad"); info.Name != "" {
+		t.Errorf("expected no info for a missing package, got %+v", info)
+	}
+}
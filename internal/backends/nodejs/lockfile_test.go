@@ -0,0 +1,43 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestNpmLockfileVersionTooHigh(t *testing.T) {
+	contents, err := os.ReadFile("testdata/package-lock-v99.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg packageLockJSON
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	err = npmLockfileVersionError(cfg)
+	if err == nil {
+		t.Fatal("expected an error for lockfileVersion 99")
+	}
+	if !strings.Contains(err.Error(), "expected 1 to 3") {
+		t.Errorf("expected the error to name the supported range, got %q", err)
+	}
+
+	// Without --strict, parsing carries on with a warning.
+	pkgs := listNpmLockfileWithContents(contents)
+	if pkgs[api.PkgName("left-pad")] != "1.3.0" {
+		t.Errorf("expected left-pad 1.3.0, got %v", pkgs)
+	}
+}
+
+func TestNpmLockfileVersionSupported(t *testing.T) {
+	for _, version := range []int{1, 2, 3} {
+		if err := npmLockfileVersionError(packageLockJSON{LockfileVersion: version}); err != nil {
+			t.Errorf("expected lockfileVersion %d to be supported, got %s", version, err)
+		}
+	}
+}
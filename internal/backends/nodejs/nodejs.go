@@ -10,12 +10,16 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-version"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
+	"github.com/replit/upm/internal/pkg"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/yaml.v2"
@@ -60,14 +64,42 @@ type npmSearchResults struct {
 // which means that we have to deserialize the union of the type described in the document, and the
 // type of a package.json file: https://docs.npmjs.com/cli/v10/configuring-npm/package-json
 type npmInfoResult struct {
-	Name        string                 `json:"name"`
-	Versions    map[string]interface{} `json:"versions"`
-	Author      packageJsonPerson      `json:"author"`
-	Bugs        packageJsonBugs        `json:"bugs"`
-	Description string                 `json:"description"`
-	Homepage    string                 `json:"homepage"`
-	License     string                 `json:"license"`
-	Repository  packageJsonRepository  `json:"repository"`
+	Name        string                     `json:"name"`
+	Versions    map[string]json.RawMessage `json:"versions"`
+	Author      packageJsonPerson          `json:"author"`
+	Bugs        packageJsonBugs            `json:"bugs"`
+	Description string                     `json:"description"`
+	Homepage    string                     `json:"homepage"`
+	License     string                     `json:"license"`
+	Keywords    npmKeywords                `json:"keywords"`
+	Repository  packageJsonRepository      `json:"repository"`
+	Time        map[string]interface{}     `json:"time"`
+}
+
+// npmKeywords are the keywords of a package.json. They should be an
+// array, but some packages give a single string of comma-separated
+// keywords instead.
+type npmKeywords []string
+
+func (keywords *npmKeywords) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*keywords = nil
+		for _, keyword := range strings.Split(str, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				*keywords = append(*keywords, keyword)
+			}
+		}
+		return nil
+	}
+
+	// Anything else is ignored rather than failing the whole
+	// lookup, since keywords are only informational.
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*keywords = list
+	}
+	return nil
 }
 
 type packageJsonRepository struct {
@@ -185,10 +217,13 @@ type packageJSON struct {
 type packageLockJSON struct {
 	LockfileVersion int `json:"lockfileVersion"`
 	Dependencies    map[string]struct {
-		Version string `json:"version"`
+		Version  string `json:"version"`
+		Optional bool   `json:"optional"`
 	} `json:"dependencies"`
 	Packages map[string]struct {
-		Version string `json:"version"`
+		Version  string `json:"version"`
+		Dev      bool   `json:"dev"`
+		Optional bool   `json:"optional"`
 	} `json:"packages"`
 }
 
@@ -284,7 +319,15 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 	case 200:
 		break
 	case 404:
-		return api.PkgInfo{}
+		// The package may still be installed, e.g. from a
+		// private registry or a local path.
+		info := api.PkgInfo{}
+		addInstalledInfo(&info, nodejsGetPackageDir(), name)
+		if info.InstalledVersion != "" {
+			info.Name = string(name)
+			addInstalledPeerInfo(&info, nodejsGetPackageDir(), name)
+		}
+		return info
 	default:
 		util.Die("NPM registry: HTTP status %d", resp.StatusCode)
 	}
@@ -299,7 +342,12 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 		util.Die("NPM registry: %s", err)
 	}
 
+	// The values of "time" are publish timestamps, except for
+	// the "unpublished" entry, which is an object.
+	created, _ := npmInfo.Time["created"].(string)
+
 	lastVersionStr := ""
+	var lastVersionManifest json.RawMessage
 	if len(npmInfo.Versions) > 0 {
 		var lastVersion *version.Version = nil
 		for versionStr := range npmInfo.Versions {
@@ -318,10 +366,11 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 		}
 		if lastVersion != nil {
 			lastVersionStr = lastVersion.String()
+			lastVersionManifest = npmInfo.Versions[lastVersion.Original()]
 		}
 	}
 
-	return api.PkgInfo{
+	info := api.PkgInfo{
 		Name:          npmInfo.Name,
 		Description:   npmInfo.Description,
 		Version:       lastVersionStr,
@@ -333,13 +382,229 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 			Email: npmInfo.Author.Email,
 			URL:   npmInfo.Author.URL,
 		}.String(),
-		License: npmInfo.License,
+		License:        npmInfo.License,
+		Keywords:       npmInfo.Keywords,
+		FirstPublished: created,
 	}
+	if lastVersionManifest != nil {
+		addPeerInfo(&info, lastVersionManifest)
+		addDeprecationInfo(&info, lastVersionManifest)
+	}
+	addInstalledInfo(&info, nodejsGetPackageDir(), name)
+	return info
 }
 
-// nodejsListSpecfile implements ListSpecfile for nodejs-yarn, nodejs-pnpm and
-// nodejs-npm.
-func nodejsListSpecfile() map[api.PkgName]api.PkgSpec {
+// addDeprecationInfo fills in why the package is deprecated from the
+// registry manifest of its latest version, whose "deprecated" field
+// holds the message that npm deprecate was given.
+func addDeprecationInfo(info *api.PkgInfo, contentsB []byte) {
+	var manifest struct {
+		Deprecated interface{} `json:"deprecated"`
+	}
+	if err := json.Unmarshal(contentsB, &manifest); err != nil {
+		return
+	}
+	// Some old manifests have "deprecated": false.
+	if message, ok := manifest.Deprecated.(string); ok {
+		info.Deprecated = message
+	}
+}
+
+// nodejsPopularPackages implements PopularPackages for the Node.js
+// backends.
+func nodejsPopularPackages() []api.PkgName {
+	return pkg.LoadPopularPackages("/popular/npm.txt")
+}
+
+// nodejsDependencyTypes are the kinds of dependency that the Node.js
+// backends can add.
+var nodejsDependencyTypes = []config.DependencyType{
+	config.DependencyDev,
+	config.DependencyPeer,
+	config.DependencyOptional,
+	config.DependencyOptionalPeer,
+}
+
+// nodejsDependencySections maps each kind of dependency to the
+// section of package.json that declares it.
+var nodejsDependencySections = map[config.DependencyType]string{
+	config.DependencyRegular:      "dependencies",
+	config.DependencyDev:          "devDependencies",
+	config.DependencyPeer:         "peerDependencies",
+	config.DependencyOptional:     "optionalDependencies",
+	config.DependencyOptionalPeer: "peerDependencies",
+}
+
+// nodejsAddCmd appends to cmd the flag, taken from flags, that makes
+// the package manager declare packages as config.Dependency, followed
+// by the packages to add. --prefer-offline is passed on as well.
+func nodejsAddCmd(cmd []string, flags map[config.DependencyType]string, pkgs map[api.PkgName]api.PkgSpec) []string {
+	cmd = withPreferOfflineFlag(cmd)
+	if flag, ok := flags[config.Dependency]; ok {
+		cmd = append(cmd, flag)
+	}
+	for name, spec := range pkgs {
+		arg := string(name)
+		if spec != "" {
+			arg += "@" + string(spec)
+		}
+		cmd = append(cmd, arg)
+	}
+	return cmd
+}
+
+// markOptionalPeers records in the peerDependenciesMeta of
+// package.json that the given peer dependencies are optional, after
+// they have been added, if config.Dependency asks for that. None of
+// the package managers can do this from the command line.
+func markOptionalPeers(pkgs map[api.PkgName]api.PkgSpec) {
+	if config.Dependency != config.DependencyOptionalPeer {
+		return
+	}
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	contentsB, err = setOptionalPeers(contentsB, pkgs)
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
+
+// setOptionalPeers returns the given package.json contents with the
+// packages marked as optional in peerDependenciesMeta.
+func setOptionalPeers(contentsB []byte, pkgs map[api.PkgName]api.PkgSpec) ([]byte, error) {
+	meta := map[string]interface{}{}
+	for name := range pkgs {
+		meta[string(name)] = map[string]bool{"optional": true}
+	}
+	return util.SetJSONObjectValues(contentsB, "peerDependenciesMeta", meta)
+}
+
+// nodejsAddToSpecfile implements AddToSpecfile for the Node.js
+// backends, writing the packages straight into the section of
+// package.json for config.Dependency. Packages without a spec get
+// "*".
+func nodejsAddToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "nodejsAddToSpecfile")
+	defer span.Finish()
+	var contentsB []byte
+	if util.Exists("package.json") {
+		var err error
+		contentsB, err = os.ReadFile("package.json")
+		if err != nil {
+			util.Die("package.json: %s", err)
+		}
+	}
+	contentsB, err := nodejsAddToSpecfileContents(contentsB, pkgs, projectName)
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
+
+// nodejsAddToSpecfileContents implements AddToSpecfileContents for
+// the Node.js backends. A new package.json is given the project name,
+// if any.
+func nodejsAddToSpecfileContents(contentsB []byte, pkgs map[api.PkgName]api.PkgSpec, projectName string) ([]byte, error) {
+	if len(contentsB) == 0 && projectName != "" {
+		nameB, err := json.Marshal(map[string]string{"name": projectName})
+		if err != nil {
+			panic(err)
+		}
+		contentsB = nameB
+	}
+
+	deps := map[string]string{}
+	for name, spec := range pkgs {
+		if spec == "" {
+			spec = "*"
+		}
+		deps[string(name)] = string(spec)
+	}
+
+	contentsB, err := util.SetJSONObjectEntries(contentsB, nodejsDependencySections[config.Dependency], deps)
+	if err != nil {
+		return nil, err
+	}
+	if config.Dependency == config.DependencyOptionalPeer {
+		return setOptionalPeers(contentsB, pkgs)
+	}
+	return contentsB, nil
+}
+
+// nodejsSortedSections are the objects in package.json that
+// nodejsSortSpecfile sorts by package name.
+var nodejsSortedSections = []string{
+	"dependencies",
+	"devDependencies",
+	"peerDependencies",
+	"peerDependenciesMeta",
+	"optionalDependencies",
+}
+
+// nodejsSortSpecfile implements SortSpecfile for all Node.js
+// backends. It sorts the dependency sections the way npm does when it
+// writes package.json itself.
+func nodejsSortSpecfile(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "nodejsSortSpecfile")
+	defer span.Finish()
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	contentsB, err = util.SortJSONObjects(contentsB, nodejsSortedSections)
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
+
+// withWorkspaceManifests returns files followed by the package.json
+// of each workspace member, so that a lockfile check done on a copy
+// of the project sees the whole workspace.
+func withWorkspaceManifests(files []string) []string {
+	members, err := nodejsWorkspaces(".")
+	if err != nil {
+		util.Die("%s", err)
+	}
+	for _, member := range members {
+		files = append(files, filepath.Join(filepath.FromSlash(member), "package.json"))
+	}
+	return files
+}
+
+// npmIsLockfileCurrent implements IsLockfileCurrent for npm, which
+// can bring package-lock.json up to date without installing
+// anything. This is done on a copy, to leave the project alone.
+func npmIsLockfileCurrent(ctx context.Context) bool {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npm install --package-lock-only")
+	defer span.Finish()
+	files := withWorkspaceManifests([]string{"package.json", "package-lock.json", ".npmrc"})
+	return !util.LockfileWouldChange(files, "package-lock.json", func() {
+		util.RunCmd([]string{"npm", "install", "--package-lock-only", "--ignore-scripts", "--no-audit", "--no-fund"})
+	})
+}
+
+// pnpmIsLockfileCurrent implements IsLockfileCurrent for pnpm, in
+// the same way as npmIsLockfileCurrent.
+func pnpmIsLockfileCurrent(ctx context.Context) bool {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pnpm install --lockfile-only")
+	defer span.Finish()
+	files := withWorkspaceManifests([]string{"package.json", "pnpm-lock.yaml", "pnpm-workspace.yaml", ".npmrc"})
+	return !util.LockfileWouldChange(files, "pnpm-lock.yaml", func() {
+		util.RunCmd([]string{"pnpm", "install", "--lockfile-only", "--ignore-scripts"})
+	})
+}
+
+// readPackageJSON reads and parses package.json, terminating the
+// process on error. The dependency maps are never nil.
+func readPackageJSON() packageJSON {
 	contentsB, err := os.ReadFile("package.json")
 	if err != nil {
 		util.Die("package.json: %s", err)
@@ -348,6 +613,49 @@ func nodejsListSpecfile() map[api.PkgName]api.PkgSpec {
 	if err := json.Unmarshal(contentsB, &cfg); err != nil {
 		util.Die("package.json: %s", err)
 	}
+	if cfg.Dependencies == nil {
+		cfg.Dependencies = map[string]string{}
+	}
+	if cfg.DevDependencies == nil {
+		cfg.DevDependencies = map[string]string{}
+	}
+	return cfg
+}
+
+// nodejsRuntimeConstraint implements RuntimeConstraint for the
+// Node.js backends, using the engines field of package.json.
+func nodejsRuntimeConstraint() (string, string) {
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		return "nodejs", ""
+	}
+	var cfg struct {
+		Engines map[string]string `json:"engines"`
+	}
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.Die("package.json: %s", err)
+	}
+	return "nodejs", cfg.Engines["node"]
+}
+
+// nodejsListPackagesForNix returns the packages that package.json
+// depends on, if it exists, for InstallReplitNixSystemDependencies.
+func nodejsListPackagesForNix() []api.PkgName {
+	pkgs := []api.PkgName{}
+	if !util.Exists("package.json") {
+		return pkgs
+	}
+	for name := range nodejsListSpecfile() {
+		pkgs = append(pkgs, name)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i] < pkgs[j] })
+	return pkgs
+}
+
+// nodejsListSpecfile implements ListSpecfile for nodejs-yarn, nodejs-pnpm and
+// nodejs-npm.
+func nodejsListSpecfile() map[api.PkgName]api.PkgSpec {
+	cfg := readPackageJSON()
 	pkgs := map[api.PkgName]api.PkgSpec{}
 	for nameStr, specStr := range cfg.Dependencies {
 		pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
@@ -358,6 +666,64 @@ func nodejsListSpecfile() map[api.PkgName]api.PkgSpec {
 	return pkgs
 }
 
+// nodejsListSpecfileAttributes implements ListSpecfileAttributes for
+// the Node.js backends, reporting the "dev" group of packages in
+// devDependencies.
+func nodejsListSpecfileAttributes() map[api.PkgName]map[string]string {
+	cfg := readPackageJSON()
+	attrs := map[api.PkgName]map[string]string{}
+	for nameStr := range cfg.DevDependencies {
+		group := "dev"
+		if _, ok := cfg.Dependencies[nameStr]; ok {
+			group = "prod, dev"
+		}
+		attrs[api.PkgName(nameStr)] = map[string]string{"group": group}
+	}
+	return attrs
+}
+
+// npmLockfileVersionError returns an error if the lockfileVersion of
+// package-lock.json is one that listNpmLockfileWithContents doesn't
+// understand.
+func npmLockfileVersionError(cfg packageLockJSON) error {
+	return util.LockfileVersionError("package-lock.json", cfg.LockfileVersion, 1, 3)
+}
+
+func listNpmLockfileWithContents(contentsB []byte) map[api.PkgName]api.PkgVersion {
+	var cfg packageLockJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.Die("package-lock.json: %s", err)
+	}
+	util.WarnOrDie(npmLockfileVersionError(cfg))
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	if cfg.LockfileVersion <= 2 {
+		for nameStr, data := range cfg.Dependencies {
+			pkgs[api.PkgName(nameStr)] = api.PkgVersion(data.Version)
+		}
+	} else {
+		for pathStr, data := range cfg.Packages {
+			nameStr := strings.TrimPrefix(pathStr, "node_modules/")
+			pkgs[api.PkgName(nameStr)] = api.PkgVersion(data.Version)
+		}
+	}
+	return pkgs
+}
+
+// npmInstallPackagesCmd returns the npm install command that installs
+// the given packages at the versions locked for them, with --no-save
+// so that package.json and package-lock.json are left alone. Since
+// npm 7, which always builds the whole tree of the lockfile, this
+// also installs any other locked package that is missing; npm has no
+// way to install only some of them.
+func npmInstallPackagesCmd(pkgs map[api.PkgName]bool, locked map[api.PkgName]api.PkgVersion) []string {
+	args := []string{}
+	for name := range pkgs {
+		args = append(args, string(name)+"@"+string(locked[name]))
+	}
+	sort.Strings(args)
+	return append(withPreferOfflineFlag([]string{"npm", "install", "--no-save"}), args...)
+}
+
 // nodejsGuessRegexps is the value of GuessRegexps for nodejs-yarn, nodejs-pnpm and
 // nodejs-npm.
 var nodejsGuessRegexps = util.Regexps([]string{
@@ -398,11 +764,20 @@ var NodejsYarnBackend = api.LanguageBackend{
 		api.QuirksAddRemoveAlsoInstalls |
 		api.QuirksLockAlsoInstalls |
 		api.QuirkRemoveNeedsLockfile,
-	GetPackageDir: func() string {
-		return "node_modules"
-	},
-	Search: nodejsSearch,
-	Info:   nodejsInfo,
+	GetPackageDir:         nodejsGetPackageDir,
+	IsInstallNeeded:       yarnIsInstallNeeded,
+	BinPath:               nodejsBinPath,
+	FetchCmd:              yarnFetchCmd,
+	Search:                nodejsSearch,
+	Info:                  nodejsInfo,
+	PackageSize:           nodejsPackageSize,
+	PopularPackages:       nodejsPopularPackages,
+	AddToSpecfile:         nodejsAddToSpecfile,
+	AddToSpecfileContents: nodejsAddToSpecfileContents,
+	DependencyTypes:       nodejsDependencyTypes,
+	DirectReference:       nodejsDirectReference,
+	RuntimeConstraint:     nodejsRuntimeConstraint,
+	SortSpecfile:          nodejsSortSpecfile,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "yarn (init) add")
@@ -410,15 +785,15 @@ var NodejsYarnBackend = api.LanguageBackend{
 		if !util.Exists("package.json") {
 			util.RunCmd([]string{"yarn", "init", "-y"})
 		}
-		cmd := []string{"yarn", "add"}
-		for name, spec := range pkgs {
-			arg := string(name)
-			if spec != "" {
-				arg += "@" + string(spec)
-			}
-			cmd = append(cmd, arg)
-		}
+		cmd := nodejsAddCmd([]string{"yarn", "add"}, map[config.DependencyType]string{
+			config.DependencyDev:          "--dev",
+			config.DependencyPeer:         "--peer",
+			config.DependencyOptional:     "--optional",
+			config.DependencyOptionalPeer: "--peer",
+		}, pkgs)
 		util.RunCmd(cmd)
+		pinBareAdds(pkgs)
+		markOptionalPeers(pkgs)
 	},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
@@ -435,15 +810,16 @@ var NodejsYarnBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "yarn install")
 		defer span.Finish()
-		util.RunCmd([]string{"yarn", "install"})
+		util.RunCmd(yarnInstallCmd())
 	},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "yarn install")
 		defer span.Finish()
-		util.RunCmd([]string{"yarn", "install"})
+		runNodejsInstall(yarnFrozenInstallCmd(), "yarn.lock")
 	},
-	ListSpecfile: nodejsListSpecfile,
+	ListSpecfile:           nodejsListSpecfile,
+	ListSpecfileAttributes: nodejsListSpecfileAttributes,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		contentsB, err := os.ReadFile("yarn.lock")
 		if err != nil {
@@ -462,7 +838,8 @@ var NodejsYarnBackend = api.LanguageBackend{
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	TypesFor:                           nodejsTypesFor,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.NodejsNixDeps, nodejsListPackagesForNix),
 }
 
 // NodejsPNPMBackend is a UPM backend for Node.js that uses [pnpm](https://pnpm.io/).
@@ -474,12 +851,23 @@ var NodejsPNPMBackend = api.LanguageBackend{
 	FilenamePatterns: nodejsPatterns,
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
-		api.QuirksLockAlsoInstalls,
-	GetPackageDir: func() string {
-		return "node_modules"
-	},
-	Search: nodejsSearch,
-	Info:   nodejsInfo,
+		api.QuirksLockAlsoInstalls |
+		api.QuirksAddSupportsOmit,
+	GetPackageDir:         nodejsGetPackageDir,
+	IsInstallNeeded:       makeNodejsIsInstallNeeded(pnpmStoreIntact),
+	BinPath:               nodejsBinPath,
+	FetchCmd:              makeFetchCmd("pnpm", "dlx"),
+	Search:                nodejsSearch,
+	Info:                  nodejsInfo,
+	PackageSize:           nodejsPackageSize,
+	PopularPackages:       nodejsPopularPackages,
+	AddToSpecfile:         nodejsAddToSpecfile,
+	AddToSpecfileContents: nodejsAddToSpecfileContents,
+	DependencyTypes:       nodejsDependencyTypes,
+	DirectReference:       nodejsDirectReference,
+	RuntimeConstraint:     nodejsRuntimeConstraint,
+	SortSpecfile:          nodejsSortSpecfile,
+	UpgradeCatalog:        pnpmUpgradeCatalog,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "pnpm (init) add")
@@ -488,14 +876,22 @@ var NodejsPNPMBackend = api.LanguageBackend{
 			util.RunCmd([]string{"pnpm", "init"})
 		}
 		cmd := []string{"pnpm", "add"}
-		for name, spec := range pkgs {
-			arg := string(name)
-			if spec != "" {
-				arg += "@" + string(spec)
-			}
-			cmd = append(cmd, arg)
+		switch config.SaveCatalog {
+		case "":
+		case "default":
+			cmd = append(cmd, "--save-catalog")
+		default:
+			cmd = append(cmd, "--save-catalog-name="+config.SaveCatalog)
 		}
+		cmd = nodejsAddCmd(withOmitFlags(cmd, pnpmOmitFlags), map[config.DependencyType]string{
+			config.DependencyDev:          "--save-dev",
+			config.DependencyPeer:         "--save-peer",
+			config.DependencyOptional:     "--save-optional",
+			config.DependencyOptionalPeer: "--save-peer",
+		}, pkgs)
 		util.RunCmd(cmd)
+		pinBareAdds(pkgs)
+		markOptionalPeers(pkgs)
 	},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
@@ -511,15 +907,17 @@ var NodejsPNPMBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "pnpm install")
 		defer span.Finish()
-		util.RunCmd([]string{"pnpm", "install"})
+		util.RunCmd(pnpmInstallCmd())
 	},
+	IsLockfileCurrent: pnpmIsLockfileCurrent,
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "pnpm install")
 		defer span.Finish()
-		util.RunCmd([]string{"pnpm", "install"})
+		runNodejsInstall(pnpmFrozenInstallCmd(), "pnpm-lock.yaml")
 	},
-	ListSpecfile: nodejsListSpecfile,
+	ListSpecfile:           nodejsListSpecfile,
+	ListSpecfileAttributes: nodejsListSpecfileAttributes,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		lockfileBytes, err := os.ReadFile("pnpm-lock.yaml")
 		if err != nil {
@@ -556,7 +954,8 @@ var NodejsPNPMBackend = api.LanguageBackend{
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	TypesFor:                           nodejsTypesFor,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.NodejsNixDeps, nodejsListPackagesForNix),
 }
 
 // NodejsNPMBackend is a UPM backend for Node.js that uses [NPM](https://npmjs.com/).
@@ -568,12 +967,23 @@ var NodejsNPMBackend = api.LanguageBackend{
 	FilenamePatterns: nodejsPatterns,
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
-		api.QuirksLockAlsoInstalls,
-	GetPackageDir: func() string {
-		return "node_modules"
-	},
-	Search: nodejsSearch,
-	Info:   nodejsInfo,
+		api.QuirksLockAlsoInstalls |
+		api.QuirksAddSupportsOmit,
+	GetPackageDir:         nodejsGetPackageDir,
+	IsInstallNeeded:       makeNodejsIsInstallNeeded(npmTreeIntact),
+	InstallHealth:         npmInstallHealth,
+	BinPath:               nodejsBinPath,
+	FetchCmd:              makeFetchCmd("npx", "--yes"),
+	Search:                nodejsSearch,
+	Info:                  nodejsInfo,
+	PackageSize:           nodejsPackageSize,
+	PopularPackages:       nodejsPopularPackages,
+	AddToSpecfile:         nodejsAddToSpecfile,
+	AddToSpecfileContents: nodejsAddToSpecfileContents,
+	DependencyTypes:       nodejsDependencyTypes,
+	DirectReference:       nodejsDirectReference,
+	RuntimeConstraint:     nodejsRuntimeConstraint,
+	SortSpecfile:          nodejsSortSpecfile,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "npm (init) install")
@@ -581,15 +991,15 @@ var NodejsNPMBackend = api.LanguageBackend{
 		if !util.Exists("package.json") {
 			util.RunCmd([]string{"npm", "init", "-y"})
 		}
-		cmd := []string{"npm", "install"}
-		for name, spec := range pkgs {
-			arg := string(name)
-			if spec != "" {
-				arg += "@" + string(spec)
-			}
-			cmd = append(cmd, arg)
-		}
+		cmd := nodejsAddCmd(withOmitFlags([]string{"npm", "install"}, npmOmitFlags), map[config.DependencyType]string{
+			config.DependencyDev:          "--save-dev",
+			config.DependencyPeer:         "--save-peer",
+			config.DependencyOptional:     "--save-optional",
+			config.DependencyOptionalPeer: "--save-peer",
+		}, pkgs)
 		util.RunCmd(cmd)
+		pinBareAdds(pkgs)
+		markOptionalPeers(pkgs)
 	},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
@@ -605,41 +1015,41 @@ var NodejsNPMBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "npm install")
 		defer span.Finish()
-		util.RunCmd([]string{"npm", "install"})
+		util.RunCmd(npmInstallCmd("install"))
 	},
+	IsLockfileCurrent: npmIsLockfileCurrent,
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "npm ci")
 		defer span.Finish()
-		util.RunCmd([]string{"npm", "ci"})
+		runNodejsInstall(npmInstallCmd("ci"), "package-lock.json")
 	},
-	ListSpecfile: nodejsListSpecfile,
-	ListLockfile: func() map[api.PkgName]api.PkgVersion {
+	InstallPackages: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "npm install --no-save")
+		defer span.Finish()
 		contentsB, err := os.ReadFile("package-lock.json")
 		if err != nil {
 			util.Die("package-lock.json: %s", err)
 		}
-		var cfg packageLockJSON
-		if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.RunCmd(npmInstallPackagesCmd(pkgs, listNpmLockfileWithContents(contentsB)))
+	},
+	ListSpecfile:           nodejsListSpecfile,
+	ListSpecfileAttributes: nodejsListSpecfileAttributes,
+	ListLockfile: func() map[api.PkgName]api.PkgVersion {
+		contentsB, err := os.ReadFile("package-lock.json")
+		if err != nil {
 			util.Die("package-lock.json: %s", err)
 		}
-		pkgs := map[api.PkgName]api.PkgVersion{}
-		if cfg.LockfileVersion <= 2 {
-			for nameStr, data := range cfg.Dependencies {
-				pkgs[api.PkgName(nameStr)] = api.PkgVersion(data.Version)
-			}
-		} else {
-			for pathStr, data := range cfg.Packages {
-				nameStr := strings.TrimPrefix(pathStr, "node_modules/")
-				pkgs[api.PkgName(nameStr)] = api.PkgVersion(data.Version)
-			}
-		}
-		return pkgs
+		return listNpmLockfileWithContents(contentsB)
 	},
+	SBOM: npmSBOM,
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	TypesFor:                           nodejsTypesFor,
+	WhyNot:                             npmWhyNot,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.NodejsNixDeps, nodejsListPackagesForNix),
 }
 
 // BunBackend is a UPM backend for Node.js that uses [Bun](https://bun.sh/).
@@ -652,11 +1062,20 @@ var BunBackend = api.LanguageBackend{
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
 		api.QuirksLockAlsoInstalls,
-	GetPackageDir: func() string {
-		return "node_modules"
-	},
-	Search: nodejsSearch,
-	Info:   nodejsInfo,
+	GetPackageDir:         nodejsGetPackageDir,
+	IsInstallNeeded:       makeNodejsIsInstallNeeded(nil),
+	BinPath:               nodejsBinPath,
+	FetchCmd:              makeFetchCmd("bunx"),
+	Search:                nodejsSearch,
+	Info:                  nodejsInfo,
+	PackageSize:           nodejsPackageSize,
+	PopularPackages:       nodejsPopularPackages,
+	AddToSpecfile:         nodejsAddToSpecfile,
+	AddToSpecfileContents: nodejsAddToSpecfileContents,
+	DependencyTypes:       nodejsDependencyTypes,
+	DirectReference:       nodejsDirectReference,
+	RuntimeConstraint:     nodejsRuntimeConstraint,
+	SortSpecfile:          nodejsSortSpecfile,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bun (init) add")
@@ -665,15 +1084,15 @@ var BunBackend = api.LanguageBackend{
 		if !util.Exists("package.json") {
 			util.RunCmd([]string{"bun", "init", "-y"})
 		}
-		cmd := []string{"bun", "add"}
-		for name, spec := range pkgs {
-			arg := string(name)
-			if spec != "" {
-				arg += "@" + string(spec)
-			}
-			cmd = append(cmd, arg)
-		}
-		util.RunCmd(cmd)
+		cmd := nodejsAddCmd([]string{"bun", "add"}, map[config.DependencyType]string{
+			config.DependencyDev:          "--dev",
+			config.DependencyPeer:         "--peer",
+			config.DependencyOptional:     "--optional",
+			config.DependencyOptionalPeer: "--peer",
+		}, pkgs)
+		util.RunCmd(withBunFilter(cmd))
+		pinBareAdds(pkgs)
+		markOptionalPeers(pkgs)
 	},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
@@ -690,15 +1109,16 @@ var BunBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bun install")
 		defer span.Finish()
-		util.RunCmd([]string{"bun", "install"})
+		util.RunCmd(bunInstallCmd())
 	},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bun install")
 		defer span.Finish()
-		util.RunCmd([]string{"bun", "install"})
+		runNodejsInstall(withBunFilter(bunFrozenInstallCmd()), "bun.lockb")
 	},
-	ListSpecfile: nodejsListSpecfile,
+	ListSpecfile:           bunListSpecfile,
+	ListSpecfileAttributes: nodejsListSpecfileAttributes,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		hashString, err := exec.Command("bun", "pm", "hash-string").Output()
 		if err != nil {
@@ -718,5 +1138,6 @@ var BunBackend = api.LanguageBackend{
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	TypesFor:                           nodejsTypesFor,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.NodejsNixDeps, nodejsListPackagesForNix),
 }
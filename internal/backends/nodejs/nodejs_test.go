@@ -2,10 +2,17 @@ package nodejs
 
 import (
 	"context"
+	"encoding/json"
 	"os"
+	"os/exec"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/replit/upm/internal/util"
 )
 
 type TestCase struct {
@@ -202,3 +209,185 @@ func verify(t *testing.T, tc TestCase, extension string) {
 		}
 	}
 }
+
+// offlineProject changes into a fresh directory for the duration of
+// the test, in which no commands can be found on the PATH and any
+// registry request fails the test.
+func offlineProject(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	testutil.Chdir(t, dir)
+
+	t.Setenv("PATH", t.TempDir())
+	testutil.Offline(t)
+
+	return dir
+}
+
+func TestNodejsAddToSpecfile(t *testing.T) {
+	offlineProject(t)
+	writeFile(t, "package.json", `{
+    "name": "app",
+    "dependencies": {
+        "left-pad": "^1.3.0"
+    },
+    "scripts": {
+        "start": "node index.js"
+    }
+}
+`)
+
+	for _, b := range []api.LanguageBackend{NodejsNPMBackend, NodejsPNPMBackend, NodejsYarnBackend, BunBackend} {
+		b.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+			"react":   "^18.2.0",
+			"express": "",
+		}, "")
+	}
+
+	contents, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+    "name": "app",
+    "dependencies": {
+        "left-pad": "^1.3.0",
+        "express": "*",
+        "react": "^18.2.0"
+    },
+    "scripts": {
+        "start": "node index.js"
+    }
+}
+`
+	if string(contents) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, contents)
+	}
+	if util.Exists("node_modules") || util.Exists("package-lock.json") {
+		t.Errorf("expected nothing to be installed or locked")
+	}
+}
+
+func TestNodejsAddToSpecfileDependencyTypes(t *testing.T) {
+	offlineProject(t)
+	writeFile(t, "package.json", `{
+  "name": "lib"
+}
+`)
+	t.Cleanup(func() { config.Dependency = config.DependencyRegular })
+
+	for depType, name := range map[config.DependencyType]api.PkgName{
+		config.DependencyDev:          "typescript",
+		config.DependencyPeer:         "react",
+		config.DependencyOptional:     "fsevents",
+		config.DependencyOptionalPeer: "react-dom",
+	} {
+		config.Dependency = depType
+		NodejsNPMBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+			name: "",
+		}, "")
+	}
+
+	contents, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		DevDependencies      map[string]string          `json:"devDependencies"`
+		PeerDependencies     map[string]string          `json:"peerDependencies"`
+		OptionalDependencies map[string]string          `json:"optionalDependencies"`
+		PeerDependenciesMeta map[string]map[string]bool `json:"peerDependenciesMeta"`
+	}
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DevDependencies["typescript"] != "*" {
+		t.Errorf("expected typescript in devDependencies, got %s", contents)
+	}
+	if cfg.PeerDependencies["react"] != "*" || cfg.PeerDependencies["react-dom"] != "*" {
+		t.Errorf("expected react and react-dom in peerDependencies, got %s", contents)
+	}
+	if cfg.OptionalDependencies["fsevents"] != "*" {
+		t.Errorf("expected fsevents in optionalDependencies, got %s", contents)
+	}
+	if !cfg.PeerDependenciesMeta["react-dom"]["optional"] || cfg.PeerDependenciesMeta["react"]["optional"] {
+		t.Errorf("expected only react-dom to be an optional peer, got %s", contents)
+	}
+}
+
+func TestNodejsAddToSpecfileCreates(t *testing.T) {
+	offlineProject(t)
+
+	NodejsNPMBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"react": "",
+	}, "my-app")
+
+	contents, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"name\": \"my-app\",\n  \"dependencies\": {\n    \"react\": \"*\"\n  }\n}\n"
+	if string(contents) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, contents)
+	}
+}
+
+func TestNpmIsLockfileCurrent(t *testing.T) {
+	if _, err := exec.LookPath("npm"); err != nil {
+		t.Skip("npm is not available")
+	}
+
+	testutil.Chdir(t, t.TempDir())
+
+	writeFile(t, "package.json", `{"name": "lock-check", "version": "1.0.0"}`)
+	writeFile(t, "package-lock.json", `{
+  "name": "lock-check",
+  "version": "1.0.0",
+  "lockfileVersion": 3,
+  "requires": true,
+  "packages": {
+    "": {
+      "name": "lock-check",
+      "version": "1.0.0"
+    }
+  }
+}
+`)
+	if !npmIsLockfileCurrent(context.Background()) {
+		t.Errorf("expected package-lock.json to be up to date")
+	}
+
+	// The version of the project is recorded in the lockfile.
+	writeFile(t, "package.json", `{"name": "lock-check", "version": "2.0.0"}`)
+	if npmIsLockfileCurrent(context.Background()) {
+		t.Errorf("expected package-lock.json to be out of date")
+	}
+	if util.Exists("node_modules") {
+		t.Errorf("expected nothing to be installed")
+	}
+	contents, err := os.ReadFile("package-lock.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `"version": "1.0.0"`) {
+		t.Errorf("expected package-lock.json to be left alone, got:\n%s", contents)
+	}
+}
+
+func TestNpmKeywords(t *testing.T) {
+	tcs := map[string][]string{
+		`{"keywords": ["http", "server"]}`:   {"http", "server"},
+		`{"keywords": "http, server, "}`:     {"http", "server"},
+		`{"keywords": {"unexpected": true}}`: nil,
+	}
+	for contents, expected := range tcs {
+		var info npmInfoResult
+		if err := json.Unmarshal([]byte(contents), &info); err != nil {
+			t.Fatalf("%s: %s", contents, err)
+		}
+		if !reflect.DeepEqual(expected, []string(info.Keywords)) {
+			t.Errorf("%s: expected keywords %v, got %v", contents, expected, info.Keywords)
+		}
+	}
+}
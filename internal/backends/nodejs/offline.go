@@ -0,0 +1,26 @@
+package nodejs
+
+import (
+	"github.com/replit/upm/internal/config"
+)
+
+// withPreferOfflineFlag appends --prefer-offline to cmd, an install or
+// add command, if it was given to upm and the package manager
+// understands it. npm, pnpm and Yarn 1 then use cached packages and
+// metadata without checking whether they are stale. Yarn 2 and later
+// have no such flag, and always install from their cache when they
+// can, as Bun does.
+func withPreferOfflineFlag(cmd []string) []string {
+	if !config.PreferOffline {
+		return cmd
+	}
+	switch cmd[0] {
+	case "npm", "pnpm":
+		cmd = append(cmd, "--prefer-offline")
+	case "yarn":
+		if !yarnIsBerry() {
+			cmd = append(cmd, "--prefer-offline")
+		}
+	}
+	return cmd
+}
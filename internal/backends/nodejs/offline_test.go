@@ -0,0 +1,60 @@
+package nodejs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+func setPreferOffline(t *testing.T, preferOffline bool) {
+	t.Helper()
+	previous := config.PreferOffline
+	config.PreferOffline = preferOffline
+	t.Cleanup(func() { config.PreferOffline = previous })
+}
+
+func TestPreferOfflineFlag(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, false, "")
+	offlineProject(t)
+
+	setPreferOffline(t, false)
+	if cmd := npmInstallCmd("ci"); !reflect.DeepEqual(cmd, []string{"npm", "ci"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+
+	setPreferOffline(t, true)
+	tcs := map[string][]string{
+		"npm":     npmInstallCmd("ci"),
+		"yarn":    yarnInstallCmd(),
+		"pnpm":    pnpmInstallCmd(),
+		"bun":     bunInstallCmd(),
+		"npm add": nodejsAddCmd([]string{"npm", "install"}, nil, map[api.PkgName]api.PkgSpec{"left-pad": ""}),
+	}
+	expected := map[string][]string{
+		"npm":     {"npm", "ci", "--prefer-offline"},
+		"yarn":    {"yarn", "install", "--prefer-offline"},
+		"pnpm":    {"pnpm", "install", "--prefer-offline"},
+		"bun":     {"bun", "install"},
+		"npm add": {"npm", "install", "--prefer-offline", "left-pad"},
+	}
+	for name, cmd := range tcs {
+		if !reflect.DeepEqual(cmd, expected[name]) {
+			t.Errorf("%s: expected %v, got %v", name, expected[name], cmd)
+		}
+	}
+}
+
+func TestPreferOfflineFlag_YarnBerry(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, false, "")
+	offlineProject(t)
+	writeFile(t, "package.json", `{"packageManager": "yarn@4.1.0"}`)
+
+	setPreferOffline(t, true)
+	if cmd := yarnInstallCmd(); !reflect.DeepEqual(cmd, []string{"yarn", "install"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
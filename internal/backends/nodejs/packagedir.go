@@ -0,0 +1,264 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/yaml.v2"
+)
+
+// nodejsGetPackageDir implements GetPackageDir for the Node.js
+// backends. When node_modules is a symlink (as in setups that share
+// a global store, like pnpm or Nix), the link is resolved so that
+// callers get the directory the packages actually live in.
+func nodejsGetPackageDir() string {
+	resolved, err := filepath.EvalSymlinks("node_modules")
+	if err != nil {
+		return "node_modules"
+	}
+	return resolved
+}
+
+// pnpmModulesYAML represents the relevant data in the
+// node_modules/.modules.yaml file written by pnpm.
+type pnpmModulesYAML struct {
+	VirtualStoreDir string `yaml:"virtualStoreDir"`
+}
+
+// hasDanglingLinks returns true if any top-level entry of pkgDir (or
+// of one of its @scope directories) is a symlink whose target no
+// longer exists.
+func hasDanglingLinks(pkgDir string) bool {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return true
+	}
+	for _, entry := range entries {
+		path := filepath.Join(pkgDir, entry.Name())
+		if strings.HasPrefix(entry.Name(), "@") && entry.IsDir() {
+			if hasDanglingLinks(path) {
+				return true
+			}
+			continue
+		}
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pnpmStoreIntact returns true if the pnpm virtual store referenced
+// by pkgDir/.modules.yaml exists.
+func pnpmStoreIntact(pkgDir string) bool {
+	contentsB, err := os.ReadFile(filepath.Join(pkgDir, ".modules.yaml"))
+	if err != nil {
+		return false
+	}
+	var modules pnpmModulesYAML
+	if err := yaml.Unmarshal(contentsB, &modules); err != nil {
+		return false
+	}
+	storeDir := modules.VirtualStoreDir
+	if storeDir == "" {
+		storeDir = ".pnpm"
+	}
+	if !filepath.IsAbs(storeDir) {
+		storeDir = filepath.Join(pkgDir, storeDir)
+	}
+	info, err := os.Stat(storeDir)
+	return err == nil && info.IsDir()
+}
+
+// npmLockedPackage is a package that package-lock.json records for
+// the top-level tree, keyed in npmLockedPackages by its path under
+// node_modules.
+type npmLockedPackage struct {
+	version  string
+	optional bool
+}
+
+// npmLockedPackages returns the packages recorded in cfg, other than
+// development dependencies when those are being omitted.
+func npmLockedPackages(cfg packageLockJSON) map[string]npmLockedPackage {
+	pkgs := map[string]npmLockedPackage{}
+	if cfg.LockfileVersion <= 1 {
+		for name, data := range cfg.Dependencies {
+			pkgs[name] = npmLockedPackage{data.Version, data.Optional}
+		}
+	} else {
+		omitDev := getDevDependencyMode() == devOmit
+		for path, data := range cfg.Packages {
+			// Only packages installed into the top-level
+			// tree are checked; the root entry and workspace
+			// links are skipped.
+			if !strings.HasPrefix(path, "node_modules/") {
+				continue
+			}
+			if omitDev && data.Dev {
+				continue
+			}
+			pkgs[strings.TrimPrefix(path, "node_modules/")] = npmLockedPackage{data.Version, data.Optional}
+		}
+	}
+	return pkgs
+}
+
+// npmTreeIntact returns true if every package recorded in
+// package-lock.json is present under pkgDir, other than development
+// dependencies when those are being omitted. Optional packages are
+// skipped, as in npmInstallHealth.
+func npmTreeIntact(pkgDir string) bool {
+	contentsB, err := os.ReadFile("package-lock.json")
+	if err != nil {
+		return false
+	}
+	var cfg packageLockJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return false
+	}
+	for path, pkg := range npmLockedPackages(cfg) {
+		if pkg.optional {
+			continue
+		}
+		if !util.Exists(filepath.Join(pkgDir, filepath.FromSlash(path))) {
+			return false
+		}
+	}
+	return true
+}
+
+// npmInstallHealth implements InstallHealth for npm. Each package
+// recorded in package-lock.json must be installed, with a readable
+// package.json at the locked version. Optional packages are skipped,
+// since npm leaves out those that don't support the platform.
+func npmInstallHealth(ctx context.Context) (bool, []string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npmInstallHealth")
+	defer span.Finish()
+	pkgDir := nodejsGetPackageDir()
+	if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+		return false, []string{"node_modules is missing"}
+	}
+	contentsB, err := os.ReadFile("package-lock.json")
+	if err != nil {
+		return false, []string{err.Error()}
+	}
+	var cfg packageLockJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return false, []string{fmt.Sprintf("package-lock.json: %s", err)}
+	}
+
+	issues := []string{}
+	if hasDanglingLinks(pkgDir) {
+		issues = append(issues, "node_modules contains links to packages that no longer exist")
+	}
+	locked := npmLockedPackages(cfg)
+	paths := []string{}
+	for path := range locked {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		pkg := locked[path]
+		if pkg.optional {
+			continue
+		}
+		dir := filepath.Join(pkgDir, filepath.FromSlash(path))
+		if !util.Exists(dir) {
+			issues = append(issues, fmt.Sprintf("%s is not installed", path))
+			continue
+		}
+		manifestB, err := os.ReadFile(filepath.Join(dir, "package.json"))
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("%s is incomplete: it has no package.json", path))
+			continue
+		}
+		var manifest struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(manifestB, &manifest); err != nil {
+			issues = append(issues, fmt.Sprintf("%s is corrupt: package.json: %s", path, err))
+			continue
+		}
+		// Versions such as git+https://... or file:...
+		// aren't what the package declares.
+		if pkg.version != "" && !strings.Contains(pkg.version, ":") && manifest.Version != pkg.version {
+			issues = append(issues, fmt.Sprintf("%s %s is installed, but the lockfile has %s", path, manifest.Version, pkg.version))
+		}
+	}
+	return len(issues) == 0, issues
+}
+
+// makeNodejsIsInstallNeeded returns an IsInstallNeeded function for
+// the Node.js backends. The package directory is resolved through
+// any symlinks, and installation is considered necessary if it is
+// missing, contains dangling links, lacks a direct dependency from
+// package.json (development dependencies only count if they aren't
+// being omitted), or fails the backend-specific storeIntact check
+// (if given).
+func makeNodejsIsInstallNeeded(storeIntact func(pkgDir string) bool) func() bool {
+	return func() bool {
+		pkgDir := nodejsGetPackageDir()
+		if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+			return true
+		}
+		if hasDanglingLinks(pkgDir) {
+			return true
+		}
+		if util.Exists("package.json") {
+			cfg := readPackageJSON()
+			required := cfg.Dependencies
+			if getDevDependencyMode() != devOmit {
+				for name, spec := range cfg.DevDependencies {
+					required[name] = spec
+				}
+			}
+			for name := range required {
+				if !util.Exists(filepath.Join(pkgDir, name)) {
+					return true
+				}
+			}
+		}
+		if storeIntact != nil && !storeIntact(pkgDir) {
+			return true
+		}
+		return false
+	}
+}
+
+// yarnPnPFiles are the files in which Yarn's Plug'n'Play linker
+// records where each package is, instead of installing them into
+// node_modules: .pnp.cjs since Yarn 3, and .pnp.js before.
+var yarnPnPFiles = []string{".pnp.cjs", ".pnp.js"}
+
+// yarnIsInstallNeeded implements IsInstallNeeded for Yarn. Projects
+// that use Plug'n'Play have no node_modules, so installation is only
+// considered necessary if package.json or yarn.lock changed since the
+// PnP file was written. Other projects are checked as for the other
+// Node.js backends.
+func yarnIsInstallNeeded() bool {
+	for _, pnp := range yarnPnPFiles {
+		info, err := os.Stat(pnp)
+		if err != nil {
+			continue
+		}
+		for _, file := range []string{"package.json", "yarn.lock"} {
+			if other, err := os.Stat(file); err == nil && other.ModTime().After(info.ModTime()) {
+				return true
+			}
+		}
+		return false
+	}
+	return makeNodejsIsInstallNeeded(nil)()
+}
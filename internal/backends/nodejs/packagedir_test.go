@@ -0,0 +1,229 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/testutil"
+)
+
+// setupSymlinkedProject creates a project whose node_modules is a
+// symlink into a separate store directory containing left-pad, and
+// changes into it for the duration of the test. It returns the store
+// directory.
+func setupSymlinkedProject(t *testing.T) string {
+	t.Helper()
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := filepath.Join(root, "store", "node_modules")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{filepath.Join(store, "left-pad"), project} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(store, "left-pad", "package.json"), `{"name": "left-pad"}`)
+	writeFile(t, filepath.Join(project, "package.json"), `{"dependencies": {"left-pad": "^1.3.0"}}`)
+	if err := os.Symlink(store, filepath.Join(project, "node_modules")); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Chdir(t, project)
+
+	return store
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodejsGetPackageDir_ResolvesSymlink(t *testing.T) {
+	store := setupSymlinkedProject(t)
+
+	if dir := nodejsGetPackageDir(); dir != store {
+		t.Errorf("expected package dir %q, got %q", store, dir)
+	}
+}
+
+func TestNodejsGetPackageDir_NoPackageDir(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	if dir := nodejsGetPackageDir(); dir != "node_modules" {
+		t.Errorf("expected package dir %q, got %q", "node_modules", dir)
+	}
+	if !makeNodejsIsInstallNeeded(nil)() {
+		t.Errorf("expected install to be needed without node_modules")
+	}
+}
+
+func TestNodejsIsInstallNeeded_Symlinked(t *testing.T) {
+	setupSymlinkedProject(t)
+
+	if makeNodejsIsInstallNeeded(nil)() {
+		t.Errorf("expected install not to be needed for intact symlinked store")
+	}
+}
+
+func TestNodejsIsInstallNeeded_MissingDependency(t *testing.T) {
+	store := setupSymlinkedProject(t)
+
+	if err := os.RemoveAll(filepath.Join(store, "left-pad")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !makeNodejsIsInstallNeeded(nil)() {
+		t.Errorf("expected install to be needed when a dependency is missing from the store")
+	}
+}
+
+func TestNodejsIsInstallNeeded_DanglingLink(t *testing.T) {
+	store := setupSymlinkedProject(t)
+
+	if err := os.Symlink(filepath.Join(store, "does-not-exist"), filepath.Join(store, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !makeNodejsIsInstallNeeded(nil)() {
+		t.Errorf("expected install to be needed with a dangling link")
+	}
+}
+
+func TestNodejsIsInstallNeeded_PNPMVirtualStore(t *testing.T) {
+	store := setupSymlinkedProject(t)
+	isInstallNeeded := makeNodejsIsInstallNeeded(pnpmStoreIntact)
+
+	if !isInstallNeeded() {
+		t.Errorf("expected install to be needed without .modules.yaml")
+	}
+
+	writeFile(t, filepath.Join(store, ".modules.yaml"), "virtualStoreDir: .pnpm\n")
+	if !isInstallNeeded() {
+		t.Errorf("expected install to be needed without a virtual store")
+	}
+
+	if err := os.Mkdir(filepath.Join(store, ".pnpm"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if isInstallNeeded() {
+		t.Errorf("expected install not to be needed with an intact virtual store")
+	}
+}
+
+func TestNodejsIsInstallNeeded_NPMLockfile(t *testing.T) {
+	setupSymlinkedProject(t)
+	isInstallNeeded := makeNodejsIsInstallNeeded(npmTreeIntact)
+
+	writeFile(t, "package-lock.json", `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"dependencies": {"left-pad": "^1.3.0"}},
+			"node_modules/left-pad": {"version": "1.3.0"}
+		}
+	}`)
+	if isInstallNeeded() {
+		t.Errorf("expected install not to be needed when the lockfile matches the store")
+	}
+
+	writeFile(t, "package-lock.json", `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"dependencies": {"left-pad": "^1.3.0"}},
+			"node_modules/left-pad": {"version": "1.3.0"},
+			"node_modules/is-odd": {"version": "3.0.1"}
+		}
+	}`)
+	if !isInstallNeeded() {
+		t.Errorf("expected install to be needed when a locked package is missing")
+	}
+
+	// npm leaves out optional packages that don't support the
+	// platform.
+	writeFile(t, "package-lock.json", `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"dependencies": {"left-pad": "^1.3.0"}},
+			"node_modules/left-pad": {"version": "1.3.0"},
+			"node_modules/fsevents": {"version": "2.3.3", "optional": true}
+		}
+	}`)
+	if isInstallNeeded() {
+		t.Errorf("expected install not to be needed when only an optional package is missing")
+	}
+}
+
+func TestYarnIsInstallNeeded_PnP(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	writeFile(t, "package.json", `{"dependencies": {"left-pad": "^1.3.0"}}`)
+	writeFile(t, "yarn.lock", "")
+	if !yarnIsInstallNeeded() {
+		t.Errorf("expected install to be needed without node_modules or .pnp.cjs")
+	}
+
+	// Plug'n'Play installs have no node_modules.
+	writeFile(t, ".pnp.cjs", "")
+	past := time.Now().Add(-time.Hour)
+	for _, file := range []string{"package.json", "yarn.lock"} {
+		if err := os.Chtimes(file, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if yarnIsInstallNeeded() {
+		t.Errorf("expected install not to be needed with an up-to-date .pnp.cjs")
+	}
+
+	writeFile(t, "yarn.lock", "# changed\n")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("yarn.lock", future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !yarnIsInstallNeeded() {
+		t.Errorf("expected install to be needed when yarn.lock is newer than .pnp.cjs")
+	}
+}
+
+func TestNPMInstallHealth(t *testing.T) {
+	setDevDependencyConfig(t, false, "")
+	testutil.Chdir(t, "testdata/broken-install")
+
+	ok, issues := npmInstallHealth(context.Background())
+	if ok {
+		t.Errorf("expected the install to be reported as broken")
+	}
+	// fsevents is optional, so its absence isn't a problem.
+	expected := []string{
+		"@acme/half is incomplete: it has no package.json",
+		"chalk 5.2.0 is installed, but the lockfile has 5.3.0",
+		"left-pad is not installed",
+	}
+	if !reflect.DeepEqual(expected, issues) {
+		t.Errorf("expected %q, got %q", expected, issues)
+	}
+}
+
+func TestNPMInstallHealth_Intact(t *testing.T) {
+	store := setupSymlinkedProject(t)
+	writeFile(t, filepath.Join(store, "left-pad", "package.json"), `{"name": "left-pad", "version": "1.3.0"}`)
+	writeFile(t, "package-lock.json", `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"dependencies": {"left-pad": "^1.3.0"}},
+			"node_modules/left-pad": {"version": "1.3.0"}
+		}
+	}`)
+
+	if ok, issues := npmInstallHealth(context.Background()); !ok {
+		t.Errorf("expected the install to be healthy, got %q", issues)
+	}
+}
@@ -0,0 +1,65 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// packagePeers represents the fields of a package.json, or of a
+// version in the registry, that declare peer dependencies.
+type packagePeers struct {
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	PeerDependenciesMeta map[string]struct {
+		Optional bool `json:"optional"`
+	} `json:"peerDependenciesMeta"`
+}
+
+// split returns the required and the optional peer dependencies, each
+// as a sorted list of "name constraint" entries. A package that is
+// only listed in peerDependenciesMeta is an optional peer of any
+// version, as npm treats it.
+func (p packagePeers) split() ([]string, []string) {
+	required := []string{}
+	optional := []string{}
+	for name, constraint := range p.PeerDependencies {
+		if p.PeerDependenciesMeta[name].Optional {
+			optional = append(optional, name+" "+constraint)
+		} else {
+			required = append(required, name+" "+constraint)
+		}
+	}
+	for name, meta := range p.PeerDependenciesMeta {
+		if _, ok := p.PeerDependencies[name]; !ok && meta.Optional {
+			optional = append(optional, name+" *")
+		}
+	}
+	sort.Strings(required)
+	sort.Strings(optional)
+	return required, optional
+}
+
+// addPeerInfo fills in the peer dependencies of info from the given
+// package.json or registry version contents, leaving info alone if
+// they can't be parsed.
+func addPeerInfo(info *api.PkgInfo, contentsB []byte) {
+	var peers packagePeers
+	if err := json.Unmarshal(contentsB, &peers); err != nil {
+		return
+	}
+	info.PeerDependencies, info.OptionalPeerDependencies = peers.split()
+}
+
+// addInstalledPeerInfo fills in the peer dependencies of info from
+// the package.json of the installed copy of the named package in
+// pkgDir, if there is one.
+func addInstalledPeerInfo(info *api.PkgInfo, pkgDir string, name api.PkgName) {
+	contentsB, err := os.ReadFile(filepath.Join(pkgDir, string(name), "package.json"))
+	if err != nil {
+		return
+	}
+	addPeerInfo(info, contentsB)
+}
@@ -0,0 +1,83 @@
+package nodejs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+var (
+	expectedPeers = []string{
+		"react ^17.0.0 || ^18.0.0",
+		"react-dom ^17.0.0 || ^18.0.0",
+	}
+	expectedOptionalPeers = []string{
+		"@types/react *",
+		"sass *",
+		"typescript >=4.7",
+	}
+)
+
+func TestAddInstalledPeerInfo(t *testing.T) {
+	info := api.PkgInfo{}
+	addInstalledPeerInfo(&info, "testdata/installed/node_modules", "peer-pkg")
+
+	if !reflect.DeepEqual(expectedPeers, info.PeerDependencies) {
+		t.Errorf("expected peers %v, got %v", expectedPeers, info.PeerDependencies)
+	}
+	if !reflect.DeepEqual(expectedOptionalPeers, info.OptionalPeerDependencies) {
+		t.Errorf("expected optional peers %v, got %v", expectedOptionalPeers, info.OptionalPeerDependencies)
+	}
+}
+
+func TestAddInstalledPeerInfoNoPeers(t *testing.T) {
+	info := api.PkgInfo{}
+	addInstalledPeerInfo(&info, "testdata/installed/node_modules", "@acme/cli")
+
+	if len(info.PeerDependencies) != 0 || len(info.OptionalPeerDependencies) != 0 {
+		t.Errorf("expected no peers, got %+v", info)
+	}
+}
+
+func TestNodejsInfoPeers(t *testing.T) {
+	registry, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry = filepath.Join(registry, "testdata", "peer-pkg-registry.json")
+	offlineProject(t)
+	testutil.ServeFiles(t, map[string]string{"https://registry.npmjs.org/peer-pkg": registry})
+
+	// The peers are those of the latest stable version.
+	info := nodejsInfo("peer-pkg")
+	if info.Version != "1.4.0" {
+		t.Errorf("expected version 1.4.0, got %q", info.Version)
+	}
+	if !reflect.DeepEqual(expectedPeers, info.PeerDependencies) {
+		t.Errorf("expected peers %v, got %v", expectedPeers, info.PeerDependencies)
+	}
+	if !reflect.DeepEqual(expectedOptionalPeers, info.OptionalPeerDependencies) {
+		t.Errorf("expected optional peers %v, got %v", expectedOptionalPeers, info.OptionalPeerDependencies)
+	}
+	if expected := []string{"react", "components", "ui"}; !reflect.DeepEqual(expected, info.Keywords) {
+		t.Errorf("expected keywords %v, got %v", expected, info.Keywords)
+	}
+}
+
+func TestNodejsInfoInstalledOnlyPeers(t *testing.T) {
+	testutil.Chdir(t, "testdata/installed")
+
+	testutil.Serve(t, nil)
+
+	info := nodejsInfo("peer-pkg")
+	if !reflect.DeepEqual(expectedPeers, info.PeerDependencies) {
+		t.Errorf("expected peers %v, got %v", expectedPeers, info.PeerDependencies)
+	}
+	if !reflect.DeepEqual(expectedOptionalPeers, info.OptionalPeerDependencies) {
+		t.Errorf("expected optional peers %v, got %v", expectedOptionalPeers, info.OptionalPeerDependencies)
+	}
+}
@@ -0,0 +1,87 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// distTag matches dist-tags such as "latest" or "next".
+var distTag = regexp.MustCompile(`^[A-Za-z][A-Za-z-]+$`)
+
+// unpinnedSpec matches the package.json constraints that don't say
+// which versions of a package the project works with: an empty
+// constraint, a wildcard, or a dist-tag.
+var unpinnedSpec = regexp.MustCompile(`^(|\*|[xX]|[A-Za-z][A-Za-z-]+)$`)
+
+// pinBareAdds replaces the constraint that was just written to
+// package.json for each package added without a spec, or with a
+// dist-tag, by a caret range of the version that was actually
+// installed, if the package manager left a wildcard or the tag itself
+// there. npm, Yarn and pnpm already save "^x.y.z" by default, but Bun
+// saves a requested dist-tag verbatim, and a stray save-prefix in an
+// .npmrc can yield "*". Exact versions written because of save-exact
+// are left alone, and so is a wildcard that was asked for explicitly.
+func pinBareAdds(pkgs map[api.PkgName]api.PkgSpec) {
+	section := nodejsDependencySections[config.Dependency]
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	pins, err := unpinnedAdds(contentsB, section, pkgs, nodejsGetPackageDir())
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	if len(pins) == 0 {
+		return
+	}
+	contentsB, err = util.SetJSONObjectEntries(contentsB, section, pins)
+	if err != nil {
+		util.Die("package.json: %s", err)
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
+
+// unpinnedAdds returns, for each of the added packages that was
+// requested without a spec or by dist-tag and whose constraint in
+// section of the given package.json contents is unpinned, a caret
+// range of the version installed in pkgDir. Packages that aren't
+// installed there, as with Yarn's Plug'n'Play, are skipped.
+func unpinnedAdds(contentsB []byte, section string, pkgs map[api.PkgName]api.PkgSpec, pkgDir string) (map[string]string, error) {
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return nil, err
+	}
+	declared := map[string]string{}
+	if raw, ok := cfg[section]; ok {
+		if err := json.Unmarshal(raw, &declared); err != nil {
+			return nil, err
+		}
+	}
+
+	pins := map[string]string{}
+	for name, spec := range pkgs {
+		if spec != "" && !distTag.MatchString(string(spec)) {
+			continue
+		}
+		constraint, ok := declared[string(name)]
+		if !ok || !unpinnedSpec.MatchString(constraint) {
+			continue
+		}
+		installedB, err := os.ReadFile(filepath.Join(pkgDir, string(name), "package.json"))
+		if err != nil {
+			continue
+		}
+		var installed installedPackageJSON
+		if json.Unmarshal(installedB, &installed) != nil || installed.Version == "" {
+			continue
+		}
+		pins[string(name)] = "^" + installed.Version
+	}
+	return pins, nil
+}
@@ -0,0 +1,106 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// installFake writes node_modules/<name>/package.json for the given
+// version, as a package manager would have.
+func installFake(t *testing.T, name, version string) {
+	t.Helper()
+	dir := filepath.Join("node_modules", name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "package.json"), `{"name": "`+name+`", "version": "`+version+`"}`)
+}
+
+func readDependencies(t *testing.T) map[string]string {
+	t.Helper()
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg packageJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Dependencies
+}
+
+func TestPinBareAdds(t *testing.T) {
+	setDevDependencyConfig(t, false, "")
+	offlineProject(t)
+	writeFile(t, "package.json", `{
+    "name": "app",
+    "dependencies": {
+        "lodash": "*",
+        "next": "canary",
+        "left-pad": "1.3.0",
+        "react": "latest",
+        "chalk": "*",
+        "web": "workspace:*"
+    }
+}`)
+	installFake(t, "lodash", "4.17.21")
+	installFake(t, "next", "15.0.0-canary.1")
+	installFake(t, "left-pad", "1.3.0")
+	installFake(t, "react", "18.3.1")
+	installFake(t, "chalk", "5.3.0")
+
+	pinBareAdds(map[api.PkgName]api.PkgSpec{
+		"lodash":   "",
+		"next":     "canary",
+		"left-pad": "",
+		"react":    "^18",
+		"chalk":    "*",
+		"web":      "",
+	})
+
+	expected := map[string]string{
+		"lodash":   "^4.17.21",
+		"next":     "^15.0.0-canary.1",
+		"left-pad": "1.3.0",
+		"react":    "latest",
+		"chalk":    "*",
+		"web":      "workspace:*",
+	}
+	deps := readDependencies(t)
+	for name, constraint := range expected {
+		if deps[name] != constraint {
+			t.Errorf("%s: expected %q, got %q", name, constraint, deps[name])
+		}
+	}
+}
+
+func TestNpmBareAddWritesCaret(t *testing.T) {
+	setDevDependencyConfig(t, false, "")
+	binDir := filepath.Join(offlineProject(t), "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+
+	// A misconfigured save-prefix makes npm write "*" for a bare add.
+	writeFile(t, filepath.Join(binDir, "npm"), `#!/bin/sh
+mkdir -p node_modules/lodash
+echo '{"name": "lodash", "version": "4.17.21"}' > node_modules/lodash/package.json
+echo '{"name": "app", "dependencies": {"lodash": "*"}}' > package.json
+`)
+	if err := os.Chmod(filepath.Join(binDir, "npm"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "package.json", `{"name": "app"}`)
+
+	NodejsNPMBackend.Add(context.Background(), map[api.PkgName]api.PkgSpec{"lodash": ""}, "")
+
+	if constraint := readDependencies(t)["lodash"]; constraint != "^4.17.21" {
+		t.Errorf("expected ^4.17.21, got %q", constraint)
+	}
+}
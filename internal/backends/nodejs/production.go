@@ -0,0 +1,127 @@
+package nodejs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// devDependencyMode says whether an install should include the
+// development dependencies listed in package.json.
+type devDependencyMode int
+
+const (
+	// devDefault means nothing was requested, so the package
+	// manager's own default applies (normally, install them).
+	devDefault devDependencyMode = iota
+
+	// devOmit means development dependencies are skipped.
+	devOmit
+
+	// devInclude means development dependencies are installed
+	// even though NODE_ENV=production.
+	devInclude
+)
+
+// getDevDependencyMode decides whether development dependencies are
+// installed. The precedence, from highest to lowest, is:
+//
+//  1. --only=prod or --only=dev
+//  2. --production
+//  3. NODE_ENV=production, which npm itself also honors
+func getDevDependencyMode() devDependencyMode {
+	switch config.Only {
+	case "prod":
+		return devOmit
+	case "dev":
+		return devInclude
+	}
+	if config.Production || os.Getenv("NODE_ENV") == "production" {
+		return devOmit
+	}
+	return devDefault
+}
+
+// withDevDependencyFlags appends the flags that make a package
+// manager honor getDevDependencyMode to cmd. The omit and include
+// arguments are the flags for the respective modes, and either may
+// be empty if the package manager doesn't need one.
+func withDevDependencyFlags(cmd []string, omit string, include string) []string {
+	switch getDevDependencyMode() {
+	case devOmit:
+		if omit != "" {
+			cmd = append(cmd, omit)
+		}
+	case devInclude:
+		if include != "" {
+			cmd = append(cmd, include)
+		}
+	}
+	return cmd
+}
+
+// withOmitFlags appends to cmd the flags, taken from flags, that make
+// the package manager skip installing each kind of dependency in
+// config.Omit. Kinds it can't skip are warned about.
+func withOmitFlags(cmd []string, flags map[config.DependencyType]string) []string {
+	for _, depType := range config.Omit {
+		flag, ok := flags[depType]
+		if !ok {
+			util.Warn(context.Background(), util.Warning{
+				Code:    util.WarningUnsupportedOption,
+				Message: fmt.Sprintf("%s can't omit %s dependencies; they will be installed", cmd[0], depType),
+			})
+			continue
+		}
+		cmd = append(cmd, flag)
+	}
+	return cmd
+}
+
+// npmOmitFlags are the flags of npm install for config.Omit.
+var npmOmitFlags = map[config.DependencyType]string{
+	config.DependencyDev:      "--omit=dev",
+	config.DependencyOptional: "--omit=optional",
+	config.DependencyPeer:     "--omit=peer",
+}
+
+// pnpmOmitFlags are the flags of pnpm add for config.Omit. pnpm
+// always installs peer dependencies as needed.
+var pnpmOmitFlags = map[config.DependencyType]string{
+	config.DependencyDev:      "--prod",
+	config.DependencyOptional: "--no-optional",
+}
+
+func npmInstallCmd(subcommand string) []string {
+	return withPreferOfflineFlag(withDevDependencyFlags([]string{"npm", subcommand}, "--omit=dev", "--include=dev"))
+}
+
+// yarnInstallCmd returns the yarn install command. Yarn 2 and later
+// reject --production and always install development dependencies,
+// which only yarn workspaces focus --production can leave out, so
+// asking them to omit those is warned about instead.
+func yarnInstallCmd() []string {
+	cmd := []string{"yarn", "install"}
+	if !yarnIsBerry() {
+		cmd = withDevDependencyFlags(cmd, "--production=true", "--production=false")
+	} else if getDevDependencyMode() == devOmit {
+		util.Warn(context.Background(), util.Warning{
+			Code:    util.WarningUnsupportedOption,
+			Message: "yarn 2 and later can't omit dev dependencies on install; they will be installed (yarn workspaces focus --production can leave them out)",
+		})
+	}
+	return withPreferOfflineFlag(cmd)
+}
+
+func pnpmInstallCmd() []string {
+	return withPreferOfflineFlag(withDevDependencyFlags([]string{"pnpm", "install"}, "--prod", "--prod=false"))
+}
+
+func bunInstallCmd() []string {
+	// Bun installs development dependencies unless told
+	// otherwise, regardless of NODE_ENV.
+	return withDevDependencyFlags([]string{"bun", "install"}, "--production", "")
+}
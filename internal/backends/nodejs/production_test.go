@@ -0,0 +1,191 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+func setDevDependencyConfig(t *testing.T, production bool, only string) {
+	t.Helper()
+	origProduction, origOnly := config.Production, config.Only
+	config.Production, config.Only = production, only
+	t.Cleanup(func() {
+		config.Production, config.Only = origProduction, origOnly
+	})
+}
+
+func TestInstallCmd_Default(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, false, "")
+
+	if cmd := npmInstallCmd("ci"); !reflect.DeepEqual(cmd, []string{"npm", "ci"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
+
+func TestInstallCmd_NodeEnvProduction(t *testing.T) {
+	t.Setenv("NODE_ENV", "production")
+	setDevDependencyConfig(t, false, "")
+
+	tcs := map[string][]string{
+		"npm":  npmInstallCmd("ci"),
+		"yarn": yarnInstallCmd(),
+		"pnpm": pnpmInstallCmd(),
+		"bun":  bunInstallCmd(),
+	}
+	expected := map[string][]string{
+		"npm":  {"npm", "ci", "--omit=dev"},
+		"yarn": {"yarn", "install", "--production=true"},
+		"pnpm": {"pnpm", "install", "--prod"},
+		"bun":  {"bun", "install", "--production"},
+	}
+	for name, cmd := range tcs {
+		if !reflect.DeepEqual(cmd, expected[name]) {
+			t.Errorf("%s: expected %v, got %v", name, expected[name], cmd)
+		}
+	}
+}
+
+func TestInstallCmd_ProductionFlag(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, true, "")
+
+	if cmd := npmInstallCmd("install"); !reflect.DeepEqual(cmd, []string{"npm", "install", "--omit=dev"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
+
+func TestInstallCmd_OnlyOverridesNodeEnv(t *testing.T) {
+	t.Setenv("NODE_ENV", "production")
+	setDevDependencyConfig(t, true, "dev")
+
+	tcs := map[string][]string{
+		"npm":  npmInstallCmd("ci"),
+		"yarn": yarnInstallCmd(),
+		"pnpm": pnpmInstallCmd(),
+		"bun":  bunInstallCmd(),
+	}
+	expected := map[string][]string{
+		"npm":  {"npm", "ci", "--include=dev"},
+		"yarn": {"yarn", "install", "--production=false"},
+		"pnpm": {"pnpm", "install", "--prod=false"},
+		"bun":  {"bun", "install"},
+	}
+	for name, cmd := range tcs {
+		if !reflect.DeepEqual(cmd, expected[name]) {
+			t.Errorf("%s: expected %v, got %v", name, expected[name], cmd)
+		}
+	}
+}
+
+func TestInstallCmd_YarnBerry(t *testing.T) {
+	t.Setenv("NODE_ENV", "production")
+	offlineProject(t)
+	writeFile(t, "package.json", `{"packageManager": "yarn@4.1.0"}`)
+
+	// Yarn 2 and later reject --production, so omitting dev
+	// dependencies is only warned about.
+	for _, only := range []string{"", "prod", "dev"} {
+		setDevDependencyConfig(t, false, only)
+		_, warnings := util.WithWarnings(context.Background())
+		if cmd := yarnInstallCmd(); !reflect.DeepEqual(cmd, []string{"yarn", "install"}) {
+			t.Errorf("--only=%q: unexpected command %v", only, cmd)
+		}
+		if omitted := only != "dev"; (len(warnings.List()) == 1) != omitted {
+			t.Errorf("--only=%q: unexpected warnings %v", only, warnings.List())
+		}
+	}
+}
+
+func TestInstallCmd_OnlyProd(t *testing.T) {
+	t.Setenv("NODE_ENV", "development")
+	setDevDependencyConfig(t, false, "prod")
+
+	if cmd := npmInstallCmd("ci"); !reflect.DeepEqual(cmd, []string{"npm", "ci", "--omit=dev"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
+
+// fakePackageManager puts an executable of the given name on PATH
+// that records its arguments, one per line, in args.txt.
+func fakePackageManager(t *testing.T, name string) {
+	t.Helper()
+	binDir := filepath.Join(offlineProject(t), "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+	writeFile(t, filepath.Join(binDir, name), "#!/bin/sh\nprintf '%s\\n' \"$@\" > args.txt\n")
+	if err := os.Chmod(filepath.Join(binDir, name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "package.json", `{"name": "app"}`)
+}
+
+func TestAddCmd_Omit(t *testing.T) {
+	t.Setenv("NODE_ENV", "")
+	setDevDependencyConfig(t, false, "")
+	origOmit := config.Omit
+	t.Cleanup(func() { config.Omit = origOmit })
+	config.Omit = []config.DependencyType{config.DependencyOptional, config.DependencyPeer}
+
+	tcs := map[string]struct {
+		backend  api.LanguageBackend
+		expected []string
+	}{
+		"npm":  {NodejsNPMBackend, []string{"install", "--omit=optional", "--omit=peer", "left-pad"}},
+		"pnpm": {NodejsPNPMBackend, []string{"add", "--no-optional", "left-pad"}},
+	}
+	for name, tc := range tcs {
+		fakePackageManager(t, name)
+		tc.backend.Add(context.Background(), map[api.PkgName]api.PkgSpec{"left-pad": ""}, "")
+
+		contentsB, err := os.ReadFile("args.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := strings.Fields(string(contentsB))
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, args)
+		}
+	}
+}
+
+func TestNpmInstallPackages(t *testing.T) {
+	fakePackageManager(t, "npm")
+	writeFile(t, "package.json", `{"name": "app", "dependencies": {"left-pad": "^1.3.0", "zod": "^3.22.0"}}`)
+	writeFile(t, "package-lock.json", `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app"},
+    "node_modules/left-pad": {"version": "1.3.0"},
+    "node_modules/zod": {"version": "3.22.4"}
+  }
+}`)
+
+	NodejsNPMBackend.InstallPackages(context.Background(), map[api.PkgName]bool{"left-pad": true})
+
+	contentsB, err := os.ReadFile("args.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"install", "--no-save", "left-pad@1.3.0"}
+	if args := strings.Fields(string(contentsB)); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+	contentsB, err = os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contentsB) != `{"name": "app", "dependencies": {"left-pad": "^1.3.0", "zod": "^3.22.0"}}` {
+		t.Errorf("package.json changed: %s", contentsB)
+	}
+}
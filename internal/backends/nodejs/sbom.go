@@ -0,0 +1,226 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmLockPackage is an entry of the packages object of a
+// package-lock.json file (lockfileVersion 2 and later), with the data
+// needed for an SBOM.
+type npmLockPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// Workspace members are linked from node_modules, and listed
+	// under the path that the link resolves to.
+	Link     bool   `json:"link"`
+	Resolved string `json:"resolved"`
+
+	// npm copies the license field of package.json, which is
+	// normally a string but was once allowed to be an object.
+	License interface{} `json:"license"`
+
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+}
+
+// npmLockDependency is an entry of the dependencies object of a
+// package-lock.json file with lockfileVersion 1.
+type npmLockDependency struct {
+	Version  string            `json:"version"`
+	Requires map[string]string `json:"requires"`
+}
+
+// npmSBOMLock represents the data in a package-lock.json file that an
+// SBOM is built from.
+type npmSBOMLock struct {
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Packages        map[string]npmLockPackage    `json:"packages"`
+	Dependencies    map[string]npmLockDependency `json:"dependencies"`
+}
+
+// npmPackageName returns the name of the package at path in the
+// packages object of package-lock.json, e.g. "@scope/name" for
+// "node_modules/a/node_modules/@scope/name".
+func npmPackageName(path string, data npmLockPackage) string {
+	if data.Name != "" {
+		return data.Name
+	}
+	if idx := strings.LastIndex(path, "node_modules/"); idx >= 0 {
+		return path[idx+len("node_modules/"):]
+	}
+	return path
+}
+
+// resolveNpmPackage returns the path, in the packages object of
+// package-lock.json, of the package that name resolves to when
+// required from the package at from. Like Node.js, it looks in the
+// node_modules of from and then of each enclosing package.
+func resolveNpmPackage(packages map[string]npmLockPackage, from string, name string) (string, bool) {
+	dir := from
+	for {
+		path := "node_modules/" + name
+		if dir != "" {
+			path = dir + "/" + path
+		}
+		if _, ok := packages[path]; ok {
+			return path, true
+		}
+		if dir == "" {
+			return "", false
+		}
+		if idx := strings.LastIndex(dir, "/node_modules/"); idx >= 0 {
+			dir = dir[:idx]
+		} else {
+			dir = ""
+		}
+	}
+}
+
+// npmLicense returns the license of a package as npm recorded it,
+// or an empty string.
+func npmLicense(license interface{}) string {
+	switch license := license.(type) {
+	case string:
+		return license
+	case map[string]interface{}:
+		if licenseType, ok := license["type"].(string); ok {
+			return licenseType
+		}
+	}
+	return ""
+}
+
+// npmSBOMComponents returns the components of an SBOM for the given
+// package-lock.json contents, and the project itself as the root if
+// the lockfile names it. Licenses are only known from lockfileVersion
+// 2 on, since earlier lockfiles don't record them. A package that npm
+// installed at several paths, for lack of a single place in the tree
+// that all its dependents can share, is one component, depending on
+// what each of its copies does.
+func npmSBOMComponents(contentsB []byte) (*pkg.SBOMComponent, []pkg.SBOMComponent, error) {
+	var cfg npmSBOMLock
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		return nil, nil, err
+	}
+	util.WarnOrDie(npmLockfileVersionError(packageLockJSON{LockfileVersion: cfg.LockfileVersion}))
+
+	var root *pkg.SBOMComponent
+	components := []pkg.SBOMComponent{}
+	if cfg.LockfileVersion <= 1 {
+		for name, data := range cfg.Dependencies {
+			component := pkg.SBOMComponent{
+				Name:    name,
+				Version: data.Version,
+				PURL:    pkg.PackageURL("npm", name, data.Version),
+			}
+			for dependency := range data.Requires {
+				if dependencyData, ok := cfg.Dependencies[dependency]; ok {
+					component.DependsOn = append(component.DependsOn, pkg.PackageURL("npm", dependency, dependencyData.Version))
+				}
+			}
+			components = append(components, component)
+		}
+		return root, components, nil
+	}
+
+	purls := map[string]string{}
+	paths := []string{}
+	for path, data := range cfg.Packages {
+		purls[path] = pkg.PackageURL("npm", npmPackageName(path, data), data.Version)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	byPURL := map[string]int{}
+	for _, path := range paths {
+		data := cfg.Packages[path]
+		if data.Link {
+			continue
+		}
+		component := pkg.SBOMComponent{
+			Name:    npmPackageName(path, data),
+			Version: data.Version,
+			License: npmLicense(data.License),
+			PURL:    purls[path],
+		}
+		for _, deps := range []map[string]string{
+			data.Dependencies,
+			data.DevDependencies,
+			data.OptionalDependencies,
+			data.PeerDependencies,
+		} {
+			for dependency := range deps {
+				if resolved, ok := resolveNpmPackage(cfg.Packages, path, dependency); ok {
+					if target := cfg.Packages[resolved]; target.Link {
+						resolved = target.Resolved
+					}
+					component.DependsOn = append(component.DependsOn, purls[resolved])
+				}
+			}
+		}
+		if path == "" {
+			if component.Name != "" {
+				root = &component
+			}
+			continue
+		}
+		if i, ok := byPURL[component.PURL]; ok {
+			components[i].DependsOn = append(components[i].DependsOn, component.DependsOn...)
+			continue
+		}
+		byPURL[component.PURL] = len(components)
+		components = append(components, component)
+	}
+	if root != nil {
+		root.DependsOn = uniqueStrings(root.DependsOn)
+	}
+	for i := range components {
+		components[i].DependsOn = uniqueStrings(components[i].DependsOn)
+	}
+	return root, components, nil
+}
+
+// uniqueStrings returns the distinct strings of list, sorted, or nil
+// if there are none.
+func uniqueStrings(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// npmSBOM implements SBOM for nodejs-npm.
+func npmSBOM(ctx context.Context, format string) ([]byte, error) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npmSBOM")
+	defer span.Finish()
+	contentsB, err := os.ReadFile("package-lock.json")
+	if err != nil {
+		return nil, err
+	}
+	root, components, err := npmSBOMComponents(contentsB)
+	if err != nil {
+		return nil, fmt.Errorf("package-lock.json: %s", err)
+	}
+	return pkg.SBOM(format, root, components)
+}
@@ -0,0 +1,137 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/replit/upm/internal/pkg"
+)
+
+func TestNpmSBOMComponents(t *testing.T) {
+	contents, err := os.ReadFile("testdata/sbom/package-lock.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, components, err := npmSBOMComponents(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if root == nil || root.PURL != "pkg:npm/my-app@1.0.0" {
+		t.Fatalf("unexpected root %v", root)
+	}
+	sort.Strings(root.DependsOn)
+	expectedRoot := []string{
+		"pkg:npm/%40types/node@18.19.3",
+		"pkg:npm/debug@4.3.4",
+		"pkg:npm/ms@2.0.0",
+		"pkg:npm/util@0.1.0",
+	}
+	if !reflect.DeepEqual(root.DependsOn, expectedRoot) {
+		t.Errorf("root depends on %v, expected %v", root.DependsOn, expectedRoot)
+	}
+
+	byPURL := map[string]pkg.SBOMComponent{}
+	for _, component := range components {
+		byPURL[component.PURL] = component
+	}
+	if len(byPURL) != 5 {
+		t.Errorf("expected 5 components, got %v", byPURL)
+	}
+
+	// debug resolves ms to its own nested copy, not the top-level
+	// one.
+	if deps := byPURL["pkg:npm/debug@4.3.4"].DependsOn; !reflect.DeepEqual(deps, []string{"pkg:npm/ms@2.1.2"}) {
+		t.Errorf("debug depends on %v", deps)
+	}
+	// The linked workspace member is listed under its own path.
+	util := byPURL["pkg:npm/util@0.1.0"]
+	if util.License != "(MIT OR Apache-2.0)" || !reflect.DeepEqual(util.DependsOn, []string{"pkg:npm/debug@4.3.4"}) {
+		t.Errorf("unexpected workspace member %v", util)
+	}
+	if license := byPURL["pkg:npm/%40types/node@18.19.3"].License; license != "MIT" {
+		t.Errorf("expected @types/node to be MIT, got %q", license)
+	}
+
+	output, err := pkg.SBOM(pkg.SBOMFormatCycloneDX, root, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(output, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.BOMFormat != "CycloneDX" || len(bom.Components) != 5 {
+		t.Errorf("unexpected SBOM %s", output)
+	}
+}
+
+func TestNpmSBOMComponents_NestedDuplicates(t *testing.T) {
+	contents, err := os.ReadFile("testdata/sbom/package-lock-duplicates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, components, err := npmSBOMComponents(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// debug and ms@2.1.2 are each installed at two paths, but are
+	// one component each.
+	purls := []string{}
+	for _, component := range components {
+		purls = append(purls, component.PURL)
+	}
+	sort.Strings(purls)
+	expected := []string{
+		"pkg:npm/debug@4.3.4",
+		"pkg:npm/ms@2.0.0",
+		"pkg:npm/ms@2.1.2",
+		"pkg:npm/send@0.18.0",
+	}
+	if !reflect.DeepEqual(purls, expected) {
+		t.Errorf("expected components %v, got %v", expected, purls)
+	}
+
+	output, err := pkg.SBOM(pkg.SBOMFormatCycloneDX, root, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom struct {
+		Components []struct {
+			BOMRef string `json:"bom-ref"`
+		} `json:"components"`
+		Dependencies []struct {
+			Ref       string   `json:"ref"`
+			DependsOn []string `json:"dependsOn"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal(output, &bom); err != nil {
+		t.Fatal(err)
+	}
+	refs := map[string]bool{}
+	for _, component := range bom.Components {
+		if refs[component.BOMRef] {
+			t.Errorf("duplicate bom-ref %s in %s", component.BOMRef, output)
+		}
+		refs[component.BOMRef] = true
+	}
+	dependencyRefs := map[string]bool{}
+	for _, dependency := range bom.Dependencies {
+		if dependencyRefs[dependency.Ref] {
+			t.Errorf("duplicate dependency ref %s in %s", dependency.Ref, output)
+		}
+		dependencyRefs[dependency.Ref] = true
+		if dependency.Ref == "pkg:npm/send@0.18.0" && !reflect.DeepEqual(dependency.DependsOn, []string{"pkg:npm/debug@4.3.4", "pkg:npm/ms@2.1.2"}) {
+			t.Errorf("send depends on %v", dependency.DependsOn)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/replit/upm/internal/api"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmVersionManifest is the part of the registry manifest of one
+// version of a package that nodejsPackageSize reads.
+type npmVersionManifest struct {
+	Dist struct {
+		UnpackedSize int64 `json:"unpackedSize"`
+	} `json:"dist"`
+}
+
+// nodejsPackageSize implements PackageSize for the Node.js backends,
+// reading dist.unpackedSize from the registry manifest of the version,
+// or of the latest one if version is empty. Packages that aren't in
+// the registry, and older versions published without the field, have
+// no size.
+func nodejsPackageSize(ctx context.Context, name api.PkgName, version api.PkgVersion) (int64, bool) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "nodejsPackageSize")
+	defer span.Finish()
+	if version == "" {
+		version = "latest"
+	}
+	endpoint := "https://registry.npmjs.org/" + url.QueryEscape(string(name)) + "/" + url.PathEscape(string(version))
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, false
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false
+	}
+	var manifest npmVersionManifest
+	if err := json.Unmarshal(body, &manifest); err != nil || manifest.Dist.UnpackedSize <= 0 {
+		return 0, false
+	}
+	return manifest.Dist.UnpackedSize, true
+}
@@ -0,0 +1,43 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+func TestNodejsPackageSize(t *testing.T) {
+	manifest, err := filepath.Abs(filepath.Join("testdata", "size", "left-pad-1.3.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offlineProject(t)
+	testutil.ServeFiles(t, map[string]string{
+		"https://registry.npmjs.org/left-pad/1.3.0":  manifest,
+		"https://registry.npmjs.org/left-pad/latest": manifest,
+	})
+
+	for _, version := range []api.PkgVersion{"1.3.0", ""} {
+		size, ok := nodejsPackageSize(context.Background(), "left-pad", version)
+		if !ok || size != 9953 {
+			t.Errorf("left-pad %q: expected a size of 9953, got %d (%v)", version, size, ok)
+		}
+	}
+	if size, ok := nodejsPackageSize(context.Background(), "left-pad", "1.0.0"); ok {
+		t.Errorf("expected no size for a missing version, got %d", size)
+	}
+
+	// Versions published without the field have no size.
+	old := filepath.Join(t.TempDir(), "left-pad-0.0.1.json")
+	if err := os.WriteFile(old, []byte(`{"name": "left-pad", "version": "0.0.1", "dist": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.ServeFiles(t, map[string]string{"https://registry.npmjs.org/left-pad/0.0.1": old})
+	if size, ok := nodejsPackageSize(context.Background(), "left-pad", "0.0.1"); ok {
+		t.Errorf("expected no size without dist.unpackedSize, got %d", size)
+	}
+}
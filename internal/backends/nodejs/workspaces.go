@@ -0,0 +1,183 @@
+package nodejs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// pnpmWorkspaceYAML represents the relevant data in a
+// pnpm-workspace.yaml file.
+type pnpmWorkspaceYAML struct {
+	Packages []string                     `yaml:"packages"`
+	Catalog  map[string]string            `yaml:"catalog"`
+	Catalogs map[string]map[string]string `yaml:"catalogs"`
+}
+
+// workspacePatterns returns the workspace globs declared in dir,
+// either by the workspaces field of package.json (an array, or an
+// object with a packages array, as Yarn also accepts) or by
+// pnpm-workspace.yaml. Missing files are not an error.
+func workspacePatterns(dir string) ([]string, error) {
+	patterns := []string{}
+
+	contentsB, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err == nil {
+		var cfg struct {
+			Workspaces json.RawMessage `json:"workspaces"`
+		}
+		if err := json.Unmarshal(contentsB, &cfg); err != nil {
+			return nil, fmt.Errorf("package.json: %s", err)
+		}
+		workspaces := bytes.TrimSpace(cfg.Workspaces)
+		switch {
+		case len(workspaces) == 0 || bytes.Equal(workspaces, []byte("null")):
+		case bytes.HasPrefix(workspaces, []byte("{")):
+			var object struct {
+				Packages []string `json:"packages"`
+			}
+			if err := json.Unmarshal(workspaces, &object); err != nil {
+				return nil, fmt.Errorf("package.json: workspaces: %s", err)
+			}
+			patterns = append(patterns, object.Packages...)
+		default:
+			var array []string
+			if err := json.Unmarshal(workspaces, &array); err != nil {
+				return nil, fmt.Errorf("package.json: workspaces: %s", err)
+			}
+			patterns = append(patterns, array...)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	contentsB, err = os.ReadFile(filepath.Join(dir, "pnpm-workspace.yaml"))
+	if err == nil {
+		var cfg pnpmWorkspaceYAML
+		if err := yaml.Unmarshal(contentsB, &cfg); err != nil {
+			return nil, fmt.Errorf("pnpm-workspace.yaml: %s", err)
+		}
+		patterns = append(patterns, cfg.Packages...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// workspaceGlob converts a workspace glob into a regexp matching
+// slash-separated paths relative to the workspace root. A * or ?
+// stays within one path segment, while ** matches any number of
+// them.
+func workspaceGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '/':
+			if pattern[i:] == "/**" {
+				// A trailing /** also matches the
+				// directory itself.
+				expr.WriteString("(?:/.*)?")
+				i += 2
+			} else {
+				expr.WriteString("/")
+			}
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// nodejsWorkspaces returns the member packages of the workspace
+// rooted at dir, as sorted slash-separated paths relative to it. The
+// globs declared in dir (see workspacePatterns) are expanded against
+// the directories containing a package.json, outside node_modules
+// and hidden directories. Patterns starting with ! exclude
+// directories matched by the others. This is shared by all of the
+// Node.js backends.
+func nodejsWorkspaces(dir string) ([]string, error) {
+	patterns, err := workspacePatterns(dir)
+	if err != nil || len(patterns) == 0 {
+		return nil, err
+	}
+
+	include := []*regexp.Regexp{}
+	exclude := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		glob, err := workspaceGlob(strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("workspace pattern %q: %s", pattern, err)
+		}
+		if negated {
+			exclude = append(exclude, glob)
+		} else {
+			include = append(include, glob)
+		}
+	}
+	matchesAny := func(globs []*regexp.Regexp, path string) bool {
+		for _, glob := range globs {
+			if glob.MatchString(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	members := []string{}
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if entry.Name() == "node_modules" || strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchesAny(include, rel) || matchesAny(exclude, rel) {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, "package.json")); err == nil {
+			members = append(members, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(members)
+	return members, nil
+}
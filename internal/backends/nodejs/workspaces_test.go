@@ -0,0 +1,49 @@
+package nodejs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNodejsWorkspaces(t *testing.T) {
+	pnpmDir := t.TempDir()
+	files := map[string]string{
+		"package.json":                  `{"name": "pnpm-workspace"}`,
+		"pnpm-workspace.yaml":           "packages:\n  - 'packages/*'\n  - '!**/test/**'\n",
+		"packages/a/package.json":       `{"name": "a"}`,
+		"packages/b/package.json":       `{"name": "b"}`,
+		"packages/test/package.json":    `{"name": "test"}`,
+		".hidden/packages/package.json": `{"name": "hidden"}`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(pnpmDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		dir      string
+		expected []string
+	}{
+		{"testdata/workspaces", []string{"packages/app", "packages/utils"}},
+		{"testdata/workspaces-object", []string{"apps/web", "libs/deep/core"}},
+		{pnpmDir, []string{"packages/a", "packages/b"}},
+		{"testdata/installed", nil},
+	}
+	for _, tc := range testCases {
+		members, err := nodejsWorkspaces(tc.dir)
+		if err != nil {
+			t.Errorf("%s: %s", tc.dir, err)
+			continue
+		}
+		if !reflect.DeepEqual(tc.expected, members) {
+			t.Errorf("%s: expected members %v, got %v", tc.dir, tc.expected, members)
+		}
+	}
+}
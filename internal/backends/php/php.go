@@ -9,9 +9,11 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -53,12 +55,26 @@ type packageDetail struct {
 	Name          string            `json:"name"`
 	Description   string            `json:"description"`
 	LatestVersion string            `json:"version"`
-	Licenses      []string          `json:"license"`
+	Licenses      composerLicenses  `json:"license"`
 	Homepage      string            `json:"homepage"`
 	Support       map[string]string `json:"support"`
 	Authors       []authors         `json:"authors"`
 }
 
+// composerLicenses is the license field of a package, which is
+// usually an array, but may also be a single string in a package's
+// own composer.json.
+type composerLicenses []string
+
+func (l *composerLicenses) UnmarshalJSON(data []byte) error {
+	var license string
+	if json.Unmarshal(data, &license) == nil {
+		*l = []string{license}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
 type authors struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
@@ -69,7 +85,27 @@ func composerIsAvailable() bool {
 	return err == nil
 }
 
+// search implements Search, looking in the repositories declared in
+// composer.json before Packagist, unless Packagist is turned off.
 func search(query string) []api.PkgInfo {
+	repos, usePackagist := projectRepositories()
+	results := repositorySearch(repos, query)
+	if !usePackagist {
+		return results
+	}
+	seen := map[string]bool{}
+	for _, result := range results {
+		seen[result.Name] = true
+	}
+	for _, result := range searchPackagist(query) {
+		if !seen[result.Name] {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func searchPackagist(query string) []api.PkgInfo {
 	endpoint := "https://packagist.org/search.json?q=" + url.QueryEscape(query)
 	resp, err := api.HttpClient.Get(endpoint)
 
@@ -112,8 +148,21 @@ func parseSearch(arr []byte) ([]api.PkgInfo, error) {
 	return pkgInfoArr, nil
 }
 
-// This API can only accept strings in the [vendor]/[packageName] format
+// info implements Info, looking in the repositories declared in
+// composer.json before Packagist, as Composer does.
 func info(name api.PkgName) api.PkgInfo {
+	repos, usePackagist := projectRepositories()
+	if pkgInfo, ok := repositoryInfo(repos, name); ok {
+		return pkgInfo
+	}
+	if !usePackagist {
+		return api.PkgInfo{}
+	}
+	return packagistInfo(name)
+}
+
+// This API can only accept strings in the [vendor]/[packageName] format
+func packagistInfo(name api.PkgName) api.PkgInfo {
 	endpoint := fmt.Sprintf("https://repo.packagist.org/p2/%s.json", string(name))
 	resp, err := api.HttpClient.Get(endpoint)
 
@@ -153,24 +202,7 @@ func parseInfo(body []byte, packageName api.PkgName) (api.PkgInfo, error) {
 	}
 
 	// latest version is always first
-	latestVersionResult := packagistInfo.PackageInfo[string(packageName)][0]
-
-	authors := []string{}
-	for _, author := range latestVersionResult.Authors {
-		authors = append(authors, author.Name)
-	}
-
-	bugTracker := latestVersionResult.Support["issues"]
-
-	return api.PkgInfo{
-		Name:          latestVersionResult.Name,
-		Description:   latestVersionResult.Description,
-		Version:       latestVersionResult.LatestVersion,
-		HomepageURL:   latestVersionResult.Homepage,
-		License:       strings.Join(latestVersionResult.Licenses, ", "),
-		Author:        strings.Join(authors, ", "),
-		BugTrackerURL: bugTracker,
-	}, nil
+	return detailInfo(packagistInfo.PackageInfo[string(packageName)][0]), nil
 }
 
 func listSpecfile() map[api.PkgName]api.PkgSpec {
@@ -206,6 +238,22 @@ func listSpecfileWithContents(contents []byte) map[api.PkgName]api.PkgSpec {
 	return packages
 }
 
+// runtimeConstraint implements RuntimeConstraint using the php
+// platform package in the require section of composer.json.
+func runtimeConstraint() (string, string) {
+	contents, err := os.ReadFile("composer.json")
+	if err != nil {
+		return "php", ""
+	}
+	var specfile struct {
+		RequireDependencies map[string]string `json:"require"`
+	}
+	if err := json.Unmarshal(contents, &specfile); err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	return "php", specfile.RequireDependencies["php"]
+}
+
 func listLockfile() map[api.PkgName]api.PkgVersion {
 	contents, err := os.ReadFile("composer.lock")
 	if err != nil {
@@ -229,13 +277,155 @@ func listLockfileWithContents(contents []byte) map[api.PkgName]api.PkgVersion {
 	return packages
 }
 
+// composerScripts returns the sorted names of the scripts defined
+// in the given composer.json contents. Composer runs some of these
+// (e.g. post-install-cmd) automatically, so it's worth surfacing.
+func composerScripts(contents []byte) []string {
+	var specfile struct {
+		Scripts map[string]interface{} `json:"scripts"`
+	}
+	if err := json.Unmarshal(contents, &specfile); err != nil {
+		return nil
+	}
+	names := []string{}
+	for name := range specfile.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reportComposerScripts logs the scripts defined in composer.json,
+// if any, and whether they are going to be run.
+func reportComposerScripts(willRun bool) {
+	contents, err := os.ReadFile("composer.json")
+	if err != nil {
+		return
+	}
+	scripts := composerScripts(contents)
+	if len(scripts) == 0 {
+		return
+	}
+	if willRun {
+		util.Log("composer.json defines scripts, which composer may run:", strings.Join(scripts, ", "))
+		util.Log("pass --no-scripts to skip them")
+	} else {
+		util.Log("not running scripts defined in composer.json:", strings.Join(scripts, ", "))
+	}
+}
+
+// Only "composer install" runs scripts by default, since it is the
+// one operation whose purpose is to set up the project. Everything
+// else that modifies composer.json or composer.lock passes
+// --no-scripts, so that adding or removing a package in an untrusted
+// project can't execute arbitrary code. Search, Info and the
+// specfile and lockfile listings don't invoke composer at all.
+
+// addToSpecfile implements AddToSpecfile, writing the packages
+// straight into the require section of composer.json (require-dev
+// with --dev). Packages without a spec get "*".
+func addToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectVendorName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "composer addToSpecfile")
+	defer span.Finish()
+	var contents []byte
+	if util.Exists("composer.json") {
+		var err error
+		contents, err = os.ReadFile("composer.json")
+		if err != nil {
+			util.Die("composer.json: %s", err)
+		}
+	}
+	contents, err := addToSpecfileContents(contents, pkgs, projectVendorName)
+	if err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	util.TryWriteAtomic("composer.json", contents)
+}
+
+// addToSpecfileContents implements AddToSpecfileContents.
+func addToSpecfileContents(contents []byte, pkgs map[api.PkgName]api.PkgSpec, projectVendorName string) ([]byte, error) {
+	deps := map[string]string{}
+	for name, spec := range pkgs {
+		if spec == "" {
+			spec = "*"
+		}
+		deps[string(name)] = string(spec)
+	}
+
+	section := "require"
+	if config.Dependency == config.DependencyDev {
+		section = "require-dev"
+	}
+	return util.SetJSONObjectEntries(contents, section, deps)
+}
+
+// addVCSRepository declares config.VCS as a repository in
+// composer.json, creating the file if necessary, so that the package
+// about to be required is sourced from it. Nothing is done if the
+// repository is already declared.
+func addVCSRepository(pkgs map[api.PkgName]api.PkgSpec) {
+	contents := []byte("{}\n")
+	if util.Exists("composer.json") {
+		var err error
+		contents, err = os.ReadFile("composer.json")
+		if err != nil {
+			util.Die("composer.json: %s", err)
+		}
+	} else {
+		util.TryWriteAtomic("composer.json", contents)
+	}
+	if hasRepository(contents, config.VCS) {
+		return
+	}
+	for name := range pkgs {
+		util.RunCmd(composerVCSRepositoryCmd(name, config.VCS))
+	}
+}
+
+func composerRequireCmd(pkgs map[api.PkgName]api.PkgSpec) []string {
+	cmd := []string{"composer", "require", "--no-scripts"}
+	if config.Dependency == config.DependencyDev {
+		cmd = append(cmd, "--dev")
+	}
+	for name, spec := range pkgs {
+		arg := string(name)
+		if spec != "" {
+			arg += ":" + string(spec)
+		}
+		cmd = append(cmd, arg)
+	}
+	return cmd
+}
+
+func composerRemoveCmd(pkgs map[api.PkgName]bool) []string {
+	cmd := []string{"composer", "remove", "--no-scripts"}
+	for name := range pkgs {
+		cmd = append(cmd, string(name))
+	}
+	return cmd
+}
+
+func composerUpdateCmd() []string {
+	return []string{"composer", "update", "--no-scripts"}
+}
+
+func composerInstallCmd() []string {
+	cmd := []string{"composer", "install"}
+	if config.NoScripts {
+		cmd = append(cmd, "--no-scripts")
+	}
+	return cmd
+}
+
 var PhpComposerBackend = api.LanguageBackend{
 	Name:             "php-composer",
 	Specfile:         "composer.json",
 	Lockfile:         "composer.lock",
 	IsAvailable:      composerIsAvailable,
 	FilenamePatterns: []string{"*.php"},
-	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksAddRemoveAlsoInstalls,
+	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksAddRemoveAlsoInstalls | api.QuirksAddSupportsVCS,
+	SpecSyntax:       api.SpecSyntaxComposer,
 	GetPackageDir: func() string {
 		return "vendor"
 	},
@@ -245,41 +435,40 @@ var PhpComposerBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "composer require")
 		defer span.Finish()
-		cmd := []string{"composer", "require"}
-
-		for name, spec := range pkgs {
-			arg := string(name)
-			if spec != "" {
-				arg += ":" + string(spec)
-			}
-			cmd = append(cmd, arg)
+		reportComposerScripts(false)
+		if config.VCS != "" {
+			addVCSRepository(pkgs)
 		}
-		util.RunCmd(cmd)
+		util.RunCmd(composerRequireCmd(pkgs))
 	},
+	AddToSpecfile:         addToSpecfile,
+	AddToSpecfileContents: addToSpecfileContents,
+	DependencyTypes:       []config.DependencyType{config.DependencyDev},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "composer remove")
 		defer span.Finish()
-		cmd := []string{"composer", "remove"}
-		for name := range pkgs {
-			cmd = append(cmd, string(name))
-		}
-		util.RunCmd(cmd)
+		reportComposerScripts(false)
+		util.RunCmd(composerRemoveCmd(pkgs))
 	},
 	Lock: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "composer update")
 		defer span.Finish()
-		util.RunCmd([]string{"composer", "update"})
+		reportComposerScripts(false)
+		util.RunCmd(composerUpdateCmd())
 	},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "composer install")
 		defer span.Finish()
-		util.RunCmd([]string{"composer", "install"})
+		reportComposerScripts(!config.NoScripts)
+		util.RunCmd(composerInstallCmd())
 	},
-	ListSpecfile: listSpecfile,
-	ListLockfile: listLockfile,
+	ListSpecfile:           listSpecfile,
+	ListSpecfileAttributes: listSpecfileAttributes,
+	ListLockfile:           listLockfile,
+	RuntimeConstraint:      runtimeConstraint,
 	Guess: func(context.Context) (map[api.PkgName]bool, bool) {
 		util.NotImplemented()
 		return nil, false
@@ -1,10 +1,14 @@
 package php
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"testing"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -157,3 +161,67 @@ func TestInfoParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestComposerScripts(t *testing.T) {
+	contents, err := os.ReadFile("testdata/composer-scripts.json")
+	require.NoError(t, err)
+	require.Equal(t, []string{"post-install-cmd", "post-update-cmd", "test"}, composerScripts(contents))
+
+	contents, err = os.ReadFile("testdata/composer1.json")
+	require.NoError(t, err)
+	require.Empty(t, composerScripts(contents))
+}
+
+func TestComposerNoScripts(t *testing.T) {
+	pkgs := map[api.PkgName]api.PkgSpec{"monolog/monolog": "^3.2"}
+	require.Equal(t, []string{"composer", "require", "--no-scripts", "monolog/monolog:^3.2"}, composerRequireCmd(pkgs))
+	require.Equal(t, []string{"composer", "remove", "--no-scripts", "monolog/monolog"}, composerRemoveCmd(map[api.PkgName]bool{"monolog/monolog": true}))
+	require.Equal(t, []string{"composer", "update", "--no-scripts"}, composerUpdateCmd())
+}
+
+func TestComposerInstallScripts(t *testing.T) {
+	orig := config.NoScripts
+	defer func() { config.NoScripts = orig }()
+
+	config.NoScripts = false
+	require.Equal(t, []string{"composer", "install"}, composerInstallCmd())
+
+	config.NoScripts = true
+	require.Equal(t, []string{"composer", "install", "--no-scripts"}, composerInstallCmd())
+}
+
+func TestAddToSpecfile(t *testing.T) {
+	contents, err := os.ReadFile("testdata/composer1.json")
+	require.NoError(t, err)
+
+	testutil.Chdir(t, t.TempDir())
+	require.NoError(t, os.WriteFile("composer.json", contents, 0o644))
+
+	// Neither composer nor Packagist may be used.
+	t.Setenv("PATH", t.TempDir())
+	testutil.Offline(t)
+
+	PhpComposerBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"monolog/monolog": "",
+		"symfony/console": "^7.0",
+	}, "")
+
+	edited, err := os.ReadFile("composer.json")
+	require.NoError(t, err)
+	var cfg struct {
+		Name       string            `json:"name"`
+		Require    map[string]string `json:"require"`
+		RequireDev map[string]string `json:"require-dev"`
+	}
+	require.NoError(t, json.Unmarshal(edited, &cfg))
+	require.Equal(t, "asdf/jkjl", cfg.Name)
+	require.Equal(t, map[string]string{
+		"aws/aws-sdk-php":   "^3.209",
+		"guzzlehttp/guzzle": "7.0",
+		"monolog/monolog":   "*",
+		"symfony/console":   "^7.0",
+	}, cfg.Require)
+	require.Equal(t, map[string]string{"monolog/monolog": "^3.2"}, cfg.RequireDev)
+	require.NoFileExists(t, "composer.lock")
+	require.NoDirExists(t, "vendor")
+}
@@ -0,0 +1,509 @@
+package php
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+/*
+Used for the repositories of composer.json
+*/
+type composerRepository struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// The definitions of a "package" repository, either a single
+	// object or an array of them, one per version.
+	Package json.RawMessage `json:"package"`
+}
+
+// composerVCSTypes are the repository types that Composer reads
+// from a version control system.
+var composerVCSTypes = map[string]bool{
+	"vcs":       true,
+	"git":       true,
+	"github":    true,
+	"gitlab":    true,
+	"bitbucket": true,
+	"hg":        true,
+	"svn":       true,
+	"fossil":    true,
+}
+
+// parseRepositories returns the repositories declared in the given
+// composer.json contents, in order, and whether Packagist is still
+// consulted after them. The repositories may be given as an array or
+// as an object keyed by name, and {"packagist.org": false} turns
+// Packagist off.
+func parseRepositories(contents []byte) ([]composerRepository, bool, error) {
+	var specfile struct {
+		Repositories json.RawMessage `json:"repositories"`
+	}
+	if err := json.Unmarshal(contents, &specfile); err != nil {
+		return nil, false, err
+	}
+	if len(specfile.Repositories) == 0 {
+		return nil, true, nil
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(specfile.Repositories, &entries); err != nil {
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(specfile.Repositories, &named); err != nil {
+			return nil, false, fmt.Errorf("repositories: %s", err)
+		}
+		names := []string{}
+		for name := range named {
+			names = append(names, name)
+		}
+		// Objects are unordered once decoded, so the names
+		// give a deterministic order.
+		sort.Strings(names)
+		for _, name := range names {
+			if name == "packagist.org" || name == "packagist" {
+				entries = append(entries, json.RawMessage(`{"packagist.org": `+string(named[name])+`}`))
+				continue
+			}
+			entries = append(entries, named[name])
+		}
+	}
+
+	repos := []composerRepository{}
+	usePackagist := true
+	for _, entry := range entries {
+		var disabled map[string]interface{}
+		if json.Unmarshal(entry, &disabled) == nil {
+			if enabled, ok := disabled["packagist.org"].(bool); ok {
+				usePackagist = usePackagist && enabled
+				continue
+			}
+		}
+		var repo composerRepository
+		if err := json.Unmarshal(entry, &repo); err != nil {
+			return nil, false, fmt.Errorf("repositories: %s", err)
+		}
+		repos = append(repos, repo)
+	}
+	return repos, usePackagist, nil
+}
+
+// projectRepositories returns the repositories declared in the
+// composer.json of the current directory, if any, and whether
+// Packagist is consulted after them.
+func projectRepositories() ([]composerRepository, bool) {
+	contents, err := os.ReadFile("composer.json")
+	if err != nil {
+		return nil, true
+	}
+	repos, usePackagist, err := parseRepositories(contents)
+	if err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	return repos, usePackagist
+}
+
+// describe returns the source attribute that upm list shows for the
+// packages of the repository, e.g. "vcs:https://github.com/acme/lib".
+func (repo composerRepository) describe() string {
+	if repo.Type == "package" {
+		return "package"
+	}
+	return repo.Type + ":" + repo.URL
+}
+
+// packageDefinitions returns the inline package definitions of a
+// "package" repository.
+func (repo composerRepository) packageDefinitions() []packageDetail {
+	var definitions []packageDetail
+	if json.Unmarshal(repo.Package, &definitions) == nil {
+		return definitions
+	}
+	var definition packageDetail
+	if json.Unmarshal(repo.Package, &definition) == nil {
+		return []packageDetail{definition}
+	}
+	return nil
+}
+
+// pathPackages returns the packages of a "path" repository, read
+// from the composer.json of each directory its URL (which may be a
+// glob) matches, keyed by name.
+func (repo composerRepository) pathPackages() map[string]packageDetail {
+	pkgs := map[string]packageDetail{}
+	dirs, err := filepath.Glob(repo.URL)
+	if err != nil {
+		return pkgs
+	}
+	for _, dir := range dirs {
+		contents, err := os.ReadFile(filepath.Join(dir, "composer.json"))
+		if err != nil {
+			continue
+		}
+		var detail packageDetail
+		if json.Unmarshal(contents, &detail) == nil && detail.Name != "" {
+			pkgs[detail.Name] = detail
+		}
+	}
+	return pkgs
+}
+
+// composerRepositoryIndex represents the relevant parts of the
+// packages.json of a Composer repository.
+type composerRepositoryIndex struct {
+	// The URL template of the metadata of each package, e.g.
+	// "/p2/%package%.json", as served by Packagist.
+	MetadataURL string `json:"metadata-url"`
+
+	// The URL template of the search API, e.g.
+	// "/search.json?q=%query%&type=%type%". Many repositories,
+	// such as those generated by Satis, don't have one.
+	Search string `json:"search"`
+}
+
+// getJSON fetches the given URL and decodes the JSON response into v.
+func getJSON(endpoint string, v interface{}) error {
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// resolve returns the URL template ref, as found in the packages.json
+// of the repository, made absolute.
+func (repo composerRepository) resolve(ref string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(repo.URL, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	// The templates contain placeholders such as %package%,
+	// which are not valid escapes, so parse them in a form that
+	// can be put back.
+	resolved, err := base.Parse(strings.ReplaceAll(ref, "%", "%25"))
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(resolved.String(), "%25", "%"), nil
+}
+
+// index fetches the packages.json of a Composer repository.
+func (repo composerRepository) index() (composerRepositoryIndex, error) {
+	var index composerRepositoryIndex
+	endpoint, err := repo.resolve("packages.json")
+	if err != nil {
+		return index, err
+	}
+	err = getJSON(endpoint, &index)
+	return index, err
+}
+
+// latestDefinition returns the definition with the highest version,
+// or the first one if the versions can't be compared.
+func latestDefinition(definitions []packageDetail) packageDetail {
+	latest := definitions[0]
+	var latestVersion *version.Version
+	for _, definition := range definitions {
+		v, err := version.NewVersion(definition.LatestVersion)
+		if err != nil {
+			continue
+		}
+		if latestVersion == nil || v.GreaterThan(latestVersion) {
+			latest, latestVersion = definition, v
+		}
+	}
+	return latest
+}
+
+// detailInfo converts a package definition to a PkgInfo.
+func detailInfo(detail packageDetail) api.PkgInfo {
+	authors := []string{}
+	for _, author := range detail.Authors {
+		authors = append(authors, author.Name)
+	}
+	return api.PkgInfo{
+		Name:          detail.Name,
+		Description:   detail.Description,
+		Version:       detail.LatestVersion,
+		HomepageURL:   detail.Homepage,
+		License:       strings.Join(detail.Licenses, ", "),
+		Author:        strings.Join(authors, ", "),
+		BugTrackerURL: detail.Support["issues"],
+	}
+}
+
+// repositoryInfo looks the package up in the given repositories, in
+// order, as Composer does before it falls back to Packagist. Package
+// and path repositories are read locally, and Composer repositories
+// through their metadata-url. VCS repositories can't be queried
+// without cloning them, so they are skipped.
+func repositoryInfo(repos []composerRepository, name api.PkgName) (api.PkgInfo, bool) {
+	for _, repo := range repos {
+		switch repo.Type {
+		case "package":
+			definitions := []packageDetail{}
+			for _, definition := range repo.packageDefinitions() {
+				if definition.Name == string(name) {
+					definitions = append(definitions, definition)
+				}
+			}
+			if len(definitions) > 0 {
+				return detailInfo(latestDefinition(definitions)), true
+			}
+		case "path":
+			if detail, ok := repo.pathPackages()[string(name)]; ok {
+				return detailInfo(detail), true
+			}
+		case "composer":
+			index, err := repo.index()
+			if err != nil {
+				warnRepository(repo, err)
+				continue
+			}
+			if index.MetadataURL == "" {
+				continue
+			}
+			endpoint, err := repo.resolve(strings.ReplaceAll(index.MetadataURL, "%package%", string(name)))
+			if err != nil {
+				warnRepository(repo, err)
+				continue
+			}
+			var metadata packagistInfoSearchResult
+			if err := getJSON(endpoint, &metadata); err != nil {
+				continue
+			}
+			if definitions := metadata.PackageInfo[string(name)]; len(definitions) > 0 {
+				return detailInfo(definitions[0]), true
+			}
+		}
+	}
+	return api.PkgInfo{}, false
+}
+
+// warnRepository warns that the given repository couldn't be queried
+// because of err.
+func warnRepository(repo composerRepository, err error) {
+	util.Warn(context.Background(), util.Warning{
+		Code:    util.WarningRegistry,
+		Message: fmt.Sprintf("repository %s: %s", repo.URL, err),
+	})
+}
+
+// repositorySearch returns the packages of the given repositories
+// whose names contain the query. Composer repositories are searched
+// through their search API, if they have one.
+func repositorySearch(repos []composerRepository, query string) []api.PkgInfo {
+	results := []api.PkgInfo{}
+	matches := func(name string) bool {
+		return strings.Contains(strings.ToLower(name), strings.ToLower(query))
+	}
+	for _, repo := range repos {
+		switch repo.Type {
+		case "package":
+			byName := map[string][]packageDetail{}
+			names := []string{}
+			for _, definition := range repo.packageDefinitions() {
+				if matches(definition.Name) {
+					if byName[definition.Name] == nil {
+						names = append(names, definition.Name)
+					}
+					byName[definition.Name] = append(byName[definition.Name], definition)
+				}
+			}
+			for _, name := range names {
+				results = append(results, detailInfo(latestDefinition(byName[name])))
+			}
+		case "path":
+			pkgs := repo.pathPackages()
+			names := []string{}
+			for name := range pkgs {
+				if matches(name) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				results = append(results, detailInfo(pkgs[name]))
+			}
+		case "composer":
+			index, err := repo.index()
+			if err != nil {
+				warnRepository(repo, err)
+				continue
+			}
+			if index.Search == "" {
+				continue
+			}
+			template := strings.ReplaceAll(index.Search, "%query%", url.QueryEscape(query))
+			endpoint, err := repo.resolve(strings.ReplaceAll(template, "%type%", ""))
+			if err != nil {
+				warnRepository(repo, err)
+				continue
+			}
+			var found packagistSearchResults
+			if err := getJSON(endpoint, &found); err != nil {
+				warnRepository(repo, err)
+				continue
+			}
+			for _, result := range found.Packages {
+				results = append(results, api.PkgInfo{
+					Name:          result.Name,
+					Description:   result.Description,
+					SourceCodeURL: result.Repository,
+				})
+			}
+		}
+	}
+	return results
+}
+
+// composerLockEntry represents where a package in composer.lock was
+// installed from.
+type composerLockEntry struct {
+	Name   string `json:"name"`
+	Source struct {
+		URL string `json:"url"`
+	} `json:"source"`
+	Dist struct {
+		URL string `json:"url"`
+	} `json:"dist"`
+	NotificationURL string `json:"notification-url"`
+}
+
+// normalizeRepositoryURL returns a repository URL in a form that can
+// be compared with others, e.g. without a trailing ".git".
+func normalizeRepositoryURL(u string) string {
+	u = strings.ToLower(strings.TrimRight(u, "/"))
+	return strings.TrimSuffix(u, ".git")
+}
+
+// listSpecfileAttributes implements ListSpecfileAttributes, reporting
+// the repository that each package comes from as its "source", if it
+// isn't Packagist.
+func listSpecfileAttributes() map[api.PkgName]map[string]string {
+	contents, err := os.ReadFile("composer.json")
+	if err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	lockContents, err := os.ReadFile("composer.lock")
+	if err != nil && !os.IsNotExist(err) {
+		util.Die("composer.lock: %s", err)
+	}
+	return listSpecfileAttributesWithContents(contents, lockContents)
+}
+
+// listSpecfileAttributesWithContents reports the repository of each
+// package required by the given composer.json contents, as the
+// "source" attribute, e.g. "vcs:https://github.com/acme/lib",
+// "path:packages/*", "composer:https://repo.example.com" or
+// "package". Packages defined inline or in a path repository are
+// known from composer.json itself; for the others, the source or
+// dist recorded in the given composer.lock contents (which may be
+// empty) is matched against the repositories.
+func listSpecfileAttributesWithContents(contents []byte, lockContents []byte) map[api.PkgName]map[string]string {
+	repos, _, err := parseRepositories(contents)
+	if err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	required := listSpecfileWithContents(contents)
+
+	sources := map[string]string{}
+	for _, repo := range repos {
+		switch repo.Type {
+		case "package":
+			for _, definition := range repo.packageDefinitions() {
+				if _, ok := sources[definition.Name]; !ok {
+					sources[definition.Name] = repo.describe()
+				}
+			}
+		case "path":
+			for name := range repo.pathPackages() {
+				if _, ok := sources[name]; !ok {
+					sources[name] = repo.describe()
+				}
+			}
+		}
+	}
+
+	var lock struct {
+		Packages    []composerLockEntry `json:"packages"`
+		PackagesDev []composerLockEntry `json:"packages-dev"`
+	}
+	if len(lockContents) > 0 {
+		if err := json.Unmarshal(lockContents, &lock); err != nil {
+			util.Die("composer.lock: %s", err)
+		}
+	}
+	locked := append(lock.Packages, lock.PackagesDev...)
+	for _, pkg := range locked {
+		if _, ok := sources[pkg.Name]; ok {
+			continue
+		}
+		for _, repo := range repos {
+			repoURL := normalizeRepositoryURL(repo.URL)
+			if repoURL == "" {
+				continue
+			}
+			matched := false
+			switch {
+			case composerVCSTypes[repo.Type]:
+				matched = normalizeRepositoryURL(pkg.Source.URL) == repoURL
+			case repo.Type == "composer":
+				matched = strings.HasPrefix(normalizeRepositoryURL(pkg.NotificationURL), repoURL) ||
+					strings.HasPrefix(normalizeRepositoryURL(pkg.Dist.URL), repoURL)
+			}
+			if matched {
+				sources[pkg.Name] = repo.describe()
+				break
+			}
+		}
+	}
+
+	attrs := map[api.PkgName]map[string]string{}
+	for name := range required {
+		if source, ok := sources[string(name)]; ok {
+			attrs[name] = map[string]string{"source": source}
+		}
+	}
+	return attrs
+}
+
+// hasRepository returns true if the given composer.json contents
+// already declare a repository with the given URL.
+func hasRepository(contents []byte, repoURL string) bool {
+	repos, _, err := parseRepositories(contents)
+	if err != nil {
+		util.Die("composer.json: %s", err)
+	}
+	for _, repo := range repos {
+		if normalizeRepositoryURL(repo.URL) == normalizeRepositoryURL(repoURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// composerVCSRepositoryCmd returns the command that declares a VCS
+// repository at repoURL in composer.json, named after the package
+// that is sourced from it.
+func composerVCSRepositoryCmd(name api.PkgName, repoURL string) []string {
+	key := strings.ReplaceAll(string(name), "/", "-")
+	return []string{"composer", "config", "repositories." + key, "vcs", repoURL}
+}
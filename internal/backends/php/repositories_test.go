@@ -0,0 +1,126 @@
+package php
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// repositoriesProject changes to the testdata/repositories project
+// and serves the Acme Composer repository and Packagist from
+// fixtures. It returns the Transport serving them.
+func repositoriesProject(t *testing.T) *testutil.Transport {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	testutil.Chdir(t, filepath.Join(testdata, "repositories"))
+
+	return testutil.ServeFiles(t, map[string]string{
+		"https://repo.acme.test/packages.json":               filepath.Join(testdata, "repo-acme-packages.json"),
+		"https://repo.acme.test/p2/acme/internal-sdk.json":   filepath.Join(testdata, "repo-acme-internal-sdk.json"),
+		"https://repo.acme.test/search.json?q=monolog&type=": filepath.Join(testdata, "repo-acme-search.json"),
+		"https://repo.packagist.org/p2/monolog/monolog.json": filepath.Join(testdata, "infoResponse.json"),
+		"https://packagist.org/search.json?q=monolog":        filepath.Join(testdata, "searchResponse.json"),
+	})
+}
+
+func TestListSpecfileAttributes(t *testing.T) {
+	repositoriesProject(t)
+
+	require.Equal(t, map[api.PkgName]map[string]string{
+		"acme/billing":      {"source": "vcs:https://github.com/acme/billing"},
+		"acme/internal-sdk": {"source": "composer:https://repo.acme.test"},
+		"acme/tools":        {"source": "path:packages/*"},
+		"legacy/widget":     {"source": "package"},
+	}, PhpComposerBackend.ListSpecfileAttributes())
+}
+
+func TestParseRepositories(t *testing.T) {
+	repos, usePackagist, err := parseRepositories([]byte(`{
+		"repositories": {
+			"packagist.org": false,
+			"acme": {"type": "composer", "url": "https://repo.acme.test"}
+		}
+	}`))
+	require.NoError(t, err)
+	require.False(t, usePackagist)
+	require.Equal(t, []composerRepository{{Type: "composer", URL: "https://repo.acme.test"}}, repos)
+
+	repos, usePackagist, err = parseRepositories([]byte(`{"repositories": [{"packagist.org": false}]}`))
+	require.NoError(t, err)
+	require.False(t, usePackagist)
+	require.Empty(t, repos)
+
+	_, usePackagist, err = parseRepositories([]byte(`{"name": "acme/app"}`))
+	require.NoError(t, err)
+	require.True(t, usePackagist)
+}
+
+func TestRepositoryInfo(t *testing.T) {
+	registry := repositoriesProject(t)
+
+	info := PhpComposerBackend.Info("acme/internal-sdk")
+	require.Equal(t, api.PkgInfo{
+		Name:        "acme/internal-sdk",
+		Description: "Client for Acme's internal APIs",
+		Version:     "2.3.1",
+		License:     "proprietary",
+	}, info)
+	require.NotContains(t, registry.URLs(), "https://repo.packagist.org/p2/acme/internal-sdk.json")
+
+	// Package and path repositories are read locally, and
+	// Packagist isn't asked about the packages they have.
+	registry.Requests = nil
+	require.Equal(t, "1.2.0", PhpComposerBackend.Info("legacy/widget").Version)
+	require.Equal(t, "Development tools shared across Acme projects", PhpComposerBackend.Info("acme/tools").Description)
+	require.Equal(t, []string{
+		"https://repo.acme.test/packages.json",
+		"https://repo.acme.test/p2/legacy/widget.json",
+		"https://repo.acme.test/packages.json",
+		"https://repo.acme.test/p2/acme/tools.json",
+	}, registry.URLs())
+
+	// Packages that the repositories don't have come from
+	// Packagist, after the Composer repository is consulted.
+	registry.Requests = nil
+	info = PhpComposerBackend.Info("monolog/monolog")
+	require.Equal(t, "3.2.0", info.Version)
+	require.Equal(t, []string{
+		"https://repo.acme.test/packages.json",
+		"https://repo.acme.test/p2/monolog/monolog.json",
+		"https://repo.packagist.org/p2/monolog/monolog.json",
+	}, registry.URLs())
+}
+
+func TestRepositorySearch(t *testing.T) {
+	registry := repositoriesProject(t)
+
+	names := []string{}
+	for _, result := range PhpComposerBackend.Search("monolog") {
+		names = append(names, result.Name)
+	}
+	require.Equal(t, []string{"acme/internal-sdk", "monolog/monolog", "symfony/monolog-bundle"}, names)
+	require.Contains(t, registry.URLs(), "https://repo.acme.test/search.json?q=monolog&type=")
+	require.Contains(t, registry.URLs(), "https://packagist.org/search.json?q=monolog")
+
+	names = []string{}
+	for _, result := range repositorySearch([]composerRepository{{Type: "path", URL: "packages/*"}}, "TOOLS") {
+		names = append(names, result.Name)
+	}
+	require.Equal(t, []string{"acme/tools"}, names)
+}
+
+func TestComposerVCSRepository(t *testing.T) {
+	contents, err := os.ReadFile("testdata/repositories/composer.json")
+	require.NoError(t, err)
+	require.True(t, hasRepository(contents, "https://github.com/acme/billing.git"))
+	require.False(t, hasRepository(contents, "https://github.com/acme/payroll"))
+
+	require.Equal(t,
+		[]string{"composer", "config", "repositories.acme-payroll", "vcs", "https://github.com/acme/payroll"},
+		composerVCSRepositoryCmd("acme/payroll", "https://github.com/acme/payroll"),
+	)
+}
@@ -1,9 +1,17 @@
 package python
 
 import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/replit/upm/internal/util"
 )
 
 func TestNormalizePackageName(t *testing.T) {
@@ -28,3 +36,271 @@ func TestNormalizePackageName(t *testing.T) {
 		}
 	}
 }
+
+func TestListPoetrySpecfileSelfExtra(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/self-extra.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := listPoetrySpecfileWithContents(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[api.PkgName]api.PkgSpec{
+		"requests": "^2.31.0",
+	}
+	if !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+}
+
+func TestIsSelfReference(t *testing.T) {
+	if !isSelfReference("my-package", "My_Package") {
+		t.Errorf("expected my-package to refer to My_Package")
+	}
+	if isSelfReference("my-package", "") {
+		t.Errorf("expected no self references without a project name")
+	}
+	if isSelfReference("requests", "My_Package") {
+		t.Errorf("expected requests not to refer to My_Package")
+	}
+	if !isSelfReference("my-package[cli]", "My_Package") {
+		t.Errorf("expected my-package[cli] to refer to My_Package")
+	}
+}
+
+func TestSelfReferenceOffline(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/self-extra.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, t.TempDir())
+	if err := os.WriteFile("pyproject.toml", contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Offline(t)
+
+	// upm info of the project itself, with or without extras,
+	// doesn't look it up.
+	for _, b := range []api.LanguageBackend{PythonPoetryBackend, PythonPipBackend, PythonPipToolsBackend} {
+		for _, name := range []api.PkgName{"My_Package", "my-package[cli]"} {
+			if info := b.Info(name); info.Name != "My_Package" {
+				t.Errorf("%s: expected %s to be the project, got %+v", b.Name, name, info)
+			}
+		}
+	}
+
+	// Nor does upm add, which checks the requires_python of the
+	// packages before running the package manager.
+	checkRequiresPython(map[api.PkgName]api.PkgSpec{"my-package[cli]": ""})
+}
+
+func TestPoetryLockVersion(t *testing.T) {
+	for _, tc := range []struct {
+		lockVersion string
+		ok          bool
+	}{
+		{"", true},
+		{"1.1", true},
+		{"2.0", true},
+		{"3.0", false},
+	} {
+		cfg := poetryLock{}
+		cfg.Metadata.LockVersion = tc.lockVersion
+		err := poetryLockVersionError(cfg)
+		if tc.ok && err != nil {
+			t.Errorf("expected lock-version %q to be supported, got %s", tc.lockVersion, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("expected lock-version %q to be rejected", tc.lockVersion)
+		}
+	}
+}
+
+func TestPoetryAddToSpecfile(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/extras.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Chdir(t, t.TempDir())
+	if err := os.WriteFile("pyproject.toml", contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither poetry nor PyPI may be used.
+	t.Setenv("PATH", t.TempDir())
+	testutil.Offline(t)
+
+	PythonPoetryBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"flask": "^3.0",
+		"rich":  "",
+	}, "")
+
+	config.Dependency = config.DependencyOptional
+	config.Extra = "yaml"
+	t.Cleanup(func() {
+		config.Dependency = config.DependencyRegular
+		config.Extra = ""
+		config.Group = ""
+	})
+	PythonPoetryBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"ruamel.yaml": "",
+	}, "")
+
+	config.Dependency = config.DependencyDev
+	config.Extra = ""
+	PythonPoetryBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"pytest": "^8.0",
+	}, "")
+
+	config.Dependency = config.DependencyGroup
+	config.Group = "docs"
+	PythonPoetryBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"sphinx": "",
+	}, "")
+
+	edited, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := listPoetrySpecfileWithContents(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[api.PkgName]api.PkgSpec{
+		"requests":    "^2.31.0",
+		"psycopg2":    "^2.9",
+		"mysqlclient": "^2.2",
+		"PyYAML":      "^6.0",
+		"flask":       "^3.0",
+		"rich":        "*",
+		"ruamel.yaml": "*",
+		"pytest":      "^8.0",
+		"sphinx":      "*",
+	}
+	if !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+
+	attrs, err := listPoetrySpecfileAttributesWithContents(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]string{"optional": "yes", "extras": "yaml"}, attrs["ruamel.yaml"]) {
+		t.Errorf("expected ruamel.yaml to be an optional part of yaml, got %v", attrs["ruamel.yaml"])
+	}
+	var cfg pyprojectTOML
+	if _, err := toml.Decode(string(edited), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Tool.Poetry.Group["dev"].Dependencies["pytest"]; !ok {
+		t.Errorf("expected pytest in the dev group, got %v", cfg.Tool.Poetry.Group)
+	}
+	if _, ok := cfg.Tool.Poetry.Group["docs"].Dependencies["sphinx"]; !ok {
+		t.Errorf("expected sphinx in the docs group, got %v", cfg.Tool.Poetry.Group)
+	}
+	if util.Exists("poetry.lock") {
+		t.Errorf("expected no lockfile to be written")
+	}
+}
+
+func TestPoetrySortSpecfile(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/extras.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents = append(contents, []byte(`
+[tool.poetry.group.dev.dependencies]
+pytest = "^8.0"
+black = "^24.0"
+`)...)
+
+	testutil.Chdir(t, t.TempDir())
+	if err := os.WriteFile("pyproject.toml", contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	PythonPoetryBackend.SortSpecfile(context.Background())
+
+	sorted, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`[tool.poetry.dependencies]
+python = "^3.10"
+mysqlclient = { version = "^2.2", optional = true }
+psycopg2 = { version = "^2.9", optional = true }
+PyYAML = { version = "^6.0", optional = true }
+requests = "^2.31.0"
+
+[tool.poetry.extras]`, `[tool.poetry.group.dev.dependencies]
+black = "^24.0"
+pytest = "^8.0"
+`} {
+		if !strings.Contains(string(sorted), expected) {
+			t.Errorf("expected pyproject.toml to contain:\n%s\ngot:\n%s", expected, sorted)
+		}
+	}
+}
+
+func TestPipInstallPackages(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	requirements := "--index-url https://pypi.example.test/simple\nFlask>=3.0\nrequests==2.32.3\n"
+	if err := os.WriteFile("requirements.txt", []byte(requirements), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for pip, recording its arguments.
+	binDir := t.TempDir()
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+	if err := os.WriteFile(binDir+"/pip", []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > args.txt\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flags come from requirements.txt, even if nothing
+	// listed the specfile first.
+	b := PythonPipBackend
+	b.InstallPackages(context.Background(), map[api.PkgName]bool{"flask": true})
+
+	args, err := os.ReadFile("args.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"install", "--index-url", "https://pypi.example.test/simple", "Flask>=3.0"}
+	if actual := strings.Split(strings.TrimSpace(string(args)), "\n"); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	contents, err := os.ReadFile("requirements.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != requirements {
+		t.Errorf("requirements.txt changed: %s", contents)
+	}
+}
+
+func TestInfoKeywords(t *testing.T) {
+	testutil.ServeFiles(t, map[string]string{
+		"https://pypi.org/pypi/requests/json": "test_resources/keywords/requests.json",
+	})
+
+	expected := []string{
+		"http",
+		"client",
+		"urllib",
+		"Topic :: Internet :: WWW/HTTP",
+		"Topic :: Software Development :: Libraries",
+	}
+	if keywords := info("requests").Keywords; !reflect.DeepEqual(expected, keywords) {
+		t.Errorf("expected %q, got %q", expected, keywords)
+	}
+
+	// Older metadata separates keywords with spaces.
+	keywords := pypiKeywords(pypiEntryInfo{Keywords: "web framework  wsgi"})
+	if expected := []string{"web", "framework", "wsgi"}; !reflect.DeepEqual(expected, keywords) {
+		t.Errorf("expected %q, got %q", expected, keywords)
+	}
+}
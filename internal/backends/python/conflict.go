@@ -0,0 +1,62 @@
+package python
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// poetryConstraintRegexp matches a dependency edge in the
+// explanation attached to a Poetry SolverProblemError, e.g.
+//
+//	flask (2.2.0) depends on werkzeug (>=2.2.0)
+//	flask (>=2.0,<3.0) requires werkzeug (>=2.0)
+//
+// The requirements of the root project have no version in
+// parentheses after the project name, so they are not matched.
+var poetryConstraintRegexp = regexp.MustCompile(
+	`([A-Za-z0-9][A-Za-z0-9._-]*) \(([^)]+)\) (?:depends on|requires) ([A-Za-z0-9][A-Za-z0-9._-]*) \(([^)]+)\)`,
+)
+
+// parsePoetryConflicts extracts the constraints placed on the package
+// name from a Poetry SolverProblemError.
+func parsePoetryConflicts(output string, name api.PkgName) []api.Conflict {
+	conflicts := []api.Conflict{}
+	seen := map[api.Conflict]bool{}
+	for _, match := range poetryConstraintRegexp.FindAllStringSubmatch(output, -1) {
+		if normalizePackageName(api.PkgName(match[3])) != normalizePackageName(name) {
+			continue
+		}
+		conflict := api.Conflict{
+			Blocker:        match[1],
+			BlockerVersion: match[2],
+			Constraint:     match[4],
+		}
+		if !seen[conflict] {
+			seen[conflict] = true
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+// poetryWhyNot implements WhyNot for python3-poetry.
+func poetryWhyNot(ctx context.Context, name api.PkgName, version api.PkgVersion) []api.Conflict {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetry add --dry-run")
+	defer span.Finish()
+	output, err := util.GetCmdCombinedOutputFallible([]string{
+		"poetry", "add", "--dry-run", string(name) + "==" + string(version),
+	})
+	if err == nil {
+		return []api.Conflict{}
+	}
+	conflicts := parsePoetryConflicts(string(output), name)
+	if len(conflicts) == 0 {
+		util.Die("poetry add --dry-run: %s\n%s", err, output)
+	}
+	return conflicts
+}
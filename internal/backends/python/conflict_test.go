@@ -0,0 +1,28 @@
+package python
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestParsePoetryConflicts(t *testing.T) {
+	output, err := os.ReadFile("test_resources/conflicts/solver-problem.txt")
+	assert.NoError(t, err)
+
+	conflicts := parsePoetryConflicts(string(output), "Werkzeug")
+
+	assert.Equal(t, []api.Conflict{
+		{Blocker: "flask", BlockerVersion: "2.2.5", Constraint: ">=2.2.2"},
+		{Blocker: "flask", BlockerVersion: ">=2.2.5,<3.0.0", Constraint: ">=2.2.2"},
+	}, conflicts)
+}
+
+func TestParsePoetryConflictsUnrelated(t *testing.T) {
+	output, err := os.ReadFile("test_resources/conflicts/solver-problem.txt")
+	assert.NoError(t, err)
+
+	assert.Empty(t, parsePoetryConflicts(string(output), "click"))
+}
@@ -0,0 +1,203 @@
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/BurntSushi/toml"
+)
+
+// poetryLegacyKeys are the keys of [tool.poetry] that Poetry always
+// includes in the content-hash of poetry.lock, as null when they are
+// missing, unless the project uses the [project] table.
+var poetryLegacyKeys = []string{"dependencies", "source", "extras", "dev-dependencies"}
+
+// poetryRelevantKeys are all of the keys of [tool.poetry] that
+// contribute to the content-hash.
+var poetryRelevantKeys = append(append([]string{}, poetryLegacyKeys...), "group")
+
+// poetryRelevantProjectKeys are the keys of the [project] table that
+// contribute to the content-hash, since Poetry 2.0.
+var poetryRelevantProjectKeys = []string{"requires-python", "dependencies", "optional-dependencies"}
+
+// poetryContentHash computes the content-hash that Poetry records in
+// poetry.lock for the given pyproject.toml contents, following
+// Locker._get_content_hash: the relevant parts of the file are dumped
+// with Python's json.dumps(..., sort_keys=True) and hashed with
+// SHA-256.
+func poetryContentHash(contents []byte) (string, error) {
+	var pyproject map[string]interface{}
+	if _, err := toml.Decode(string(contents), &pyproject); err != nil {
+		return "", err
+	}
+	project, _ := pyproject["project"].(map[string]interface{})
+	tool, _ := pyproject["tool"].(map[string]interface{})
+	poetry, _ := tool["poetry"].(map[string]interface{})
+
+	relevantProject := map[string]interface{}{}
+	for _, key := range poetryRelevantProjectKeys {
+		if value, ok := project[key]; ok {
+			relevantProject[key] = value
+		}
+	}
+
+	relevantPoetry := map[string]interface{}{}
+	for _, key := range poetryRelevantKeys {
+		value, ok := poetry[key]
+		if !ok {
+			legacy := false
+			for _, legacyKey := range poetryLegacyKeys {
+				legacy = legacy || key == legacyKey
+			}
+			if !legacy || len(relevantProject) > 0 {
+				continue
+			}
+		}
+		relevantPoetry[key] = value
+	}
+
+	// For backwards compatibility, Poetry hashes the relevant
+	// parts of [tool.poetry] at the top level unless [project]
+	// has any.
+	var relevant interface{} = relevantPoetry
+	if len(relevantProject) > 0 {
+		relevant = map[string]interface{}{
+			"project": relevantProject,
+			"tool":    map[string]interface{}{"poetry": relevantPoetry},
+		}
+	}
+
+	var b strings.Builder
+	if err := writePythonJSON(&b, relevant); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// poetryLockContentHash returns the content-hash recorded in the
+// [metadata] table of the given poetry.lock contents, or the empty
+// string if there is none.
+func poetryLockContentHash(contents []byte) (string, error) {
+	var lockfile struct {
+		Metadata struct {
+			ContentHash string `toml:"content-hash"`
+		} `toml:"metadata"`
+	}
+	if _, err := toml.Decode(string(contents), &lockfile); err != nil {
+		return "", err
+	}
+	return lockfile.Metadata.ContentHash, nil
+}
+
+// writePythonJSON writes value, as decoded from TOML, to b the same
+// way as Python's json.dumps with sort_keys=True and the default
+// separators and ensure_ascii, so that the result can be hashed.
+func writePythonJSON(b *strings.Builder, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(value))
+	case int64:
+		b.WriteString(strconv.FormatInt(value, 10))
+	case float64:
+		switch {
+		case math.IsNaN(value):
+			b.WriteString("NaN")
+		case math.IsInf(value, 1):
+			b.WriteString("Infinity")
+		case math.IsInf(value, -1):
+			b.WriteString("-Infinity")
+		case value == math.Trunc(value) && math.Abs(value) < 1e16:
+			b.WriteString(strconv.FormatFloat(value, 'f', 1, 64))
+		default:
+			b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	case string:
+		writePythonJSONString(b, value)
+	case []interface{}:
+		b.WriteString("[")
+		for i, item := range value {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writePythonJSON(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+	case []map[string]interface{}:
+		items := []interface{}{}
+		for _, item := range value {
+			items = append(items, item)
+		}
+		return writePythonJSON(b, items)
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		// Python sorts by code point, which for strings
+		// without surrogates is the same as sorting UTF-8
+		// bytes.
+		sort.Strings(keys)
+		b.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writePythonJSONString(b, key)
+			b.WriteString(": ")
+			if err := writePythonJSON(b, value[key]); err != nil {
+				return err
+			}
+		}
+		b.WriteString("}")
+	default:
+		// Poetry can't hash dates and times either.
+		return fmt.Errorf("%v is of type %T, which can't be dumped as JSON", value, value)
+	}
+	return nil
+}
+
+// writePythonJSONString writes s to b as a JSON string with ASCII
+// escapes for non-ASCII characters, as Python's json module does.
+func writePythonJSONString(b *strings.Builder, s string) {
+	b.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			switch {
+			case r < 0x20 || (r >= 0x7f && r < 0x10000):
+				fmt.Fprintf(b, `\u%04x`, r)
+			case r >= 0x10000:
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(b, `\u%04x\u%04x`, r1, r2)
+			default:
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteString(`"`)
+}
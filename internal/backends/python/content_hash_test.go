@@ -0,0 +1,88 @@
+package python
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPoetryContentHash(t *testing.T) {
+	testCases := []struct {
+		pyproject string
+		lockfile  string
+		current   bool
+	}{
+		{"pyproject.toml", "poetry.lock", true},
+		// Locked before the docs group was added.
+		{"pyproject.toml", "poetry.stale.lock", false},
+		// Poetry 2 hashes [project] as well.
+		{"project.toml", "project.lock", true},
+		{"project.toml", "poetry.lock", false},
+	}
+
+	for _, tc := range testCases {
+		pyproject, err := os.ReadFile("test_resources/content-hash/" + tc.pyproject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockfile, err := os.ReadFile("test_resources/content-hash/" + tc.lockfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorded, err := poetryLockContentHash(lockfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := poetryContentHash(pyproject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (recorded == expected) != tc.current {
+			t.Errorf("%s with %s: expected current to be %v, got content-hash %s for %s", tc.pyproject, tc.lockfile, tc.current, expected, recorded)
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("pyproject.toml", pyproject, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("poetry.lock", lockfile, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if poetryIsLockfileCurrent(context.Background()) != tc.current {
+			t.Errorf("%s with %s: expected IsLockfileCurrent to be %v", tc.pyproject, tc.lockfile, tc.current)
+		}
+		if err := os.Chdir(cwd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWritePythonJSON(t *testing.T) {
+	// Compared against json.dumps(value, sort_keys=True).
+	value := map[string]interface{}{
+		"version":  "^1.0",
+		"extras":   []interface{}{"a", "b"},
+		"optional": true,
+		"markers":  "sys_platform == \"win32\"",
+		"name":     "café \U0001F600",
+		"count":    int64(3),
+		"weight":   2.0,
+		"source":   nil,
+	}
+	var b strings.Builder
+	if err := writePythonJSON(&b, value); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"count": 3, "extras": ["a", "b"], "markers": "sys_platform == \"win32\"", "name": "caf\u00e9 \ud83d\ude00", "optional": true, "source": null, "version": "^1.0", "weight": 2.0}`
+	if b.String() != expected {
+		t.Errorf("expected %s, got %s", expected, b.String())
+	}
+}
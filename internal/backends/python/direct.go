@@ -0,0 +1,72 @@
+package python
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// wheelFilenamePattern matches the filename of a wheel, as specified
+// by PEP 427, capturing the distribution name.
+var wheelFilenamePattern = regexp.MustCompile(`^([A-Za-z0-9_.]+)-[^-]+(?:-\d[^-]*)?-[^-]+-[^-]+-[^-]+\.whl$`)
+
+// sdistFilenamePattern matches the filename of a source distribution,
+// capturing the distribution name, which ends at the last hyphen
+// followed by a version.
+var sdistFilenamePattern = regexp.MustCompile(`^(.+)-\d[^-]*\.(?:tar\.gz|tar\.bz2|tgz|zip)$`)
+
+// archiveName returns the distribution name of the wheel or source
+// distribution with the given filename, if it follows the naming
+// conventions.
+func archiveName(filename string) (api.PkgName, bool) {
+	if match := wheelFilenamePattern.FindStringSubmatch(filename); match != nil {
+		return api.PkgName(match[1]), true
+	}
+	if match := sdistFilenamePattern.FindStringSubmatch(filename); match != nil {
+		return api.PkgName(match[1]), true
+	}
+	return "", false
+}
+
+// pipDirectReference implements DirectReference for the pip backend,
+// producing a PEP 508 direct reference ("NAME @ URL"). A local
+// archive is referred to by its file:// URL, which is also how pip
+// freeze reports it once installed. Unless given, the name is taken
+// from an #egg= fragment or from the filename of the wheel or source
+// distribution.
+func pipDirectReference(name api.PkgName, ref string) (api.PkgName, api.PkgSpec, error) {
+	var u *url.URL
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		var err error
+		u, err = url.Parse(ref)
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		abs, err := filepath.Abs(ref)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return "", "", err
+		}
+		u = &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	}
+
+	if name == "" {
+		if matches := matchEggComponent.FindStringSubmatch(u.Fragment); matches != nil {
+			name = api.PkgName(matches[1])
+		} else if archive, ok := archiveName(path.Base(u.Path)); ok {
+			name = archive
+		} else {
+			return "", "", fmt.Errorf("can't tell the name of the package at %s; pass it as \"NAME %s\"", ref, ref)
+		}
+	}
+	return name, api.PkgSpec(" @ " + u.String()), nil
+}
@@ -0,0 +1,22 @@
+package python
+
+import (
+	"path/filepath"
+)
+
+// virtualenvBinPath returns the directory holding the executables of
+// the packages installed in venv, or in the project's .venv if venv
+// is empty.
+func virtualenvBinPath(venv string) string {
+	if venv == "" {
+		venv = ".venv"
+	}
+	return filepath.Join(venv, "bin")
+}
+
+// pipxFetchCmd implements FetchCmd for the Python backends, running
+// bin from a temporary virtualenv that pipx installs its package
+// into.
+func pipxFetchCmd(bin string, args []string) []string {
+	return append([]string{"pipx", "run", bin}, args...)
+}
@@ -0,0 +1,238 @@
+package python
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// poetryExtrasHeader matches the header of the [tool.poetry.extras]
+// table in pyproject.toml.
+var poetryExtrasHeader = regexp.MustCompile(`^\s*\[\s*tool\.poetry\.extras\s*\]\s*(#.*)?$`)
+
+// tableHeader matches the header of any TOML table or array of
+// tables.
+var tableHeader = regexp.MustCompile(`^\s*\[`)
+
+// listPoetrySpecfileAttributes implements ListSpecfileAttributes for
+// the Poetry backend.
+func listPoetrySpecfileAttributes() map[api.PkgName]map[string]string {
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.Die("%s", err.Error())
+	}
+	attrs, err := listPoetrySpecfileAttributesWithContents(contents)
+	if err != nil {
+		util.Die("%s", err.Error())
+	}
+	return attrs
+}
+
+// listPoetrySpecfileAttributesWithContents reports which of the
+// dependencies in the given pyproject.toml are optional, and which
+// of Poetry's legacy [tool.poetry.extras] expose them, as well as the
+// groups of those declared outside [tool.poetry.dependencies]. The
+// result is keyed by the dependency names used in pyproject.toml.
+func listPoetrySpecfileAttributesWithContents(contents []byte) (map[api.PkgName]map[string]string, error) {
+	var cfg pyprojectTOML
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		return nil, err
+	}
+
+	// Extras refer to dependencies by name, but may not spell
+	// them the same way.
+	declared := map[api.PkgName]api.PkgName{}
+	for nameStr := range cfg.Tool.Poetry.Dependencies {
+		declared[normalizePackageName(api.PkgName(nameStr))] = api.PkgName(nameStr)
+	}
+
+	extras := map[api.PkgName][]string{}
+	for extra, names := range cfg.Tool.Poetry.Extras {
+		for _, nameStr := range names {
+			name, ok := declared[normalizePackageName(api.PkgName(nameStr))]
+			if !ok {
+				continue
+			}
+			extras[name] = append(extras[name], extra)
+		}
+	}
+
+	attrs := map[api.PkgName]map[string]string{}
+	for nameStr, spec := range cfg.Tool.Poetry.Dependencies {
+		name := api.PkgName(nameStr)
+		pkgAttrs := map[string]string{}
+		if table, ok := spec.(map[string]interface{}); ok {
+			if optional, _ := table["optional"].(bool); optional {
+				pkgAttrs["optional"] = "yes"
+			}
+		}
+		if len(extras[name]) > 0 {
+			sort.Strings(extras[name])
+			pkgAttrs["extras"] = strings.Join(extras[name], ", ")
+		}
+		if len(pkgAttrs) > 0 {
+			attrs[name] = pkgAttrs
+		}
+	}
+
+	// Packages outside the main dependencies get the groups
+	// that declare them, with the legacy dev-dependencies
+	// counting as the dev group.
+	groups := map[api.PkgName][]string{}
+	for nameStr := range cfg.Tool.Poetry.Dependencies {
+		groups[api.PkgName(nameStr)] = []string{"prod"}
+	}
+	legacyDev := map[api.PkgName]bool{}
+	for nameStr := range cfg.Tool.Poetry.DevDependencies {
+		legacyDev[api.PkgName(nameStr)] = true
+		groups[api.PkgName(nameStr)] = append(groups[api.PkgName(nameStr)], "dev")
+	}
+	groupNames := []string{}
+	for group := range cfg.Tool.Poetry.Group {
+		groupNames = append(groupNames, group)
+	}
+	sort.Strings(groupNames)
+	for _, group := range groupNames {
+		for nameStr := range cfg.Tool.Poetry.Group[group].Dependencies {
+			name := api.PkgName(nameStr)
+			if group != "dev" || !legacyDev[name] {
+				groups[name] = append(groups[name], group)
+			}
+		}
+	}
+	for name, pkgGroups := range groups {
+		if name == "python" || (len(pkgGroups) == 1 && pkgGroups[0] == "prod") {
+			continue
+		}
+		if attrs[name] == nil {
+			attrs[name] = map[string]string{}
+		}
+		attrs[name]["group"] = strings.Join(pkgGroups, ", ")
+	}
+	return attrs, nil
+}
+
+// formatPoetryExtra renders one entry of the [tool.poetry.extras]
+// table.
+func formatPoetryExtra(extra string, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return fmt.Sprintf("%s = [%s]", util.TOMLKey(extra), strings.Join(quoted, ", "))
+}
+
+// addToPoetryExtra returns the given pyproject.toml contents with
+// the named packages added to the given extra in the
+// [tool.poetry.extras] table, creating the extra and the table if
+// necessary. Only the affected entry is rewritten, so the rest of the
+// file keeps its formatting.
+func addToPoetryExtra(contents []byte, extra string, names []api.PkgName) ([]byte, error) {
+	var cfg pyprojectTOML
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		return nil, err
+	}
+
+	members := cfg.Tool.Poetry.Extras[extra]
+	present := map[api.PkgName]bool{}
+	for _, name := range members {
+		present[normalizePackageName(api.PkgName(name))] = true
+	}
+	changed := false
+	for _, name := range names {
+		if present[normalizePackageName(name)] {
+			continue
+		}
+		present[normalizePackageName(name)] = true
+		members = append(members, string(name))
+		changed = true
+	}
+	if !changed {
+		return contents, nil
+	}
+	entry := formatPoetryExtra(extra, members)
+
+	lines := strings.Split(string(contents), "\n")
+	header := -1
+	for i, line := range lines {
+		if poetryExtrasHeader.MatchString(line) {
+			header = i
+			break
+		}
+	}
+
+	var result []string
+	if header < 0 {
+		text := strings.TrimRight(string(contents), "\n")
+		result = append(strings.Split(text, "\n"), "", "[tool.poetry.extras]", entry, "")
+	} else {
+		end := len(lines)
+		for i := header + 1; i < len(lines); i++ {
+			if tableHeader.MatchString(lines[i]) {
+				end = i
+				break
+			}
+		}
+
+		keyPattern := regexp.MustCompile(
+			`^\s*("` + regexp.QuoteMeta(extra) + `"|'` + regexp.QuoteMeta(extra) + `'|` + regexp.QuoteMeta(extra) + `)\s*=`,
+		)
+		start, stop := -1, -1
+		for i := header + 1; i < end; i++ {
+			if !keyPattern.MatchString(lines[i]) {
+				continue
+			}
+			// The array may span several lines; it ends on
+			// the line where its brackets balance.
+			start = i
+			depth := 0
+			for j := i; j < end; j++ {
+				depth += strings.Count(lines[j], "[") - strings.Count(lines[j], "]")
+				if depth <= 0 {
+					stop = j
+					break
+				}
+			}
+			break
+		}
+
+		result = append(result, lines[:header+1]...)
+		if start >= 0 && stop >= 0 {
+			result = append(result, lines[header+1:start]...)
+			result = append(result, entry)
+			result = append(result, lines[stop+1:]...)
+		} else {
+			// Add the new extra after the last entry in the
+			// table, ahead of any blank lines separating it
+			// from the next one.
+			last := header
+			for i := header + 1; i < end; i++ {
+				if strings.TrimSpace(lines[i]) != "" {
+					last = i
+				}
+			}
+			result = append(result, lines[header+1:last+1]...)
+			result = append(result, entry)
+			result = append(result, lines[last+1:]...)
+		}
+	}
+
+	edited := []byte(strings.Join(result, "\n"))
+
+	// Make sure that the edit produced what we meant to.
+	var check pyprojectTOML
+	if _, err := toml.Decode(string(edited), &check); err != nil {
+		return nil, fmt.Errorf("pyproject.toml: could not add to extra %q: %s", extra, err)
+	}
+	if len(check.Tool.Poetry.Extras[extra]) != len(members) {
+		return nil, fmt.Errorf("pyproject.toml: could not add to extra %q", extra)
+	}
+	return edited, nil
+}
@@ -0,0 +1,138 @@
+package python
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/api"
+)
+
+func TestListPoetrySpecfileAttributes(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/extras.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, err := listPoetrySpecfileAttributesWithContents(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[api.PkgName]map[string]string{
+		"psycopg2": {
+			"optional": "yes",
+			"extras":   "databases, pgsql",
+		},
+		"mysqlclient": {
+			"optional": "yes",
+			"extras":   "databases",
+		},
+		"PyYAML": {
+			"optional": "yes",
+		},
+	}
+	if !reflect.DeepEqual(expected, attrs) {
+		t.Errorf("expected %v, got %v", expected, attrs)
+	}
+}
+
+func TestListPoetrySpecfileAttributesGroups(t *testing.T) {
+	contents := []byte(`[tool.poetry.dependencies]
+python = "^3.10"
+requests = "^2.31"
+
+[tool.poetry.dev-dependencies]
+black = "*"
+
+[tool.poetry.group.dev.dependencies]
+black = "*"
+pytest = "^8.0"
+
+[tool.poetry.group.docs.dependencies]
+requests = "^2.31"
+sphinx = "*"
+`)
+	attrs, err := listPoetrySpecfileAttributesWithContents(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[api.PkgName]map[string]string{
+		"black":    {"group": "dev"},
+		"pytest":   {"group": "dev"},
+		"requests": {"group": "prod, docs"},
+		"sphinx":   {"group": "docs"},
+	}
+	if !reflect.DeepEqual(expected, attrs) {
+		t.Errorf("expected %v, got %v", expected, attrs)
+	}
+}
+
+func readExtras(t *testing.T, contents []byte) map[string][]string {
+	var cfg pyprojectTOML
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Tool.Poetry.Extras
+}
+
+func TestAddToPoetryExtra(t *testing.T) {
+	contents, err := os.ReadFile("test_resources/pyproject/extras.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding to an existing multiline extra rewrites only that
+	// entry.
+	edited, err := addToPoetryExtra(contents, "databases", []api.PkgName{"pyyaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extras := readExtras(t, edited)
+	expected := map[string][]string{
+		"pgsql":     {"psycopg2"},
+		"databases": {"mysqlclient", "psycopg2", "pyyaml"},
+	}
+	if !reflect.DeepEqual(expected, extras) {
+		t.Errorf("expected %v, got %v", expected, extras)
+	}
+	if !strings.Contains(string(edited), "[build-system]\nrequires = [\"poetry-core\"]") {
+		t.Errorf("expected the rest of the file to be preserved, got:\n%s", edited)
+	}
+
+	// A new extra is appended to the table.
+	edited, err = addToPoetryExtra(contents, "yaml", []api.PkgName{"PyYAML"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extras = readExtras(t, edited)
+	if !reflect.DeepEqual([]string{"PyYAML"}, extras["yaml"]) || len(extras) != 3 {
+		t.Errorf("expected a new yaml extra, got %v", extras)
+	}
+	if !strings.Contains(string(edited), "databases = [\n    \"mysqlclient\",\n    \"psycopg2\",\n]\nyaml = [\"PyYAML\"]\n") {
+		t.Errorf("expected the new extra after the existing ones, got:\n%s", edited)
+	}
+
+	// Names already in the extra are left alone.
+	edited, err = addToPoetryExtra(contents, "pgsql", []api.PkgName{"Psycopg2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(edited) != string(contents) {
+		t.Errorf("expected no change, got:\n%s", edited)
+	}
+
+	// The table is created if there isn't one.
+	plain := []byte("[tool.poetry]\nname = \"my-app\"\n\n[tool.poetry.dependencies]\nrequests = { version = \"^2.31.0\", optional = true }\n")
+	edited, err = addToPoetryExtra(plain, "http", []api.PkgName{"requests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extras = readExtras(t, edited)
+	if !reflect.DeepEqual(map[string][]string{"http": {"requests"}}, extras) {
+		t.Errorf("expected a new extras table, got %v", extras)
+	}
+}
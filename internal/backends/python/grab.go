@@ -2,6 +2,7 @@ package python
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"strings"
 
@@ -243,6 +244,20 @@ var internalModules = map[string]bool{
 	"zoneinfo":        true,
 }
 
+// typesFor implements TypesFor for the Python backends, for the
+// typeshed stubs published as types-NAME and the NAME-stubs packages
+// of PEP 561.
+func typesFor(name api.PkgName) (api.PkgName, bool) {
+	normalized := string(normalizePackageName(name))
+	if typed, ok := strings.CutPrefix(normalized, "types-"); ok && typed != "" {
+		return api.PkgName(typed), true
+	}
+	if typed, ok := strings.CutSuffix(normalized, "-stubs"); ok && typed != "" {
+		return api.PkgName(typed), true
+	}
+	return "", false
+}
+
 func guess(ctx context.Context, python string) (map[api.PkgName]bool, bool) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "python.grab.guess")
 	defer span.Finish()
@@ -251,12 +266,84 @@ func guess(ctx context.Context, python string) (map[api.PkgName]bool, bool) {
 		util.Die("couldn't get working directory: %s", err)
 	}
 
-	foundImportPaths, err := findImports(ctx, cwd)
+	foundImportPaths, ok, err := findImportsWithAST(ctx, python, cwd)
 	if err != nil {
-		util.Die("couldn't guess imports: %s", err)
+		// Python itself isn't usable, so fall back to
+		// tree-sitter.
+		foundImportPaths, err = findImports(ctx, cwd)
+		if err != nil {
+			util.Die("couldn't guess imports: %s", err)
+		}
+		ok = true
+	} else if !ok {
+		// Some files couldn't be parsed by the interpreter
+		// we have, perhaps because they use newer syntax.
+		// tree-sitter is more forgiving, so merge in what it
+		// finds.
+		tsImportPaths, err := findImports(ctx, cwd)
+		for pkg := range tsImportPaths {
+			foundImportPaths[pkg] = true
+		}
+		ok = err == nil
+	}
+
+	pkgs, filtered := filterImports(ctx, foundImportPaths)
+	ok = ok && filtered
+
+	// The project's own modules may map onto its own
+	// distribution name, which is not an external dependency.
+	projectName := readProjectName()
+	for pkg := range pkgs {
+		if isSelfReference(pkg, projectName) {
+			delete(pkgs, pkg)
+		}
+	}
+
+	return pkgs, ok
+}
+
+// astImportsResult represents the output of the find-imports.py
+// resource script.
+type astImportsResult struct {
+	Imports []string `json:"imports"`
+	Errors  []string `json:"errors"`
+}
+
+// findImportsWithAST finds the imports of the Python files in dir
+// using the ast module of the given Python interpreter. It reads the
+// same files as findImports, so that the result doesn't depend on
+// which of them is used, and a virtualenv in the project isn't taken
+// for part of it. Unlike the tree-sitter query, this also finds
+// imports inside functions,
+// conditionals and try blocks, as well as importlib.import_module
+// calls with literal arguments. The second return value is false if
+// some files could not be parsed. An error is returned if the
+// interpreter could not be run at all.
+func findImportsWithAST(ctx context.Context, python string, dir string) (map[string]bool, bool, error) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "python.grab.findImportsWithAST")
+	defer span.Finish()
+	paths, err := util.GuessPaths(dir, pyPathGlobs, pyIgnoreGlobs)
+	if err != nil {
+		return nil, false, err
+	}
+	cmd := append([]string{python, "-c", util.GetResource("/python/find-imports.py")}, paths...)
+	outputB, err := util.GetCmdOutputFallible(cmd)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var result astImportsResult
+	if err := json.Unmarshal(outputB, &result); err != nil {
+		return nil, false, err
+	}
+
+	foundImportPaths := map[string]bool{}
+	for _, pkg := range result.Imports {
+		foundImportPaths[pkg] = true
 	}
 
-	return filterImports(ctx, foundImportPaths)
+	return foundImportPaths, len(result.Errors) == 0, nil
 }
 
 func findImports(ctx context.Context, dir string) (map[string]bool, error) {
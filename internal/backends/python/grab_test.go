@@ -3,7 +3,12 @@ package python
 import (
 	"context"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/replit/upm/internal/api"
 )
 
 func TestParseFile(t *testing.T) {
@@ -55,3 +60,180 @@ import foo #upm package(bar)
 		t.Errorf("Missing imports %v", expected)
 	}
 }
+
+func TestParseFileWithAST(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not available")
+	}
+
+	expected := map[string]bool{
+		"requests":          true,
+		"numpy":             true,
+		"yaml":              true,
+		"simplejson":        true,
+		"json":              true,
+		"flask":             true,
+		"flask_sqlalchemy":  true,
+		"django.db.models":  true,
+		"bar":               true,
+		"importlib":         true,
+		"typing":            true,
+		"conditional.thing": true,
+	}
+
+	content := `
+import requests
+from typing import (
+    Any,
+    Optional,
+)
+import importlib
+
+try:
+    import simplejson as json
+except ImportError:
+    import json
+
+if Optional:
+    import conditional.thing
+
+def load():
+    import numpy
+    from flask import (
+        Flask,
+        request,
+    )
+    return importlib.import_module("yaml")
+
+class Model:
+    from django.db.models import (  # upm package(django)
+        Model,
+    )
+
+import foo  # upm package(bar)
+from . import sibling
+from .relative import thing
+__import__("flask_sqlalchemy")
+`
+
+	testDir := t.TempDir()
+	if err := os.WriteFile(testDir+"/index.py", []byte(content), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+	// Like tree-sitter, only the top-level files are read.
+	if err := os.MkdirAll(testDir+"/pkg", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(testDir+"/pkg/mod.py", []byte("import nested.submodule\n"), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+	if err := os.MkdirAll(testDir+"/venv", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(testDir+"/venv/ignored.py", []byte("import ignored\n"), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+
+	found, ok, err := findImportsWithAST(context.Background(), "python3", testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+	if !ok {
+		t.Error("Expected all files to parse")
+	}
+
+	// The pragma replaces the module name on its line.
+	delete(expected, "django.db.models")
+	expected["django"] = true
+
+	for path := range found {
+		if _, ok := expected[path]; ok {
+			delete(expected, path)
+		} else {
+			t.Errorf("Unexpected import %s", path)
+		}
+	}
+
+	if len(expected) > 0 {
+		t.Errorf("Missing imports %v", expected)
+	}
+}
+
+func TestParseFileWithASTSyntaxError(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not available")
+	}
+
+	testDir := t.TempDir()
+	if err := os.WriteFile(testDir+"/good.py", []byte("import requests\n"), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+	if err := os.WriteFile(testDir+"/bad.py", []byte("import (\n"), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+
+	found, ok, err := findImportsWithAST(context.Background(), "python3", testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+	if ok {
+		t.Error("Expected the syntax error to be reported")
+	}
+	if !found["requests"] {
+		t.Errorf("Expected imports from parseable files, got %v", found)
+	}
+}
+
+func TestFindImportsSkipsVirtualenvs(t *testing.T) {
+	testDir := t.TempDir()
+	files := map[string]string{
+		"main.py":          "import requests\n",
+		".venv/pyvenv.cfg": "home = /usr/bin\n",
+		".venv/lib/python3.11/site-packages/requests/__init__.py": "import chardet\nimport urllib3\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(testDir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(testDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both ways of finding imports read the same files, which
+	// leave out the packages installed in the virtualenv.
+	expected := map[string]bool{"requests": true}
+	found, err := findImports(context.Background(), testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected %v with tree-sitter, got %v", expected, found)
+	}
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not available")
+	}
+	found, ok, err := findImportsWithAST(context.Background(), "python3", testDir)
+	if err != nil || !ok {
+		t.Fatal("Parse failed", err)
+	}
+	if !reflect.DeepEqual(expected, found) {
+		t.Errorf("expected %v with ast, got %v", expected, found)
+	}
+}
+
+func TestTypesFor(t *testing.T) {
+	for name, expected := range map[string]string{
+		"types-requests": "requests",
+		"types-PyYAML":   "pyyaml",
+		"pandas-stubs":   "pandas",
+		"requests":       "",
+		"types-":         "",
+	} {
+		typed, ok := typesFor(api.PkgName(name))
+		if ok != (expected != "") || string(typed) != expected {
+			t.Errorf("expected %s to provide types for %q, got %q (%v)", name, expected, typed, ok)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package python
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// installedDistributions returns the .dist-info directories in the
+// site-packages of the virtualenv at venv, keyed by the normalized
+// name of the distribution they describe.
+func installedDistributions(venv string) map[api.PkgName]string {
+	dists := map[api.PkgName]string{}
+	for _, pattern := range []string{
+		filepath.Join(venv, "lib", "python*", "site-packages", "*.dist-info"),
+		filepath.Join(venv, "Lib", "site-packages", "*.dist-info"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		for _, dir := range matches {
+			base := strings.TrimSuffix(filepath.Base(dir), ".dist-info")
+			if i := strings.LastIndex(base, "-"); i > 0 {
+				dists[normalizePackageName(api.PkgName(base[:i]))] = dir
+			}
+		}
+	}
+	return dists
+}
+
+// distributionVersion returns the version of the distribution whose
+// .dist-info directory is dir, as given by its METADATA, or an error
+// if that is missing or has no version.
+func distributionVersion(dir string) (string, error) {
+	contentsB, err := os.ReadFile(filepath.Join(dir, "METADATA"))
+	if err != nil {
+		return "", fmt.Errorf("%s has no METADATA", filepath.Base(dir))
+	}
+	for _, line := range strings.Split(string(contentsB), "\n") {
+		if line == "" || line == "\r" {
+			// The headers end at the first blank line
+			break
+		}
+		if version, found := strings.CutPrefix(line, "Version:"); found {
+			return strings.TrimSpace(version), nil
+		}
+	}
+	return "", fmt.Errorf("%s/METADATA has no version", filepath.Base(dir))
+}
+
+// pythonInstallHealth checks that each of the named packages is
+// installed in the virtualenv at venv, at the version the lockfile
+// has for it. Packages that aren't in the lockfile are skipped.
+func pythonInstallHealth(venv string, names []api.PkgName, locked map[api.PkgName]api.PkgVersion) (bool, []string) {
+	lockedVersions := map[api.PkgName]api.PkgVersion{}
+	for name, version := range locked {
+		lockedVersions[normalizePackageName(name)] = version
+	}
+	dists := installedDistributions(venv)
+
+	issues := []string{}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	for _, name := range names {
+		normalized := normalizePackageName(name)
+		lockedVersion, ok := lockedVersions[normalized]
+		if !ok {
+			continue
+		}
+		dir, ok := dists[normalized]
+		if !ok {
+			issues = append(issues, fmt.Sprintf("%s is not installed", name))
+			continue
+		}
+		version, err := distributionVersion(dir)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("%s is corrupt: %s", name, err))
+			continue
+		}
+		if version != string(lockedVersion) {
+			issues = append(issues, fmt.Sprintf("%s %s is installed, but the lockfile has %s", name, version, lockedVersion))
+		}
+	}
+	return len(issues) == 0, issues
+}
+
+// poetryInstallHealth implements InstallHealth for Poetry, checking
+// the direct dependencies of the project, other than optional ones,
+// in its virtualenv. Without a virtualenv there is nothing to check,
+// since Poetry may be installing into the system Python.
+func poetryInstallHealth(ctx context.Context) (bool, []string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetryInstallHealth")
+	defer span.Finish()
+	venv := strings.TrimSpace(poetryGetPackageDir())
+	if venv == "" || !util.Exists(venv) {
+		return true, nil
+	}
+	pkgs, err := listPoetrySpecfile()
+	if err != nil {
+		return false, []string{err.Error()}
+	}
+	attrs := listPoetrySpecfileAttributes()
+	names := []api.PkgName{}
+	for name := range pkgs {
+		if attrs[name]["optional"] == "yes" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return pythonInstallHealth(venv, names, listPoetryLockfile())
+}
+
+// pipToolsInstallHealth implements InstallHealth for pip-tools,
+// checking every package of the compiled requirements files, which
+// pip-sync installs exactly, in the active virtualenv. As for Poetry,
+// there is nothing to check without one.
+func pipToolsInstallHealth(ctx context.Context) (bool, []string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pipToolsInstallHealth")
+	defer span.Finish()
+	venv := os.Getenv("VIRTUAL_ENV")
+	if venv == "" || !util.Exists(venv) {
+		return true, nil
+	}
+	locked := map[api.PkgName]api.PkgVersion{}
+	for _, lockfilePkgs := range listPipToolsLockfiles(".") {
+		for name, version := range lockfilePkgs {
+			locked[normalizePackageName(name)] = version
+		}
+	}
+	names := []api.PkgName{}
+	for name := range locked {
+		names = append(names, name)
+	}
+	return pythonInstallHealth(venv, names, locked)
+}
@@ -0,0 +1,57 @@
+package python
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+
+	"github.com/replit/upm/internal/testutil"
+)
+
+func TestPoetryInstallHealth(t *testing.T) {
+	venv, err := filepath.Abs("test_resources/broken-install/venv")
+	assert.NoError(t, err)
+	testutil.Chdir(t, "test_resources/broken-install")
+	t.Setenv("VIRTUAL_ENV", venv)
+
+	// ruamel.yaml is optional, so its absence isn't a problem.
+	ok, issues := PythonPoetryBackend.InstallHealth(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, []string{
+		"flask 3.0.2 is installed, but the lockfile has 3.0.3",
+		"rich is corrupt: rich-13.7.1.dist-info has no METADATA",
+		"urllib3 is not installed",
+	}, issues)
+}
+
+func TestPoetryInstallHealthWithoutVirtualenv(t *testing.T) {
+	fakePoetry(t, "")
+
+	ok, issues := PythonPoetryBackend.InstallHealth(context.Background())
+	assert.True(t, ok)
+	assert.Empty(t, issues)
+}
+
+func TestPipToolsInstallHealth(t *testing.T) {
+	venv, err := filepath.Abs("test_resources/broken-install/venv")
+	assert.NoError(t, err)
+	testutil.Chdir(t, "test_resources/broken-install-pip-tools")
+	t.Setenv("VIRTUAL_ENV", venv)
+
+	// Every compiled package is checked, including urllib3, which
+	// is only pulled in by requests, and pytest from dev.txt.
+	ok, issues := PythonPipToolsBackend.InstallHealth(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, []string{
+		"flask 3.0.2 is installed, but the lockfile has 3.0.3",
+		"rich is corrupt: rich-13.7.1.dist-info has no METADATA",
+		"urllib3 is not installed",
+	}, issues)
+
+	t.Setenv("VIRTUAL_ENV", "")
+	ok, issues = PythonPipToolsBackend.InstallHealth(context.Background())
+	assert.True(t, ok)
+	assert.Empty(t, issues)
+}
@@ -0,0 +1,239 @@
+package python
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"golang.org/x/net/html"
+)
+
+// pypiSimpleIndex is the index pip uses unless told otherwise, and
+// pypiJSONAPI the JSON API that describes its packages.
+const (
+	pypiSimpleIndex = "https://pypi.org/simple"
+	pypiJSONAPI     = "https://pypi.org/pypi"
+)
+
+// pipIndexes are the package index options of a requirements file.
+//
+// See https://pip.pypa.io/en/stable/cli/pip_install/#package-index-options
+type pipIndexes struct {
+	// The --index-url, or "" for PyPI.
+	IndexURL string
+	// Each --extra-index-url, in order.
+	ExtraIndexURLs []string
+	// Each --find-links.
+	FindLinks []string
+	// Whether --no-index was given.
+	NoIndex bool
+}
+
+// parsePipIndexes collects the package index options among the flags
+// of a requirements file. As with pip, a later --index-url overrides
+// an earlier one.
+func parsePipIndexes(flags []PipFlag) pipIndexes {
+	var indexes pipIndexes
+	for _, flag := range flags {
+		parts := strings.Fields(string(flag))
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			value = parts[1]
+		}
+		switch parts[0] {
+		case "-i", "--index-url":
+			indexes.IndexURL = value
+		case "--extra-index-url":
+			indexes.ExtraIndexURLs = append(indexes.ExtraIndexURLs, value)
+		case "-f", "--find-links":
+			indexes.FindLinks = append(indexes.FindLinks, value)
+		case "--no-index":
+			indexes.NoIndex = true
+		}
+	}
+	return indexes
+}
+
+// readPipIndexes returns the package index options of
+// requirements.txt. A missing or unreadable file has none.
+func readPipIndexes() pipIndexes {
+	flags, _, err := ListRequirementsTxt("requirements.txt")
+	if err != nil {
+		return pipIndexes{}
+	}
+	return parsePipIndexes(flags)
+}
+
+// urls returns the simple API URLs of the indexes pip will look
+// packages up in, the primary index first.
+func (p pipIndexes) urls() []string {
+	if p.NoIndex {
+		return nil
+	}
+	primary := p.IndexURL
+	if primary == "" {
+		primary = pypiSimpleIndex
+	}
+	return append([]string{primary}, p.ExtraIndexURLs...)
+}
+
+// settings returns the options as project-level settings, keyed by
+// the name of the flag.
+func (p pipIndexes) settings() map[string]string {
+	settings := map[string]string{}
+	if p.IndexURL != "" {
+		settings["index-url"] = redactURL(p.IndexURL)
+	}
+	if len(p.ExtraIndexURLs) > 0 {
+		redacted := []string{}
+		for _, u := range p.ExtraIndexURLs {
+			redacted = append(redacted, redactURL(u))
+		}
+		settings["extra-index-url"] = strings.Join(redacted, ", ")
+	}
+	if len(p.FindLinks) > 0 {
+		settings["find-links"] = strings.Join(p.FindLinks, ", ")
+	}
+	if p.NoIndex {
+		settings["no-index"] = "true"
+	}
+	return settings
+}
+
+// setEnv exports the options in the environment that pip reads them
+// from, so that they also apply when pip runs itself, for example to
+// install build dependencies in an isolated environment.
+func (p pipIndexes) setEnv() {
+	set := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if err := os.Setenv(key, value); err != nil {
+			util.Die("%s", err)
+		}
+	}
+	set("PIP_INDEX_URL", p.IndexURL)
+	set("PIP_EXTRA_INDEX_URL", strings.Join(p.ExtraIndexURLs, " "))
+	set("PIP_FIND_LINKS", strings.Join(p.FindLinks, " "))
+	if p.NoIndex {
+		set("PIP_NO_INDEX", "1")
+	}
+}
+
+// redactURL hides the password of a URL with credentials, as pip
+// does when it prints one.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxx")
+	}
+	return u.String()
+}
+
+// jsonAPI returns the JSON API that goes with a simple API URL, as
+// served by PyPI and the indexes that mirror its layout: the
+// /pypi/<name>/json endpoints next to /simple.
+func jsonAPI(index string) string {
+	index = strings.TrimSuffix(index, "/")
+	if index == pypiSimpleIndex {
+		return pypiJSONAPI
+	}
+	return strings.TrimSuffix(index, "/simple") + "/pypi"
+}
+
+// isPypi reports whether index is PyPI's.
+func isPypi(index string) bool {
+	return strings.TrimSuffix(index, "/") == pypiSimpleIndex
+}
+
+// pipInfo implements Info for pip, looking the package up in the
+// indexes of requirements.txt in the order pip would.
+func pipInfo(name api.PkgName) api.PkgInfo {
+	if info, ok := selfInfo(name); ok {
+		return info
+	}
+	for _, index := range readPipIndexes().urls() {
+		if info, found := pypiInfo(jsonAPI(index), name); found {
+			return info
+		}
+	}
+	return api.PkgInfo{}
+}
+
+// pipSearch implements Search for pip. The projects of private
+// indexes whose names contain the query come first, followed by the
+// results of PyPI's search if it is one of the indexes.
+func pipSearch(query string) []api.PkgInfo {
+	results := []api.PkgInfo{}
+	seen := map[api.PkgName]bool{}
+	searchesPypi := false
+	for _, index := range readPipIndexes().urls() {
+		if isPypi(index) {
+			searchesPypi = true
+			continue
+		}
+		names, err := simpleIndexProjects(index)
+		if err != nil {
+			util.Warn(context.Background(), util.Warning{
+				Code:    util.WarningRegistry,
+				Message: fmt.Sprintf("%s: %s", redactURL(index), err),
+			})
+			continue
+		}
+		needle := normalizePackageName(api.PkgName(query))
+		for _, name := range names {
+			normalized := normalizePackageName(api.PkgName(name))
+			if strings.Contains(string(normalized), string(needle)) && !seen[normalized] {
+				seen[normalized] = true
+				results = append(results, api.PkgInfo{Name: name})
+			}
+		}
+	}
+	if searchesPypi {
+		for _, result := range searchPypi(query) {
+			if !seen[normalizePackageName(api.PkgName(result.Name))] {
+				results = append(results, result)
+			}
+		}
+	}
+	return results
+}
+
+// simpleIndexProjects returns the names of the projects listed on the
+// root page of a simple API index.
+//
+// See https://packaging.python.org/en/latest/specifications/simple-repository-api/
+func simpleIndexProjects(index string) ([]string, error) {
+	endpoint := strings.TrimSuffix(index, "/") + "/"
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("request failed with %s", resp.Status)
+	}
+	tree, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, anchor := range findNodes(tree, func(node *html.Node) bool {
+		return node.Type == html.ElementNode && node.Data == "a"
+	}) {
+		if name := strings.Trim(collectText(anchor), WhiteSpaceChars); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
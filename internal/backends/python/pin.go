@@ -0,0 +1,98 @@
+package python
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// pinBareAdds replaces the "*" constraint that poetry add leaves in
+// pyproject.toml for a package added without a spec, as older Poetry
+// releases and some plugins do, by a caret range of the version
+// recorded in poetry.lock. Current releases already write "^x.y.z".
+func pinBareAdds(pkgs map[api.PkgName]api.PkgSpec) {
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	lockContents, err := os.ReadFile("poetry.lock")
+	if err != nil {
+		return
+	}
+	path := poetryAddTable()
+	pins, err := poetryUnpinnedAdds(contents, lockContents, path, pkgs)
+	if err != nil {
+		util.Die("%s", err)
+	}
+	if len(pins) == 0 {
+		return
+	}
+	contents, err = util.SetTOMLTableEntries(contents, poetryTableName(path), pins)
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	util.TryWriteAtomic("pyproject.toml", contents)
+}
+
+// poetryUnpinnedAdds returns, for each package added without a spec
+// whose constraint in the table of the given pyproject.toml contents
+// at path is "*", the TOML value of a caret range of the version
+// locked in the given poetry.lock contents. An optional dependency
+// keeps its optional flag; other tables, such as those with extras or
+// a source, are left alone.
+func poetryUnpinnedAdds(contents, lockContents []byte, path []string, pkgs map[api.PkgName]api.PkgSpec) (map[string]string, error) {
+	var cfg map[string]interface{}
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		return nil, err
+	}
+	var lock poetryLock
+	if _, err := toml.Decode(string(lockContents), &lock); err != nil {
+		return nil, err
+	}
+
+	table := cfg
+	for _, key := range path {
+		table, _ = table[key].(map[string]interface{})
+	}
+	declared := map[api.PkgName]string{}
+	for name := range table {
+		declared[normalizePackageName(api.PkgName(name))] = name
+	}
+	locked := map[api.PkgName]string{}
+	for _, pkgObj := range lock.Package {
+		locked[normalizePackageName(api.PkgName(pkgObj.Name))] = pkgObj.Version
+	}
+
+	pins := map[string]string{}
+	for name, spec := range pkgs {
+		if spec != "" {
+			continue
+		}
+		key, ok := declared[normalizePackageName(name)]
+		version := locked[normalizePackageName(name)]
+		if !ok || version == "" {
+			continue
+		}
+		value := strconv.Quote("^" + version)
+		switch entry := table[key].(type) {
+		case string:
+			if entry != "*" {
+				continue
+			}
+		case map[string]interface{}:
+			optional, _ := entry["optional"].(bool)
+			if entry["version"] != "*" || !optional || len(entry) != 2 {
+				continue
+			}
+			value = "{ version = " + value + ", optional = true }"
+		default:
+			continue
+		}
+		pins[key] = value
+	}
+	return pins, nil
+}
@@ -0,0 +1,88 @@
+package python
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/testutil"
+	assert "github.com/stretchr/testify/assert"
+)
+
+const pinLockfile = `[[package]]
+name = "requests"
+version = "2.32.3"
+
+[[package]]
+name = "rich"
+version = "13.7.1"
+
+[[package]]
+name = "ruamel-yaml"
+version = "0.18.6"
+
+[[package]]
+name = "flask"
+version = "3.0.3"
+
+[metadata]
+lock-version = "2.0"
+`
+
+func TestPoetryUnpinnedAdds(t *testing.T) {
+	contents := []byte(`[tool.poetry.dependencies]
+requests = "*"
+rich = "^13.0"
+"ruamel.yaml" = { version = "*", optional = true }
+flask = { version = "*", extras = ["async"] }
+`)
+	pins, err := poetryUnpinnedAdds(contents, []byte(pinLockfile), []string{"tool", "poetry", "dependencies"}, map[api.PkgName]api.PkgSpec{
+		"requests":    "",
+		"rich":        "",
+		"ruamel-yaml": "",
+		"flask":       "",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"requests":    `"^2.32.3"`,
+		"ruamel.yaml": `{ version = "^0.18.6", optional = true }`,
+	}, pins)
+
+	pins, err = poetryUnpinnedAdds(contents, []byte(pinLockfile), []string{"tool", "poetry", "dependencies"}, map[api.PkgName]api.PkgSpec{
+		"requests": "*",
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, pins, "an explicit wildcard is kept")
+}
+
+func TestPoetryBareAddWritesCaret(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	assert.NoError(t, os.WriteFile("pyproject.toml", []byte(`[tool.poetry]
+name = "app"
+
+[tool.poetry.group.dev.dependencies]
+`), 0o644))
+
+	binDir := t.TempDir()
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+	// Stands in for a poetry add that leaves a wildcard behind.
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "poetry"), []byte(`#!/bin/sh
+echo 'requests = "*"' >> pyproject.toml
+cat > poetry.lock <<'EOF'
+`+pinLockfile+`EOF
+`), 0o755))
+	testutil.Offline(t)
+
+	config.Dependency = config.DependencyDev
+	t.Cleanup(func() { config.Dependency = config.DependencyRegular })
+	PythonPoetryBackend.Add(context.Background(), map[api.PkgName]api.PkgSpec{"requests": ""}, "")
+
+	edited, err := os.ReadFile("pyproject.toml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(edited), `[tool.poetry.group.dev.dependencies]
+requests = "^2.32.3"
+`)
+}
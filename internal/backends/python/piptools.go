@@ -0,0 +1,249 @@
+package python
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/nix"
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// pip-tools support
+//
+// pip-compile compiles each requirements file with the .in extension
+// into a fully pinned one of the same name with the .txt extension,
+// e.g. dev.in into dev.txt. requirements.in is the specfile, and its
+// compiled requirements.txt the lockfile, but every .in file beside
+// it is compiled and locked alongside.
+//
+//   https://pip-tools.readthedocs.io/en/stable/
+
+// pipToolsSpecfiles returns the pip-tools input files in dir:
+// requirements.in first, since the others often constrain themselves
+// to its compiled output with -c, and then any other .in files in
+// lexical order.
+func pipToolsSpecfiles(dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.in"))
+	if err != nil {
+		panic(err)
+	}
+	specfiles := []string{}
+	others := []string{}
+	for _, match := range matches {
+		if filepath.Base(match) == "requirements.in" {
+			specfiles = append(specfiles, match)
+		} else {
+			others = append(others, match)
+		}
+	}
+	sort.Strings(others)
+	return append(specfiles, others...)
+}
+
+// pipToolsLockfile returns the file that pip-compile compiles
+// specfile into by default.
+func pipToolsLockfile(specfile string) string {
+	return strings.TrimSuffix(specfile, ".in") + ".txt"
+}
+
+// listCompiledRequirements returns the pinned versions in a file
+// compiled by pip-compile. Unlike ListRequirementsTxt, it takes the
+// version from each "==" pin and skips the hashes that
+// --generate-hashes writes on continuation lines.
+func listCompiledRequirements(path string) (map[api.PkgName]api.PkgVersion, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for scanner := bufio.NewScanner(handle); scanner.Scan(); {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "\\"))
+		name, spec, found := findPackage(line)
+		if !found {
+			continue
+		}
+		version, pinned := strings.CutPrefix(strings.TrimSpace(string(*spec)), "==")
+		if !pinned {
+			continue
+		}
+		pkgs[*name] = api.PkgVersion(version)
+	}
+	return pkgs, nil
+}
+
+// listPipToolsLockfiles returns the pinned versions compiled from
+// each pip-tools input file in dir, keyed by the input file. Input
+// files that haven't been compiled yet are reported and left out.
+func listPipToolsLockfiles(dir string) map[string]map[api.PkgName]api.PkgVersion {
+	lockfiles := map[string]map[api.PkgName]api.PkgVersion{}
+	for _, specfile := range pipToolsSpecfiles(dir) {
+		lockfile := pipToolsLockfile(specfile)
+		if !util.Exists(lockfile) {
+			util.Log(fmt.Sprintf("%s has not been compiled into %s; run upm lock", specfile, lockfile))
+			continue
+		}
+		pkgs, err := listCompiledRequirements(lockfile)
+		if err != nil {
+			util.Die("%s: %s", lockfile, err)
+		}
+		lockfiles[specfile] = pkgs
+	}
+	return lockfiles
+}
+
+// pipToolsRemove removes pkgs from every pip-tools input file in dir,
+// since ListSpecfile lists the packages of all of them.
+func pipToolsRemove(dir string, pkgs map[api.PkgName]bool) error {
+	for _, specfile := range pipToolsSpecfiles(dir) {
+		if err := RemoveFromRequirementsTxt(specfile, pkgs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pipToolsListPackagesForNix returns the packages of every pip-tools
+// input file, skipping those that can't be read.
+func pipToolsListPackagesForNix() []api.PkgName {
+	result := []api.PkgName{}
+	for _, specfile := range pipToolsSpecfiles(".") {
+		_, pkgs, err := ListRequirementsTxt(specfile)
+		if err != nil {
+			continue
+		}
+		for name := range pkgs {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func pipToolsIsAvailable() bool {
+	for _, cmd := range []string{"pip-compile", "pip-sync"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// makePythonPipToolsBackend returns a backend for invoking pip-tools, given an arg0 for invoking Python
+// (either a full path or just a name like "python3") to use when invoking Python.
+func makePythonPipToolsBackend(python string) api.LanguageBackend {
+	b := api.LanguageBackend{
+		Name:                 "python3-pip-tools",
+		Specfile:             "requirements.in",
+		Lockfile:             "requirements.txt",
+		IsAvailable:          pipToolsIsAvailable,
+		Alias:                "python-python3-pip-tools",
+		FilenamePatterns:     []string{"*.py"},
+		Quirks:               api.QuirksNone,
+		SpecSyntax:           api.SpecSyntaxExact,
+		NormalizePackageName: normalizePackageName,
+		GetPackageDir: func() string {
+			if venv := os.Getenv("VIRTUAL_ENV"); venv != "" {
+				return venv
+			}
+			return ""
+		},
+		BinPath: func(ctx context.Context) string {
+			return virtualenvBinPath(os.Getenv("VIRTUAL_ENV"))
+		},
+		FetchCmd:     pipxFetchCmd,
+		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
+
+		Search:          searchPypi,
+		Info:            info,
+		PackageSize:     packageSize,
+		PopularPackages: popularPackages,
+		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pip-tools add")
+			defer span.Finish()
+			checkRequiresPython(pkgs)
+			appendRequirements("requirements.in", pkgs)
+		},
+		AddToSpecfile: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pipToolsAddToSpecfile")
+			defer span.Finish()
+			appendRequirements("requirements.in", pkgs)
+		},
+		AddToSpecfileContents: pipAddToSpecfileContents,
+		DirectReference:       pipDirectReference,
+		RuntimeConstraint:     pythonRuntimeConstraint,
+		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pip-tools remove")
+			defer span.Finish()
+			if err := pipToolsRemove(".", pkgs); err != nil {
+				util.Die("%s", err.Error())
+			}
+		},
+		Lock: func(ctx context.Context) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pip-compile")
+			defer span.Finish()
+			for _, specfile := range pipToolsSpecfiles(".") {
+				util.RunCmd([]string{"pip-compile", "--output-file", pipToolsLockfile(specfile), specfile})
+			}
+		},
+		Install: func(ctx context.Context) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pip-sync")
+			defer span.Finish()
+			cmd := []string{"pip-sync"}
+			for _, specfile := range pipToolsSpecfiles(".") {
+				if lockfile := pipToolsLockfile(specfile); util.Exists(lockfile) {
+					cmd = append(cmd, lockfile)
+				}
+			}
+			util.RunCmd(cmd)
+		},
+		ListSpecfile: func() map[api.PkgName]api.PkgSpec {
+			projectName := readProjectName()
+			pkgs := map[api.PkgName]api.PkgSpec{}
+			for _, specfile := range pipToolsSpecfiles(".") {
+				_, rawPkgs, err := ListRequirementsTxt(specfile)
+				if err != nil {
+					util.Die("%s", err.Error())
+				}
+				for name, spec := range rawPkgs {
+					if isSelfReference(name, projectName) {
+						continue
+					}
+					pkgs[normalizePackageName(name)] = spec
+				}
+			}
+			return pkgs
+		},
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			pkgs := map[api.PkgName]api.PkgVersion{}
+			for _, lockfilePkgs := range listPipToolsLockfiles(".") {
+				for name, version := range lockfilePkgs {
+					pkgs[normalizePackageName(name)] = version
+				}
+			}
+			return pkgs
+		},
+		InstallHealth:                      pipToolsInstallHealth,
+		GuessRegexps:                       pythonGuessRegexps,
+		Guess:                              func(ctx context.Context) (map[api.PkgName]bool, bool) { return guess(ctx, python) },
+		TypesFor:                           typesFor,
+		InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.PythonNixDeps, pipToolsListPackagesForNix),
+	}
+
+	return b
+}
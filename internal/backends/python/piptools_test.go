@@ -0,0 +1,68 @@
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestPipToolsSpecfiles(t *testing.T) {
+	assert.Equal(t, []string{
+		"test_resources/pip-tools/requirements.in",
+		"test_resources/pip-tools/dev.in",
+		"test_resources/pip-tools/docs.in",
+	}, pipToolsSpecfiles("test_resources/pip-tools"))
+
+	assert.Equal(t, "test_resources/pip-tools/dev.txt", pipToolsLockfile("test_resources/pip-tools/dev.in"))
+}
+
+func TestPipToolsLockfiles(t *testing.T) {
+	lockfiles := listPipToolsLockfiles("test_resources/pip-tools")
+
+	assert.Equal(t, map[string]map[api.PkgName]api.PkgVersion{
+		"test_resources/pip-tools/requirements.in": {
+			"blinker":  "1.7.0",
+			"flask":    "3.0.0",
+			"requests": "2.31.0",
+		},
+		"test_resources/pip-tools/dev.in": {
+			"iniconfig": "2.0.0",
+			"pytest":    "7.4.3",
+			"requests":  "2.31.0",
+		},
+	}, lockfiles)
+}
+
+func TestPipToolsRemove(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"requirements.in", "dev.in", "docs.in"} {
+		contents, err := os.ReadFile(filepath.Join("test_resources/pip-tools", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pytest is only in dev.in, and requests in both it and
+	// requirements.in.
+	if err := pipToolsRemove(dir, map[api.PkgName]bool{"pytest": true, "requests": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"requirements.in": "flask>=2.0\n",
+		"dev.in":          "-c requirements.txt\n",
+		"docs.in":         "sphinx\n",
+	} {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, string(contents), name)
+	}
+}
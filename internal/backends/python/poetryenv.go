@@ -0,0 +1,61 @@
+package python
+
+import (
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// readPythonVersionFile returns the Python version requested by the
+// .python-version file in the current directory, as used by pyenv and
+// similar tools, or "" if there is none. Only the first version is
+// used when several are listed.
+func readPythonVersionFile() string {
+	contents, err := os.ReadFile(".python-version")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+// poetryGetPackageDir implements GetPackageDir for the Poetry
+// backend, returning the virtualenv that Poetry uses for the project,
+// or "" if it hasn't created one yet. poetry env info only reports on
+// an existing virtualenv, so this is safe to call from commands that
+// shouldn't create one, such as upm list.
+func poetryGetPackageDir() string {
+	// Check if we're already inside an activated
+	// virtualenv. If so, just use it.
+	if venv := os.Getenv("VIRTUAL_ENV"); venv != "" {
+		return venv
+	}
+
+	outputB, err := util.GetCmdOutputFallible([]string{
+		"poetry", "env", "info", "--path",
+	})
+	if err != nil {
+		// there's no virtualenv configured, so no package directory
+		return ""
+	}
+	return strings.TrimSpace(string(outputB))
+}
+
+// poetryUseEnv makes Poetry create the project's virtualenv with the
+// Python version from .python-version, if there is one and the
+// virtualenv doesn't exist yet, so that the commands that create it
+// (poetry add, install and lock) don't fall back to whichever Python
+// Poetry itself runs on.
+func poetryUseEnv() {
+	version := readPythonVersionFile()
+	if version == "" || poetryGetPackageDir() != "" {
+		return
+	}
+	util.RunCmd([]string{"poetry", "env", "use", version})
+}
@@ -0,0 +1,88 @@
+package python
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+
+	"github.com/replit/upm/internal/testutil"
+)
+
+// fakePoetry changes into a fresh Poetry project and puts a poetry on
+// the PATH that records each invocation in poetry.log. poetry env
+// info --path prints venv, or fails like Poetry does when there is
+// no virtualenv if venv is empty.
+func fakePoetry(t *testing.T, venv string) {
+	testutil.Chdir(t, t.TempDir())
+	assert.NoError(t, os.WriteFile("pyproject.toml", []byte(`[tool.poetry]
+name = "app"
+
+[tool.poetry.dependencies]
+python = "^3.11"
+requests = "^2.32"
+`), 0o644))
+	assert.NoError(t, os.WriteFile("poetry.lock", []byte(pinLockfile), 0o644))
+
+	binDir := t.TempDir()
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/usr/bin:/bin")
+	t.Setenv("VIRTUAL_ENV", "")
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "poetry"), []byte(`#!/bin/sh
+echo "$@" >> poetry.log
+if [ "$1 $2" = "env info" ]; then
+	[ -n "`+venv+`" ] || exit 1
+	echo "`+venv+`"
+fi
+`), 0o755))
+}
+
+// poetryLog returns the poetry commands run so far.
+func poetryLog(t *testing.T) []string {
+	contents, err := os.ReadFile("poetry.log")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(contents)), "\n")
+}
+
+func TestPoetryGetPackageDir(t *testing.T) {
+	fakePoetry(t, "/home/user/.cache/pypoetry/virtualenvs/app-py3.11")
+	assert.Equal(t, "/home/user/.cache/pypoetry/virtualenvs/app-py3.11", PythonPoetryBackend.GetPackageDir())
+	assert.Equal(t, []string{"env info --path"}, poetryLog(t))
+
+	// An activated virtualenv takes precedence.
+	t.Setenv("VIRTUAL_ENV", "/work/.venv")
+	assert.Equal(t, "/work/.venv", PythonPoetryBackend.GetPackageDir())
+}
+
+func TestPoetryReadOnlyCommandsDontCreateEnv(t *testing.T) {
+	fakePoetry(t, "")
+	assert.NoError(t, os.WriteFile(".python-version", []byte("3.11.9\n"), 0o644))
+
+	assert.Equal(t, "", PythonPoetryBackend.GetPackageDir())
+	PythonPoetryBackend.ListSpecfile()
+	PythonPoetryBackend.ListLockfile()
+	for _, cmd := range poetryLog(t) {
+		assert.Equal(t, "env info --path", cmd, "only poetry env info may run")
+	}
+}
+
+func TestPoetryInstallUsesPythonVersion(t *testing.T) {
+	fakePoetry(t, "")
+	assert.NoError(t, os.WriteFile(".python-version", []byte("# pyenv\n3.11.9\n3.12.4\n"), 0o644))
+
+	PythonPoetryBackend.Install(context.Background())
+	assert.Equal(t, []string{"env info --path", "env use 3.11.9", "install"}, poetryLog(t))
+}
+
+func TestPoetryInstallKeepsExistingEnv(t *testing.T) {
+	fakePoetry(t, "/home/user/.cache/pypoetry/virtualenvs/app-py3.12")
+	assert.NoError(t, os.WriteFile(".python-version", []byte("3.11.9\n"), 0o644))
+
+	PythonPoetryBackend.Install(context.Background())
+	assert.Equal(t, []string{"env info --path", "install"}, poetryLog(t))
+}
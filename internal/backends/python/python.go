@@ -9,10 +9,14 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/BurntSushi/toml"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/pkg"
 	"github.com/replit/upm/internal/util"
@@ -26,29 +30,42 @@ var normalizationPattern = regexp.MustCompile(`[-_.]+`)
 // pypiEntryInfoResponse is a wrapper around pypiEntryInfo
 // that matches the format of the REST API
 type pypiEntryInfoResponse struct {
-	Info pypiEntryInfo `json:"info"`
+	Info     pypiEntryInfo                `json:"info"`
+	Releases map[string][]pypiReleaseFile `json:"releases"`
+}
+
+// pypiReleaseFile represents a file uploaded for a release in the
+// PyPI API's single-package lookup.
+type pypiReleaseFile struct {
+	UploadTime string `json:"upload_time_iso_8601"`
 }
 
 // pypiEntryInfo represents the response we get from the
 // PyPI API on doing a single-package lookup.
 type pypiEntryInfo struct {
-	Author        string   `json:"author"`
-	AuthorEmail   string   `json:"author_email"`
-	HomePage      string   `json:"home_page"`
-	License       string   `json:"license"`
-	Name          string   `json:"name"`
-	ProjectURL    string   `json:"project_url"`
-	PackageURL    string   `json:"package_url"`
-	BugTrackerURL string   `json:"bugtrack_url"`
-	DocsURL       string   `json:"docs_url"`
-	RequiresDist  []string `json:"requires_dist"`
-	Summary       string   `json:"summary"`
-	Version       string   `json:"version"`
+	Author         string   `json:"author"`
+	AuthorEmail    string   `json:"author_email"`
+	HomePage       string   `json:"home_page"`
+	License        string   `json:"license"`
+	Name           string   `json:"name"`
+	ProjectURL     string   `json:"project_url"`
+	PackageURL     string   `json:"package_url"`
+	BugTrackerURL  string   `json:"bugtrack_url"`
+	Classifiers    []string `json:"classifiers"`
+	DocsURL        string   `json:"docs_url"`
+	Keywords       string   `json:"keywords"`
+	RequiresDist   []string `json:"requires_dist"`
+	RequiresPython string   `json:"requires_python"`
+	Summary        string   `json:"summary"`
+	Version        string   `json:"version"`
 }
 
 // pyprojectTOML represents the relevant parts of a pyproject.toml
 // file.
 type pyprojectTOML struct {
+	Project struct {
+		Name string `json:"name"`
+	} `json:"project"`
 	Tool struct {
 		Poetry struct {
 			Name string `json:"name"`
@@ -56,17 +73,89 @@ type pyprojectTOML struct {
 			// strings or maps (why?? good lord).
 			Dependencies    map[string]interface{} `json:"dependencies"`
 			DevDependencies map[string]interface{} `json:"dev-dependencies"`
+			// Dependency groups, including the "dev" group
+			// that replaced dev-dependencies in Poetry 1.2.
+			Group map[string]struct {
+				Dependencies map[string]interface{} `json:"dependencies"`
+			} `json:"group"`
+			// Poetry's legacy extras, mapping each extra
+			// to the optional dependencies it pulls in.
+			Extras map[string][]string `json:"extras"`
 		} `json:"poetry"`
 	} `json:"tool"`
 }
 
+// projectName returns the name of the project itself, as declared
+// in either the [project] or [tool.poetry] table, or the empty string
+// if neither declares one.
+func (cfg *pyprojectTOML) projectName() string {
+	if cfg.Project.Name != "" {
+		return cfg.Project.Name
+	}
+	return cfg.Tool.Poetry.Name
+}
+
+// readProjectName returns the project name declared in
+// pyproject.toml, or the empty string if there is no such file or it
+// can't be read.
+func readProjectName() string {
+	var cfg pyprojectTOML
+	if _, err := toml.DecodeFile("pyproject.toml", &cfg); err != nil {
+		return ""
+	}
+	return cfg.projectName()
+}
+
+// isSelfReference returns true if a dependency on name is actually
+// a reference to the project itself, e.g. to pull in one of its own
+// extras as in "my-package[dev]". Such dependencies must not be
+// treated as external packages, since there is nothing to fetch from
+// the registry. The extras requested, if any, don't matter.
+func isSelfReference(name api.PkgName, projectName string) bool {
+	if projectName == "" {
+		return false
+	}
+	nameStr, _, _ := strings.Cut(string(name), "[")
+	return normalizePackageName(api.PkgName(nameStr)) == normalizePackageName(api.PkgName(projectName))
+}
+
+// selfInfo returns the info of the project itself, which is only its
+// name, and true if name refers to it, so that Info doesn't look it
+// up in the registry.
+func selfInfo(name api.PkgName) (api.PkgInfo, bool) {
+	projectName := readProjectName()
+	if !isSelfReference(name, projectName) {
+		return api.PkgInfo{}, false
+	}
+	return api.PkgInfo{Name: projectName}, true
+}
+
 // poetryLock represents the relevant parts of a poetry.lock file, in
 // TOML format.
 type poetryLock struct {
 	Package []struct {
-		Name    string `json:"name"`
-		Version string `json:"version"`
+		Name         string                 `json:"name"`
+		Version      string                 `json:"version"`
+		Dependencies map[string]interface{} `toml:"dependencies"`
 	} `json:"package"`
+	Metadata struct {
+		LockVersion string `toml:"lock-version"`
+	} `json:"metadata"`
+}
+
+// poetryLockVersionError returns an error if the major lock-version
+// of poetry.lock is one we don't know how to parse. Lockfiles from
+// before lock-version was introduced are accepted.
+func poetryLockVersionError(cfg poetryLock) error {
+	if cfg.Metadata.LockVersion == "" {
+		return nil
+	}
+	majorStr, _, _ := strings.Cut(cfg.Metadata.LockVersion, ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return fmt.Errorf("poetry.lock: invalid lock-version %q", cfg.Metadata.LockVersion)
+	}
+	return util.LockfileVersionError("poetry.lock", major, 1, 2)
 }
 
 func pipIsAvailable() bool {
@@ -106,8 +195,24 @@ func normalizePackageName(name api.PkgName) api.PkgName {
 	return api.PkgName(nameStr)
 }
 
+// popularPackages implements PopularPackages for the Python
+// backends.
+func popularPackages() []api.PkgName {
+	return pkg.LoadPopularPackages("/popular/pypi.txt")
+}
+
 func info(name api.PkgName) api.PkgInfo {
-	res, err := api.HttpClient.Get(fmt.Sprintf("https://pypi.org/pypi/%s/json", string(name)))
+	if info, ok := selfInfo(name); ok {
+		return info
+	}
+	info, _ := pypiInfo(pypiJSONAPI, name)
+	return info
+}
+
+// pypiInfo looks up a package in the JSON API at base, which is
+// https://pypi.org/pypi for PyPI, and reports whether it was found.
+func pypiInfo(base string, name api.PkgName) (api.PkgInfo, bool) {
+	res, err := api.HttpClient.Get(fmt.Sprintf("%s/%s/json", base, string(name)))
 
 	if err != nil {
 		util.Die("HTTP Request failed with error: %s", err)
@@ -116,7 +221,7 @@ func info(name api.PkgName) api.PkgInfo {
 	defer res.Body.Close()
 
 	if res.StatusCode == 404 {
-		return api.PkgInfo{}
+		return api.PkgInfo{}, false
 	}
 
 	if res.StatusCode != 200 {
@@ -144,7 +249,9 @@ func info(name api.PkgName) api.PkgInfo {
 			Name:  output.Info.Author,
 			Email: output.Info.AuthorEmail,
 		}.String(),
-		License: output.Info.License,
+		License:        output.Info.License,
+		Keywords:       pypiKeywords(output.Info),
+		RequiresPython: output.Info.RequiresPython,
 	}
 
 	deps := []string{}
@@ -157,13 +264,50 @@ func info(name api.PkgName) api.PkgInfo {
 	}
 	info.Dependencies = deps
 
-	return info
+	// PyPI doesn't report when a project was created, so use
+	// the earliest upload of any of its releases.
+	for _, files := range output.Releases {
+		for _, file := range files {
+			if file.UploadTime == "" {
+				continue
+			}
+			if info.FirstPublished == "" || file.UploadTime < info.FirstPublished {
+				info.FirstPublished = file.UploadTime
+			}
+		}
+	}
+
+	return info, true
+}
+
+// pypiKeywords returns the keywords of a PyPI project followed by its
+// topic classifiers. The keywords are a single string, separated by
+// commas or, in older metadata, by spaces.
+func pypiKeywords(info pypiEntryInfo) []string {
+	separator := func(r rune) bool { return r == ',' }
+	if !strings.Contains(info.Keywords, ",") {
+		separator = unicode.IsSpace
+	}
+	keywords := []string{}
+	for _, keyword := range strings.FieldsFunc(info.Keywords, separator) {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	for _, classifier := range info.Classifiers {
+		if strings.HasPrefix(classifier, "Topic :: ") {
+			keywords = append(keywords, classifier)
+		}
+	}
+	return keywords
 }
 
 func add(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "poetry (init) add")
 	defer span.Finish()
+	checkRequiresPython(pkgs)
+
 	// Initalize the specfile if it doesnt exist
 	if !util.Exists("pyproject.toml") {
 		cmd := []string{"poetry", "init", "--no-interaction"}
@@ -174,8 +318,17 @@ func add(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName stri
 
 		util.RunCmd(cmd)
 	}
+	poetryUseEnv()
 
 	cmd := []string{"poetry", "add"}
+	switch config.Dependency {
+	case config.DependencyDev:
+		cmd = append(cmd, "--group", "dev")
+	case config.DependencyGroup:
+		cmd = append(cmd, "--group", config.Group)
+	case config.DependencyOptional:
+		cmd = append(cmd, "--optional")
+	}
 	for name, spec := range pkgs {
 		name := string(name)
 		spec := string(spec)
@@ -192,6 +345,228 @@ func add(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName stri
 		}
 	}
 	util.RunCmd(cmd)
+	pinBareAdds(pkgs)
+
+	// Poetry has no way to add a dependency to an extra, so edit
+	// the specfile ourselves and bring the lockfile up to date
+	// with the change.
+	if config.Extra != "" {
+		names := []api.PkgName{}
+		for name := range pkgs {
+			names = append(names, name)
+		}
+		contents, err := os.ReadFile("pyproject.toml")
+		if err != nil {
+			util.Die("%s", err.Error())
+		}
+		contents, err = addToPoetryExtra(contents, config.Extra, names)
+		if err != nil {
+			util.Die("%s", err.Error())
+		}
+		util.TryWriteAtomic("pyproject.toml", contents)
+		util.RunCmd([]string{"poetry", "lock", "--no-update"})
+	}
+}
+
+// poetryAddTable returns the path to the table of pyproject.toml that
+// packages are added to, according to config.Dependency: the main
+// dependencies, or those of the dev group or of config.Group.
+func poetryAddTable() []string {
+	switch config.Dependency {
+	case config.DependencyDev:
+		return []string{"tool", "poetry", "group", "dev", "dependencies"}
+	case config.DependencyGroup:
+		return []string{"tool", "poetry", "group", config.Group, "dependencies"}
+	}
+	return []string{"tool", "poetry", "dependencies"}
+}
+
+// poetryTableName returns the TOML name of the table at the given
+// path, e.g. "tool.poetry.dependencies".
+func poetryTableName(path []string) string {
+	keys := []string{}
+	for _, key := range path {
+		keys = append(keys, util.TOMLKey(key))
+	}
+	return strings.Join(keys, ".")
+}
+
+// poetryAddToSpecfile implements AddToSpecfile for the Poetry
+// backend. Packages without a spec get "*". Like add, it honors
+// --dev, --group, --optional and --extra.
+func poetryAddToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetryAddToSpecfile")
+	defer span.Finish()
+	if !util.Exists("pyproject.toml") {
+		util.Die("pyproject.toml does not exist; run upm add without --write-only to create it")
+	}
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	contents, err = poetryAddToSpecfileContents(contents, pkgs, projectName)
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	util.TryWriteAtomic("pyproject.toml", contents)
+}
+
+// poetryAddToSpecfileContents implements AddToSpecfileContents for the
+// Poetry backend.
+func poetryAddToSpecfileContents(contents []byte, pkgs map[api.PkgName]api.PkgSpec, projectName string) ([]byte, error) {
+	table := poetryTableName(poetryAddTable())
+	optional := config.Dependency == config.DependencyOptional
+	deps := map[string]string{}
+	names := []api.PkgName{}
+	for name, spec := range pkgs {
+		if spec == "" {
+			spec = "*"
+		}
+		value := strconv.Quote(string(spec))
+		if optional {
+			value = "{ version = " + value + ", optional = true }"
+		}
+		deps[string(name)] = value
+		names = append(names, name)
+	}
+
+	contents, err := util.SetTOMLTableEntries(contents, table, deps)
+	if err != nil || config.Extra == "" {
+		return contents, err
+	}
+	return addToPoetryExtra(contents, config.Extra, names)
+}
+
+// poetryIsLockfileCurrent implements IsLockfileCurrent for the
+// Poetry backend. It compares the content-hash recorded in
+// poetry.lock with the one computed from pyproject.toml, which
+// changes whenever the dependencies, groups, extras or sources do,
+// so poetry itself isn't needed.
+func poetryIsLockfileCurrent(ctx context.Context) bool {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetryIsLockfileCurrent")
+	defer span.Finish()
+	lockContents, err := os.ReadFile("poetry.lock")
+	if os.IsNotExist(err) {
+		return false
+	} else if err != nil {
+		util.Die("poetry.lock: %s", err)
+	}
+	recorded, err := poetryLockContentHash(lockContents)
+	if err != nil {
+		util.Die("poetry.lock: %s", err)
+	}
+
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	expected, err := poetryContentHash(contents)
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	return recorded == expected
+}
+
+// poetrySortSpecfile implements SortSpecfile for the Poetry backend,
+// sorting the main dependency table and those of every group. The
+// python constraint stays at the top of [tool.poetry.dependencies],
+// where Poetry puts it.
+func poetrySortSpecfile(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetrySortSpecfile")
+	defer span.Finish()
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	var cfg pyprojectTOML
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+
+	tables := []string{"tool.poetry.dependencies", "tool.poetry.dev-dependencies"}
+	groups := []string{}
+	for group := range cfg.Tool.Poetry.Group {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		tables = append(tables, "tool.poetry.group."+util.TOMLKey(group)+".dependencies")
+	}
+
+	contents, err = util.SortTOMLTables(contents, tables, []string{"python"})
+	if err != nil {
+		util.Die("pyproject.toml: %s", err)
+	}
+	util.TryWriteAtomic("pyproject.toml", contents)
+}
+
+// pipAddToSpecfile implements AddToSpecfile for the pip backend,
+// appending the packages to requirements.txt. Packages without a
+// spec are written without a version constraint.
+func pipAddToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pipAddToSpecfile")
+	defer span.Finish()
+	appendRequirements("requirements.txt", pkgs)
+}
+
+// pipAddToSpecfileContents implements AddToSpecfileContents for the
+// pip and pip-tools backends.
+func pipAddToSpecfileContents(contents []byte, pkgs map[api.PkgName]api.PkgSpec, projectName string) ([]byte, error) {
+	return append(contents, requirementsLines(pkgs)...), nil
+}
+
+// pipInstallPackagesCmd returns the pip install command that installs
+// the given packages with the specs that requirements.txt, whose
+// flags and packages are given, declares for them. The file itself
+// isn't passed to pip, so only those packages are installed.
+func pipInstallPackagesCmd(flags []PipFlag, pkgs map[api.PkgName]bool, rawPkgs map[api.PkgName]api.PkgSpec) []string {
+	cmd := []string{"pip", "install"}
+	for _, flag := range flags {
+		// A flag such as "--index-url URL" is one line of the
+		// file but two arguments to pip.
+		cmd = append(cmd, strings.Fields(string(flag))...)
+	}
+	args := []string{}
+	for name, spec := range rawPkgs {
+		if pkgs[normalizePackageName(name)] {
+			args = append(args, string(name)+string(spec))
+		}
+	}
+	sort.Strings(args)
+	return append(cmd, args...)
+}
+
+// appendRequirements appends the packages to the requirements file at
+// path, in order of name, creating it if need be.
+func appendRequirements(path string, pkgs map[api.PkgName]api.PkgSpec) {
+	handle, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		util.Die("Unable to open %s for writing: %s", path, err)
+	}
+	defer handle.Close()
+	if _, err := handle.WriteString(requirementsLines(pkgs)); err != nil {
+		util.Die("Error writing to %s: %s", path, err)
+	}
+}
+
+// requirementsLines returns the lines that appendRequirements appends
+// for the packages.
+func requirementsLines(pkgs map[api.PkgName]api.PkgSpec) string {
+	names := []string{}
+	for name := range pkgs {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	lines := ""
+	for _, name := range names {
+		lines += name + string(pkgs[api.PkgName(name)]) + "\n"
+	}
+	return lines
 }
 
 func searchPypi(query string) []api.PkgInfo {
@@ -205,6 +580,22 @@ func searchPypi(query string) []api.PkgInfo {
 	return results
 }
 
+// listPoetryLockfile implements ListLockfile for Poetry.
+func listPoetryLockfile() map[api.PkgName]api.PkgVersion {
+	var cfg poetryLock
+	if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
+		util.Die("%s", err.Error())
+	}
+	util.WarnOrDie(poetryLockVersionError(cfg))
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, pkgObj := range cfg.Package {
+		name := api.PkgName(pkgObj.Name)
+		version := api.PkgVersion(pkgObj.Version)
+		pkgs[name] = version
+	}
+	return pkgs
+}
+
 // makePythonPoetryBackend returns a backend for invoking poetry, given an arg0 for invoking Python
 // (either a full path or just a name like "python3") to use when invoking Python.
 func makePythonPoetryBackend(python string) api.LanguageBackend {
@@ -216,39 +607,30 @@ func makePythonPoetryBackend(python string) api.LanguageBackend {
 		IsAvailable:      poetryIsAvailable,
 		FilenamePatterns: []string{"*.py"},
 		Quirks: api.QuirksAddRemoveAlsoLocks |
-			api.QuirksAddRemoveAlsoInstalls,
+			api.QuirksAddRemoveAlsoInstalls |
+			api.QuirksAddSupportsExtras,
+		SpecSyntax: api.SpecSyntaxExact,
+		DependencyTypes: []config.DependencyType{
+			config.DependencyDev,
+			config.DependencyOptional,
+			config.DependencyGroup,
+		},
 		NormalizePackageName: normalizePackageName,
-		GetPackageDir: func() string {
-			// Check if we're already inside an activated
-			// virtualenv. If so, just use it.
-			if venv := os.Getenv("VIRTUAL_ENV"); venv != "" {
-				return venv
-			}
-
-			outputB, err := util.GetCmdOutputFallible([]string{
-				"poetry", "env", "list", "--full-path",
-			})
-			if err != nil {
-				// there's no virtualenv configured, so no package directory
-				return ""
-			}
-
-			var path string
-			for _, line := range strings.Split(strings.TrimSpace(string(outputB)), "\n") {
-				var isActive bool
-				path, isActive = strings.CutSuffix(line, " (Activated)")
-				if isActive {
-					break
-				}
-			}
-
-			return path
+		GetPackageDir:        poetryGetPackageDir,
+		InstallHealth:        poetryInstallHealth,
+		BinPath: func(ctx context.Context) string {
+			return virtualenvBinPath(poetryGetPackageDir())
 		},
+		FetchCmd:     pipxFetchCmd,
 		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
 
-		Search: searchPypi,
-		Info:   info,
-		Add:    add,
+		Search:                searchPypi,
+		Info:                  info,
+		PackageSize:           packageSize,
+		PopularPackages:       popularPackages,
+		Add:                   add,
+		AddToSpecfile:         poetryAddToSpecfile,
+		AddToSpecfileContents: poetryAddToSpecfileContents,
 		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "poetry remove")
@@ -259,12 +641,16 @@ func makePythonPoetryBackend(python string) api.LanguageBackend {
 			}
 			util.RunCmd(cmd)
 		},
+		SortSpecfile:      poetrySortSpecfile,
+		RuntimeConstraint: pythonRuntimeConstraint,
 		Lock: func(ctx context.Context) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "poetry lock")
 			defer span.Finish()
+			poetryUseEnv()
 			util.RunCmd([]string{"poetry", "lock", "--no-update"})
 		},
+		IsLockfileCurrent: poetryIsLockfileCurrent,
 		Install: func(ctx context.Context) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "poetry install")
@@ -274,6 +660,7 @@ func makePythonPoetryBackend(python string) api.LanguageBackend {
 			// which happens for example if 'poetry remove' is
 			// interrupted. See
 			// <https://github.com/sdispater/poetry/issues/648>.
+			poetryUseEnv()
 			util.RunCmd([]string{"poetry", "install"})
 		},
 		ListSpecfile: func() map[api.PkgName]api.PkgSpec {
@@ -284,21 +671,20 @@ func makePythonPoetryBackend(python string) api.LanguageBackend {
 
 			return pkgs
 		},
-		ListLockfile: func() map[api.PkgName]api.PkgVersion {
-			var cfg poetryLock
-			if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
-				util.Die("%s", err.Error())
-			}
-			pkgs := map[api.PkgName]api.PkgVersion{}
-			for _, pkgObj := range cfg.Package {
-				name := api.PkgName(pkgObj.Name)
-				version := api.PkgVersion(pkgObj.Version)
-				pkgs[name] = version
+		ListSpecfileAttributes: listPoetrySpecfileAttributes,
+		ListLockfile:           listPoetryLockfile,
+		ListLockfileDependencies: func() map[api.PkgName][]api.PkgName {
+			contents, err := os.ReadFile("poetry.lock")
+			if err != nil {
+				util.Die("poetry.lock: %s", err)
 			}
-			return pkgs
+			return listPoetryLockfileDependencies(contents)
 		},
+		SBOM:         poetrySBOM,
 		GuessRegexps: pythonGuessRegexps,
 		Guess:        func(ctx context.Context) (map[api.PkgName]bool, bool) { return guess(ctx, python) },
+		TypesFor:     typesFor,
+		WhyNot:       poetryWhyNot,
 		InstallReplitNixSystemDependencies: func(ctx context.Context, pkgs []api.PkgName) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "python.InstallReplitNixSystemDependencies")
@@ -342,6 +728,7 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 		Alias:                "python-python3-pip",
 		FilenamePatterns:     []string{"*.py"},
 		Quirks:               api.QuirksAddRemoveAlsoInstalls | api.QuirksNotReproducible,
+		SpecSyntax:           api.SpecSyntaxExact,
 		NormalizePackageName: normalizePackageName,
 		GetPackageDir: func() string {
 			// Check if we're already inside an activated
@@ -359,18 +746,26 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 
 			return ""
 		},
+		BinPath: func(ctx context.Context) string {
+			return virtualenvBinPath(os.Getenv("VIRTUAL_ENV"))
+		},
+		FetchCmd:     pipxFetchCmd,
 		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
 
-		Search: searchPypi,
-		Info:   info,
+		Search:          pipSearch,
+		Info:            pipInfo,
+		PackageSize:     pipPackageSize,
+		PopularPackages: popularPackages,
 		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "pip install")
 			defer span.Finish()
+			checkRequiresPython(pkgs)
 
+			parsePipIndexes(pipFlags).setEnv()
 			cmd := []string{"pip", "install"}
 			for _, flag := range pipFlags {
-				cmd = append(cmd, string(flag))
+				cmd = append(cmd, strings.Fields(string(flag))...)
 			}
 			for name, spec := range pkgs {
 				name := string(name)
@@ -411,6 +806,10 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 				}
 			}
 		},
+		AddToSpecfile:         pipAddToSpecfile,
+		AddToSpecfileContents: pipAddToSpecfileContents,
+		DirectReference:       pipDirectReference,
+		RuntimeConstraint:     pythonRuntimeConstraint,
 		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "pip uninstall")
@@ -431,16 +830,33 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 			span, ctx := tracer.StartSpanFromContext(ctx, "pip install")
 			defer span.Finish()
 
+			readPipIndexes().setEnv()
 			util.RunCmd([]string{"pip", "install", "-r", "requirements.txt"})
 		},
+		InstallPackages: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+			//nolint:ineffassign,wastedassign,staticcheck
+			span, ctx := tracer.StartSpanFromContext(ctx, "pip install")
+			defer span.Finish()
+
+			flags, rawPkgs, err := ListRequirementsTxt("requirements.txt")
+			if err != nil {
+				util.Die("%s", err.Error())
+			}
+			parsePipIndexes(flags).setEnv()
+			util.RunCmd(pipInstallPackagesCmd(flags, pkgs, rawPkgs))
+		},
 		ListSpecfile: func() map[api.PkgName]api.PkgSpec {
 			flags, rawPkgs, err := ListRequirementsTxt("requirements.txt")
 			if err != nil {
 				util.Die("%s", err.Error())
 			}
 
+			projectName := readProjectName()
 			normalizedPkgs := make(map[api.PkgName]api.PkgSpec)
 			for name, spec := range rawPkgs {
+				if isSelfReference(name, projectName) {
+					continue
+				}
 				normalizedPkgs[normalizePackageName(name)] = spec
 			}
 
@@ -449,8 +865,12 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 
 			return normalizedPkgs
 		},
+		ListSpecfileSettings: func() map[string]string {
+			return readPipIndexes().settings()
+		},
 		GuessRegexps: pythonGuessRegexps,
 		Guess:        func(ctx context.Context) (map[api.PkgName]bool, bool) { return guess(ctx, python) },
+		TypesFor:     typesFor,
 		InstallReplitNixSystemDependencies: func(ctx context.Context, pkgs []api.PkgName) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "python.InstallReplitNixSystemDependencies")
@@ -475,14 +895,70 @@ func makePythonPipBackend(python string) api.LanguageBackend {
 	return b
 }
 
+// pythonRuntimeConstraint implements RuntimeConstraint for the
+// Python backends, using the python dependency of Poetry or else the
+// requires-python field of the [project] table in pyproject.toml,
+// which pip projects may also have.
+func pythonRuntimeConstraint() (string, string) {
+	var cfg struct {
+		Project struct {
+			RequiresPython string `toml:"requires-python"`
+		} `toml:"project"`
+		Tool struct {
+			Poetry struct {
+				Dependencies map[string]interface{} `toml:"dependencies"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.DecodeFile("pyproject.toml", &cfg); err != nil {
+		return "python", ""
+	}
+	if constraint, ok := cfg.Tool.Poetry.Dependencies["python"].(string); ok {
+		return "python", constraint
+	}
+	return "python", cfg.Project.RequiresPython
+}
+
+// listPoetryLockfileDependencies implements ListLockfileDependencies
+// for Poetry, using the [package.dependencies] table of each package
+// in poetry.lock.
+func listPoetryLockfileDependencies(contents []byte) map[api.PkgName][]api.PkgName {
+	var cfg poetryLock
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
+		util.Die("poetry.lock: %s", err)
+	}
+	util.WarnOrDie(poetryLockVersionError(cfg))
+	graph := map[api.PkgName][]api.PkgName{}
+	for _, pkgObj := range cfg.Package {
+		name := api.PkgName(pkgObj.Name)
+		if graph[name] == nil {
+			graph[name] = []api.PkgName{}
+		}
+		for dependency := range pkgObj.Dependencies {
+			graph[name] = append(graph[name], api.PkgName(dependency))
+		}
+		sort.Slice(graph[name], func(i, j int) bool { return graph[name][i] < graph[name][j] })
+	}
+	return graph
+}
+
 func listPoetrySpecfile() (map[api.PkgName]api.PkgSpec, error) {
+	contents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		return nil, err
+	}
+	return listPoetrySpecfileWithContents(contents)
+}
+
+func listPoetrySpecfileWithContents(contents []byte) (map[api.PkgName]api.PkgSpec, error) {
 	var cfg pyprojectTOML
-	if _, err := toml.DecodeFile("pyproject.toml", &cfg); err != nil {
+	if _, err := toml.Decode(string(contents), &cfg); err != nil {
 		return nil, err
 	}
+	projectName := cfg.projectName()
 	pkgs := map[api.PkgName]api.PkgSpec{}
 	for nameStr, spec := range cfg.Tool.Poetry.Dependencies {
-		if nameStr == "python" {
+		if nameStr == "python" || isSelfReference(api.PkgName(nameStr), projectName) {
 			continue
 		}
 
@@ -492,16 +968,24 @@ func listPoetrySpecfile() (map[api.PkgName]api.PkgSpec, error) {
 		}
 		pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
 	}
-	for nameStr, spec := range cfg.Tool.Poetry.DevDependencies {
-		if nameStr == "python" {
-			continue
-		}
+	sections := []map[string]interface{}{cfg.Tool.Poetry.DevDependencies}
+	for _, group := range cfg.Tool.Poetry.Group {
+		sections = append(sections, group.Dependencies)
+	}
+	for _, section := range sections {
+		for nameStr, spec := range section {
+			if nameStr == "python" || isSelfReference(api.PkgName(nameStr), projectName) {
+				continue
+			}
 
-		specStr := normalizeSpec(spec)
-		if specStr == "" {
-			continue
+			specStr := normalizeSpec(spec)
+			if specStr == "" {
+				continue
+			}
+			if _, ok := pkgs[api.PkgName(nameStr)]; !ok {
+				pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+			}
 		}
-		pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
 	}
 
 	return pkgs, nil
@@ -525,3 +1009,7 @@ func getPython3() string {
 // PythonPoetryBackend is a UPM backend for Python 3 that uses Poetry.
 var PythonPoetryBackend = makePythonPoetryBackend(getPython3())
 var PythonPipBackend = makePythonPipBackend(getPython3())
+
+// PythonPipToolsBackend is a UPM backend for Python 3 that uses
+// pip-tools.
+var PythonPipToolsBackend = makePythonPipToolsBackend(getPython3())
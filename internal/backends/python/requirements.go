@@ -21,7 +21,10 @@ var pep345Name = `(?:[A-Z0-9]|[A-Z0-9][A-Z0-9._-]*[A-Z0-9])`
 var pep440VersionComponent = `(?:(?:~=|!=|===|==|>=|<=|>|<)\s*[^, ]+)`
 var pep440VersionSpec = pep440VersionComponent + `(?:\s*,\s*` + pep440VersionComponent + `)*`
 var extrasSpec = `\[(` + pep345Name + `(?:\s*,\s*` + pep345Name + `)*)\]`
-var matchPackageAndSpec = regexp.MustCompile(`(?i)^\s*(` + pep345Name + `)\s*` + `((?:` + extrasSpec + `)?\s*(?:` + pep440VersionSpec + `)?)?\s*$`)
+
+// A PEP 508 direct reference, as in "name @ https://...".
+var pep508URLSpec = `@\s*\S+`
+var matchPackageAndSpec = regexp.MustCompile(`(?i)^\s*(` + pep345Name + `)\s*` + `((?:` + extrasSpec + `)?\s*(?:` + pep440VersionSpec + `|` + pep508URLSpec + `)?)?\s*$`)
 var matchEggComponent = regexp.MustCompile(`(?i)\begg=(` + pep345Name + `)(?:$|[^A-Z0-9])`)
 
 // Global options:
@@ -113,7 +116,10 @@ func recurseRequirementsTxt(depth int, path string, sofar map[api.PkgName]api.Pk
 			// -c constraints.txt
 			//
 			// TODO: Accumulate constraints to pass to underlyling pip
-		} else if parts := strings.SplitN(line, " ", 2); len(parts) > 1 && knownFlags[parts[0]] {
+		} else if knownFlags[line] {
+			// A flag without a value, such as --no-index
+			flags = append(flags, PipFlag(line))
+		} else if parts := splitFlag(line); len(parts) > 1 && knownFlags[parts[0]] {
 			flags = append(flags, PipFlag(strings.Join(parts, " ")))
 			// If we find an editable package, try to extract the package name out of the URI
 			// This both shows that package in the `upm list` output, as well as prevents upm
@@ -131,6 +137,15 @@ func recurseRequirementsTxt(depth int, path string, sofar map[api.PkgName]api.Pk
 	return flags, sofar, constraints, nil
 }
 
+// splitFlag splits a line such as "--index-url URL" or
+// "--index-url=URL" into the flag and its value.
+func splitFlag(line string) []string {
+	if flag, value, found := strings.Cut(line, "="); found && strings.HasPrefix(flag, "--") && !strings.ContainsAny(flag, " \t") {
+		return []string{flag, strings.TrimSpace(value)}
+	}
+	return strings.SplitN(line, " ", 2)
+}
+
 func ListRequirementsTxt(path string) ([]PipFlag, map[api.PkgName]api.PkgSpec, error) {
 	flags, result, _, err := recurseRequirementsTxt(0, path, make(map[api.PkgName]api.PkgSpec), make(Constraints))
 	return flags, result, err
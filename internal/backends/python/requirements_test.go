@@ -38,6 +38,8 @@ func TestSpecParser(t *testing.T) {
 		"SomeProjectExtras":       "[foo, bar]",
 		"SomeProjectCompatible":   "~= 1.4.2",
 		"SomeProjectExtrasRange":  "[security] >= 2.8.1, == 2.8.*",
+		"SomeProjectURL":          "@ https://example.com/SomeProjectURL-1.0-py3-none-any.whl",
+		"SomeProjectExtrasURL":    "[foo] @ file:///tmp/SomeProjectExtrasURL-1.0.tar.gz",
 	}, deps)
 }
 
@@ -49,3 +51,18 @@ func TestRequirementsNotFound(t *testing.T) {
 
 	assert.NotEmpty(t, err)
 }
+
+func TestArchiveName(t *testing.T) {
+	testCases := map[string]api.PkgName{
+		"requests-2.31.0-py3-none-any.whl":                    "requests",
+		"zope.interface-6.2-1-cp311-cp311-manylinux_2_17.whl": "zope.interface",
+		"my_lib-1.0.tar.gz":                                   "my_lib",
+		"python-dateutil-2.9.0.zip":                           "python-dateutil",
+		"not-an-archive.txt":                                  "",
+	}
+	for filename, expected := range testCases {
+		name, ok := archiveName(filename)
+		assert.Equal(t, expected, name, filename)
+		assert.Equal(t, expected != "", ok, filename)
+	}
+}
@@ -0,0 +1,78 @@
+package python
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/util"
+)
+
+// requiresPythonProblems returns a description of each of the given
+// packages whose requires_python, as reported by getInfo, excludes a
+// Python release that the project's constraint allows. Only the
+// latest release of a package is known, so a package whose spec
+// doesn't allow it can't be checked, and neither can one added by URL
+// or path.
+func requiresPythonProblems(project string, pkgs map[api.PkgName]api.PkgSpec, getInfo func(api.PkgName) api.PkgInfo) []string {
+	if project == "" {
+		return nil
+	}
+	names := []string{}
+	for name := range pkgs {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	problems := []string{}
+	for _, name := range names {
+		spec := string(pkgs[api.PkgName(name)])
+		if strings.ContainsAny(spec, ":/@") {
+			continue
+		}
+		// The requirements of a package don't depend on which
+		// of its extras are requested.
+		name, _, _ = strings.Cut(name, "[")
+		info := getInfo(api.PkgName(name))
+		if info.RequiresPython == "" {
+			continue
+		}
+		if spec != "" {
+			latest, err := version.NewVersion(info.Version)
+			if err != nil || !pkg.SatisfiesConstraint(api.SpecSyntaxExact, spec, latest) {
+				continue
+			}
+		}
+		if excluded, ok := pkg.PythonIncompatibility(project, info.RequiresPython); ok {
+			problems = append(problems, fmt.Sprintf(
+				"%s %s requires Python %s, but the project allows Python %s (%s)",
+				info.Name, info.Version, info.RequiresPython, excluded, project,
+			))
+		}
+	}
+	return problems
+}
+
+// checkRequiresPython warns about each of the packages about to be
+// added whose requires_python excludes a Python release that the
+// project allows, since the resolver would otherwise fail with a
+// confusing error (or pick an old version). With
+// --refuse-incompatible, it refuses to add them instead.
+func checkRequiresPython(pkgs map[api.PkgName]api.PkgSpec) {
+	_, project := pythonRuntimeConstraint()
+	problems := requiresPythonProblems(project, pkgs, info)
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		util.Warn(context.Background(), util.Warning{Code: util.WarningIncompatible, Message: problem})
+	}
+	if config.RefuseIncompatible {
+		util.Die("refusing to add packages that don't support every Python version the project allows; narrow the project's Python constraint, or add a compatible version")
+	}
+}
@@ -0,0 +1,55 @@
+package python
+
+import (
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestInfoRequiresPython(t *testing.T) {
+	testutil.ServeFiles(t, map[string]string{
+		"https://pypi.org/pypi/numpy/json": "test_resources/requires-python/numpy.json",
+	})
+
+	assert.Equal(t, ">=3.10", info("numpy").RequiresPython)
+}
+
+func TestRequiresPythonProblems(t *testing.T) {
+	infos := map[api.PkgName]api.PkgInfo{
+		"numpy":    {Name: "numpy", Version: "2.1.0", RequiresPython: ">=3.10"},
+		"requests": {Name: "requests", Version: "2.32.3", RequiresPython: ">=3.8"},
+		"legacy":   {Name: "legacy", Version: "0.9.0"},
+	}
+	getInfo := func(name api.PkgName) api.PkgInfo { return infos[name] }
+
+	// numpy 2.1.0 doesn't support Python 3.9, which the project
+	// allows.
+	problems := requiresPythonProblems("^3.9", map[api.PkgName]api.PkgSpec{
+		"numpy":    "",
+		"requests": "",
+		"legacy":   "",
+	}, getInfo)
+	assert.Equal(t, []string{
+		"numpy 2.1.0 requires Python >=3.10, but the project allows Python 3.9 (^3.9)",
+	}, problems)
+
+	// Requesting extras doesn't change the requirement.
+	problems = requiresPythonProblems(">=3.9,<3.13", map[api.PkgName]api.PkgSpec{"numpy[dev]": "^2.0"}, getInfo)
+	assert.Len(t, problems, 1)
+
+	// A project that only supports newer Pythons is fine.
+	assert.Empty(t, requiresPythonProblems("^3.11", map[api.PkgName]api.PkgSpec{"numpy": ""}, getInfo))
+
+	// An older version of numpy may support Python 3.9, but its
+	// requirements aren't known, and neither are those of a
+	// package added by URL.
+	assert.Empty(t, requiresPythonProblems("^3.9", map[api.PkgName]api.PkgSpec{
+		"numpy":  "^1.24",
+		"legacy": "@ https://example.com/legacy-0.9.0.tar.gz",
+	}, getInfo))
+
+	// Without a constraint on Python, there is nothing to check.
+	assert.Empty(t, requiresPythonProblems("", map[api.PkgName]api.PkgSpec{"numpy": ""}, getInfo))
+}
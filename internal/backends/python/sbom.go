@@ -0,0 +1,114 @@
+package python
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// poetrySBOMComponents returns the components of an SBOM for the
+// given poetry.lock contents, and the project described by the given
+// pyproject.toml contents as the root, if it is named. poetry.lock
+// doesn't record licenses, so they are left out.
+func poetrySBOMComponents(lockContents []byte, pyprojectContents []byte) (*pkg.SBOMComponent, []pkg.SBOMComponent, error) {
+	var cfg poetryLock
+	if _, err := toml.Decode(string(lockContents), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("poetry.lock: %s", err)
+	}
+	util.WarnOrDie(poetryLockVersionError(cfg))
+
+	// poetry.lock only has one version of each package, so a
+	// dependency can be found by name.
+	purls := map[api.PkgName]string{}
+	for _, pkgObj := range cfg.Package {
+		purls[normalizePackageName(api.PkgName(pkgObj.Name))] = pkg.PackageURL("pypi", pkgObj.Name, pkgObj.Version)
+	}
+	dependsOn := func(names []string) []string {
+		result := []string{}
+		for _, name := range names {
+			if purl, ok := purls[normalizePackageName(api.PkgName(name))]; ok {
+				result = append(result, purl)
+			}
+		}
+		return result
+	}
+
+	components := []pkg.SBOMComponent{}
+	for _, pkgObj := range cfg.Package {
+		names := []string{}
+		for name := range pkgObj.Dependencies {
+			names = append(names, name)
+		}
+		components = append(components, pkg.SBOMComponent{
+			Name:      pkgObj.Name,
+			Version:   pkgObj.Version,
+			PURL:      pkg.PackageURL("pypi", pkgObj.Name, pkgObj.Version),
+			DependsOn: dependsOn(names),
+		})
+	}
+
+	var project struct {
+		Project struct {
+			Name    string `toml:"name"`
+			Version string `toml:"version"`
+		} `toml:"project"`
+		Tool struct {
+			Poetry struct {
+				Name    string `toml:"name"`
+				Version string `toml:"version"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.Decode(string(pyprojectContents), &project); err != nil {
+		return nil, nil, fmt.Errorf("pyproject.toml: %s", err)
+	}
+	name, version := project.Project.Name, project.Project.Version
+	if name == "" {
+		name, version = project.Tool.Poetry.Name, project.Tool.Poetry.Version
+	}
+	if name == "" {
+		return nil, components, nil
+	}
+
+	specfilePkgs, err := listPoetrySpecfileWithContents(pyprojectContents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pyproject.toml: %s", err)
+	}
+	names := []string{}
+	for name := range specfilePkgs {
+		names = append(names, string(name))
+	}
+	root := &pkg.SBOMComponent{
+		Name:      name,
+		Version:   version,
+		PURL:      pkg.PackageURL("pypi", name, version),
+		DependsOn: dependsOn(names),
+	}
+	return root, components, nil
+}
+
+// poetrySBOM implements SBOM for the Poetry backend.
+func poetrySBOM(ctx context.Context, format string) ([]byte, error) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetrySBOM")
+	defer span.Finish()
+	lockContents, err := os.ReadFile("poetry.lock")
+	if err != nil {
+		return nil, err
+	}
+	pyprojectContents, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		return nil, err
+	}
+	root, components, err := poetrySBOMComponents(lockContents, pyprojectContents)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.SBOM(format, root, components)
+}
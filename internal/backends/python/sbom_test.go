@@ -0,0 +1,47 @@
+package python
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/replit/upm/internal/pkg"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestPoetrySBOMComponents(t *testing.T) {
+	lockContents, err := os.ReadFile("test_resources/sbom/poetry.lock")
+	assert.NoError(t, err)
+	pyprojectContents, err := os.ReadFile("test_resources/sbom/pyproject.toml")
+	assert.NoError(t, err)
+
+	root, components, err := poetrySBOMComponents(lockContents, pyprojectContents)
+	assert.NoError(t, err)
+
+	// python is a constraint on the interpreter, not a package, so
+	// it is left out.
+	sort.Strings(root.DependsOn)
+	assert.Equal(t, &pkg.SBOMComponent{
+		Name:    "my_app",
+		Version: "0.1.0",
+		PURL:    "pkg:pypi/my-app@0.1.0",
+		DependsOn: []string{
+			"pkg:pypi/requests@2.31.0",
+			"pkg:pypi/typing-extensions@4.9.0",
+		},
+	}, root)
+
+	sort.Slice(components, func(i, j int) bool { return components[i].PURL < components[j].PURL })
+	for i := range components {
+		sort.Strings(components[i].DependsOn)
+	}
+	assert.Equal(t, []pkg.SBOMComponent{
+		{Name: "certifi", Version: "2023.11.17", PURL: "pkg:pypi/certifi@2023.11.17", DependsOn: []string{}},
+		{Name: "requests", Version: "2.31.0", PURL: "pkg:pypi/requests@2.31.0", DependsOn: []string{
+			"pkg:pypi/certifi@2023.11.17",
+			"pkg:pypi/urllib3@2.1.0",
+		}},
+		{Name: "typing-extensions", Version: "4.9.0", PURL: "pkg:pypi/typing-extensions@4.9.0", DependsOn: []string{}},
+		{Name: "urllib3", Version: "2.1.0", PURL: "pkg:pypi/urllib3@2.1.0", DependsOn: []string{}},
+	}, components)
+}
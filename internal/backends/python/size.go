@@ -0,0 +1,92 @@
+package python
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/replit/upm/internal/api"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// pypiReleaseResponse is the part of the JSON API's lookup of one
+// release of a project that pypiSize reads: the files of the release.
+type pypiReleaseResponse struct {
+	URLs []struct {
+		PackageType string `json:"packagetype"`
+		Size        int64  `json:"size"`
+	} `json:"urls"`
+}
+
+// pypiSize looks up the size of a release of a project, or of its
+// latest one if version is empty, in the JSON API at base, which is
+// https://pypi.org/pypi for PyPI. The registry doesn't know how large
+// a release is once installed, so this is the size of its largest
+// wheel, or of its sdist if it has no wheels, which understates it.
+func pypiSize(base string, name api.PkgName, version api.PkgVersion) (int64, bool) {
+	endpoint := fmt.Sprintf("%s/%s/json", base, string(name))
+	if version != "" {
+		endpoint = fmt.Sprintf("%s/%s/%s/json", base, string(name), string(version))
+	}
+	res, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return 0, false
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return 0, false
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, false
+	}
+	var output pypiReleaseResponse
+	if err := json.Unmarshal(body, &output); err != nil {
+		return 0, false
+	}
+
+	var wheel, sdist int64
+	for _, file := range output.URLs {
+		switch file.PackageType {
+		case "bdist_wheel":
+			if file.Size > wheel {
+				wheel = file.Size
+			}
+		case "sdist":
+			if file.Size > sdist {
+				sdist = file.Size
+			}
+		}
+	}
+	switch {
+	case wheel > 0:
+		return wheel, true
+	case sdist > 0:
+		return sdist, true
+	}
+	return 0, false
+}
+
+// packageSize implements PackageSize for the Python backends that
+// use PyPI.
+func packageSize(ctx context.Context, name api.PkgName, version api.PkgVersion) (int64, bool) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "python.packageSize")
+	defer span.Finish()
+	return pypiSize(pypiJSONAPI, name, version)
+}
+
+// pipPackageSize implements PackageSize for pip, looking the package
+// up in the indexes of requirements.txt in the order pip would.
+func pipPackageSize(ctx context.Context, name api.PkgName, version api.PkgVersion) (int64, bool) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pipPackageSize")
+	defer span.Finish()
+	for _, index := range readPipIndexes().urls() {
+		if size, ok := pypiSize(jsonAPI(index), name, version); ok {
+			return size, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package python
+
+import (
+	"context"
+	"testing"
+
+	"github.com/replit/upm/internal/testutil"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestPackageSize(t *testing.T) {
+	registry := testutil.ServeFiles(t, map[string]string{
+		"https://pypi.org/pypi/requests/json":        "test_resources/size/requests-2.32.3.json",
+		"https://pypi.org/pypi/requests/2.32.3/json": "test_resources/size/requests-2.32.3.json",
+		"https://pypi.org/pypi/docopt/0.6.2/json":    "test_resources/size/docopt-0.6.2.json",
+	})
+
+	// The wheel is preferred over the sdist.
+	size, ok := packageSize(context.Background(), "requests", "")
+	assert.True(t, ok)
+	assert.Equal(t, int64(64928), size)
+	size, ok = packageSize(context.Background(), "requests", "2.32.3")
+	assert.True(t, ok)
+	assert.Equal(t, int64(64928), size)
+
+	// Without wheels, the sdist is used.
+	size, ok = packageSize(context.Background(), "docopt", "0.6.2")
+	assert.True(t, ok)
+	assert.Equal(t, int64(25901), size)
+
+	_, ok = packageSize(context.Background(), "no-such-project", "")
+	assert.False(t, ok)
+	assert.Len(t, registry.Requests, 4)
+}
@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// replitFile represents the relevant parts of a .replit file.
+type replitFile struct {
+	// The language of the Repl, in older .replit files, e.g.
+	// "python3".
+	Language string `toml:"language"`
+
+	// The Nix modules the Repl uses, e.g. "python-3.10:v18-...".
+	Modules []string `toml:"modules"`
+}
+
+// replitLanguages maps the names of languages used by .replit and
+// replit.nix, with any version removed, to --lang values.
+var replitLanguages = map[string]string{
+	"python":     "python",
+	"nodejs":     "nodejs",
+	"node":       "nodejs",
+	"javascript": "nodejs",
+	"typescript": "nodejs",
+	"bun":        "bun",
+	"ruby":       "ruby",
+	"dart":       "dart",
+	"java":       "java",
+	"jdk":        "java",
+	"maven":      "java",
+	"r":          "rlang",
+	"rlang":      "rlang",
+	"dotnet":     "dotnet",
+	"csharp":     "dotnet",
+	"fsharp":     "dotnet",
+	"rust":       "rust",
+	"cargo":      "rust",
+	"rustc":      "rust",
+	"php":        "php",
+	"emacs":      "elisp",
+	"elisp":      "elisp",
+}
+
+// replitLanguagePrefix matches the name of a language at the start of
+// a .replit language or module, or of a Nix package name, before any
+// version (as in "python3", "nodejs-20" or "php82").
+var replitLanguagePrefix = regexp.MustCompile(`^[A-Za-z]+`)
+
+// replitNixPackage matches a package in the deps of replit.nix,
+// capturing its name.
+var replitNixPackage = regexp.MustCompile(`\bpkgs\.([A-Za-z][A-Za-z0-9_-]*)`)
+
+// replitLanguage returns the --lang value for a language, module or
+// Nix package name from .replit or replit.nix, or "" if it isn't a
+// language upm knows.
+func replitLanguage(name string) string {
+	return replitLanguages[strings.ToLower(replitLanguagePrefix.FindString(name))]
+}
+
+// replitLanguageHint returns the --lang value that the .replit file
+// (its language field, or else its first module for a known
+// language) or failing that replit.nix (its first package for a
+// known language) points to, or "" if neither does. Files that are
+// missing or can't be parsed give no hint.
+func replitLanguageHint() string {
+	var cfg replitFile
+	if _, err := toml.DecodeFile(".replit", &cfg); err == nil {
+		if language := replitLanguage(cfg.Language); language != "" {
+			return language
+		}
+		for _, module := range cfg.Modules {
+			if language := replitLanguage(module); language != "" {
+				return language
+			}
+		}
+	}
+
+	contentsB, err := os.ReadFile("replit.nix")
+	if err != nil {
+		return ""
+	}
+	for _, match := range replitNixPackage.FindAllStringSubmatch(string(contentsB), -1) {
+		if language := replitLanguage(match[1]); language != "" {
+			return language
+		}
+	}
+	return ""
+}
@@ -151,6 +151,13 @@ var RlangBackend = api.LanguageBackend{
 		}
 	},
 	Lock: RLock,
+	// RLock only writes the lockfile from the specfile, so it can
+	// be checked on a copy of them.
+	IsLockfileCurrent: func(ctx context.Context) bool {
+		return !util.LockfileWouldChange([]string{"Rconfig.json", "Rconfig.lock.json"}, "Rconfig.lock.json", func() {
+			RLock(ctx)
+		})
+	},
 	Install: func(ctx context.Context) {
 		createRPkgDir()
 
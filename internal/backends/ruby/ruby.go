@@ -8,9 +8,13 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -68,6 +72,81 @@ func getPath() string {
 	}
 }
 
+// gemfileGem matches a gem declaration in a Gemfile, capturing the
+// name of the gem.
+var gemfileGem = regexp.MustCompile(`(?m)^\s*gem\s+["']([^"']+)["']`)
+
+// gemfileLockSpec matches a gem in the specs of a Gemfile.lock,
+// capturing its name. The gems themselves are indented by four
+// spaces, and their dependencies by six.
+var gemfileLockSpec = regexp.MustCompile(`(?m)^    ([^ \n]+) \(`)
+
+// gemfileRuby matches the ruby directive of a Gemfile, capturing the
+// version requirement it gives.
+var gemfileRuby = regexp.MustCompile(`(?m)^\s*ruby\s+["']([^"']+)["']`)
+
+// gemfileRuntimeConstraint implements RuntimeConstraint using the
+// ruby directive of the Gemfile. As with listGemsForNix, this doesn't
+// need Ruby to be installed.
+func gemfileRuntimeConstraint() (string, string) {
+	contentsB, err := os.ReadFile("Gemfile")
+	if err != nil {
+		return "ruby", ""
+	}
+	match := gemfileRuby.FindStringSubmatch(string(contentsB))
+	if match == nil {
+		return "ruby", ""
+	}
+	return "ruby", match[1]
+}
+
+// listGemsForNix returns the gems named in the Gemfile and
+// Gemfile.lock, whichever exist, for
+// InstallReplitNixSystemDependencies. Unlike ListSpecfile and
+// ListLockfile, this doesn't need Ruby to be installed, since it may
+// be run before anything else is. The lockfile matters because gems
+// that need system libraries, such as ffi, are often pulled in
+// indirectly.
+func listGemsForNix() []api.PkgName {
+	names := map[api.PkgName]bool{}
+	for file, pattern := range map[string]*regexp.Regexp{
+		"Gemfile":      gemfileGem,
+		"Gemfile.lock": gemfileLockSpec,
+	} {
+		contentsB, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, match := range pattern.FindAllStringSubmatch(string(contentsB), -1) {
+			names[api.PkgName(match[1])] = true
+		}
+	}
+	pkgs := []api.PkgName{}
+	for name := range names {
+		pkgs = append(pkgs, name)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i] < pkgs[j] })
+	return pkgs
+}
+
+// bundlerIsLockfileCurrent implements IsLockfileCurrent for Bundler,
+// whose bundle lock doesn't install anything. It is run on a copy of
+// the Gemfile, Gemfile.lock and the gemspecs that the Gemfile may
+// load, to leave the project alone.
+func bundlerIsLockfileCurrent(ctx context.Context) bool {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "bundlerIsLockfileCurrent")
+	defer span.Finish()
+	gemspecs, err := filepath.Glob("*.gemspec")
+	if err != nil {
+		util.Die("%s", err)
+	}
+	files := append([]string{"Gemfile", "Gemfile.lock"}, gemspecs...)
+	return !util.LockfileWouldChange(files, "Gemfile.lock", func() {
+		util.RunCmd([]string{"bundle", "lock"})
+	})
+}
+
 // RubyBackend is a UPM language backend for Ruby using Bundler.
 var RubyBackend = api.LanguageBackend{
 	Name:             "ruby-bundler",
@@ -75,7 +154,9 @@ var RubyBackend = api.LanguageBackend{
 	Lockfile:         "Gemfile.lock",
 	IsAvailable:      bundlerIsAvailable,
 	FilenamePatterns: []string{"*.rb"},
-	Quirks:           api.QuirksAddRemoveAlsoLocks,
+	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksAddSupportsGitHub,
+	SpecSyntax:       api.SpecSyntaxExact,
+	DependencyTypes:  []config.DependencyType{config.DependencyDev, config.DependencyGroup},
 	GetPackageDir: func() string {
 		path := string(util.GetCmdOutput([]string{
 			"bundle", "config", "--parseable", "path"}))
@@ -87,6 +168,24 @@ var RubyBackend = api.LanguageBackend{
 			return path
 		}
 	},
+	BinPath: func(ctx context.Context) string {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "bundle config bin")
+		defer span.Finish()
+		// Bundler's binstubs load the bundle like bundle exec,
+		// and are written to the directory configured as
+		// "bin", which is bin by default.
+		outputB, _ := util.GetCmdOutputFallible([]string{
+			"bundle", "config", "--parseable", "bin"})
+		path := strings.TrimPrefix(strings.TrimSpace(string(outputB)), "bin=")
+		if path == "" {
+			return "bin"
+		}
+		return path
+	},
+	FetchCmd: func(bin string, args []string) []string {
+		return append([]string{"gem", "exec", bin}, args...)
+	},
 	Search: func(query string) []api.PkgInfo {
 		endpoint := "https://rubygems.org/api/v1/search.json"
 		queryParams := "?query=" + url.QueryEscape(query)
@@ -184,6 +283,16 @@ var RubyBackend = api.LanguageBackend{
 		if !util.Exists("Gemfile") {
 			util.RunCmd([]string{"bundle", "init"})
 		}
+		addArgs := []string{}
+		if config.GitHub != "" {
+			addArgs = append(addArgs, "--github="+config.GitHub)
+		}
+		switch config.Dependency {
+		case config.DependencyDev:
+			addArgs = append(addArgs, "--group=development")
+		case config.DependencyGroup:
+			addArgs = append(addArgs, "--group="+config.Group)
+		}
 		args := []string{}
 		for name, spec := range pkgs {
 			if spec == "" {
@@ -194,14 +303,15 @@ var RubyBackend = api.LanguageBackend{
 			// We need to --skip-install here and run that
 			// separately, because there's no way to get
 			// Bundler to --clean when installing via add.
-			util.RunCmd(append([]string{
-				"bundle", "add", "--skip-install"}, args...))
+			cmd := append([]string{"bundle", "add", "--skip-install"}, args...)
+			util.RunCmd(append(cmd, addArgs...))
 		}
 		for name, spec := range pkgs {
 			if spec != "" {
 				nameArg := string(name)
 				versionArg := "--version=" + string(spec)
-				util.RunCmd([]string{"bundle", "add", nameArg, versionArg})
+				cmd := []string{"bundle", "add", nameArg, versionArg}
+				util.RunCmd(append(cmd, addArgs...))
 			}
 		}
 	},
@@ -221,6 +331,7 @@ var RubyBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"bundle", "lock"})
 	},
+	IsLockfileCurrent: bundlerIsLockfileCurrent,
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bundle install")
@@ -242,6 +353,23 @@ var RubyBackend = api.LanguageBackend{
 		}
 		return results
 	},
+	RuntimeConstraint: gemfileRuntimeConstraint,
+	ListSpecfileAttributes: func() map[api.PkgName]map[string]string {
+		outputB := util.GetCmdOutput([]string{
+			"ruby", "-e", util.GetResource("/ruby/list-specfile-sources.rb"),
+		})
+		sources := map[api.PkgName]string{}
+		if err := json.Unmarshal(outputB, &sources); err != nil {
+			util.Die("ruby: %s", err)
+		}
+		results := map[api.PkgName]map[string]string{}
+		for name, source := range sources {
+			if source != "" {
+				results[name] = map[string]string{"source": source}
+			}
+		}
+		return results
+	},
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		outputB := util.GetCmdOutput([]string{
 			"ruby", "-e", util.GetResource("/ruby/list-lockfile.rb"),
@@ -268,5 +396,5 @@ var RubyBackend = api.LanguageBackend{
 		}
 		return results, true
 	},
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.RubyNixDeps, listGemsForNix),
 }
@@ -0,0 +1,66 @@
+package ruby
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+// chdirToGemfile copies the given fixture into a fresh directory as
+// its Gemfile, and changes into the directory for the duration of the
+// test. The test is skipped if Ruby or Bundler aren't available.
+func chdirToGemfile(t *testing.T, fixture string) {
+	t.Helper()
+
+	if err := exec.Command("ruby", "-rbundler", "-e", "").Run(); err != nil {
+		t.Skipf("ruby with bundler is not available: %s", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Gemfile"), contents, 0o644))
+	testutil.Chdir(t, dir)
+}
+
+func TestListSpecfileAttributesSources(t *testing.T) {
+	chdirToGemfile(t, "Gemfile.sources")
+
+	require.Equal(t, map[api.PkgName]map[string]string{
+		"rack":         {"source": "https://rubygems.org"},
+		"rails":        {"source": "git:https://github.com/rails/rails.git@main"},
+		"nokogiri":     {"source": "git:https://github.com/sparklemotion/nokogiri.git@v1.16.0"},
+		"local_helper": {"source": "path:vendor/local_helper"},
+		"private_gem":  {"source": "https://gems.example.com"},
+	}, RubyBackend.ListSpecfileAttributes())
+}
+
+func TestListSpecfileGitGems(t *testing.T) {
+	chdirToGemfile(t, "Gemfile.sources")
+
+	// Git gems are listed like any other, so that they survive
+	// a round trip through the specfile.
+	pkgs := RubyBackend.ListSpecfile()
+	require.Contains(t, pkgs, api.PkgName("rails"))
+	require.Contains(t, pkgs, api.PkgName("nokogiri"))
+	require.Equal(t, api.PkgSpec("~> 3.0"), pkgs["rack"])
+}
+
+func TestListGemsForNix(t *testing.T) {
+	contents, err := os.ReadFile(filepath.Join("testdata", "Gemfile.lock.native"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Gemfile"), []byte("source \"https://rubygems.org\"\ngem \"nokogiri\"\ngem 'pg'\ngem \"rack\", \"~> 3.0\"\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Gemfile.lock"), contents, 0o644))
+	testutil.Chdir(t, dir)
+
+	require.Equal(t, []api.PkgName{"mini_portile2", "nokogiri", "pg", "racc", "rack"}, listGemsForNix())
+}
@@ -0,0 +1,315 @@
+package rust
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	goversion "github.com/hashicorp/go-version"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// cargoConfig represents the parts of a .cargo/config.toml that
+// declare alternative registries.
+type cargoConfig struct {
+	Registries map[string]struct {
+		Index string `toml:"index"`
+	} `toml:"registries"`
+}
+
+// registryConfig represents the config.json at the root of a sparse
+// registry index.
+type registryConfig struct {
+	// The base URL of the registry's web API, if it has one.
+	API string `json:"api"`
+}
+
+// indexEntry represents one line of a crate's file in a registry
+// index, which describes one of its versions.
+type indexEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"vers"`
+	Yanked  bool   `json:"yanked"`
+}
+
+// cargoHome returns the directory where Cargo keeps its global
+// configuration.
+func cargoHome() string {
+	if home := os.Getenv("CARGO_HOME"); home != "" {
+		return home
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cargo")
+}
+
+// registryEnvName returns how a registry name is spelled in Cargo's
+// environment variables, e.g. "MY_REGISTRY" for "my-registry".
+func registryEnvName(registry string) string {
+	return strings.ToUpper(strings.ReplaceAll(registry, "-", "_"))
+}
+
+// cargoRegistries returns the index URL of each alternative registry
+// configured for the current directory. Like Cargo, it reads
+// .cargo/config.toml (or the older .cargo/config) in the current
+// directory and each of its parents, and then in CARGO_HOME, with
+// nearer files taking precedence, and lets
+// CARGO_REGISTRIES_<NAME>_INDEX override them all.
+func cargoRegistries() map[string]string {
+	dirs := []string{}
+	if dir, err := filepath.Abs("."); err == nil {
+		for {
+			dirs = append(dirs, filepath.Join(dir, ".cargo"))
+			if dir == filepath.Dir(dir) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+	dirs = append(dirs, cargoHome())
+
+	registries := map[string]string{}
+	seen := map[string]bool{}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, name := range []string{"config", "config.toml"} {
+			path := filepath.Join(dirs[i], name)
+			if seen[path] || !util.Exists(path) {
+				continue
+			}
+			seen[path] = true
+			var cfg cargoConfig
+			if _, err := toml.DecodeFile(path, &cfg); err != nil {
+				util.Die("%s: %s", path, err)
+			}
+			for registry, table := range cfg.Registries {
+				if table.Index != "" {
+					registries[registry] = table.Index
+				}
+			}
+			// When both exist, Cargo only reads the one
+			// without an extension.
+			break
+		}
+	}
+
+	for registry := range registries {
+		if index := os.Getenv("CARGO_REGISTRIES_" + registryEnvName(registry) + "_INDEX"); index != "" {
+			registries[registry] = index
+		}
+	}
+	return registries
+}
+
+// dependencyRegistries returns the alternative registry of each
+// dependency of the decoded Cargo.toml that declares one, as with
+// foo = { version = "1", registry = "my-registry" }. For dependencies
+// inherited from the workspace, the registry is looked up in it,
+// unless it is nil.
+func dependencyRegistries(specfile cargoToml, workspace *cargoWorkspace) map[api.PkgName]string {
+	registries := map[api.PkgName]string{}
+	for _, section := range cargoSections {
+		for name, dependency := range specfile.section(section.table) {
+			if isInherited(dependency) && workspace != nil {
+				dependency = workspace.Dependencies[name]
+			}
+			descriptor, _ := dependency.(map[string]interface{})
+			if registry, ok := descriptor["registry"].(string); ok {
+				registries[api.PkgName(name)] = registry
+			}
+		}
+	}
+	return registries
+}
+
+// crateRegistry returns the alternative registry that the project
+// sources the named crate from, or "" if it comes from crates.io or
+// the project doesn't depend on it.
+func crateRegistry(name api.PkgName) string {
+	if !util.Exists("Cargo.toml") {
+		return ""
+	}
+	specfile, err := readCargoToml("Cargo.toml")
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+	_, workspace := findCargoWorkspace()
+	return dependencyRegistries(specfile, workspace)[name]
+}
+
+// sparseIndex returns the base URL of the sparse index of the named
+// registry, and the token configured for it in the environment. It
+// returns an error if the registry isn't configured or has a git
+// index, which can't be queried over HTTP.
+func sparseIndex(registry string) (string, string, error) {
+	index, ok := cargoRegistries()[registry]
+	if !ok {
+		return "", "", fmt.Errorf("registry %q is not configured in .cargo/config.toml", registry)
+	}
+	if !strings.HasPrefix(index, "sparse+") {
+		return "", "", fmt.Errorf("registry %q has a git index (%s), which upm can't query; only sparse registries are supported", registry, index)
+	}
+	token := os.Getenv("CARGO_REGISTRIES_" + registryEnvName(registry) + "_TOKEN")
+	return strings.TrimSuffix(strings.TrimPrefix(index, "sparse+"), "/"), token, nil
+}
+
+// warnRegistry warns that the named registry can't be queried
+// because of err, so that its crates are missing from the results.
+func warnRegistry(err error) {
+	util.Warn(context.Background(), util.Warning{Code: util.WarningRegistry, Message: err.Error()})
+}
+
+// indexPath returns the path of a crate's file in a registry index.
+func indexPath(name api.PkgName) string {
+	lower := strings.ToLower(string(name))
+	switch len(lower) {
+	case 1:
+		return "1/" + lower
+	case 2:
+		return "2/" + lower
+	case 3:
+		return "3/" + lower[:1] + "/" + lower
+	default:
+		return lower[:2] + "/" + lower[2:4] + "/" + lower
+	}
+}
+
+// registryGet fetches the given URL of a registry, sending token, if
+// not empty, as the Authorization header. It returns false if there
+// is nothing there, and dies on other errors, reporting them under
+// label.
+func registryGet(label string, endpoint string, token string) ([]byte, bool) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		util.Die("%s: %s", label, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := api.HttpClient.Do(req)
+	if err != nil {
+		util.Die("%s: %s", label, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		break
+	case 404:
+		return nil, false
+	default:
+		util.Die("%s: HTTP status %d", label, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		util.Die("%s: could not read response: %s", label, err)
+	}
+	return body, true
+}
+
+// registryAPI returns the base URL of the web API of the registry
+// with the given sparse index, as given by its config.json, or "" if
+// it has none.
+func registryAPI(registry string, index string, token string) string {
+	body, ok := registryGet(registry, index+"/config.json", token)
+	if !ok {
+		return ""
+	}
+	var cfg registryConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		util.Die("%s: config.json: %s", registry, err)
+	}
+	return strings.TrimSuffix(cfg.API, "/")
+}
+
+// registryInfo looks a crate up in the named alternative registry,
+// through its web API if it has one, and otherwise in its index,
+// which only gives the name and latest version. If the registry
+// can't be queried, that is warned about and the crate isn't found.
+func registryInfo(registry string, name api.PkgName) api.PkgInfo {
+	index, token, err := sparseIndex(registry)
+	if err != nil {
+		warnRegistry(err)
+		return api.PkgInfo{}
+	}
+	if base := registryAPI(registry, index, token); base != "" {
+		return apiInfo(registry, base, token, name)
+	}
+
+	body, ok := registryGet(registry, index+"/"+indexPath(name), token)
+	if !ok {
+		return api.PkgInfo{}
+	}
+	return indexInfo(body)
+}
+
+// indexInfo returns the name and latest version, ignoring yanked
+// versions and prereleases, of the crate described by the given
+// index file.
+func indexInfo(contents []byte) api.PkgInfo {
+	info := api.PkgInfo{}
+	var latest *goversion.Version
+	for _, line := range strings.Split(string(contents), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry indexEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			util.Die("registry index: %s", err)
+		}
+		info.Name = entry.Name
+		v, err := goversion.NewVersion(entry.Version)
+		if err != nil || entry.Yanked || v.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			info.Version = entry.Version
+		}
+	}
+	return info
+}
+
+// registrySearch searches the web APIs of the alternative registries
+// that the project's dependencies come from. Registries without one
+// are skipped, and so are those that can't be queried, with a
+// warning.
+func registrySearch(query string) []api.PkgInfo {
+	if !util.Exists("Cargo.toml") {
+		return nil
+	}
+	specfile, err := readCargoToml("Cargo.toml")
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+	_, workspace := findCargoWorkspace()
+	used := map[string]bool{}
+	for _, registry := range dependencyRegistries(specfile, workspace) {
+		used[registry] = true
+	}
+	registries := []string{}
+	for registry := range used {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	results := []api.PkgInfo{}
+	for _, registry := range registries {
+		index, token, err := sparseIndex(registry)
+		if err != nil {
+			warnRegistry(err)
+			continue
+		}
+		if base := registryAPI(registry, index, token); base != "" {
+			results = append(results, apiSearch(registry, base, token, query)...)
+		}
+	}
+	return results
+}
@@ -0,0 +1,124 @@
+package rust
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/testutil"
+)
+
+// registriesProject changes to the testdata/registries project and
+// serves its alternative registries and crates.io from fixtures. It
+// returns the Transport serving them.
+func registriesProject(t *testing.T) *testutil.Transport {
+	responses, err := filepath.Abs("testdata/registries/responses")
+	require.NoError(t, err)
+	testutil.Chdir(t, "testdata/registries")
+	t.Setenv("CARGO_HOME", t.TempDir())
+
+	return testutil.ServeFiles(t, map[string]string{
+		"https://crates.acme.test/index/config.json":       filepath.Join(responses, "acme-config.json"),
+		"https://crates.acme.test/api/v1/crates/acme-auth": filepath.Join(responses, "acme-auth.json"),
+		"https://crates.acme.test/api/v1/crates?q=auth":    filepath.Join(responses, "acme-search.json"),
+		"https://mirror.acme.test/config.json":             filepath.Join(responses, "mirror-config.json"),
+		"https://mirror.acme.test/ac/me/acme-fixtures":     filepath.Join(responses, "acme-fixtures.index"),
+		"https://crates.io/api/v1/crates?q=auth":           filepath.Join(responses, "crates-io-search.json"),
+	})
+}
+
+func TestCargoRegistries(t *testing.T) {
+	registriesProject(t)
+	t.Setenv("CARGO_REGISTRIES_MIRROR_INDEX", "sparse+https://mirror.example.test/")
+
+	// Configuration above the repository may add registries of its
+	// own, so only the project's are checked.
+	registries := cargoRegistries()
+	require.Equal(t, "sparse+https://crates.acme.test/index/", registries["acme"])
+	require.Equal(t, "sparse+https://mirror.example.test/", registries["mirror"])
+	require.Equal(t, "https://github.com/acme/crate-index", registries["legacy"])
+}
+
+func TestListSpecfileAttributesRegistry(t *testing.T) {
+	contents, err := os.ReadFile("testdata/registries/Cargo.toml")
+	require.NoError(t, err)
+
+	require.Equal(t, map[api.PkgName]map[string]string{
+		"serde":         {"section": "dependencies"},
+		"acme-auth":     {"section": "dependencies", "registry": "acme"},
+		"acme-fixtures": {"section": "dev-dependencies", "group": "dev", "registry": "mirror"},
+	}, listSpecfileAttributesWithContents(contents))
+}
+
+func TestRegistryInfo(t *testing.T) {
+	registry := registriesProject(t)
+
+	// A registry with a web API is asked instead of crates.io.
+	info := RustBackend.Info("acme-auth")
+	require.Equal(t, "acme-auth", info.Name)
+	require.Equal(t, "2.1.4", info.Version)
+	require.Equal(t, "LicenseRef-Acme", info.License)
+	require.Equal(t, []string{
+		"https://crates.acme.test/index/config.json",
+		"https://crates.acme.test/api/v1/crates/acme-auth",
+	}, registry.URLs())
+
+	// Without one, the latest stable version that isn't yanked
+	// is read from the index.
+	registry.Requests = nil
+	require.Equal(t, api.PkgInfo{Name: "acme-fixtures", Version: "0.3.2"}, RustBackend.Info("acme-fixtures"))
+	require.NotContains(t, registry.URLs(), "https://crates.io/api/v1/crates/acme-fixtures")
+}
+
+func TestRegistrySearch(t *testing.T) {
+	registriesProject(t)
+
+	results := RustBackend.Search("auth")
+	descriptions := map[string]string{}
+	names := []string{}
+	for _, result := range results {
+		names = append(names, result.Name)
+		descriptions[result.Name] = result.Description
+	}
+	require.Equal(t, []string{"acme-auth", "oauth2"}, names)
+	require.Equal(t, "Authentication for Acme services", descriptions["acme-auth"])
+}
+
+func TestRegistryUnqueryable(t *testing.T) {
+	registry := registriesProject(t)
+
+	// A registry with a git index is reported rather than
+	// queried, and its crates aren't found.
+	_, _, err := sparseIndex("legacy")
+	require.ErrorContains(t, err, `registry "legacy" has a git index`)
+	require.Equal(t, api.PkgInfo{}, registryInfo("legacy", "legacy-crate"))
+	_, _, err = sparseIndex("unknown")
+	require.ErrorContains(t, err, `registry "unknown" is not configured`)
+	require.Empty(t, registry.Requests)
+
+	// A web API without a search endpoint finds nothing.
+	require.Empty(t, apiSearch("acme", "https://crates.acme.test/missing", "", "auth"))
+}
+
+func TestAddToSpecfileRegistry(t *testing.T) {
+	contents, err := os.ReadFile("testdata/registries/Cargo.toml")
+	require.NoError(t, err)
+
+	contents, err = addToSpecfileWithContents(contents, "dependencies", map[api.PkgName]api.PkgSpec{
+		"acme-metrics": "1.2",
+		"acme-auth":    "2.2",
+	}, false, "acme")
+	require.NoError(t, err)
+	require.Contains(t, string(contents), `acme-auth = { version = "2.2", registry = "acme" }`)
+	require.Contains(t, string(contents), `acme-metrics = { version = "1.2", registry = "acme" }`)
+}
+
+func TestIndexPath(t *testing.T) {
+	require.Equal(t, "1/a", indexPath("a"))
+	require.Equal(t, "2/ab", indexPath("ab"))
+	require.Equal(t, "3/a/abc", indexPath("abc"))
+	require.Equal(t, "se/rd/serde", indexPath("Serde"))
+}
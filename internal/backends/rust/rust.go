@@ -4,29 +4,166 @@ package rust
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
+	"github.com/replit/upm/internal/pkg"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 type cargoToml struct {
+	Package struct {
+		// The path of the workspace root, if it isn't the
+		// nearest parent directory with a [workspace].
+		Workspace string `toml:"workspace"`
+	} `toml:"package"`
+	Workspace         *cargoWorkspace        `toml:"workspace"`
+	Dependencies      map[string]interface{} `toml:"dependencies"`
+	DevDependencies   map[string]interface{} `toml:"dev-dependencies"`
+	BuildDependencies map[string]interface{} `toml:"build-dependencies"`
+}
+
+// cargoWorkspace represents the parts of the [workspace] table of the
+// Cargo.toml at the root of a workspace that matter to its members.
+type cargoWorkspace struct {
+	// The fields of [package], such as version and edition, and
+	// the dependencies that members can inherit with
+	// workspace = true.
+	Package      map[string]interface{} `toml:"package"`
 	Dependencies map[string]interface{} `toml:"dependencies"`
 }
 
+// workspaceTable is the table of a workspace root's Cargo.toml that
+// declares the dependencies that its members inherit.
+const workspaceTable = "workspace.dependencies"
+
+// decodeCargoToml decodes the contents of a Cargo.toml, which may use
+// dotted keys (see util.UndotTOMLKeys), as workspace members often do
+// to inherit fields.
+func decodeCargoToml(contents []byte, specfile *cargoToml) error {
+	return toml.Unmarshal(util.UndotTOMLKeys(contents), specfile)
+}
+
+// readCargoToml reads and decodes the Cargo.toml at path.
+func readCargoToml(path string) (cargoToml, error) {
+	var specfile cargoToml
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return specfile, err
+	}
+	err = decodeCargoToml(contents, &specfile)
+	return specfile, err
+}
+
+// isInherited reports whether an entry of a dependency table is
+// inherited from the workspace, as with serde = { workspace = true }
+// or serde.workspace = true.
+func isInherited(dependency interface{}) bool {
+	descriptor, ok := dependency.(map[string]interface{})
+	return ok && descriptor["workspace"] == true
+}
+
+// findCargoWorkspace returns the path of the Cargo.toml at the root
+// of the workspace that the Cargo.toml in the current directory
+// belongs to, which may be that file itself, and the workspace it
+// declares. Like Cargo, it follows package.workspace if set, and
+// otherwise searches upwards for a Cargo.toml with a [workspace]
+// table. The workspace is nil if there is none.
+func findCargoWorkspace() (string, *cargoWorkspace) {
+	specfile, err := readCargoToml("Cargo.toml")
+	if err != nil {
+		return "", nil
+	}
+	if specfile.Workspace != nil {
+		return "Cargo.toml", specfile.Workspace
+	}
+
+	if specfile.Package.Workspace != "" {
+		path := filepath.Join(specfile.Package.Workspace, "Cargo.toml")
+		root, err := readCargoToml(path)
+		if err != nil {
+			util.Die("%s: %s", path, err)
+		}
+		return path, root.Workspace
+	}
+
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		return "", nil
+	}
+	for dir != filepath.Dir(dir) {
+		dir = filepath.Dir(dir)
+		path := filepath.Join(dir, "Cargo.toml")
+		if !util.Exists(path) {
+			continue
+		}
+		root, err := readCargoToml(path)
+		if err != nil {
+			util.Die("%s: %s", path, err)
+		}
+		if root.Workspace != nil {
+			return path, root.Workspace
+		}
+	}
+	return "", nil
+}
+
+// cargoSection describes one of the dependency tables of Cargo.toml.
+type cargoSection struct {
+	// The name of the table, e.g. "dev-dependencies".
+	table string
+	// The kind of dependency that the table declares.
+	depType config.DependencyType
+	// The flag that makes cargo add and cargo rm use the table.
+	flag string
+}
+
+// cargoSections lists the dependency tables of Cargo.toml, with
+// [dependencies] first.
+var cargoSections = []cargoSection{
+	{"dependencies", config.DependencyRegular, ""},
+	{"dev-dependencies", config.DependencyDev, "--dev"},
+	{"build-dependencies", config.DependencyBuild, "--build"},
+}
+
+// section returns the contents of the named dependency table.
+func (c *cargoToml) section(table string) map[string]interface{} {
+	switch table {
+	case "dev-dependencies":
+		return c.DevDependencies
+	case "build-dependencies":
+		return c.BuildDependencies
+	case workspaceTable:
+		if c.Workspace == nil {
+			return nil
+		}
+		return c.Workspace.Dependencies
+	default:
+		return c.Dependencies
+	}
+}
+
 type cargoLock struct {
+	Version  int            `toml:"version"`
 	Packages []cargoPackage `toml:"package"`
 }
 
 type cargoPackage struct {
-	Name    string `toml:"name"`
-	Version string `toml:"version"`
+	Name         string   `toml:"name"`
+	Version      string   `toml:"version"`
+	Dependencies []string `toml:"dependencies"`
 }
 
 type crateSearchResults struct {
@@ -39,13 +176,17 @@ type crateInfoResult struct {
 }
 
 type crate struct {
-	Name          string `json:"name"`
-	Description   string `json:"description"`
-	Homepage      string `json:"homepage"`
-	Documentation string `json:"documentation"`
-	Repository    string `json:"repository"`
-	NewestVersion string `json:"newest_version"`
-	Versions      []int  `json:"versions"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Homepage      string   `json:"homepage"`
+	Documentation string   `json:"documentation"`
+	Repository    string   `json:"repository"`
+	NewestVersion string   `json:"newest_version"`
+	Versions      []int    `json:"versions"`
+	Downloads     int      `json:"downloads"`
+	CreatedAt     string   `json:"created_at"`
+	Keywords      []string `json:"keywords"`
+	Categories    []string `json:"categories"`
 }
 
 type version struct {
@@ -70,6 +211,10 @@ func (c *crateInfoResult) toPkgInfo() api.PkgInfo {
 		}
 	}
 
+	// Categories are slugs such as "web-programming::http-client",
+	// listed after the keywords the author chose.
+	keywords := append(append([]string{}, c.Crate.Keywords...), c.Crate.Categories...)
+
 	return api.PkgInfo{
 		Name:             c.Crate.Name,
 		Description:      c.Crate.Description,
@@ -79,6 +224,9 @@ func (c *crateInfoResult) toPkgInfo() api.PkgInfo {
 		SourceCodeURL:    c.Crate.Repository,
 		Author:           author,
 		License:          license,
+		Downloads:        strconv.Itoa(c.Crate.Downloads),
+		FirstPublished:   c.Crate.CreatedAt,
+		Keywords:         keywords,
 	}
 }
 
@@ -87,24 +235,39 @@ func cargoIsAvailable() bool {
 	return err == nil
 }
 
-func search(query string) []api.PkgInfo {
-	endpoint := "https://crates.io/api/v1/crates"
-	path := "?q=" + url.QueryEscape(query)
+// cratesIOAPI is the base URL of the crates.io web API, which
+// alternative registries may also implement.
+const cratesIOAPI = "https://crates.io"
 
-	resp, err := api.HttpClient.Get(endpoint + path)
-	if err != nil {
-		util.Die("crates.io: %s", err)
+// search implements Search. Crates.io is searched, and so are the
+// alternative registries that the project's dependencies come from,
+// whose results come first.
+func search(query string) []api.PkgInfo {
+	pkgs := []api.PkgInfo{}
+	seen := map[string]bool{}
+	for _, info := range append(registrySearch(query), apiSearch("crates.io", cratesIOAPI, "", query)...) {
+		if seen[info.Name] {
+			continue
+		}
+		seen[info.Name] = true
+		pkgs = append(pkgs, info)
 	}
-	defer resp.Body.Close()
+	return pkgs
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.Die("crates.io: %s", err)
+// apiSearch searches the crates.io web API at base, as implemented
+// by crates.io and some alternative registries. Errors are reported
+// under the given label, and token, if not empty, is sent as the
+// Authorization header.
+func apiSearch(label string, base string, token string, query string) []api.PkgInfo {
+	body, ok := registryGet(label, base+"/api/v1/crates?q="+url.QueryEscape(query), token)
+	if !ok {
+		return nil
 	}
 
 	var crateResults crateSearchResults
 	if err := json.Unmarshal(body, &crateResults); err != nil {
-		util.Die("crates.io: %s", err)
+		util.Die("%s: %s", label, err)
 	}
 
 	var pkgs []api.PkgInfo
@@ -118,36 +281,264 @@ func search(query string) []api.PkgInfo {
 	return pkgs
 }
 
+func popularPackages() []api.PkgName {
+	return pkg.LoadPopularPackages("/popular/crates.txt")
+}
+
+// info implements Info, looking the crate up in the alternative
+// registry that the project sources it from, if any, and otherwise
+// on crates.io.
 func info(name api.PkgName) api.PkgInfo {
-	endpoint := "https://crates.io/api/v1/crates"
-	path := "/" + url.PathEscape(string(name))
+	if registry := crateRegistry(name); registry != "" {
+		return registryInfo(registry, name)
+	}
+	return apiInfo("crates.io", cratesIOAPI, "", name)
+}
 
-	resp, err := api.HttpClient.Get(endpoint + path)
+// apiInfo looks a crate up in the crates.io web API at base; see
+// apiSearch.
+func apiInfo(label string, base string, token string, name api.PkgName) api.PkgInfo {
+	body, ok := registryGet(label, base+"/api/v1/crates/"+url.PathEscape(string(name)), token)
+	if !ok {
+		return api.PkgInfo{}
+	}
+
+	var crateInfo crateInfoResult
+	if err := json.Unmarshal(body, &crateInfo); err != nil {
+		util.Die("%s: %s", label, err)
+	}
+
+	return crateInfo.toPkgInfo()
+}
+
+// addToSpecfile implements AddToSpecfile, writing the packages
+// straight into the table of Cargo.toml for config.Dependency
+// ([dependencies], [dev-dependencies] or [build-dependencies]).
+// Packages without a spec get "*".
+func addToSpecfile(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "cargo addToSpecfile")
+	defer span.Finish()
+	if !util.Exists("Cargo.toml") {
+		util.Die("Cargo.toml does not exist; run upm add without --write-only to create it")
+	}
+	contents, err := os.ReadFile("Cargo.toml")
 	if err != nil {
-		util.Die("crates.io: %s", err)
+		util.Die("Cargo.toml: %s", err)
 	}
-	defer resp.Body.Close()
 
-	switch resp.StatusCode {
-	case 200:
-		break
-	case 404:
-		return api.PkgInfo{}
-	default:
-		util.Die("crates.io: HTTP status %d", resp.StatusCode)
+	table := addTable()
+	var specfile cargoToml
+	if err := decodeCargoToml(contents, &specfile); err != nil {
+		util.Die("Cargo.toml: %s", err)
 	}
+	contents, err = addToSpecfileContents(contents, pkgs, projectName)
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+	util.TryWriteAtomic("Cargo.toml", contents)
 
-	body, err := io.ReadAll(resp.Body)
+	// The versions of dependencies inherited from the workspace
+	// are set in its root, which may be this same file.
+	inherited := map[api.PkgName]api.PkgSpec{}
+	for name, spec := range pkgs {
+		if isInherited(specfile.section(table)[string(name)]) {
+			inherited[name] = spec
+		}
+	}
+	if len(inherited) == 0 {
+		return
+	}
+	rootPath, workspace := findCargoWorkspace()
+	if workspace == nil {
+		util.Die("Cargo.toml: dependencies are inherited from a workspace, but there is none")
+	}
+	rootContents, err := os.ReadFile(rootPath)
+	if err != nil {
+		util.Die("%s: %s", rootPath, err)
+	}
+	rootContents, err = addToSpecfileWithContents(rootContents, workspaceTable, inherited, false, config.Registry)
 	if err != nil {
-		util.Die("crates.io: could not read response: %s", err)
+		util.Die("%s: %s", rootPath, err)
 	}
+	util.TryWriteAtomic(rootPath, rootContents)
+}
 
-	var crateInfo crateInfoResult
-	if err := json.Unmarshal(body, &crateInfo); err != nil {
-		util.Die("crates.io: %s", err)
+// addToSpecfileContents implements AddToSpecfileContents for
+// Cargo.toml itself. The versions of packages inherited from the
+// workspace, which addToSpecfile sets in its root, aren't included.
+func addToSpecfileContents(contents []byte, pkgs map[api.PkgName]api.PkgSpec, projectName string) ([]byte, error) {
+	return addToSpecfileWithContents(contents, addTable(), pkgs, config.Dependency == config.DependencyOptional, config.Registry)
+}
+
+// addTable returns the table of Cargo.toml that packages are added to
+// for config.Dependency.
+func addTable() string {
+	for _, section := range cargoSections {
+		if section.depType == config.Dependency {
+			return section.table
+		}
 	}
+	return "dependencies"
+}
 
-	return crateInfo.toPkgInfo()
+// sortSpecfile implements SortSpecfile, sorting each dependency
+// table of Cargo.toml. Dependencies declared in tables of their own,
+// such as [dependencies.serde], are left where they are.
+func sortSpecfile(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "cargo sortSpecfile")
+	defer span.Finish()
+	contents, err := os.ReadFile("Cargo.toml")
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+	tables := []string{}
+	for _, section := range cargoSections {
+		tables = append(tables, section.table)
+	}
+	contents, err = util.SortTOMLTables(contents, tables, nil)
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+	util.TryWriteAtomic("Cargo.toml", contents)
+}
+
+// addToSpecfileWithContents returns the given Cargo.toml contents
+// with the packages set in the named dependency table. Packages that
+// are already declared there only have their version changed, so
+// that features, git and path descriptors are kept, whether they are
+// declared inline or in a table of their own such as
+// [dependencies.serde]. Packages inherited from the workspace keep
+// their workspace = true and get no version, which Cargo wouldn't
+// allow; it is set in the workspace root instead (see
+// addToSpecfile). If registry isn't empty, the packages are sourced
+// from that alternative registry.
+func addToSpecfileWithContents(contents []byte, table string, pkgs map[api.PkgName]api.PkgSpec, optional bool, registry string) ([]byte, error) {
+	var specfile cargoToml
+	if err := decodeCargoToml(contents, &specfile); err != nil {
+		return nil, err
+	}
+	existing := specfile.section(table)
+
+	deps := map[string]string{}
+	for name, spec := range pkgs {
+		if spec == "" {
+			spec = "*"
+		}
+		version := strconv.Quote(string(spec))
+		inherited := isInherited(existing[string(name)])
+		if inherited && !optional {
+			continue
+		}
+		// The workspace root says where an inherited dependency
+		// comes from.
+		packageRegistry := registry
+		if inherited {
+			packageRegistry = ""
+		}
+
+		subtable := table + "." + string(name)
+		header := regexp.MustCompile(`(?m)^\s*\[\s*` + regexp.QuoteMeta(subtable) + `\s*\]`)
+		if header.Match(contents) {
+			entries := map[string]string{"version": version}
+			if inherited {
+				entries = map[string]string{}
+			}
+			if optional {
+				entries["optional"] = "true"
+			}
+			if packageRegistry != "" {
+				entries["registry"] = strconv.Quote(packageRegistry)
+			}
+			var err error
+			contents, err = util.SetTOMLTableEntries(contents, subtable, entries)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		descriptor, _ := existing[string(name)].(map[string]interface{})
+		if descriptor == nil {
+			if !optional && packageRegistry == "" {
+				deps[string(name)] = version
+				continue
+			}
+			descriptor = map[string]interface{}{}
+		}
+		if inherited {
+			dotted := regexp.MustCompile(`(?m)^\s*` + regexp.QuoteMeta(string(name)) + `\s*\.\s*workspace\s*=`)
+			if dotted.Match(contents) {
+				return nil, fmt.Errorf("%s is inherited with a dotted key; make it optional by hand", name)
+			}
+		} else {
+			descriptor["version"] = string(spec)
+		}
+		if optional {
+			descriptor["optional"] = true
+		}
+		if packageRegistry != "" {
+			descriptor["registry"] = packageRegistry
+		}
+		deps[string(name)] = formatInlineTable(descriptor)
+	}
+
+	if len(deps) == 0 {
+		return contents, nil
+	}
+	return util.SetTOMLTableEntries(contents, table, deps)
+}
+
+// formatInlineTable renders a decoded TOML table as an inline table,
+// with the version first and the other keys in sorted order.
+func formatInlineTable(table map[string]interface{}) string {
+	keys := []string{}
+	for key := range table {
+		if key != "version" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := table["version"]; ok {
+		keys = append([]string{"version"}, keys...)
+	}
+
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = util.TOMLKey(key) + " = " + formatTOMLValue(table[key])
+	}
+	return "{ " + strings.Join(entries, ", ") + " }"
+}
+
+// formatTOMLValue renders a decoded TOML value.
+func formatTOMLValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return strconv.Quote(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = formatTOMLValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []map[string]interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = formatInlineTable(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		return formatInlineTable(value)
+	default:
+		return strconv.Quote(fmt.Sprint(value))
+	}
 }
 
 func listSpecfile() map[api.PkgName]api.PkgSpec {
@@ -156,49 +547,237 @@ func listSpecfile() map[api.PkgName]api.PkgSpec {
 		util.Die("Cargo.toml: %s", err)
 	}
 
-	return listSpecfileWithContents(contents)
+	_, workspace := findCargoWorkspace()
+	return listSpecfileWithContents(contents, workspace)
 }
 
-func listSpecfileWithContents(contents []byte) map[api.PkgName]api.PkgSpec {
+// listSpecfileWithContents returns the dependencies declared by the
+// given Cargo.toml contents. The specs of those inherited from the
+// workspace are looked up in it, and it may be nil if there is no
+// workspace.
+func listSpecfileWithContents(contents []byte, workspace *cargoWorkspace) map[api.PkgName]api.PkgSpec {
 	var specfile cargoToml
-	err := toml.Unmarshal(contents, &specfile)
+	err := decodeCargoToml(contents, &specfile)
 	if err != nil {
 		util.Die("Cargo.toml: %s", err)
 	}
 
+	// A crate may be declared in several sections; the spec in
+	// [dependencies] wins.
 	packages := make(map[api.PkgName]api.PkgSpec)
-	for name, dependency := range specfile.Dependencies {
-		var spec api.PkgSpec
-		switch value := dependency.(type) {
-		case string:
-			spec = api.PkgSpec(value)
-
-		case map[string]interface{}:
-			found := false
-			for _, key := range []string{"version", "git", "path"} {
-				specStr, ok := value[key].(string)
+	for _, section := range cargoSections {
+		for name, dependency := range specfile.section(section.table) {
+			if _, ok := packages[api.PkgName(name)]; ok {
+				continue
+			}
+			if isInherited(dependency) {
+				var ok bool
+				if workspace != nil {
+					dependency, ok = workspace.Dependencies[name]
+				}
 				if !ok {
-					continue
+					util.Die("Cargo.toml: %q is inherited from the workspace, which doesn't declare it", name)
 				}
-
-				spec = api.PkgSpec(specStr)
-				found = true
-				break
 			}
+			packages[api.PkgName(name)] = dependencySpec(name, dependency)
+		}
+	}
+
+	return packages
+}
+
+// dependencySpec returns the spec of one entry of a dependency table:
+// its version, or failing that, its git URL or path.
+func dependencySpec(name string, dependency interface{}) api.PkgSpec {
+	var spec api.PkgSpec
+	switch value := dependency.(type) {
+	case string:
+		spec = api.PkgSpec(value)
 
-			if !found {
-				util.Die("Cargo.toml: could not determine spec for dependecy %q", name)
+	case map[string]interface{}:
+		found := false
+		for _, key := range []string{"version", "git", "path"} {
+			specStr, ok := value[key].(string)
+			if !ok {
+				continue
 			}
 
+			spec = api.PkgSpec(specStr)
+			found = true
+			break
+		}
+
+		if !found {
+			util.Die("Cargo.toml: could not determine spec for dependecy %q", name)
+		}
+
+	default:
+		util.Die("Cargo.toml: unexpected dependency format %q", name)
+	}
+
+	return spec
+}
+
+func listSpecfileAttributes() map[api.PkgName]map[string]string {
+	contents, err := os.ReadFile("Cargo.toml")
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+
+	return listSpecfileAttributesWithContents(contents)
+}
+
+// cargoPackageFields are the fields of [package] that upm list
+// --verbose shows, in the order they are usually declared in.
+var cargoPackageFields = []string{"name", "version", "edition", "rust-version", "license"}
+
+// listSpecfileSettings implements ListSpecfileSettings for Cargo.
+func listSpecfileSettings() map[string]string {
+	contents, err := os.ReadFile("Cargo.toml")
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+
+	_, workspace := findCargoWorkspace()
+	return listSpecfileSettingsWithContents(contents, workspace)
+}
+
+// listSpecfileSettingsWithContents returns the fields of [package] in
+// the given Cargo.toml contents that are among cargoPackageFields,
+// keyed by "package." and their name. Fields inherited with
+// workspace = true are resolved from the [workspace.package] of the
+// given workspace, which may be nil, and marked as inherited, or
+// reported as missing there.
+func listSpecfileSettingsWithContents(contents []byte, workspace *cargoWorkspace) map[string]string {
+	var specfile struct {
+		Package map[string]interface{} `toml:"package"`
+	}
+	if err := toml.Unmarshal(util.UndotTOMLKeys(contents), &specfile); err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+
+	settings := map[string]string{}
+	for _, field := range cargoPackageFields {
+		value, ok := specfile.Package[field]
+		if !ok {
+			continue
+		}
+		if !isInherited(value) {
+			settings["package."+field] = fmt.Sprint(value)
+			continue
+		}
+		var inherited interface{}
+		if workspace != nil {
+			inherited, ok = workspace.Package[field]
+		}
+		if !ok {
+			settings["package."+field] = "inherited from the workspace, which doesn't declare it"
+			continue
+		}
+		settings["package."+field] = fmt.Sprint(inherited) + " (from the workspace)"
+	}
+	return settings
+}
+
+// listSpecfileAttributesWithContents reports the sections of
+// Cargo.toml that declare each dependency, as the "section"
+// attribute, e.g. "dependencies, dev-dependencies", and those not
+// only in [dependencies] as the "group" attribute, e.g. "prod, dev".
+// Dependencies inherited from the workspace also get the "workspace"
+// attribute, and those from an alternative registry the "registry"
+// attribute, e.g. "my-registry".
+func listSpecfileAttributesWithContents(contents []byte) map[api.PkgName]map[string]string {
+	var specfile cargoToml
+	err := decodeCargoToml(contents, &specfile)
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
+
+	sections := map[api.PkgName][]string{}
+	inherited := map[api.PkgName]bool{}
+	for _, section := range cargoSections {
+		for name, dependency := range specfile.section(section.table) {
+			sections[api.PkgName(name)] = append(sections[api.PkgName(name)], section.table)
+			inherited[api.PkgName(name)] = inherited[api.PkgName(name)] || isInherited(dependency)
+		}
+	}
+	registries := dependencyRegistries(specfile, nil)
+
+	attrs := map[api.PkgName]map[string]string{}
+	for name, tables := range sections {
+		attrs[name] = map[string]string{"section": strings.Join(tables, ", ")}
+		if groups := cargoGroups(tables); groups != "prod" {
+			attrs[name]["group"] = groups
+		}
+		if inherited[name] {
+			attrs[name]["workspace"] = "true"
+		}
+		if registry := registries[name]; registry != "" {
+			attrs[name]["registry"] = registry
+		}
+	}
+	return attrs
+}
+
+// cargoGroups returns the "group" attribute of a dependency declared
+// in the given tables of Cargo.toml, e.g. "prod, dev" for one in both
+// [dependencies] and [dev-dependencies].
+func cargoGroups(tables []string) string {
+	groups := []string{}
+	for _, table := range tables {
+		switch table {
+		case "dependencies":
+			groups = append(groups, "prod")
 		default:
-			util.Die("Cargo.toml: unexpected dependency format %q", name)
+			groups = append(groups, strings.TrimSuffix(table, "-dependencies"))
 		}
+	}
+	return strings.Join(groups, ", ")
+}
 
-		packages[api.PkgName(name)] = spec
+// cargoRmCmds returns the cargo rm commands that remove the given
+// packages from every section of Cargo.toml that declares them.
+// Packages that aren't declared anywhere are passed to a plain cargo
+// rm, which reports the error.
+func cargoRmCmds(contents []byte, pkgs map[api.PkgName]bool) [][]string {
+	var specfile cargoToml
+	err := decodeCargoToml(contents, &specfile)
+	if err != nil {
+		util.Die("Cargo.toml: %s", err)
+	}
 
+	found := map[api.PkgName]bool{}
+	cmds := [][]string{}
+	for _, section := range cargoSections {
+		names := []string{}
+		for name := range pkgs {
+			if _, ok := specfile.section(section.table)[string(name)]; ok {
+				names = append(names, string(name))
+				found[name] = true
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		cmd := []string{"cargo", "rm"}
+		if section.flag != "" {
+			cmd = append(cmd, section.flag)
+		}
+		cmds = append(cmds, append(cmd, names...))
 	}
 
-	return packages
+	missing := []string{}
+	for name := range pkgs {
+		if !found[name] {
+			missing = append(missing, string(name))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		cmds = append(cmds, append([]string{"cargo", "rm"}, missing...))
+	}
+	return cmds
 }
 
 func listLockfile() map[api.PkgName]api.PkgVersion {
@@ -210,6 +789,41 @@ func listLockfile() map[api.PkgName]api.PkgVersion {
 	return listLockfileWithContents(contents)
 }
 
+// listPackagesForNix returns the crates named in Cargo.toml and
+// Cargo.lock, whichever exist. The lockfile matters because the
+// crates that need system libraries, such as openssl-sys, are
+// usually pulled in indirectly.
+func listPackagesForNix() []api.PkgName {
+	names := map[api.PkgName]bool{}
+	if util.Exists("Cargo.toml") {
+		for name := range listSpecfile() {
+			names[name] = true
+		}
+	}
+	if util.Exists("Cargo.lock") {
+		for name := range listLockfile() {
+			names[name] = true
+		}
+	}
+	pkgs := []api.PkgName{}
+	for name := range names {
+		pkgs = append(pkgs, name)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i] < pkgs[j] })
+	return pkgs
+}
+
+// lockfileVersionError returns an error if the format version of
+// Cargo.lock is one we don't know how to parse. The version key was
+// only introduced with format 3, so its absence means format 1 or 2.
+func lockfileVersionError(lockfile cargoLock) error {
+	version := lockfile.Version
+	if version == 0 {
+		version = 1
+	}
+	return util.LockfileVersionError("Cargo.lock", version, 1, 4)
+}
+
 func listLockfileWithContents(contents []byte) map[api.PkgName]api.PkgVersion {
 	var lockfile cargoLock
 	err := toml.Unmarshal(contents, &lockfile)
@@ -217,6 +831,8 @@ func listLockfileWithContents(contents []byte) map[api.PkgName]api.PkgVersion {
 		util.Die("Cargo.lock: %s", err)
 	}
 
+	util.WarnOrDie(lockfileVersionError(lockfile))
+
 	packages := make(map[api.PkgName]api.PkgVersion)
 	for _, pkg := range lockfile.Packages {
 		packages[api.PkgName(pkg.Name)] = api.PkgVersion(pkg.Version)
@@ -225,6 +841,121 @@ func listLockfileWithContents(contents []byte) map[api.PkgName]api.PkgVersion {
 	return packages
 }
 
+func listLockfileDependencies() map[api.PkgName][]api.PkgName {
+	contents, err := os.ReadFile("Cargo.lock")
+	if err != nil {
+		util.Die("Cargo.lock: %s", err)
+	}
+
+	return listLockfileDependenciesWithContents(contents)
+}
+
+// listLockfileDependenciesWithContents implements
+// ListLockfileDependencies. Cargo.lock names a dependency as "NAME",
+// or as "NAME VERSION" (followed by the source if need be) when
+// several versions of it are locked, and only the name is kept.
+func listLockfileDependenciesWithContents(contents []byte) map[api.PkgName][]api.PkgName {
+	var lockfile cargoLock
+	err := toml.Unmarshal(contents, &lockfile)
+	if err != nil {
+		util.Die("Cargo.lock: %s", err)
+	}
+
+	util.WarnOrDie(lockfileVersionError(lockfile))
+
+	graph := make(map[api.PkgName][]api.PkgName)
+	for _, pkg := range lockfile.Packages {
+		name := api.PkgName(pkg.Name)
+		if graph[name] == nil {
+			graph[name] = []api.PkgName{}
+		}
+		for _, dependency := range pkg.Dependencies {
+			dependencyName, _, _ := strings.Cut(dependency, " ")
+			graph[name] = append(graph[name], api.PkgName(dependencyName))
+		}
+	}
+
+	return graph
+}
+
+var (
+	// error: failed to select a version for the requirement `serde = "^1.0.150"`
+	cargoRequirementRegexp = regexp.MustCompile("failed to select a version for the requirement `([^ `]+) = \"([^\"]*)\"`")
+	// error: failed to select a version for `serde`.
+	cargoSelectRegexp = regexp.MustCompile("failed to select a version for `([^`]+)`")
+	// versions that meet the requirements `^1.0.166` are: 1.0.188, ...
+	cargoMeetRegexp = regexp.MustCompile("versions that meet the requirements `([^`]*)`")
+	// required by package `serde_json v1.0.108`
+	cargoRequiredByRegexp = regexp.MustCompile("required by package `([^ `]+) v([^ `]+)")
+	// ... which satisfies dependency `serde = "=1.0.150"` of package `my-app v0.1.0 (/app)`
+	cargoSatisfiesRegexp = regexp.MustCompile("which satisfies dependency `([^ `]+) = \"([^\"]*)\"` of package `([^ `]+) v([^ `]+)")
+)
+
+// parseCargoConflicts extracts the constraints placed on the package
+// name from cargo's version selection errors.
+func parseCargoConflicts(output string, name api.PkgName) []api.Conflict {
+	conflicts := []api.Conflict{}
+	seen := map[api.Conflict]bool{}
+	addConflict := func(conflict api.Conflict) {
+		if !seen[conflict] {
+			seen[conflict] = true
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	// A version selection error names the constraint and the
+	// package that imposes it on separate lines, in either order,
+	// so collect both before recording a conflict.
+	var relevant bool
+	var constraint string
+	var blocker []string
+	for _, line := range strings.Split(output, "\n") {
+		if match := cargoRequirementRegexp.FindStringSubmatch(line); match != nil {
+			relevant, constraint, blocker = match[1] == string(name), match[2], nil
+		} else if match := cargoSelectRegexp.FindStringSubmatch(line); match != nil {
+			relevant, constraint, blocker = match[1] == string(name), "", nil
+		} else if match := cargoMeetRegexp.FindStringSubmatch(line); match != nil && relevant {
+			constraint = match[1]
+		} else if match := cargoRequiredByRegexp.FindStringSubmatch(line); match != nil && relevant && blocker == nil {
+			blocker = match
+		}
+		if relevant && constraint != "" && blocker != nil {
+			addConflict(api.Conflict{
+				Blocker:        blocker[1],
+				BlockerVersion: blocker[2],
+				Constraint:     constraint,
+			})
+			relevant = false
+		}
+
+		if match := cargoSatisfiesRegexp.FindStringSubmatch(line); match != nil && match[1] == string(name) {
+			addConflict(api.Conflict{
+				Blocker:        match[3],
+				BlockerVersion: match[4],
+				Constraint:     match[2],
+			})
+		}
+	}
+	return conflicts
+}
+
+func whyNot(ctx context.Context, name api.PkgName, version api.PkgVersion) []api.Conflict {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "cargo update --dry-run")
+	defer span.Finish()
+	output, err := util.GetCmdCombinedOutputFallible([]string{
+		"cargo", "update", "--dry-run", "--package", string(name), "--precise", string(version),
+	})
+	if err == nil {
+		return []api.Conflict{}
+	}
+	conflicts := parseCargoConflicts(string(output), name)
+	if len(conflicts) == 0 {
+		util.Die("cargo update --dry-run: %s\n%s", err, output)
+	}
+	return conflicts
+}
+
 // RustBackend is a UPM backend for Rust that uses Cargo.
 var RustBackend = api.LanguageBackend{
 	Name:             "rust",
@@ -232,11 +963,14 @@ var RustBackend = api.LanguageBackend{
 	Lockfile:         "Cargo.lock",
 	IsAvailable:      cargoIsAvailable,
 	FilenamePatterns: []string{"*.rs"},
+	Quirks:           api.QuirksAddSupportsRegistry,
+	SpecSyntax:       api.SpecSyntaxCargo,
 	GetPackageDir: func() string {
 		return "target"
 	},
-	Search: search,
-	Info:   info,
+	Search:          search,
+	Info:            info,
+	PopularPackages: popularPackages,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "cargo add")
@@ -245,6 +979,17 @@ var RustBackend = api.LanguageBackend{
 			util.RunCmd([]string{"cargo", "init", "."})
 		}
 		cmd := []string{"cargo", "add"}
+		switch config.Dependency {
+		case config.DependencyDev:
+			cmd = append(cmd, "--dev")
+		case config.DependencyBuild:
+			cmd = append(cmd, "--build")
+		case config.DependencyOptional:
+			cmd = append(cmd, "--optional")
+		}
+		if config.Registry != "" {
+			cmd = append(cmd, "--registry", config.Registry)
+		}
 		for name, spec := range pkgs {
 			arg := string(name)
 			if spec != "" {
@@ -254,27 +999,50 @@ var RustBackend = api.LanguageBackend{
 		}
 		util.RunCmd(cmd)
 	},
+	AddToSpecfile:         addToSpecfile,
+	AddToSpecfileContents: addToSpecfileContents,
+	DependencyTypes: []config.DependencyType{
+		config.DependencyDev,
+		config.DependencyBuild,
+		config.DependencyOptional,
+	},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "cargo rm")
 		defer span.Finish()
-		cmd := []string{"cargo", "rm"}
-		for name := range pkgs {
-			cmd = append(cmd, string(name))
+		contents, err := os.ReadFile("Cargo.toml")
+		if err != nil {
+			util.Die("Cargo.toml: %s", err)
+		}
+		for _, cmd := range cargoRmCmds(contents, pkgs) {
+			util.RunCmd(cmd)
 		}
-		util.RunCmd(cmd)
 	},
+	SortSpecfile: sortSpecfile,
 	Lock: func(ctx context.Context) {
 		// Lock file is updated at build time
 	},
+	IsLockfileCurrent: func(ctx context.Context) bool {
+		//nolint:ineffassign,wastedassign,staticcheck
+		span, ctx := tracer.StartSpanFromContext(ctx, "cargo update --locked")
+		defer span.Finish()
+		// With --locked, cargo fails instead of changing
+		// Cargo.lock, and updating only the workspace members
+		// leaves the other packages at their locked versions.
+		return util.GetExitCode([]string{"cargo", "update", "--workspace", "--locked"}, false, true) == 0
+	},
 	Install: func(ctx context.Context) {
 		// Dependencies are installed at build time
 	},
-	ListSpecfile: listSpecfile,
-	ListLockfile: listLockfile,
+	ListSpecfile:             listSpecfile,
+	ListSpecfileAttributes:   listSpecfileAttributes,
+	ListSpecfileSettings:     listSpecfileSettings,
+	ListLockfile:             listLockfile,
+	ListLockfileDependencies: listLockfileDependencies,
 	Guess: func(ctx context.Context) (map[api.PkgName]bool, bool) {
 		util.NotImplemented()
 		return nil, false
 	},
-	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
+	WhyNot:                             whyNot,
+	InstallReplitNixSystemDependencies: nix.MakeInstallReplitNixSystemDependencies(nix.RustNixDeps, listPackagesForNix),
 }
@@ -1,12 +1,20 @@
 package rust
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/require"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/testutil"
 )
 
 func TestCrateInfo(t *testing.T) {
@@ -15,6 +23,17 @@ func TestCrateInfo(t *testing.T) {
 	require.Equal(t, "serde", info.Name)
 }
 
+func TestCrateInfoKeywords(t *testing.T) {
+	contents, err := os.ReadFile("testdata/crate-reqwest.json")
+	require.NoError(t, err)
+	var crateInfo crateInfoResult
+	require.NoError(t, json.Unmarshal(contents, &crateInfo))
+
+	info := crateInfo.toPkgInfo()
+	require.Equal(t, []string{"http", "request", "client", "web-programming::http-client", "wasm"}, info.Keywords)
+	require.Equal(t, "MIT OR Apache-2.0", info.License)
+}
+
 func TestCrateSearch(t *testing.T) {
 	results := RustBackend.Search("serde")
 	// We don't want to check the results as they may change externally and break this test.
@@ -25,7 +44,7 @@ func TestListSpecfile(t *testing.T) {
 	contents, err := os.ReadFile("testdata/Cargo.toml")
 	require.NoError(t, err)
 
-	pkgs := listSpecfileWithContents(contents)
+	pkgs := listSpecfileWithContents(contents, nil)
 
 	expectedPkgs := map[api.PkgName]api.PkgSpec{
 		api.PkgName("rand"):       api.PkgSpec("https://github.com/rust-lang-nursery/rand"),
@@ -151,3 +170,349 @@ func TestListLockfile(t *testing.T) {
 
 	require.Equal(t, expectedPkgs, pkgs)
 }
+
+func TestListLockfileDependencies(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.lock")
+	require.NoError(t, err)
+
+	graph := listLockfileDependenciesWithContents(contents)
+	require.Equal(t, []api.PkgName{"getrandom", "once_cell", "version_check"}, graph["ahash"])
+	require.Contains(t, graph, api.PkgName("autocfg"))
+	require.Empty(t, graph["autocfg"])
+
+	direct := []api.PkgName{"rand", "serde", "serde_json", "sqlx"}
+	require.Equal(t, []api.SharedDependency{
+		{Name: "cfg-if", Count: 2, PulledInBy: []string{"rand", "sqlx"}},
+		{Name: "getrandom", Count: 2, PulledInBy: []string{"rand", "sqlx"}},
+		{Name: "itoa", Count: 2, PulledInBy: []string{"serde_json", "sqlx"}},
+		{Name: "libc", Count: 2, PulledInBy: []string{"rand", "sqlx"}},
+		{Name: "wasi", Count: 2, PulledInBy: []string{"rand", "sqlx"}},
+	}, pkg.SharedDependencies(graph, direct))
+	require.Equal(t, []string{"serde_json"}, pkg.PulledInBy(graph, direct, "serde"))
+}
+
+func TestParseCargoConflicts(t *testing.T) {
+	contents, err := os.ReadFile("testdata/conflict-requirement.txt")
+	require.NoError(t, err)
+
+	conflicts := parseCargoConflicts(string(contents), "serde")
+
+	require.Equal(t, []api.Conflict{
+		{Blocker: "serde_json", BlockerVersion: "1.0.108", Constraint: "^1.0.166"},
+	}, conflicts)
+}
+
+func TestParseCargoConflictsPreviouslySelected(t *testing.T) {
+	contents, err := os.ReadFile("testdata/conflict-selected.txt")
+	require.NoError(t, err)
+
+	conflicts := parseCargoConflicts(string(contents), "serde")
+
+	require.Equal(t, []api.Conflict{
+		{Blocker: "serde_json", BlockerVersion: "1.0.108", Constraint: "^1.0.166"},
+		{Blocker: "my-app", BlockerVersion: "0.1.0", Constraint: "=1.0.150"},
+	}, conflicts)
+}
+
+func TestLockfileVersion(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.lock")
+	require.NoError(t, err)
+
+	var lockfile cargoLock
+	require.NoError(t, toml.Unmarshal(contents, &lockfile))
+	require.NoError(t, lockfileVersionError(lockfile))
+}
+
+func TestLockfileVersionTooHigh(t *testing.T) {
+	contents := []byte(`
+version = 99
+
+[[package]]
+name = "serde"
+version = "1.0.130"
+`)
+
+	var lockfile cargoLock
+	require.NoError(t, toml.Unmarshal(contents, &lockfile))
+	err := lockfileVersionError(lockfile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "lockfile version 99 is not supported (expected 1 to 4)")
+
+	// Without --strict, parsing carries on with a warning.
+	pkgs := listLockfileWithContents(contents)
+	require.Equal(t, map[api.PkgName]api.PkgVersion{"serde": "1.0.130"}, pkgs)
+}
+
+func TestAddToSpecfile(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.toml")
+	require.NoError(t, err)
+
+	testutil.Chdir(t, t.TempDir())
+	require.NoError(t, os.WriteFile("Cargo.toml", contents, 0o644))
+
+	// Neither cargo nor crates.io may be used.
+	t.Setenv("PATH", t.TempDir())
+	testutil.Offline(t)
+
+	RustBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"anyhow": "1.0",
+		"tokio":  "",
+		"serde":  "1.0.200",
+	}, "")
+
+	edited, err := os.ReadFile("Cargo.toml")
+	require.NoError(t, err)
+	require.Equal(t, map[api.PkgName]api.PkgSpec{
+		"anyhow":     "1.0",
+		"tokio":      "*",
+		"serde":      "1.0.200",
+		"serde_json": "1.0.68",
+		"rand":       "https://github.com/rust-lang-nursery/rand",
+		"sqlx":       "0.5.7",
+	}, listSpecfileWithContents(edited, nil))
+	require.Contains(t, string(edited), "[package]\nname = \"rust-upm-test\"\n")
+	require.NoFileExists(t, "Cargo.lock")
+}
+
+func TestListSpecfileSections(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.sections.toml")
+	require.NoError(t, err)
+
+	require.Equal(t, map[api.PkgName]api.PkgSpec{
+		"serde":             "1.0.130",
+		"log":               "0.4",
+		"local_util":        "../local_util",
+		"tokio":             "1.32",
+		"pretty_assertions": "1.4",
+		"cc":                "https://github.com/rust-lang/cc-rs",
+	}, listSpecfileWithContents(contents, nil))
+
+	require.Equal(t, map[api.PkgName]map[string]string{
+		"serde":             {"section": "dependencies"},
+		"log":               {"section": "dependencies, dev-dependencies", "group": "prod, dev"},
+		"local_util":        {"section": "dependencies"},
+		"tokio":             {"section": "dependencies"},
+		"pretty_assertions": {"section": "dev-dependencies", "group": "dev"},
+		"cc":                {"section": "build-dependencies", "group": "build"},
+	}, listSpecfileAttributesWithContents(contents))
+}
+
+func TestAddToSpecfileSections(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.sections.toml")
+	require.NoError(t, err)
+
+	contents, err = addToSpecfileWithContents(contents, "dev-dependencies", map[api.PkgName]api.PkgSpec{
+		"criterion": "0.5",
+	}, false, "")
+	require.NoError(t, err)
+	contents, err = addToSpecfileWithContents(contents, "build-dependencies", map[api.PkgName]api.PkgSpec{
+		"bindgen": "",
+	}, false, "")
+	require.NoError(t, err)
+
+	// Changing the version of an existing dependency keeps the
+	// rest of its descriptor.
+	contents, err = addToSpecfileWithContents(contents, "dependencies", map[api.PkgName]api.PkgSpec{
+		"serde": "1.0.200",
+		"tokio": "1.35",
+	}, false, "")
+	require.NoError(t, err)
+
+	var specfile cargoToml
+	require.NoError(t, toml.Unmarshal(contents, &specfile))
+	require.Equal(t, "0.5", specfile.DevDependencies["criterion"])
+	require.Equal(t, "*", specfile.BuildDependencies["bindgen"])
+	require.Equal(t, map[string]interface{}{
+		"version":  "1.0.200",
+		"features": []interface{}{"derive"},
+	}, specfile.Dependencies["serde"])
+	require.Equal(t, map[string]interface{}{
+		"version":  "1.35",
+		"features": []interface{}{"full"},
+	}, specfile.Dependencies["tokio"])
+	require.Equal(t, map[string]interface{}{
+		"git":    "https://github.com/rust-lang/cc-rs",
+		"branch": "main",
+	}, specfile.BuildDependencies["cc"])
+	require.Contains(t, string(contents), "[dependencies.tokio]\nversion = \"1.35\"\n")
+	require.Contains(t, string(contents), "local_util = { path = \"../local_util\" }\n")
+}
+
+func TestCargoRmCmds(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.sections.toml")
+	require.NoError(t, err)
+
+	require.Equal(t, [][]string{
+		{"cargo", "rm", "log", "tokio"},
+		{"cargo", "rm", "--dev", "log", "pretty_assertions"},
+		{"cargo", "rm", "--build", "cc"},
+	}, cargoRmCmds(contents, map[api.PkgName]bool{
+		"log":               true,
+		"tokio":             true,
+		"pretty_assertions": true,
+		"cc":                true,
+	}))
+
+	require.Equal(t, [][]string{
+		{"cargo", "rm", "--build", "cc"},
+		{"cargo", "rm", "nonexistent"},
+	}, cargoRmCmds(contents, map[api.PkgName]bool{
+		"cc":          true,
+		"nonexistent": true,
+	}))
+}
+
+func TestIsLockfileCurrent(t *testing.T) {
+	if _, err := exec.LookPath("cargo"); err != nil {
+		t.Skip("cargo is not available")
+	}
+
+	testutil.Chdir(t, t.TempDir())
+
+	require.NoError(t, os.MkdirAll("src", 0o755))
+	require.NoError(t, os.WriteFile("src/main.rs", []byte("fn main() {}\n"), 0o644))
+	manifest := "[package]\nname = \"lock-check\"\nversion = \"0.1.0\"\nedition = \"2021\"\n"
+	require.NoError(t, os.WriteFile("Cargo.toml", []byte(manifest), 0o644))
+	require.NoError(t, exec.Command("cargo", "generate-lockfile", "--offline").Run())
+
+	require.True(t, RustBackend.IsLockfileCurrent(context.Background()))
+
+	// Bumping the version of the package changes its entry in
+	// Cargo.lock.
+	lockfile, err := os.ReadFile("Cargo.lock")
+	require.NoError(t, err)
+	bumped := strings.Replace(manifest, "0.1.0", "0.2.0", 1)
+	require.NoError(t, os.WriteFile("Cargo.toml", []byte(bumped), 0o644))
+	require.False(t, RustBackend.IsLockfileCurrent(context.Background()))
+
+	unchanged, err := os.ReadFile("Cargo.lock")
+	require.NoError(t, err)
+	require.Equal(t, string(lockfile), string(unchanged))
+}
+
+func TestSortSpecfile(t *testing.T) {
+	contents, err := os.ReadFile("testdata/Cargo.sections.toml")
+	require.NoError(t, err)
+	contents = append(contents, []byte(`# Features currently pinned.
+features_crate = { version = "1", features = [
+  "a",
+  "b",
+] }
+anyhow = "1"
+`)...)
+
+	testutil.Chdir(t, t.TempDir())
+	require.NoError(t, os.WriteFile("Cargo.toml", contents, 0o644))
+
+	RustBackend.SortSpecfile(context.Background())
+
+	sorted, err := os.ReadFile("Cargo.toml")
+	require.NoError(t, err)
+	require.Equal(t, `[package]
+name = "rust-upm-sections"
+version = "0.1.0"
+edition = "2021"
+build = "build.rs"
+
+[dependencies]
+local_util = { path = "../local_util" }
+log = "0.4"
+serde = { version = "1.0.130", features = ["derive"] }
+
+[dependencies.tokio]
+version = "1.32"
+features = ["full"]
+
+[dev-dependencies]
+log = "0.4.20"
+pretty_assertions = "1.4"
+
+[build-dependencies]
+anyhow = "1"
+cc = { git = "https://github.com/rust-lang/cc-rs", branch = "main" }
+# Features currently pinned.
+features_crate = { version = "1", features = [
+  "a",
+  "b",
+] }
+`, string(sorted))
+}
+
+// chdirToWorkspaceMember copies the workspace fixture into a fresh
+// directory and changes into its member for the duration of the test.
+// It returns the path of the workspace root.
+func chdirToWorkspaceMember(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, file := range []string{"Cargo.toml", "member/Cargo.toml"} {
+		contents, err := os.ReadFile(filepath.Join("testdata/workspace", file))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), contents, 0o644))
+	}
+
+	testutil.Chdir(t, filepath.Join(root, "member"))
+	return root
+}
+
+func TestListSpecfileWorkspace(t *testing.T) {
+	chdirToWorkspaceMember(t)
+
+	require.Equal(t, map[api.PkgName]api.PkgSpec{
+		"serde":  "1.0.190",
+		"tokio":  "1.32",
+		"log":    "0.4",
+		"anyhow": "1.0",
+	}, RustBackend.ListSpecfile())
+
+	require.Equal(t, map[api.PkgName]map[string]string{
+		"serde":  {"section": "dependencies", "workspace": "true"},
+		"tokio":  {"section": "dependencies", "workspace": "true"},
+		"log":    {"section": "dependencies"},
+		"anyhow": {"section": "dev-dependencies", "group": "dev"},
+	}, RustBackend.ListSpecfileAttributes())
+
+	// The fields of [package] are resolved from the workspace too,
+	// and those it doesn't declare are reported.
+	require.Equal(t, map[string]string{
+		"package.name":         "member",
+		"package.version":      "0.3.0 (from the workspace)",
+		"package.edition":      "2021 (from the workspace)",
+		"package.license":      "MIT (from the workspace)",
+		"package.rust-version": "inherited from the workspace, which doesn't declare it",
+	}, RustBackend.ListSpecfileSettings())
+}
+
+func TestAddToSpecfileWorkspace(t *testing.T) {
+	root := chdirToWorkspaceMember(t)
+	member, err := os.ReadFile("Cargo.toml")
+	require.NoError(t, err)
+
+	RustBackend.AddToSpecfile(context.Background(), map[api.PkgName]api.PkgSpec{
+		"serde": "1.0.200",
+		"tokio": "1.35",
+		"rand":  "0.8",
+	}, "")
+
+	// The member keeps inheriting, both its dependencies and the
+	// fields of [package], and only the new crate is added to it.
+	edited, err := os.ReadFile("Cargo.toml")
+	require.NoError(t, err)
+	require.Equal(t, strings.Replace(string(member), "log = \"0.4\"\n", "log = \"0.4\"\nrand = \"0.8\"\n", 1), string(edited))
+
+	// The versions of the inherited dependencies change in the
+	// workspace root instead.
+	rootContents, err := os.ReadFile(filepath.Join(root, "Cargo.toml"))
+	require.NoError(t, err)
+	require.Contains(t, string(rootContents), "serde = { version = \"1.0.200\", features = [\"std\"] }\n")
+	require.Contains(t, string(rootContents), "tokio = \"1.35\"\n")
+	require.Contains(t, string(rootContents), "[workspace.package]\nversion = \"0.3.0\"\n")
+
+	require.Equal(t, map[api.PkgName]api.PkgSpec{
+		"serde":  "1.0.200",
+		"tokio":  "1.35",
+		"log":    "0.4",
+		"rand":   "0.8",
+		"anyhow": "1.0",
+	}, RustBackend.ListSpecfile())
+}
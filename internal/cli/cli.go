@@ -2,11 +2,14 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/replit/upm/internal/backends"
 	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/pkg"
 	"github.com/replit/upm/internal/trace"
 	"github.com/replit/upm/internal/util"
 	"github.com/spf13/cobra"
@@ -26,6 +29,134 @@ func parseOutputFormat(formatStr string) outputFormat {
 	}
 }
 
+// runStreaming runs f, the implementation of a command that takes
+// --format "text" or "ndjson". With "ndjson", the events of the
+// command (see util.Event) are streamed to stdout as it runs, ending
+// with its result, which includes the warnings that f reported.
+func runStreaming(formatStr string, f func()) {
+	switch formatStr {
+	case "text":
+		f()
+		return
+	case "ndjson":
+	default:
+		util.Die(`Error: invalid format %#v (must be "text" or "ndjson")`, formatStr)
+	}
+	util.StreamEvents(os.Stdout)
+	defer util.StreamEvents(nil)
+	_, warnings := util.WithWarnings(context.Background())
+	f()
+	util.Emit(util.Event{Event: util.EventResult, Status: "ok", Warnings: warnings.List()})
+}
+
+// parseOnly takes the value of --only and returns it in the
+// normalized form expected by config.Only.
+func parseOnly(only string) string {
+	switch only {
+	case "":
+		return ""
+	case "prod", "production":
+		return "prod"
+	case "dev", "development":
+		return "dev"
+	default:
+		util.Die(`Error: invalid value for --only %#v (must be "prod" or "dev")`, only)
+		return ""
+	}
+}
+
+// dependencyFlags holds the flags of 'upm add' that choose what kind
+// of dependency the added packages are declared as.
+type dependencyFlags struct {
+	dev      bool
+	build    bool
+	peer     bool
+	optional bool
+	extra    string
+	group    string
+}
+
+// parseDependencyType checks the dependency flags of 'upm add' for
+// contradictions and returns the kind of dependency they ask for.
+// Each flag names a kind of dependency by itself, and they are
+// mutually exclusive, except that --optional qualifies --peer (an
+// optional peer dependency, as with npm's peerDependenciesMeta) and
+// --extra implies --optional.
+func parseDependencyType(flags dependencyFlags) (config.DependencyType, error) {
+	optional := flags.optional || flags.extra != ""
+
+	set := []string{}
+	if flags.dev {
+		set = append(set, "--dev")
+	}
+	if flags.build {
+		set = append(set, "--build")
+	}
+	if flags.peer {
+		set = append(set, "--peer")
+	}
+	if flags.extra != "" {
+		set = append(set, "--extra")
+	} else if flags.optional {
+		set = append(set, "--optional")
+	}
+	if flags.group != "" {
+		set = append(set, "--group")
+	}
+
+	switch {
+	case len(set) == 0:
+		return config.DependencyRegular, nil
+	case len(set) == 1 && flags.dev:
+		return config.DependencyDev, nil
+	case len(set) == 1 && flags.build:
+		return config.DependencyBuild, nil
+	case len(set) == 1 && flags.peer:
+		return config.DependencyPeer, nil
+	case len(set) == 1 && optional:
+		return config.DependencyOptional, nil
+	case len(set) == 1 && flags.group != "":
+		return config.DependencyGroup, nil
+	case len(set) == 2 && flags.peer && flags.optional && flags.extra == "":
+		return config.DependencyOptionalPeer, nil
+	default:
+		last := len(set) - 1
+		return "", fmt.Errorf("%s and %s can't be combined", strings.Join(set[:last], ", "), set[last])
+	}
+}
+
+// omittableDependencyTypes are the kinds of dependency that 'upm add
+// --omit' accepts, by name.
+var omittableDependencyTypes = map[string]config.DependencyType{
+	"dev":      config.DependencyDev,
+	"optional": config.DependencyOptional,
+	"peer":     config.DependencyPeer,
+}
+
+// parseOmit takes the values of 'upm add --omit', each of which may
+// be a comma-separated list, and --no-optional, and returns the kinds
+// of dependency they name, without duplicates.
+func parseOmit(values []string, noOptional bool) ([]config.DependencyType, error) {
+	if noOptional {
+		values = append(values, "optional")
+	}
+	omit := []config.DependencyType{}
+	seen := map[config.DependencyType]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			depType, ok := omittableDependencyTypes[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf(`invalid value for --omit %#v (must be "dev", "optional" or "peer")`, name)
+			}
+			if !seen[depType] {
+				seen[depType] = true
+				omit = append(omit, depType)
+			}
+		}
+	}
+	return omit, nil
+}
+
 // version is set at build time to a Git tag or the string
 // "development version" when not tagging a release.
 var version = "unknown version"
@@ -47,7 +178,9 @@ func DoCLI() {
 	backends.SetupAll()
 
 	var language string
+	var cwd string
 	var formatStr string
+	var streamFormatStr string
 	var guess bool
 	var forceLock bool
 	var forceInstall bool
@@ -57,12 +190,32 @@ func DoCLI() {
 	var ignoredPaths []string
 	var upgrade bool
 	var name string
+	var registryCheck bool
+	var force bool
+	var writeOnly bool
+	var omit []string
+	var noOptional bool
+	var allowDowngrade bool
+	var check bool
+	var unused bool
+	var yes bool
+	var groups bool
+	var catalog string
+	var size bool
+	var sortBy string
+	var depFlags dependencyFlags
 
 	cobra.EnableCommandSorting = false
 
 	rootCmd := &cobra.Command{
 		Use:     "upm",
 		Version: getVersion(),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			util.ChdirToUPM(cwd)
+			if err := config.LoadProjectConfig(); err != nil {
+				util.Die("%s", err)
+			}
+		},
 	}
 	rootCmd.SetVersionTemplate(`{{.Version}}` + "\n")
 	// Not sorting the root command options because none of the
@@ -72,12 +225,24 @@ func DoCLI() {
 	rootCmd.PersistentFlags().StringVarP(
 		&language, "lang", "l", "", "specify project language(s) manually",
 	)
+	rootCmd.PersistentFlags().StringVar(
+		&cwd, "cwd", "", "run in this project directory (overrides UPM_PROJECT_ROOT)",
+	)
 	rootCmd.PersistentFlags().BoolVarP(
 		&config.Quiet, "quiet", "q", false, "don't show what commands are being run",
 	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.Strict, "strict", false, "fail instead of warning about unsupported file formats",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.Offline, "offline", false, "don't access the network, using only locally cached packages",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.PreferOffline, "prefer-offline", false, "use cached registry data and packages when available, only accessing the network on a miss",
+	)
 	rootCmd.PersistentFlags().StringSliceVar(
 		&ignoredPackages, "ignored-packages", []string{},
-		"packages to ignore when searching, guessing, or adding (comma-separated)",
+		"packages to ignore when searching, guessing, adding, or removing unused ones (comma-separated)",
 	)
 	rootCmd.PersistentFlags().StringSliceVar(
 		&ignoredPaths, "ignored-paths", []string{},
@@ -106,9 +271,13 @@ func DoCLI() {
 		Short: "List supported languages",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			runListLanguages()
+			outputFormat := parseOutputFormat(formatStr)
+			runListLanguages(outputFormat)
 		},
 	}
+	cmdListLanguages.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
 	rootCmd.AddCommand(cmdListLanguages)
 
 	cmdSearch := &cobra.Command{
@@ -135,22 +304,51 @@ func DoCLI() {
 		Run: func(cmd *cobra.Command, args []string) {
 			pkg := args[0]
 			outputFormat := parseOutputFormat(formatStr)
-			runInfo(language, pkg, outputFormat)
+			runInfo(language, pkg, size, outputFormat)
 		},
 	}
 	cmdInfo.Flags().SortFlags = false
 	cmdInfo.Flags().StringVarP(
 		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
+	cmdInfo.Flags().BoolVar(
+		&size, "size", false, "also show the size of the package, from the registry",
+	)
 	rootCmd.AddCommand(cmdInfo)
 
 	cmdAdd := &cobra.Command{
 		Use:   `add "PACKAGE[ SPEC]"...`,
 		Short: "Add packages to the specfile",
+		Long:  "Add packages to the specfile, refusing those that the package policy forbids. Policy rules with a version constraint are only checked against specs that pin a version, not against the version a range resolves to; run upm policy-check afterwards to check the lockfile",
 		Run: func(cmd *cobra.Command, args []string) {
 			pkgSpecStrs := args
-			runAdd(language, pkgSpecStrs, upgrade, guess, forceGuess,
-				ignoredPackages, forceLock, forceInstall, name)
+			depType, err := parseDependencyType(depFlags)
+			if err != nil {
+				util.Die("%s", err)
+			}
+			config.Dependency = depType
+			config.Extra = depFlags.extra
+			config.Group = depFlags.group
+			config.Omit, err = parseOmit(omit, noOptional)
+			if err != nil {
+				util.Die("%s", err)
+			}
+			runStreaming(streamFormatStr, func() {
+				runAdd(language, pkgSpecStrs, addOptions{
+					upgrade:         upgrade,
+					guess:           guess,
+					forceGuess:      forceGuess,
+					ignoredPackages: ignoredPackages,
+					forceLock:       forceLock,
+					forceInstall:    forceInstall,
+					name:            name,
+					registryCheck:   registryCheck,
+					force:           force,
+					yes:             yes,
+					writeOnly:       writeOnly,
+					allowDowngrade:  allowDowngrade,
+				})
+			})
 		},
 	}
 	cmdAdd.Flags().SortFlags = false
@@ -172,15 +370,81 @@ func DoCLI() {
 	cmdAdd.Flags().StringVarP(
 		&name, "name", "n", "", "specify project name",
 	)
+	cmdAdd.Flags().BoolVar(
+		&depFlags.dev, "dev", false, "add packages as development dependencies",
+	)
+	cmdAdd.Flags().BoolVar(
+		&depFlags.build, "build", false, "add packages as build dependencies",
+	)
+	cmdAdd.Flags().BoolVar(
+		&depFlags.peer, "peer", false, "add packages as peer dependencies",
+	)
+	cmdAdd.Flags().BoolVar(
+		&depFlags.optional, "optional", false, "add packages as optional dependencies",
+	)
+	cmdAdd.Flags().StringVar(
+		&depFlags.extra, "extra", "", "add packages as optional dependencies of the named extra",
+	)
+	cmdAdd.Flags().StringVar(
+		&depFlags.group, "group", "", "add packages to the named dependency group",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.GitHub, "github", "", "source the package from a GitHub repository (user/repo)",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.VCS, "vcs", "", "source the package from a version control repository (URL), declaring it in the specfile",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.Registry, "registry", "", "source the packages from this alternative registry, as configured for the package manager",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.SaveCatalog, "save-catalog", "", `declare the packages in the named pnpm catalog ("default" if no name is given) and reference them from the specfile with catalog:`,
+	)
+	cmdAdd.Flags().Lookup("save-catalog").NoOptDefVal = "default"
+	cmdAdd.Flags().StringSliceVar(
+		&omit, "omit", nil, "don't install these kinds of dependencies (dev, optional, peer) during the add",
+	)
+	cmdAdd.Flags().BoolVar(
+		&noOptional, "no-optional", false, "don't install optional dependencies during the add (--omit=optional)",
+	)
+	cmdAdd.Flags().BoolVar(
+		&writeOnly, "write-only", false, "only edit the specfile, without resolving or installing",
+	)
+	cmdAdd.Flags().BoolVar(
+		&allowDowngrade, "allow-downgrade", false, "add packages at versions lower than those in the lockfile",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.RefuseIncompatible, "refuse-incompatible", false, "refuse to add packages that don't support every runtime version the project allows",
+	)
+	cmdAdd.Flags().BoolVar(
+		&registryCheck, "registry-check", false, "warn about packages that look like typosquats",
+	)
+	cmdAdd.Flags().BoolVar(
+		&force, "force", false, "add packages flagged by --registry-check without asking",
+	)
+	cmdAdd.Flags().BoolVarP(
+		&yes, "yes", "y", false, "add the packages without previewing them and asking first",
+	)
+	cmdAdd.Flags().StringVar(
+		&streamFormatStr, "format", "text", `output format ("text", or "ndjson" to stream progress events)`,
+	)
 	rootCmd.AddCommand(cmdAdd)
 
 	cmdRemove := &cobra.Command{
 		Use:   "remove PACKAGE...",
 		Short: "Remove packages from the specfile",
-		Args:  cobra.MinimumNArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if unused {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			pkgs := args
-			runRemove(language, pkgs, upgrade, forceLock, forceInstall)
+			runStreaming(streamFormatStr, func() {
+				runRemove(language, pkgs, upgrade, forceLock, forceInstall,
+					unused, yes, ignoredPackages)
+			})
 		},
 	}
 	cmdRemove.Flags().SortFlags = false
@@ -193,6 +457,15 @@ func DoCLI() {
 	cmdRemove.Flags().BoolVarP(
 		&forceInstall, "force-install", "F", false, "reinstall packages even if up to date",
 	)
+	cmdRemove.Flags().BoolVar(
+		&unused, "unused", false, "remove the packages that aren't imported anywhere",
+	)
+	cmdRemove.Flags().BoolVarP(
+		&yes, "yes", "y", false, "remove the packages found by --unused without asking",
+	)
+	cmdRemove.Flags().StringVar(
+		&streamFormatStr, "format", "text", `output format ("text", or "ndjson" to stream progress events)`,
+	)
 	rootCmd.AddCommand(cmdRemove)
 
 	updateAliases := []string{"update", "upgrade"}
@@ -207,7 +480,10 @@ func DoCLI() {
 					upgrade = true
 				}
 			}
-			runLock(language, upgrade, forceLock, forceInstall)
+			config.Only = parseOnly(config.Only)
+			runStreaming(streamFormatStr, func() {
+				runLock(language, upgrade, forceLock, forceInstall, check, catalog)
+			})
 		},
 	}
 	cmdLock.Flags().SortFlags = false
@@ -220,20 +496,53 @@ func DoCLI() {
 	cmdLock.Flags().BoolVarP(
 		&forceInstall, "force-install", "F", false, "reinstall packages even if up to date",
 	)
+	cmdLock.Flags().BoolVar(
+		&check, "check", false, "exit non-zero if the lockfile is out of date, without writing it",
+	)
+	cmdLock.Flags().StringVar(
+		&catalog, "catalog", "", `bump the entries of the named catalog ("default" for the default one) to the latest versions, and lock only for them; with --check, exit non-zero if any are behind`,
+	)
+	cmdLock.Flags().BoolVar(
+		&config.Production, "production", false, "don't install development dependencies",
+	)
+	cmdLock.Flags().StringVar(
+		&config.Only, "only", "", `install only "prod" dependencies, or "dev" too (overrides --production and NODE_ENV)`,
+	)
+	cmdLock.Flags().StringVar(
+		&streamFormatStr, "format", "text", `output format ("text", or "ndjson" to stream progress events)`,
+	)
 	rootCmd.AddCommand(cmdLock)
 
 	cmdInstall := &cobra.Command{
-		Use:   "install",
+		Use:   "install [PACKAGE...]",
 		Short: "Install packages from the lockfile",
-		Args:  cobra.NoArgs,
+		Long:  "Install packages from the lockfile, or only the named ones, without changing the specfile",
 		Run: func(cmd *cobra.Command, args []string) {
-			runInstall(language, forceInstall)
+			config.Only = parseOnly(config.Only)
+			runStreaming(streamFormatStr, func() {
+				runInstall(language, forceInstall, args)
+			})
 		},
 	}
 	cmdInstall.Flags().SortFlags = false
 	cmdInstall.Flags().BoolVarP(
 		&forceInstall, "force", "F", false, "reinstall packages even if up to date",
 	)
+	cmdInstall.Flags().BoolVar(
+		&config.Production, "production", false, "don't install development dependencies",
+	)
+	cmdInstall.Flags().StringVar(
+		&config.Only, "only", "", `install only "prod" dependencies, or "dev" too (overrides --production and NODE_ENV)`,
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.NoScripts, "no-scripts", false, "don't run scripts defined by the project while installing",
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.Frozen, "frozen", false, "fail instead of updating the lockfile if it is out of date",
+	)
+	cmdInstall.Flags().StringVar(
+		&streamFormatStr, "format", "text", `output format ("text", or "ndjson" to stream progress events)`,
+	)
 	rootCmd.AddCommand(cmdInstall)
 
 	cmdList := &cobra.Command{
@@ -243,7 +552,20 @@ func DoCLI() {
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			outputFormat := parseOutputFormat(formatStr)
-			runList(language, all, outputFormat)
+			if all && groups {
+				util.Die("--all and --groups can't be combined")
+			}
+			switch sortBy {
+			case "name":
+			case "size":
+				size = true
+			default:
+				util.Die("--sort must be name or size, not %q", sortBy)
+			}
+			if size && groups {
+				util.Die("--size and --groups can't be combined")
+			}
+			runList(language, all, groups, size, sortBy, outputFormat)
 		},
 	}
 	cmdInstall.Flags().SortFlags = false
@@ -253,6 +575,18 @@ func DoCLI() {
 	cmdList.Flags().StringVarP(
 		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
+	cmdList.Flags().BoolVar(
+		&config.Verbose, "verbose", false, "show more information about each package, such as its source",
+	)
+	cmdList.Flags().BoolVar(
+		&groups, "groups", false, "list packages by dependency group, such as prod, dev or a named group",
+	)
+	cmdList.Flags().BoolVar(
+		&size, "size", false, "show the size of each package, from the registry, and the total",
+	)
+	cmdList.Flags().StringVar(
+		&sortBy, "sort", "name", `order of the packages ("name", or "size" for the largest first, implying --size)`,
+	)
 	rootCmd.AddCommand(cmdList)
 
 	cmdGuess := &cobra.Command{
@@ -261,7 +595,8 @@ func DoCLI() {
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			util.AddIngoredPaths(ignoredPaths)
-			runGuess(language, all, forceGuess, ignoredPackages)
+			outputFormat := parseOutputFormat(formatStr)
+			runGuess(language, all, forceGuess, ignoredPackages, outputFormat)
 		},
 	}
 	cmdGuess.Flags().SortFlags = false
@@ -271,8 +606,125 @@ func DoCLI() {
 	cmdGuess.Flags().BoolVarP(
 		&forceGuess, "force", "f", false, "bypass cache",
 	)
+	cmdGuess.Flags().StringVar(
+		&formatStr, "format", "table", `output format ("table" or "json")`,
+	)
 	rootCmd.AddCommand(cmdGuess)
 
+	cmdWhy := &cobra.Command{
+		Use:   "why PACKAGE",
+		Short: "Explain which dependencies pull in a package",
+		Long:  "Show which direct dependencies pull in a package according to the lockfile, or with --all, which packages several of them share",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			var pkgName string
+			if len(args) > 0 {
+				pkgName = args[0]
+			}
+			runWhy(language, pkgName, all, outputFormat)
+		},
+	}
+	cmdWhy.Flags().SortFlags = false
+	cmdWhy.Flags().BoolVarP(
+		&all, "all", "a", false, "rank the packages that several direct dependencies pull in",
+	)
+	cmdWhy.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdWhy)
+
+	var sbomFormat string
+	cmdSBOM := &cobra.Command{
+		Use:   "sbom",
+		Short: "Print a software bill of materials",
+		Long:  "Print a software bill of materials for the packages in the lockfile, with their versions, licenses and package URLs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runSBOM(language, sbomFormat)
+		},
+	}
+	cmdSBOM.Flags().StringVarP(
+		&sbomFormat, "format", "f", pkg.SBOMFormatCycloneDX,
+		fmt.Sprintf(`SBOM format (%q or %q)`, pkg.SBOMFormatCycloneDX, pkg.SBOMFormatSPDX),
+	)
+	rootCmd.AddCommand(cmdSBOM)
+
+	var conflicts bool
+	cmdLicenses := &cobra.Command{
+		Use:   "licenses",
+		Short: "List the licenses of the packages in the lockfile",
+		Long:  "List the licenses of the packages in the lockfile, or with --conflicts, the packages that depend on others under incompatible licenses",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runLicenses(language, conflicts, outputFormat)
+		},
+	}
+	cmdLicenses.Flags().SortFlags = false
+	cmdLicenses.Flags().BoolVar(
+		&conflicts, "conflicts", false, "report packages pulled in under licenses incompatible with those that depend on them (advisory)",
+	)
+	cmdLicenses.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdLicenses)
+
+	cmdPolicyCheck := &cobra.Command{
+		Use:   "policy-check",
+		Short: "Check the lockfile against the package policy",
+		Long:  "Report the packages in the lockfile, direct or transitive, that the policy of the project configuration file forbids, exiting non-zero if there are any. Unlike upm add, this checks policy rules with a version constraint against the resolved versions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runPolicyCheck(language, outputFormat)
+		},
+	}
+	cmdPolicyCheck.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdPolicyCheck)
+
+	var fetch bool
+	cmdExec := &cobra.Command{
+		Use:   "exec BIN [ARG...]",
+		Short: "Run an executable provided by a package",
+		Long:  "Run an executable provided by one of the project's installed packages, such as one in node_modules/.bin, without installing it globally",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if code := runExec(language, args[0], args[1:], fetch); code != 0 {
+				os.Exit(code)
+			}
+		},
+	}
+	// Flags after BIN are its own.
+	cmdExec.Flags().SetInterspersed(false)
+	cmdExec.Flags().BoolVar(
+		&fetch, "fetch", false, "download and run the package providing BIN if it isn't installed",
+	)
+	rootCmd.AddCommand(cmdExec)
+
+	cmdWhyNot := &cobra.Command{
+		Use:   "why-not PACKAGE@VERSION",
+		Short: "Explain why a package version can't be installed",
+		Long:  "Run the resolver in a dry run and show which dependencies block the requested version",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runWhyNot(language, args[0], outputFormat)
+		},
+	}
+	cmdWhyNot.Flags().SortFlags = false
+	cmdWhyNot.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdWhyNot)
+
 	cmdShowSpecfile := &cobra.Command{
 		Use:   "show-specfile",
 		Short: "Print the filename of the specfile",
@@ -303,6 +755,33 @@ func DoCLI() {
 	}
 	rootCmd.AddCommand(cmdShowPackageDir)
 
+	cmdDoctor := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the project for problems",
+		Long:  "Warn about problems with the project, such as targeting a release of the language runtime that has reached end of life, or a lockfile that is out of date with the specfile",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runDoctor(language, outputFormat)
+		},
+	}
+	cmdDoctor.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdDoctor)
+
+	cmdSchema := &cobra.Command{
+		Use:       "schema " + strings.Join(schemaNames(), "|"),
+		Short:     "Print the JSON Schema of a command's JSON output",
+		Long:      "Print a JSON Schema document describing the output of a command run with --format json",
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: schemaNames(),
+		Run: func(cmd *cobra.Command, args []string) {
+			runSchema(args[0])
+		},
+	}
+	rootCmd.AddCommand(cmdSchema)
+
 	cmdInstallReplitNixSystemDependencies := &cobra.Command{
 		Use:   `install-replit-nix-system-dependencies "PACKAGE[ SPEC]" ...`,
 		Short: "Install system dependencies into replit.nix using the passed packages and the specfile.",
@@ -338,7 +817,6 @@ func DoCLI() {
 		}
 	}
 
-	util.ChdirToUPM()
 	err := rootCmd.Execute()
 	if err != nil {
 		panic(err)
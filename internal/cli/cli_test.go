@@ -0,0 +1,1431 @@
+package cli
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/backends/nodejs"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/testutil"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestParseDependencyType(t *testing.T) {
+	valid := []struct {
+		flags    dependencyFlags
+		expected config.DependencyType
+	}{
+		{dependencyFlags{}, config.DependencyRegular},
+		{dependencyFlags{dev: true}, config.DependencyDev},
+		{dependencyFlags{build: true}, config.DependencyBuild},
+		{dependencyFlags{peer: true}, config.DependencyPeer},
+		{dependencyFlags{optional: true}, config.DependencyOptional},
+		{dependencyFlags{extra: "yaml"}, config.DependencyOptional},
+		{dependencyFlags{optional: true, extra: "yaml"}, config.DependencyOptional},
+		{dependencyFlags{optional: true, peer: true}, config.DependencyOptionalPeer},
+		{dependencyFlags{group: "docs"}, config.DependencyGroup},
+	}
+	for _, tc := range valid {
+		depType, err := parseDependencyType(tc.flags)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", tc.flags, err)
+			continue
+		}
+		if depType != tc.expected {
+			t.Errorf("%+v: expected %q, got %q", tc.flags, tc.expected, depType)
+		}
+	}
+
+	invalid := []struct {
+		flags    dependencyFlags
+		expected string
+	}{
+		{dependencyFlags{dev: true, peer: true}, "--dev and --peer can't be combined"},
+		{dependencyFlags{dev: true, optional: true}, "--dev and --optional can't be combined"},
+		{dependencyFlags{dev: true, group: "docs"}, "--dev and --group can't be combined"},
+		{dependencyFlags{dev: true, build: true}, "--dev and --build can't be combined"},
+		{dependencyFlags{build: true, optional: true}, "--build and --optional can't be combined"},
+		{dependencyFlags{peer: true, extra: "yaml"}, "--peer and --extra can't be combined"},
+		{dependencyFlags{peer: true, group: "docs"}, "--peer and --group can't be combined"},
+		{dependencyFlags{optional: true, group: "docs"}, "--optional and --group can't be combined"},
+		{dependencyFlags{dev: true, peer: true, optional: true}, "--dev, --peer and --optional can't be combined"},
+	}
+	for _, tc := range invalid {
+		depType, err := parseDependencyType(tc.flags)
+		if err == nil {
+			t.Errorf("%+v: expected an error, got %q", tc.flags, depType)
+			continue
+		}
+		if err.Error() != tc.expected {
+			t.Errorf("%+v: expected error %q, got %q", tc.flags, tc.expected, err)
+		}
+	}
+}
+
+func TestParseOmit(t *testing.T) {
+	omit, err := parseOmit([]string{"dev,optional", "peer", "dev"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []config.DependencyType{config.DependencyDev, config.DependencyOptional, config.DependencyPeer}
+	if !reflect.DeepEqual(omit, expected) {
+		t.Errorf("expected %v, got %v", expected, omit)
+	}
+
+	omit, err = parseOmit(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(omit, []config.DependencyType{config.DependencyOptional}) {
+		t.Errorf("expected --no-optional to omit optional dependencies, got %v", omit)
+	}
+
+	if _, err := parseOmit([]string{"build"}, false); err == nil {
+		t.Errorf("expected build to be rejected")
+	}
+}
+
+func TestIsLockfileCurrent(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	// A backend whose lockfile is derived from the specfile alone,
+	// so that its lock can be checked on a copy of them.
+	lock := func() {
+		spec, err := os.ReadFile("deps.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("deps.lock", append([]byte("locked "), spec...), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := api.LanguageBackend{
+		Name:     "fake",
+		Specfile: "deps.txt",
+		Lockfile: "deps.lock",
+		Lock:     func(ctx context.Context) { lock() },
+		IsLockfileCurrent: func(ctx context.Context) bool {
+			return !util.LockfileWouldChange([]string{"deps.txt", "deps.lock"}, "deps.lock", lock)
+		},
+	}
+	writeFile := func(name string, contents string) {
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(name string) string {
+		contents, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(contents)
+	}
+
+	writeFile("deps.txt", "left-pad")
+	if isLockfileCurrent(context.Background(), b) {
+		t.Errorf("expected a missing lockfile to be out of date")
+	}
+
+	writeFile("deps.lock", "locked left-pad")
+	if !isLockfileCurrent(context.Background(), b) {
+		t.Errorf("expected the lockfile to be up to date")
+	}
+
+	writeFile("deps.txt", "left-pad right-pad")
+	if isLockfileCurrent(context.Background(), b) {
+		t.Errorf("expected the lockfile to be out of date")
+	}
+	if readFile("deps.lock") != "locked left-pad" {
+		t.Errorf("expected the lockfile to be left alone, got %q", readFile("deps.lock"))
+	}
+
+	// Without a check of its own, the lock isn't run on a copy,
+	// since it may install or need other files of the project.
+	b.IsLockfileCurrent = nil
+	stderr := expectDie(t, func() {
+		isLockfileCurrent(context.Background(), b)
+	})
+	if !strings.Contains(stderr, "upm lock --check is not supported for fake") {
+		t.Errorf("expected --check to be unsupported, got %q", stderr)
+	}
+	if readFile("deps.lock") != "locked left-pad" {
+		t.Errorf("expected the lockfile to be left alone, got %q", readFile("deps.lock"))
+	}
+}
+
+func TestInstallablePackages(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	if err := os.WriteFile("deps.lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := api.LanguageBackend{
+		Name:     "fake",
+		Specfile: "deps.txt",
+		Lockfile: "deps.lock",
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{"Left-Pad": "1.3.0", "zod": "3.22.4"}
+		},
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+		InstallPackages: func(ctx context.Context, pkgs map[api.PkgName]bool) {},
+	}
+
+	pkgs := installablePackages(b, []string{"left-pad"})
+	expected := map[api.PkgName]bool{"Left-Pad": true}
+	if !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+}
+
+func TestFindUnusedPackages(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	files := map[string]string{
+		"package.json": `{
+  "dependencies": {"express": "^4.18.0", "left-pad": "^1.3.0", "@babel/core": "^7.24.0"},
+  "devDependencies": {
+    "eslint": "^8.0.0",
+    "@types/express": "^4.17.0",
+    "@types/babel__core": "^7.20.0",
+    "@types/lodash": "^4.17.0"
+  }
+}`,
+		"index.js": "const express = require('express');\nconst babel = require('@babel/core');\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := nodejs.NodejsNPMBackend
+	b.Setup()
+	specfilePkgs := b.ListSpecfile()
+	guessed, ok := b.Guess(context.Background())
+	if !ok {
+		t.Fatal("guess failed")
+	}
+
+	unused := findUnusedPackages(b, specfilePkgs, guessed, []string{"eslint"})
+	// The type definitions of the packages that are used, scoped
+	// or not, are used too, but not those of packages that aren't.
+	expected := []api.PkgName{"@types/lodash", "left-pad"}
+	if !reflect.DeepEqual(expected, unused) {
+		t.Errorf("expected %v to be flagged as unused, got %v", expected, unused)
+	}
+}
+
+func TestGuessedPackages(t *testing.T) {
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+	}
+	guessed := map[api.PkgName]bool{
+		"requests": true,
+		"PyYAML":   true,
+		"pyyaml":   true,
+		"Flask":    true,
+		"attrs":    true,
+		"numpy":    true,
+	}
+	specfilePkgs := map[api.PkgName]api.PkgSpec{"flask": "^3.0"}
+
+	expected := []string{"PyYAML", "numpy", "requests"}
+	for i := 0; i < 20; i++ {
+		names := guessedPackages(b, guessed, specfilePkgs, []string{"ATTRS"})
+		if !reflect.DeepEqual(expected, names) {
+			t.Fatalf("expected %v, got %v", expected, names)
+		}
+	}
+
+	if names := guessedPackages(b, map[api.PkgName]bool{}, nil, nil); names == nil || len(names) != 0 {
+		t.Errorf("expected an empty list for an empty guess, got %#v", names)
+	}
+}
+
+func TestSpecfileGroups(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+
+	writeFile := func(filename string, contents string) {
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("package.json", `{
+  "name": "app",
+  "dependencies": {"express": "^4.18.0", "debug": "^4.3.0"},
+  "devDependencies": {"jest": "^29.0.0", "debug": "^4.3.0"}
+}`)
+	writeFile("pyproject.toml", `[tool.poetry]
+name = "app"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+requests = "^2.31"
+PyYAML = { version = "^6.0", optional = true }
+
+[tool.poetry.group.dev.dependencies]
+pytest = "^8.0"
+
+[tool.poetry.group.docs.dependencies]
+sphinx = "*"
+requests = "^2.31"
+
+[tool.poetry.extras]
+yaml = ["PyYAML"]
+`)
+
+	tcs := []struct {
+		language string
+		order    []string
+		expected map[string][]api.PkgName
+	}{
+		{
+			"nodejs-npm",
+			[]string{"prod", "dev"},
+			map[string][]api.PkgName{
+				"prod": {"debug", "express"},
+				"dev":  {"debug", "jest"},
+			},
+		},
+		{
+			"python3-poetry",
+			[]string{"prod", "dev", "docs", "optional", "extra:yaml"},
+			map[string][]api.PkgName{
+				"prod":       {"requests"},
+				"dev":        {"pytest"},
+				"docs":       {"requests", "sphinx"},
+				"optional":   {"PyYAML"},
+				"extra:yaml": {"PyYAML"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		b := backends.GetBackend(context.Background(), tc.language)
+		groups := specfileGroups(b.ListSpecfile(), b.ListSpecfileAttributes())
+		if !reflect.DeepEqual(tc.expected, groups) {
+			t.Errorf("%s: expected groups %v, got %v", tc.language, tc.expected, groups)
+		}
+		if order := sortedGroups(groups); !reflect.DeepEqual(tc.order, order) {
+			t.Errorf("%s: expected groups in the order %v, got %v", tc.language, tc.order, order)
+		}
+	}
+}
+
+func TestSortOnWrite(t *testing.T) {
+	setInteractive(t, false, unreadable{t})
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+
+	original := `{
+  "name": "app",
+  "dependencies": {
+    "zod": "^3.22.0",
+    "express": "^4.18.0"
+  }
+}
+`
+	readFile := func() string {
+		contents, err := os.ReadFile("package.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(contents)
+	}
+	add := func(pkg string) {
+		if err := os.WriteFile("package.json", []byte(original), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runAdd("nodejs-npm", []string{pkg}, addOptions{writeOnly: true})
+	}
+
+	t.Cleanup(func() { config.SortOnWrite = false })
+
+	config.SortOnWrite = false
+	add("left-pad ^1.3.0")
+	expected := `{
+  "name": "app",
+  "dependencies": {
+    "zod": "^3.22.0",
+    "express": "^4.18.0",
+    "left-pad": "^1.3.0"
+  }
+}
+`
+	if readFile() != expected {
+		t.Errorf("expected the existing order to be kept, got:\n%s", readFile())
+	}
+
+	config.SortOnWrite = true
+	add("left-pad ^1.3.0")
+	expected = `{
+  "name": "app",
+  "dependencies": {
+    "express": "^4.18.0",
+    "left-pad": "^1.3.0",
+    "zod": "^3.22.0"
+  }
+}
+`
+	if readFile() != expected {
+		t.Errorf("expected the dependencies to be sorted, got:\n%s", readFile())
+	}
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.toml")
+	t.Setenv("UPM_CONFIG", filename)
+	t.Cleanup(func() { config.SortOnWrite = false })
+
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Errorf("expected a missing file to be ignored, got %s", err)
+	}
+
+	if err := os.WriteFile(filename, []byte("sort_on_write = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.SortOnWrite {
+		t.Errorf("expected sort_on_write to be enabled")
+	}
+
+	if err := os.WriteFile(filename, []byte("sort_on_wirte = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadProjectConfig(); err == nil {
+		t.Errorf("expected an unknown option to be rejected")
+	}
+}
+
+func TestJSONSchemaPkgInfo(t *testing.T) {
+	schema := jsonSchema(reflect.TypeOf(api.PkgInfo{}))
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected properties, got %v", schema)
+	}
+
+	pkgInfo := reflect.TypeOf(api.PkgInfo{})
+	if len(properties) != pkgInfo.NumField() {
+		t.Errorf("expected %d properties, got %d", pkgInfo.NumField(), len(properties))
+	}
+	for i := 0; i < pkgInfo.NumField(); i++ {
+		field := pkgInfo.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("expected a property for %s (%q)", field.Name, name)
+			continue
+		}
+		expectedType := "string"
+		switch field.Type.Kind() {
+		case reflect.Slice:
+			expectedType = "array"
+		case reflect.Int64:
+			expectedType = "integer"
+		}
+		if property["type"] != expectedType {
+			t.Errorf("expected %s to be of type %s, got %v", name, expectedType, property["type"])
+		}
+		if property["title"] != field.Tag.Get("pretty") {
+			t.Errorf("expected %s to be titled %q, got %v", name, field.Tag.Get("pretty"), property["title"])
+		}
+	}
+	if _, ok := schema["required"]; ok {
+		t.Errorf("expected no PkgInfo field to be required, got %v", schema["required"])
+	}
+
+	// Fields without omitempty are required.
+	listSchema := jsonSchema(reflect.TypeOf([]listSpecfileJSONEntry{}))
+	items := listSchema["items"].(map[string]interface{})
+	if !reflect.DeepEqual([]string{"name", "spec"}, items["required"]) {
+		t.Errorf("expected name and spec to be required, got %v", items["required"])
+	}
+	attributes := items["properties"].(map[string]interface{})["attributes"]
+	expected := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}
+	if !reflect.DeepEqual(expected, attributes) {
+		t.Errorf("expected attributes to be %v, got %v", expected, attributes)
+	}
+
+	// The fields of an embedded struct are its own.
+	infoSchema := jsonSchema(reflect.TypeOf(infoJSON{}))
+	infoProperties := infoSchema["properties"].(map[string]interface{})
+	if len(infoProperties) != pkgInfo.NumField()+1 || infoProperties["name"] == nil || infoProperties["warnings"] == nil {
+		t.Errorf("expected the properties of PkgInfo and warnings, got %v", infoProperties)
+	}
+	if !reflect.DeepEqual([]string{"warnings"}, infoSchema["required"]) {
+		t.Errorf("expected warnings to be required, got %v", infoSchema["required"])
+	}
+
+	for _, name := range schemaNames() {
+		jsonSchema(reflect.TypeOf(schemaOutputs[name].value))
+	}
+
+	// The outputs that are arrays stay arrays, without the warnings.
+	stdout, _ := captureOutput(t, func() { runSchema("list") })
+	var listOutputSchema struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &listOutputSchema); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+	if listOutputSchema.Type != "array" {
+		t.Errorf("expected the list output to be an array, got %s", stdout)
+	}
+}
+
+// captureOutput returns what f writes to stdout and stderr.
+func captureOutput(t *testing.T, f func()) (string, string) {
+	t.Helper()
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origStdout, origStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	f()
+	os.Stdout, os.Stderr = origStdout, origStderr
+
+	stdoutB, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderrB, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(stdoutB), string(stderrB)
+}
+
+// expectDie runs f, which is expected to terminate the process with
+// util.Die, in a copy of the test binary that reruns the current test
+// up to the call to expectDie, and returns what it writes to stderr.
+// The copy runs f in the current directory of the test.
+func expectDie(t *testing.T, f func()) string {
+	t.Helper()
+	if os.Getenv("UPM_TEST_EXPECT_DIE") == t.Name() {
+		if err := os.Chdir(os.Getenv("UPM_TEST_EXPECT_DIE_DIR")); err != nil {
+			t.Fatal(err)
+		}
+		f()
+		os.Exit(0)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), "UPM_TEST_EXPECT_DIE="+t.Name(), "UPM_TEST_EXPECT_DIE_DIR="+dir)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected the process to exit with an error, got:\n%s", stderr.String())
+	}
+	return stderr.String()
+}
+
+func TestInfoDeprecatedWarning(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	testutil.ServeAll(t, `{
+  "name": "request",
+  "description": "Simplified HTTP request client.",
+  "versions": {
+    "2.88.0": {"name": "request", "version": "2.88.0"},
+    "2.88.2": {"name": "request", "version": "2.88.2", "deprecated": "request has been deprecated, see https://github.com/request/request/issues/3142"}
+  }
+}`)
+
+	stdout, stderr := captureOutput(t, func() {
+		runInfo("nodejs-npm", "request", false, outputFormatJSON)
+	})
+	message := "request is deprecated: request has been deprecated, see https://github.com/request/request/issues/3142"
+	if !strings.Contains(stderr, "warning: "+message+"\n") {
+		t.Errorf("expected the deprecation to be warned about on stderr, got %q", stderr)
+	}
+	var output struct {
+		Version  string         `json:"version"`
+		Warnings []util.Warning `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+	if output.Version != "2.88.2" {
+		t.Errorf("expected the package info alongside the warnings, got %s", stdout)
+	}
+	expected := []util.Warning{{Code: "deprecated", Message: message, Package: "request"}}
+	if !reflect.DeepEqual(expected, output.Warnings) {
+		t.Errorf("expected warnings %v, got %v", expected, output.Warnings)
+	}
+
+	// Without warnings, the array is still there.
+	testutil.ServeAll(t, `{"name": "left-pad", "versions": {"1.3.0": {"version": "1.3.0"}}}`)
+	stdout, _ = captureOutput(t, func() {
+		runInfo("nodejs-npm", "left-pad", false, outputFormatJSON)
+	})
+	if !strings.Contains(stdout, `"warnings":[]`) {
+		t.Errorf("expected an empty warnings array, got %s", stdout)
+	}
+}
+
+func TestAddDirectReference(t *testing.T) {
+	setInteractive(t, false, unreadable{t})
+	testutil.Chdir(t, t.TempDir())
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends.SetupAll()
+
+	// A tarball as made by npm pack.
+	if err := os.Mkdir("vendor", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tarball, err := os.Create("vendor/local-pkg-0.1.0.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(tarball)
+	archive := tar.NewWriter(gz)
+	manifest := []byte(`{"name": "@acme/local-pkg", "version": "0.1.0"}`)
+	if err := archive.WriteHeader(&tar.Header{Name: "package/package.json", Mode: 0o644, Size: int64(len(manifest))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.Write(manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, closer := range []io.Closer{archive, gz, tarball} {
+		if err := closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile("package.json", []byte(`{"name": "app"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runAdd("nodejs-npm", []string{
+		"https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+		"./vendor/local-pkg-0.1.0.tgz",
+		"is-odd https://example.com/downloads/latest.tgz",
+	}, addOptions{writeOnly: true})
+	b := nodejs.NodejsNPMBackend
+	expected := map[api.PkgName]api.PkgSpec{
+		"left-pad":        "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+		"@acme/local-pkg": "file:vendor/local-pkg-0.1.0.tgz",
+		"is-odd":          "https://example.com/downloads/latest.tgz",
+	}
+	if pkgs := b.ListSpecfile(); !reflect.DeepEqual(expected, pkgs) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+
+	if err := os.WriteFile("vendor/my_lib-1.0.tar.gz", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runAdd("python3-pip", []string{
+		"https://files.example.com/packages/requests-2.31.0-py3-none-any.whl",
+		"./vendor/my_lib-1.0.tar.gz",
+	}, addOptions{writeOnly: true})
+	contents, err := os.ReadFile("requirements.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedContents := "my_lib @ file://" + filepath.ToSlash(filepath.Join(dir, "vendor", "my_lib-1.0.tar.gz")) + "\n" +
+		"requests @ https://files.example.com/packages/requests-2.31.0-py3-none-any.whl\n"
+	if string(contents) != expectedContents {
+		t.Errorf("expected requirements.txt to contain:\n%s\ngot:\n%s", expectedContents, contents)
+	}
+
+	// The direct references are recognized when reading it back.
+	b = backends.GetBackend(context.Background(), "python3-pip")
+	pkgs := b.ListSpecfile()
+	if spec := pkgs["requests"]; spec != "@ https://files.example.com/packages/requests-2.31.0-py3-none-any.whl" {
+		t.Errorf("expected requests to be listed with its URL, got %v", pkgs)
+	}
+}
+
+func TestDoctorWarnings(t *testing.T) {
+	now := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	backend := func(constraint string) api.LanguageBackend {
+		return api.LanguageBackend{
+			Name: "fake",
+			RuntimeConstraint: func() (string, string) {
+				return "python", constraint
+			},
+		}
+	}
+
+	warnings := doctorWarnings(context.Background(), backend("^3.7"), now)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "python 3.7, which reached end of life on 2023-06-27") {
+		t.Errorf("expected an end-of-life warning for python 3.7, got %v", warnings)
+	}
+
+	if warnings := doctorWarnings(context.Background(), backend("^3.12"), now); len(warnings) != 0 {
+		t.Errorf("expected no warnings for python 3.12, got %v", warnings)
+	}
+
+	if warnings := doctorWarnings(context.Background(), api.LanguageBackend{Name: "fake"}, now); len(warnings) != 0 {
+		t.Errorf("expected no warnings without a runtime constraint, got %v", warnings)
+	}
+
+	testutil.Chdir(t, t.TempDir())
+	broken := api.LanguageBackend{
+		Name:     "fake",
+		Lockfile: "fake.lock",
+		InstallHealth: func(ctx context.Context) (bool, []string) {
+			return false, []string{"left-pad is not installed"}
+		},
+	}
+	if warnings := doctorWarnings(context.Background(), broken, now); len(warnings) != 0 {
+		t.Errorf("expected no warnings without a lockfile, got %v", warnings)
+	}
+	if err := os.WriteFile("fake.lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	warnings = doctorWarnings(context.Background(), broken, now)
+	if len(warnings) != 2 || warnings[0].Message != "broken install: left-pad is not installed" || !strings.Contains(warnings[1].Message, "upm install --force") {
+		t.Errorf("expected a broken install to be reported with a fix, got %v", warnings)
+	}
+}
+
+func TestAddDowngrade(t *testing.T) {
+	setInteractive(t, false, unreadable{t})
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+
+	writeFile := func(filename string, contents string) {
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("package.json", `{"name": "app", "dependencies": {"left-pad": "^1.3.0"}}`)
+	writeFile("package-lock.json", `{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "dependencies": {"left-pad": "^1.3.0"}},
+    "node_modules/left-pad": {"version": "1.3.0"}
+  }
+}`)
+	writeFile("pyproject.toml", `[tool.poetry]
+name = "app"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+requests = "^2.31"
+`)
+	writeFile("poetry.lock", `[[package]]
+name = "requests"
+version = "2.31.0"
+
+[metadata]
+lock-version = "2.0"
+`)
+
+	tcs := []struct {
+		language string
+		pkg      string
+		spec     api.PkgSpec
+		expected map[api.PkgName]string
+	}{
+		{"nodejs-npm", "left-pad", "1.0.0", map[api.PkgName]string{"left-pad": "left-pad from 1.3.0 to 1.0.0"}},
+		{"nodejs-npm", "left-pad", "^1.3.0", map[api.PkgName]string{}},
+		{"python3-poetry", "Requests", "2.28.0", map[api.PkgName]string{"requests": "Requests from 2.31.0 to 2.28.0"}},
+		{"python3-poetry", "requests", ">=2.0", map[api.PkgName]string{}},
+	}
+	for _, tc := range tcs {
+		b := backends.GetBackend(context.Background(), tc.language)
+		normPkgs := map[api.PkgName]pkgNameAndSpec{
+			b.NormalizePackageName(api.PkgName(tc.pkg)): {name: api.PkgName(tc.pkg), spec: tc.spec},
+		}
+		if downgrades := findDowngrades(b, normPkgs); !reflect.DeepEqual(tc.expected, downgrades) {
+			t.Errorf("%s: adding %s %s: expected downgrades %v, got %v", tc.language, tc.pkg, tc.spec, tc.expected, downgrades)
+		}
+	}
+
+	// Without --allow-downgrade, upm add refuses, leaving the
+	// specfile alone.
+	before, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := expectDie(t, func() {
+		runAdd("nodejs-npm", []string{"left-pad 1.0.0"}, addOptions{writeOnly: true})
+	})
+	if !strings.Contains(stderr, "refusing to downgrade left-pad from 1.3.0 to 1.0.0") {
+		t.Errorf("expected upm add to refuse the downgrade, got:\n%s", stderr)
+	}
+	if after, err := os.ReadFile("package.json"); err != nil || string(after) != string(before) {
+		t.Errorf("expected package.json to be unchanged, got %s (%v)", after, err)
+	}
+
+	// With --allow-downgrade, the lower spec replaces the one in
+	// the specfile, instead of the package being skipped as
+	// already added.
+	runAdd("nodejs-npm", []string{"left-pad 1.0.0"}, addOptions{writeOnly: true, allowDowngrade: true})
+	if spec := nodejs.NodejsNPMBackend.ListSpecfile()["left-pad"]; spec != "1.0.0" {
+		t.Errorf("expected left-pad to be downgraded to 1.0.0, got %q", spec)
+	}
+
+	runAdd("python3-poetry", []string{"requests 2.28.0"}, addOptions{writeOnly: true, allowDowngrade: true})
+	b := backends.GetBackend(context.Background(), "python3-poetry")
+	if spec := b.ListSpecfile()["requests"]; spec != "2.28.0" {
+		t.Errorf("expected requests to be downgraded to 2.28.0, got %q", spec)
+	}
+}
+
+func TestExecCmd(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	// A stand-in for an executable installed by a package, which
+	// records its arguments.
+	if err := os.MkdirAll(filepath.Join("node_modules", ".bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho \"$@\" > args\n"
+	if err := os.WriteFile(filepath.Join("node_modules", ".bin", "tool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := api.LanguageBackend{
+		Name:    "fake",
+		BinPath: func(ctx context.Context) string { return filepath.Join("node_modules", ".bin") },
+		FetchCmd: func(bin string, args []string) []string {
+			return append([]string{"npx", "--yes", bin}, args...)
+		},
+	}
+
+	cmd := execCmd(context.Background(), b, "tool", []string{"--version", "x"}, false)
+	expected := []string{"./node_modules/.bin/tool", "--version", "x"}
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("expected %v, got %v", expected, cmd)
+	}
+	if code := util.RunCmdInteractive(cmd); code != 0 {
+		t.Errorf("tool exited with %d", code)
+	}
+	recorded, err := os.ReadFile("args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recorded) != "--version x\n" {
+		t.Errorf("tool was run with %q", recorded)
+	}
+
+	// An installed executable is preferred even with --fetch, and
+	// only a missing one is fetched.
+	if cmd := execCmd(context.Background(), b, "tool", nil, true); !reflect.DeepEqual(cmd, []string{"./node_modules/.bin/tool"}) {
+		t.Errorf("expected the installed tool, got %v", cmd)
+	}
+	cmd = execCmd(context.Background(), b, "cowsay", []string{"hi"}, true)
+	if !reflect.DeepEqual(cmd, []string{"npx", "--yes", "cowsay", "hi"}) {
+		t.Errorf("expected cowsay to be fetched, got %v", cmd)
+	}
+}
+
+// unreadable is an io.Reader that fails the test if it is read.
+type unreadable struct {
+	t *testing.T
+}
+
+func (u unreadable) Read(p []byte) (int, error) {
+	u.t.Errorf("unexpected prompt")
+	return 0, io.EOF
+}
+
+// setInteractive makes upm behave as if stdin were a terminal (or
+// not) from which the given answers are read.
+func setInteractive(t *testing.T, interactive bool, input io.Reader) {
+	origIsTerminal, origInput := stdinIsTerminal, confirmInput
+	stdinIsTerminal = func() bool { return interactive }
+	confirmInput = input
+	t.Cleanup(func() { stdinIsTerminal, confirmInput = origIsTerminal, origInput })
+}
+
+func TestConfirmAdd(t *testing.T) {
+	ctx := context.Background()
+	b := nodejs.NodejsNPMBackend
+	normPkgs := map[api.PkgName]pkgNameAndSpec{
+		"left-pad": {name: "left-pad", spec: "^1.3.0"},
+		"lodahs":   {name: "lodahs"},
+	}
+	flagged := map[api.PkgName]bool{"lodahs": true}
+
+	// Without a terminal, nothing is asked.
+	setInteractive(t, false, unreadable{t})
+	if !confirmAdd(ctx, b, normPkgs, nil, nil, addOptions{}) {
+		t.Errorf("expected a non-interactive add to go ahead")
+	}
+	if !confirmAdd(ctx, b, normPkgs, nil, flagged, addOptions{force: true}) {
+		t.Errorf("expected a non-interactive add with --force to go ahead")
+	}
+
+	// Nor with --yes, unless a package was flagged.
+	setInteractive(t, true, unreadable{t})
+	if !confirmAdd(ctx, b, normPkgs, nil, nil, addOptions{yes: true}) {
+		t.Errorf("expected an add with --yes to go ahead")
+	}
+
+	setInteractive(t, true, strings.NewReader("y\n"))
+	if !confirmAdd(ctx, b, normPkgs, nil, flagged, addOptions{yes: true}) {
+		t.Errorf("expected an add of a flagged package to go ahead once confirmed")
+	}
+
+	setInteractive(t, true, strings.NewReader("n\n"))
+	if confirmAdd(ctx, b, normPkgs, nil, nil, addOptions{writeOnly: true}) {
+		t.Errorf("expected declining to abort the add")
+	}
+
+	// Declining upm add itself aborts it after previewing the
+	// change to the specfile, which is left untouched, as is the
+	// rest of the project.
+	testutil.Chdir(t, t.TempDir())
+	t.Setenv("PATH", t.TempDir())
+	testutil.Offline(t)
+	backends.SetupAll()
+	specfile := "{\n  \"name\": \"app\",\n  \"dependencies\": {\n    \"react\": \"^18.3.1\"\n  }\n}\n"
+	if err := os.WriteFile("package.json", []byte(specfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setInteractive(t, true, strings.NewReader("n\n"))
+	stderr := expectDie(t, func() {
+		runAdd("nodejs-npm", []string{"left-pad ^1.3.0"}, addOptions{})
+	})
+	for _, expected := range []string{
+		"--- package.json\n+++ package.json\n",
+		"+    \"left-pad\": \"^1.3.0\",\n",
+		"Proceed? [y/N] ",
+		"aborted",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("expected %q in the output, got:\n%s", expected, stderr)
+		}
+	}
+	contents, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != specfile {
+		t.Errorf("expected package.json to be left alone, got:\n%s", contents)
+	}
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected nothing but package.json in the project, got %v", entries)
+	}
+
+	// The preview is worked out where the project is, so that the
+	// member of a Cargo workspace still inherits from its root.
+	root := t.TempDir()
+	rootSpecfile := "[workspace]\nmembers = [\"app\"]\n\n[workspace.dependencies]\nserde = \"1.0\"\n"
+	memberSpecfile := "[package]\nname = \"app\"\n\n[dependencies]\nserde = { workspace = true }\n"
+	if err := os.WriteFile(filepath.Join(root, "Cargo.toml"), []byte(rootSpecfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	member := filepath.Join(root, "app")
+	if err := os.Mkdir(member, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(member, "Cargo.toml"), []byte(memberSpecfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, member)
+	diff := specfileDiff(ctx, backends.GetBackend(ctx, "rust"), map[api.PkgName]api.PkgSpec{"serde": "1.0.200", "rand": "0.8"}, "")
+	if !strings.Contains(diff, "+rand = \"0.8\"\n") {
+		t.Errorf("expected rand to be added to Cargo.toml, got:\n%s", diff)
+	}
+	if cwd, err := os.Getwd(); err != nil || cwd != member {
+		t.Errorf("expected to still be in %s, got %s (%v)", member, cwd, err)
+	}
+	for path, expected := range map[string]string{
+		filepath.Join(root, "Cargo.toml"):   rootSpecfile,
+		filepath.Join(member, "Cargo.toml"): memberSpecfile,
+	} {
+		if contents, err := os.ReadFile(path); err != nil || string(contents) != expected {
+			t.Errorf("expected %s to be left alone, got:\n%s", path, contents)
+		}
+	}
+}
+
+func TestProjectRoot(t *testing.T) {
+	setInteractive(t, false, unreadable{t})
+	root := t.TempDir()
+	elsewhere := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(`{"name": "app"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "package-lock.json"), []byte(`{"name": "app", "lockfileVersion": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Chdir(t, elsewhere)
+	t.Setenv("UPM_PROJECT_ROOT", root)
+	t.Setenv("UPM_PROJECT", "")
+	backends.SetupAll()
+
+	util.ChdirToUPM("")
+	if b := backends.GetBackend(context.Background(), "nodejs"); b.Name != "nodejs-npm" {
+		t.Errorf("expected the project at UPM_PROJECT_ROOT to be detected as nodejs-npm, got %s", b.Name)
+	}
+	runAdd("nodejs", []string{"left-pad ^1.3.0"}, addOptions{writeOnly: true})
+
+	contents, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), `"left-pad": "^1.3.0"`) {
+		t.Errorf("expected left-pad to be added to the package.json at UPM_PROJECT_ROOT, got %s", contents)
+	}
+	if util.Exists(filepath.Join(elsewhere, "package.json")) {
+		t.Errorf("expected nothing to be written to the directory upm was started in")
+	}
+}
+
+func TestInstallNDJSON(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	// An external backend whose install only works on the files.
+	previous := config.External
+	t.Cleanup(func() { config.External = previous })
+	config.External = &config.ExternalBackend{
+		Name:         "fake",
+		Specfile:     "deps.txt",
+		Lockfile:     "deps.lock",
+		Add:          "true",
+		Remove:       "true",
+		Install:      "mkdir -p libs",
+		Lock:         "true",
+		List:         "cat {specfile}",
+		ListLockfile: "cat {lockfile}",
+	}
+	for name, contents := range map[string]string{
+		"deps.txt":  "left-pad\nlodash ^4\n",
+		"deps.lock": "left-pad 1.3.0\nlodash 4.17.21\n",
+	} {
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, _ := captureOutput(t, func() {
+		runStreaming("ndjson", func() {
+			runInstall("", true, nil)
+		})
+	})
+
+	events := []util.Event{}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		var event util.Event
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("expected a JSON event per line, got %q: %s", line, err)
+		}
+		events = append(events, event)
+	}
+	expected := []util.Event{
+		{Event: util.EventPhaseStart, Phase: "install"},
+		{Event: util.EventProgress, Phase: "install", Message: "sh -c 'mkdir -p libs'"},
+		{Event: util.EventProgress, Phase: "install", Message: "sh -c 'cat deps.lock'"},
+		{Event: util.EventPackage, Phase: "install", Package: "left-pad", Version: "1.3.0"},
+		{Event: util.EventPackage, Phase: "install", Package: "lodash", Version: "4.17.21"},
+		{Event: util.EventPhaseEnd, Phase: "install"},
+		{Event: util.EventResult, Status: "ok"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events\n%+v\ngot\n%+v", expected, events)
+	}
+	if !util.Exists("libs") {
+		t.Error("expected the packages to be installed")
+	}
+
+	// Without --format ndjson, stdout is left alone.
+	stdout, _ = captureOutput(t, func() {
+		runStreaming("text", func() {
+			runInstall("", true, nil)
+		})
+	})
+	if stdout != "" {
+		t.Errorf("expected nothing on stdout, got %q", stdout)
+	}
+
+	// The warnings of the command are included in its result.
+	previousOmit := config.Omit
+	t.Cleanup(func() { config.Omit = previousOmit })
+	config.Omit = []config.DependencyType{config.DependencyDev}
+	setInteractive(t, false, unreadable{t})
+	stdout, stderr := captureOutput(t, func() {
+		runStreaming("ndjson", func() {
+			runAdd("", []string{"is-even"}, addOptions{})
+		})
+	})
+	message := "--omit is not supported for fake; all dependencies will be installed"
+	if !strings.Contains(stderr, "warning: "+message+"\n") {
+		t.Errorf("expected the unsupported --omit to be warned about on stderr, got %q", stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	var result util.Event
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &result); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+	expectedWarnings := []util.Warning{{Code: util.WarningUnsupportedOption, Message: message}}
+	if result.Event != util.EventResult || !reflect.DeepEqual(expectedWarnings, result.Warnings) {
+		t.Errorf("expected the result to have warnings %v, got %s", expectedWarnings, lines[len(lines)-1])
+	}
+}
+
+func TestLockfileDrift(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+
+	writeFile := func(filename string, contents string) {
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("package.json", `{"name": "drift", "dependencies": {"left-pad": "^1.3.0"}}`)
+	writeFile("package-lock.json", `{
+  "name": "drift",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "drift", "dependencies": {"left-pad": "^1.3.0"}},
+    "node_modules/left-pad": {"version": "1.3.0"}
+  }
+}`)
+	b := backends.GetBackend(context.Background(), "nodejs-npm")
+	store.UpdateFileHashes(context.Background(), b)
+
+	// The JSON output of upm list is still an array of the packages,
+	// so the warnings are only collected.
+	list := func() ([]util.Warning, string) {
+		_, warnings := util.WithWarnings(context.Background())
+		stdout, stderr := captureOutput(t, func() {
+			runList("nodejs-npm", false, false, false, "", outputFormatJSON)
+		})
+		var entries []listSpecfileJSONEntry
+		if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+			t.Fatalf("expected a JSON array of packages, got %q: %s", stdout, err)
+		}
+		return warnings.List(), stderr
+	}
+
+	if warnings, _ := list(); len(warnings) != 0 {
+		t.Errorf("expected no warnings while the lockfile is current, got %v", warnings)
+	}
+
+	// Editing the specfile without locking makes the lockfile drift.
+	writeFile("package.json", `{"name": "drift", "dependencies": {"left-pad": "^1.3.0", "is-even": "^1.0.0"}}`)
+	message := "package-lock.json is out of date with package.json; run upm lock to update it"
+	warnings, stderr := list()
+	if !strings.Contains(stderr, "warning: "+message+"\n") {
+		t.Errorf("expected the drift to be warned about on stderr, got %q", stderr)
+	}
+	expected := []util.Warning{{Code: util.WarningLockfileDrift, Message: message}}
+	if !reflect.DeepEqual(expected, warnings) {
+		t.Errorf("expected warnings %v, got %v", expected, warnings)
+	}
+
+	// upm doctor reports it too, along with whatever else it finds.
+	stdout, _ := captureOutput(t, func() {
+		runDoctor("nodejs-npm", outputFormatJSON)
+	})
+	var doctor doctorJSON
+	if err := json.Unmarshal([]byte(stdout), &doctor); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+	found := false
+	for _, warning := range doctor.Warnings {
+		found = found || warning == expected[0]
+	}
+	if !found {
+		t.Errorf("expected upm doctor to report the drift, got %v", doctor.Warnings)
+	}
+}
+
+func TestLicensesConflicts(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+
+	// An MIT project that pulls in a GPL-3.0 package through an
+	// Apache-2.0 one.
+	lockfile := `{
+  "name": "my-app",
+  "version": "1.0.0",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "my-app", "version": "1.0.0", "license": "MIT", "dependencies": {"http-client": "^2.0.0"}},
+    "node_modules/http-client": {"version": "2.0.0", "license": "Apache-2.0", "dependencies": {"readline-gpl": "^3.0.0"}},
+    "node_modules/readline-gpl": {"version": "3.1.0", "license": "GPL-3.0"}
+  }
+}
+`
+	for name, contents := range map[string]string{
+		"package.json":      `{"name": "my-app", "version": "1.0.0", "license": "MIT", "dependencies": {"http-client": "^2.0.0"}}`,
+		"package-lock.json": lockfile,
+	} {
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr := captureOutput(t, func() {
+		runLicenses("nodejs-npm", true, outputFormatJSON)
+	})
+	var conflicts []api.LicenseConflict
+	if err := json.Unmarshal([]byte(stdout), &conflicts); err != nil {
+		t.Fatalf("expected a JSON array of conflicts, got %q: %s", stdout, err)
+	}
+	expected := []api.LicenseConflict{
+		{
+			Package:           "http-client",
+			License:           "Apache-2.0",
+			Dependency:        "readline-gpl",
+			DependencyLicense: "GPL-3.0",
+			Through:           []string{},
+			Reason:            "a work that includes GPL-3.0-only code must be distributed under GPL-3.0-only, not Apache-2.0",
+		},
+		{
+			Package:           "my-app",
+			License:           "MIT",
+			Dependency:        "readline-gpl",
+			DependencyLicense: "GPL-3.0",
+			Through:           []string{"http-client"},
+			Reason:            "a work that includes GPL-3.0-only code must be distributed under GPL-3.0-only, not MIT",
+		},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("expected conflicts\n%+v\ngot\n%+v", expected, conflicts)
+	}
+	if !strings.Contains(stderr, "advisory") {
+		t.Errorf("expected the conflicts to be said to be advisory, got %q", stderr)
+	}
+
+	stdout, _ = captureOutput(t, func() {
+		runLicenses("nodejs-npm", false, outputFormatJSON)
+	})
+	var licenses []api.PackageLicense
+	if err := json.Unmarshal([]byte(stdout), &licenses); err != nil {
+		t.Fatalf("expected a JSON array of licenses, got %q: %s", stdout, err)
+	}
+	expectedLicenses := []api.PackageLicense{
+		{Name: "http-client", Version: "2.0.0", License: "Apache-2.0"},
+		{Name: "readline-gpl", Version: "3.1.0", License: "GPL-3.0"},
+	}
+	if !reflect.DeepEqual(licenses, expectedLicenses) {
+		t.Errorf("expected licenses %+v, got %+v", expectedLicenses, licenses)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+
+	writeFile := func(filename string, contents string) {
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(".upm/config.toml", `[[policy.deny]]
+name = "event-stream"
+version = "3.3.6"
+reason = "compromised release"
+
+[[policy.deny]]
+name = "left-pad"
+
+[[policy.deny]]
+name = "urllib3"
+version = "<1.26.18"
+reason = "CVE-2023-45803"
+`)
+	t.Setenv("UPM_CONFIG", ".upm/config.toml")
+	t.Cleanup(func() { config.PackagePolicy = config.Policy{} })
+	if err := config.LoadProjectConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A denied direct package is refused by upm add. Version
+	// constraints only apply to pinned specs.
+	npm := backends.GetBackend(context.Background(), "nodejs-npm")
+	tcs := []struct {
+		pkg      string
+		spec     api.PkgSpec
+		expected []string
+	}{
+		{"event-stream", "3.3.6", []string{"event-stream 3.3.6: compromised release"}},
+		{"event-stream", "^4.0.0", []string{}},
+		{"left-pad", "", []string{"left-pad: denied by the policy (left-pad)"}},
+		{"lodash", "4.17.21", []string{}},
+	}
+	for _, tc := range tcs {
+		normPkgs := map[api.PkgName]pkgNameAndSpec{
+			npm.NormalizePackageName(api.PkgName(tc.pkg)): {name: api.PkgName(tc.pkg), spec: tc.spec},
+		}
+		if violations := findPolicyViolations(npm, normPkgs); !reflect.DeepEqual(tc.expected, violations) {
+			t.Errorf("adding %s %s: expected violations %v, got %v", tc.pkg, tc.spec, tc.expected, violations)
+		}
+	}
+
+	// A denied transitive package is reported by upm policy-check
+	// along with the direct dependency that pulls it in.
+	writeFile("pyproject.toml", `[tool.poetry]
+name = "app"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+requests = "^2.31"
+`)
+	writeFile("poetry.lock", `[[package]]
+name = "requests"
+version = "2.31.0"
+
+[package.dependencies]
+urllib3 = ">=1.21.1,<3"
+
+[[package]]
+name = "urllib3"
+version = "1.26.5"
+
+[metadata]
+lock-version = "2.0"
+`)
+	poetry := backends.GetBackend(context.Background(), "python3-poetry")
+	expected := []api.PolicyViolation{
+		{Name: "urllib3", Version: "1.26.5", Reason: "CVE-2023-45803", PulledInBy: []string{"requests"}},
+	}
+	if violations := lockfilePolicyViolations(poetry); !reflect.DeepEqual(expected, violations) {
+		t.Errorf("expected violations\n%+v\ngot\n%+v", expected, violations)
+	}
+}
+
+// npmManifest returns the registry manifest of a package version with
+// the given unpacked size.
+func npmManifest(size int64) string {
+	return fmt.Sprintf(`{"dist": {"unpackedSize": %d}}`, size)
+}
+
+func TestListSize(t *testing.T) {
+	testutil.Chdir(t, t.TempDir())
+	backends.SetupAll()
+	for name, contents := range map[string]string{
+		"package.json": `{"name": "app", "dependencies": {"left-pad": "^1.3.0", "react": "^18.3.1", "private-pkg": "^1.0.0"}}`,
+		"package-lock.json": `{
+  "name": "app",
+  "lockfileVersion": 2,
+  "dependencies": {
+    "left-pad": {"version": "1.3.0"},
+    "react": {"version": "18.3.1", "requires": {"loose-envify": "^1.1.0"}},
+    "loose-envify": {"version": "1.4.0"},
+    "private-pkg": {"version": "1.0.0"}
+  }
+}`,
+	} {
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testutil.Serve(t, map[string]string{
+		"https://registry.npmjs.org/left-pad":           `{"name": "left-pad", "versions": {"1.3.0": {"version": "1.3.0"}}}`,
+		"https://registry.npmjs.org/left-pad/1.3.0":     npmManifest(9953),
+		"https://registry.npmjs.org/left-pad/latest":    npmManifest(9953),
+		"https://registry.npmjs.org/react/18.3.1":       npmManifest(318090),
+		"https://registry.npmjs.org/loose-envify/1.4.0": npmManifest(5814),
+	})
+
+	// The sizes are those of the locked versions, largest first,
+	// with those that are unknown last.
+	stdout, _ := captureOutput(t, func() {
+		runList("nodejs-npm", true, false, true, "size", outputFormatJSON)
+	})
+	var entries []listLockfileJSONEntry
+	if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+	expected := []listLockfileJSONEntry{
+		{Name: "react", Version: "18.3.1", Size: 318090},
+		{Name: "left-pad", Version: "1.3.0", Size: 9953},
+		{Name: "loose-envify", Version: "1.4.0", Size: 5814},
+		{Name: "private-pkg", Version: "1.0.0"},
+	}
+	if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("expected entries\n%+v\ngot\n%+v", expected, entries)
+	}
+
+	// The table of the specfile ends with the total of its
+	// packages.
+	stdout, _ = captureOutput(t, func() {
+		runList("nodejs-npm", false, false, true, "size", outputFormatTable)
+	})
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 7 || !strings.HasPrefix(lines[2], "react") || !strings.HasSuffix(lines[2], "318.1 kB") {
+		t.Fatalf("expected react first, then left-pad and private-pkg, got:\n%s", stdout)
+	}
+	if total := lines[len(lines)-1]; total != "total: 328.0 kB (1 of unknown size)" {
+		t.Errorf("expected the total of react and left-pad, got %q", total)
+	}
+
+	// upm info reports the size of the latest version.
+	stdout, _ = captureOutput(t, func() {
+		runInfo("nodejs-npm", "left-pad", true, outputFormatJSON)
+	})
+	if !strings.Contains(stdout, `"size":9953`) {
+		t.Errorf("expected the size of left-pad, got %s", stdout)
+	}
+	stdout, _ = captureOutput(t, func() {
+		runInfo("nodejs-npm", "left-pad", true, outputFormatTable)
+	})
+	if !strings.Contains(stdout, "Size:      10.0 kB\n") {
+		t.Errorf("expected the size of left-pad, got:\n%s", stdout)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "app", "dependencies": {"left-pad": "^1.3.0"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// --cwd changes into dir, which this undoes after the test.
+	testutil.Chdir(t, dir)
+	args := os.Args
+	t.Cleanup(func() {
+		os.Args = args
+		config.Verbose = false
+	})
+
+	// Running the command itself, rather than runList, catches flags
+	// that clash with the root command's, which make cobra panic.
+	for _, flags := range [][]string{{}, {"--verbose"}, {"--groups"}} {
+		os.Args = append([]string{"upm", "--cwd", dir, "--lang", "nodejs-npm", "list", "--format", "json"}, flags...)
+		stdout, _ := captureOutput(t, DoCLI)
+		if !strings.Contains(stdout, "left-pad") {
+			t.Errorf("upm list %s: expected left-pad, got %s", strings.Join(flags, " "), stdout)
+		}
+	}
+}
@@ -1,21 +1,29 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/replit/upm/internal/api"
 	"github.com/replit/upm/internal/backends"
 	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/pkg"
 	"github.com/replit/upm/internal/store"
 	"github.com/replit/upm/internal/table"
 	"github.com/replit/upm/internal/trace"
 	"github.com/replit/upm/internal/util"
+	"golang.org/x/term"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -48,13 +56,22 @@ func runWhichLanguage(language string) {
 }
 
 // runListLanguages implements 'upm list-languages'.
-func runListLanguages() {
-	for _, info := range backends.GetBackendNames() {
-		if info.Available {
-			fmt.Println(info.Name)
-		} else {
-			fmt.Println(info.Name + "  (unavailable)")
+func runListLanguages(outputFormat outputFormat) {
+	switch outputFormat {
+	case outputFormatTable:
+		for _, info := range backends.GetBackendNames() {
+			if info.Available {
+				fmt.Println(info.Name)
+			} else {
+				fmt.Println(info.Name + "  (unavailable)")
+			}
 		}
+
+	case outputFormatJSON:
+		printJSON(backends.GetBackendNames())
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
 	}
 }
 
@@ -71,7 +88,8 @@ func makeLoweredHM(normalizePackageName func(api.PkgName) api.PkgName, names []s
 // runSearch implements 'upm search'.
 func runSearch(language string, args []string, outputFormat outputFormat, ignoredPackages []string) {
 	query := strings.Join(args, " ")
-	b := backends.GetBackend(context.Background(), language)
+	ctx := context.Background()
+	b := backends.GetBackend(ctx, language)
 
 	var results []api.PkgInfo
 	if strings.TrimSpace(query) == "" {
@@ -114,11 +132,7 @@ func runSearch(language string, args []string, outputFormat outputFormat, ignore
 		t.Print()
 
 	case outputFormatJSON:
-		outputB, err := json.Marshal(results)
-		if err != nil {
-			panic(err)
-		}
-		fmt.Println(string(outputB))
+		printJSON(results)
 	}
 }
 
@@ -128,13 +142,48 @@ type infoLine struct {
 	Value string
 }
 
-// runInfo implements 'upm info'.
-func runInfo(language string, pkg string, outputFormat outputFormat) {
-	b := backends.GetBackend(context.Background(), language)
+// infoJSON represents the JSON object emitted by 'upm info': the
+// fields of the package info, along with the warnings about it.
+type infoJSON struct {
+	api.PkgInfo
+	Warnings []util.Warning `json:"warnings"`
+}
+
+// printJSON prints value as the JSON output of a command. The
+// outputs that are arrays, or maps of names, keep that shape, so the
+// warnings reported while running the command only go to stderr.
+func printJSON(value interface{}) {
+	outputB, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(outputB))
+}
+
+// runInfo implements 'upm info'. With size, it also reports the size
+// of the latest version of the package.
+func runInfo(language string, pkg string, size bool, outputFormat outputFormat) {
+	ctx, warnings := util.WithWarnings(context.Background())
+	b := backends.GetBackend(ctx, language)
+	if size && b.PackageSize == nil {
+		util.Die("--size is not supported for %s", b.Name)
+	}
 	info := b.Info(api.PkgName(pkg))
 	if info.Name == "" {
 		util.Die("no such package: %s", pkg)
 	}
+	if size {
+		if bytes, ok := b.PackageSize(ctx, api.PkgName(info.Name), ""); ok {
+			info.Size = bytes
+		}
+	}
+	if info.Deprecated != "" {
+		util.Warn(ctx, util.Warning{
+			Code:    util.WarningDeprecated,
+			Message: fmt.Sprintf("%s is deprecated: %s", info.Name, info.Deprecated),
+			Package: info.Name,
+		})
+	}
 
 	switch outputFormat {
 	case outputFormatTable:
@@ -155,6 +204,10 @@ func runInfo(language string, pkg string, outputFormat outputFormat) {
 					parts = append(parts, str)
 				}
 				value = strings.Join(parts, ", ")
+			case reflect.Int64:
+				if bytes := infoV.Field(i).Int(); bytes > 0 {
+					value = formatSize(bytes)
+				}
 			}
 			if value == "" {
 				continue
@@ -184,7 +237,7 @@ func runInfo(language string, pkg string, outputFormat outputFormat) {
 		}
 
 	case outputFormatJSON:
-		outputB, err := json.Marshal(info)
+		outputB, err := json.Marshal(infoJSON{info, warnings.List()})
 		if err != nil {
 			panic(err)
 		}
@@ -217,13 +270,61 @@ func maybeLock(ctx context.Context, b api.LanguageBackend, forceLock bool) bool
 	}
 
 	if forceLock || !util.Exists(b.Lockfile) || store.HasSpecfileChanged(b) {
+		endPhase := util.StartPhase("lock")
 		b.Lock(ctx)
+		endPhase()
 		return true
 	}
 
 	return false
 }
 
+// isLockfileCurrent reports whether the lockfile is up to date with
+// the specfile, for upm lock --check, without modifying either. It
+// terminates the process if there is nothing to check, or if the
+// backend can't check it.
+func isLockfileCurrent(ctx context.Context, b api.LanguageBackend) bool {
+	span, ctx := tracer.StartSpanFromContext(ctx, "isLockfileCurrent")
+	defer span.Finish()
+	if b.QuirksIsNotReproducible() {
+		util.Die("%s does not use a lockfile", b.Name)
+	}
+
+	if !util.Exists(b.Specfile) {
+		util.Die("%s does not exist", b.Specfile)
+	}
+
+	if !util.Exists(b.Lockfile) {
+		return false
+	}
+
+	if b.IsLockfileCurrent == nil {
+		util.Die("upm lock --check is not supported for %s", b.Name)
+	}
+
+	return b.IsLockfileCurrent(ctx)
+}
+
+// checkFrozenLockfile implements 'upm install --frozen', terminating
+// the process if there is no lockfile to install from or if the
+// backend can tell that it is out of date with the specfile. The
+// backend's install enforces the rest, with its package manager's
+// own frozen mode.
+func checkFrozenLockfile(ctx context.Context, b api.LanguageBackend) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "checkFrozenLockfile")
+	defer span.Finish()
+	if b.QuirksIsNotReproducible() {
+		util.Die("--frozen: %s does not use a lockfile", b.Name)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.Die("%s does not exist; run upm lock to create it", b.Lockfile)
+	}
+	if b.IsLockfileCurrent != nil && util.Exists(b.Specfile) && !b.IsLockfileCurrent(ctx) {
+		util.Die("%s is out of date with %s; run upm lock to update it", b.Lockfile, b.Specfile)
+	}
+}
+
 // maybeInstall either runs install or not, depending on the backend,
 // store, and command-line options.
 func maybeInstall(ctx context.Context, b api.LanguageBackend, forceInstall bool) {
@@ -233,17 +334,55 @@ func maybeInstall(ctx context.Context, b api.LanguageBackend, forceInstall bool)
 		if !util.Exists(b.Lockfile) {
 			return
 		}
-		if forceInstall || store.HasLockfileChanged(b) {
-			b.Install(ctx)
+		if forceInstall || store.HasLockfileChanged(b) || b.IsInstallNeeded() {
+			installPhase(b, nil, func() { b.Install(ctx) })
 		}
 	} else {
 		if !util.Exists(b.Specfile) {
 			return
 		}
-		if forceInstall || store.HasSpecfileChanged(b) {
-			b.Install(ctx)
+		if forceInstall || store.HasSpecfileChanged(b) || b.IsInstallNeeded() {
+			installPhase(b, nil, func() { b.Install(ctx) })
+		}
+	}
+}
+
+// installPhase runs install as the install phase of the command. When
+// events are streamed, a package event is emitted, once it is done,
+// for each package of the lockfile (or, if the backend isn't
+// reproducible, the specfile) that is in only, or for all of them if
+// only is nil.
+func installPhase(b api.LanguageBackend, only map[api.PkgName]bool, install func()) {
+	endPhase := util.StartPhase("install")
+	defer endPhase()
+	install()
+	if !util.IsStreamingEvents() {
+		return
+	}
+
+	s := silenceSubroutines()
+	versions := map[api.PkgName]string{}
+	if b.QuirksIsReproducible() {
+		for name, version := range b.ListLockfile() {
+			versions[name] = string(version)
+		}
+	} else {
+		for name := range b.ListSpecfile() {
+			versions[name] = ""
+		}
+	}
+	s.restore()
+
+	names := []string{}
+	for name := range versions {
+		if only == nil || only[name] {
+			names = append(names, string(name))
 		}
 	}
+	sort.Strings(names)
+	for _, name := range names {
+		util.Emit(util.Event{Event: util.EventPackage, Package: name, Version: versions[api.PkgName(name)]})
+	}
 }
 
 // pkgNameAndSpec is a tuple of a PkgName and a PkgSpec. It's used to
@@ -273,19 +412,412 @@ func normalizePackageArgs(b api.LanguageBackend, args []string) map[api.PkgName]
 	return normPkgs
 }
 
+// archiveSuffixes are the file extensions of the package archives
+// that upm add accepts in place of a package name.
+var archiveSuffixes = []string{".tgz", ".tar.gz", ".tar.bz2", ".zip", ".whl"}
+
+// isDirectReference returns true if arg, a package name or spec given
+// to upm add, is a URL or the path of a local package archive rather
+// than something to look up in the registry.
+func isDirectReference(arg string) bool {
+	if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+		return true
+	}
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(arg, suffix) && (strings.Contains(arg, "/") || util.Exists(arg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDirectReferences separates the arguments of upm add that
+// refer to a package by URL or path, either alone or as "NAME URL",
+// from the others. The former are resolved through the backend's
+// DirectReference and returned keyed by normalized name, and the
+// rest are returned as they were.
+func splitDirectReferences(b api.LanguageBackend, args []string) ([]string, map[api.PkgName]pkgNameAndSpec) {
+	rest := []string{}
+	direct := map[api.PkgName]pkgNameAndSpec{}
+	for _, arg := range args {
+		var name api.PkgName
+		ref := arg
+		if fields := strings.SplitN(arg, " ", 2); len(fields) == 2 {
+			name = api.PkgName(fields[0])
+			ref = strings.TrimSpace(fields[1])
+		}
+		if !isDirectReference(ref) {
+			rest = append(rest, arg)
+			continue
+		}
+		if b.DirectReference == nil {
+			util.Die("%s does not support adding packages by URL or path", b.Name)
+		}
+
+		name, spec, err := b.DirectReference(name, ref)
+		if err != nil {
+			util.Die("%s", err)
+		}
+		direct[b.NormalizePackageName(name)] = pkgNameAndSpec{
+			name: name,
+			spec: spec,
+		}
+	}
+	return rest, direct
+}
+
+// checkRegistry implements 'upm add --registry-check'. Each of the
+// requested packages is looked up in the registry and compared
+// against the backend's list of popular packages. The reasons any of
+// them look like a typosquat are printed, and those packages are
+// returned, by normalized name, for confirmAdd to ask about.
+func checkRegistry(ctx context.Context, b api.LanguageBackend, normPkgs map[api.PkgName]pkgNameAndSpec) map[api.PkgName]bool {
+	popular := b.PopularPackages()
+	now := time.Now()
+
+	names := []string{}
+	for _, nameAndSpec := range normPkgs {
+		names = append(names, string(nameAndSpec.name))
+	}
+	sort.Strings(names)
+
+	flagged := map[api.PkgName]bool{}
+	for _, name := range names {
+		info := b.Info(api.PkgName(name))
+		reasons := pkg.RegistryCheck(api.PkgName(name), info, popular, b.NormalizePackageName, now)
+		if len(reasons) == 0 {
+			continue
+		}
+		flagged[b.NormalizePackageName(api.PkgName(name))] = true
+		message := name + " looks suspicious:"
+		for _, reason := range reasons {
+			message += "\n  - " + reason
+		}
+		util.Warn(ctx, util.Warning{Code: util.WarningTyposquat, Message: message, Package: name})
+	}
+	return flagged
+}
+
+// stdinIsTerminal reports whether upm is being run interactively,
+// and confirmInput is where the answers to its questions are read
+// from. Tests replace them.
+var (
+	stdinIsTerminal           = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	confirmInput    io.Reader = os.Stdin
+)
+
+// confirm asks the user the given yes/no question on stderr, and
+// returns true if they answer yes.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// confirmOrDie asks the user the given yes/no question on stderr,
+// and terminates the process unless they answer yes. When stdin is
+// not a terminal, the process is terminated with refusal instead.
+func confirmOrDie(question string, refusal string) {
+	if !stdinIsTerminal() {
+		util.Die("%s", refusal)
+	}
+	if !confirm(question) {
+		util.Die("aborted")
+	}
+}
+
+// specfileDiff returns a unified diff of the change that adding pkgs
+// makes to the specfile, or "" if the backend can't tell without
+// adding them. The change is worked out by AddToSpecfileContents on
+// the contents of the specfile, so that nothing is written.
+func specfileDiff(ctx context.Context, b api.LanguageBackend, pkgs map[api.PkgName]api.PkgSpec, projectName string) string {
+	if b.AddToSpecfileContents == nil || len(pkgs) == 0 {
+		return ""
+	}
+	before := []byte{}
+	if util.Exists(b.Specfile) {
+		contents, err := os.ReadFile(b.Specfile)
+		if err != nil {
+			return ""
+		}
+		before = contents
+	}
+	after, err := b.AddToSpecfileContents(append([]byte{}, before...), pkgs, projectName)
+	if err != nil {
+		return ""
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(string(before)),
+		B:        diffLines(string(after)),
+		FromFile: b.Specfile,
+		ToFile:   b.Specfile,
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// diffLines splits contents into lines for specfileDiff, keeping
+// their newlines.
+func diffLines(contents string) []string {
+	lines := strings.SplitAfter(contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// printAddSummary previews on stderr what 'upm add' is about to do:
+// the packages it will declare in the specfile, marking downgrades
+// and those flagged by --registry-check, the change to the specfile,
+// and which of the packages will then be installed.
+func printAddSummary(ctx context.Context, b api.LanguageBackend, normPkgs map[api.PkgName]pkgNameAndSpec,
+	downgrades map[api.PkgName]string, flagged map[api.PkgName]bool, opts addOptions) {
+	normNames := []string{}
+	for normName := range normPkgs {
+		normNames = append(normNames, string(normName))
+	}
+	sort.Strings(normNames)
+
+	kind := ""
+	if config.Dependency != config.DependencyRegular {
+		kind = fmt.Sprintf(" as %s dependencies", config.Dependency)
+	}
+	fmt.Fprintf(os.Stderr, "These packages will be added to %s%s:\n", b.Specfile, kind)
+	installed := []string{}
+	pkgs := map[api.PkgName]api.PkgSpec{}
+	for _, normName := range normNames {
+		nameAndSpec := normPkgs[api.PkgName(normName)]
+		line := "  + " + string(nameAndSpec.name)
+		if nameAndSpec.spec != "" {
+			line += " " + string(nameAndSpec.spec)
+		}
+		notes := []string{}
+		if _, ok := downgrades[api.PkgName(normName)]; ok {
+			notes = append(notes, "downgrade")
+		}
+		if flagged[api.PkgName(normName)] {
+			notes = append(notes, "flagged by --registry-check")
+		}
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintln(os.Stderr, line)
+		installed = append(installed, string(nameAndSpec.name))
+		pkgs[nameAndSpec.name] = nameAndSpec.spec
+	}
+	if diff := specfileDiff(ctx, b, pkgs, opts.name); diff != "" {
+		fmt.Fprint(os.Stderr, diff)
+	}
+	if opts.writeOnly {
+		fmt.Fprintln(os.Stderr, "Nothing will be installed (--write-only).")
+	} else {
+		fmt.Fprintf(os.Stderr, "Then %s will be installed, along with their dependencies.\n", strings.Join(installed, ", "))
+	}
+}
+
+// confirmAdd implements the confirmation of 'upm add', returning
+// true if it should go ahead with adding normPkgs. When run
+// interactively, it previews the change and asks, unless opts.yes is
+// true and no package was flagged by --registry-check (or opts.force
+// is true). Otherwise it never asks, but a flagged package terminates
+// the process unless opts.force is true.
+func confirmAdd(ctx context.Context, b api.LanguageBackend, normPkgs map[api.PkgName]pkgNameAndSpec,
+	downgrades map[api.PkgName]string, flagged map[api.PkgName]bool, opts addOptions) bool {
+	suspicious := false
+	for normName := range normPkgs {
+		suspicious = suspicious || (flagged[normName] && !opts.force)
+	}
+	if !stdinIsTerminal() {
+		if suspicious {
+			util.Die("refusing to add suspicious packages; pass --force to add them anyway")
+		}
+		return true
+	}
+	if len(normPkgs) == 0 || (opts.yes && !suspicious) {
+		return true
+	}
+	printAddSummary(ctx, b, normPkgs, downgrades, flagged, opts)
+	return confirm("Proceed?")
+}
+
+// findUnusedPackages returns the packages in the specfile that
+// aren't among the guessed imports or the ignored packages, in
+// sorted order. Packages of type definitions for a package that is
+// used, as told by the backend's TypesFor, are used too.
+func findUnusedPackages(b api.LanguageBackend, specfilePkgs map[api.PkgName]api.PkgSpec,
+	guessed map[api.PkgName]bool, ignoredPackages []string) []api.PkgName {
+	used := map[api.PkgName]bool{}
+	for name := range guessed {
+		used[b.NormalizePackageName(name)] = true
+	}
+	for _, name := range ignoredPackages {
+		used[b.NormalizePackageName(api.PkgName(name))] = true
+	}
+
+	unused := []api.PkgName{}
+	for name := range specfilePkgs {
+		if used[b.NormalizePackageName(name)] {
+			continue
+		}
+		if b.TypesFor != nil {
+			if typed, ok := b.TypesFor(name); ok && used[b.NormalizePackageName(typed)] {
+				continue
+			}
+		}
+		unused = append(unused, name)
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i] < unused[j] })
+	return unused
+}
+
+// selectUnusedPackages implements the candidate selection of
+// 'upm remove --unused': it guesses the imports of the project,
+// prints the declared packages that none of them refer to, and
+// returns them once the user confirms (or straight away if yes is
+// true).
+func selectUnusedPackages(ctx context.Context, b api.LanguageBackend,
+	specfilePkgs map[api.PkgName]api.PkgSpec, ignoredPackages []string, yes bool) []string {
+	guessed := store.GuessWithCache(ctx, b, false)
+	unused := findUnusedPackages(b, specfilePkgs, guessed, ignoredPackages)
+	if len(unused) == 0 {
+		util.Log("no unused packages found")
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "These packages are declared, but not imported anywhere:")
+	names := []string{}
+	for _, name := range unused {
+		fmt.Fprintf(os.Stderr, "  - %s\n", name)
+		names = append(names, string(name))
+	}
+	fmt.Fprintln(os.Stderr, "Use --ignored-packages to keep any that are used without being imported.")
+
+	if !yes {
+		confirmOrDie("Remove them?", "refusing to remove packages without confirmation; pass --yes to remove them")
+	}
+	return names
+}
+
+// addOptions holds the flags of 'upm add' that runAdd reads.
+type addOptions struct {
+	// Upgrade all packages to the latest allowed versions.
+	upgrade bool
+
+	// Also add the guessed packages, other than ignoredPackages,
+	// guessing again rather than using the store if forceGuess.
+	guess           bool
+	forceGuess      bool
+	ignoredPackages []string
+
+	// Lock and install even if the store says it isn't needed.
+	forceLock    bool
+	forceInstall bool
+
+	// The name of the project, for backends that need one to
+	// create the specfile.
+	name string
+
+	// Check the packages against the registry for typosquats.
+	registryCheck bool
+
+	// Add packages flagged by registryCheck without asking, and
+	// skip the confirmation of the others, as in confirmAdd.
+	force bool
+	yes   bool
+
+	// Only edit the specfile, without locking or installing.
+	writeOnly bool
+
+	// Replace a spec even if it would downgrade a locked package.
+	allowDowngrade bool
+}
+
 // runAdd implements 'upm add'.
-func runAdd(
-	language string, args []string, upgrade bool,
-	guess bool, forceGuess bool, ignoredPackages []string,
-	forceLock bool, forceInstall bool, name string) {
+func runAdd(language string, args []string, opts addOptions) {
 	span, ctx := trace.StartSpanFromExistingContext("runAdd")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
 
+	if !b.SupportsDependencyType(config.Dependency) {
+		util.Die("%s does not support adding %s dependencies", b.Name, config.Dependency)
+	}
+	if config.Extra != "" && !b.QuirksDoesAddSupportExtras() {
+		util.Die("%s does not support --extra", b.Name)
+	}
+	if config.SaveCatalog != "" && b.UpgradeCatalog == nil {
+		util.Die("%s does not support --save-catalog", b.Name)
+	}
+
+	if config.GitHub != "" {
+		if !b.QuirksDoesAddSupportGitHub() {
+			util.Die("%s does not support --github", b.Name)
+		}
+		if len(args) != 1 {
+			util.Die("--github requires exactly one package")
+		}
+	}
+
+	if config.VCS != "" {
+		if !b.QuirksDoesAddSupportVCS() {
+			util.Die("%s does not support --vcs", b.Name)
+		}
+		if len(args) != 1 {
+			util.Die("--vcs requires exactly one package")
+		}
+		if config.GitHub != "" {
+			util.Die("--vcs and --github can't be combined")
+		}
+		if opts.writeOnly {
+			util.Die("--vcs can't be combined with --write-only")
+		}
+	}
+
+	if config.Registry != "" {
+		if !b.QuirksDoesAddSupportRegistry() {
+			util.Die("%s does not support --registry", b.Name)
+		}
+		if config.GitHub != "" || config.VCS != "" {
+			util.Die("--registry can't be combined with --github or --vcs")
+		}
+	}
+
+	if len(config.Omit) > 0 && !opts.writeOnly && !b.QuirksDoesAddSupportOmit() {
+		util.Warn(ctx, util.Warning{
+			Code:    util.WarningUnsupportedOption,
+			Message: fmt.Sprintf("--omit is not supported for %s; all dependencies will be installed", b.Name),
+		})
+	}
+
+	if opts.writeOnly {
+		if b.AddToSpecfile == nil {
+			util.Die("%s does not support --write-only", b.Name)
+		}
+		if opts.upgrade {
+			util.Die("--write-only can't be combined with --upgrade")
+		}
+	}
+
+	args, directPkgs := splitDirectReferences(b, args)
 	normPkgs := normalizePackageArgs(b, args)
 
-	if guess {
-		guessed := store.GuessWithCache(ctx, b, forceGuess)
+	flagged := map[api.PkgName]bool{}
+	if opts.registryCheck {
+		flagged = checkRegistry(ctx, b, normPkgs)
+	}
+
+	// Packages added by URL or path don't come from the registry,
+	// so they aren't checked against it.
+	for norm, pkg := range directPkgs {
+		normPkgs[norm] = pkg
+	}
+
+	if opts.guess {
+		guessed := store.GuessWithCache(ctx, b, opts.forceGuess)
 
 		// Map from normalized package names to original
 		// names.
@@ -294,7 +826,7 @@ func runAdd(
 			guessedNorm[b.NormalizePackageName(name)] = name
 		}
 
-		for _, pkg := range ignoredPackages {
+		for _, pkg := range opts.ignoredPackages {
 			delete(guessedNorm, b.NormalizePackageName(api.PkgName(pkg)))
 		}
 
@@ -308,15 +840,39 @@ func runAdd(
 		}
 	}
 
+	downgrades := findDowngrades(b, normPkgs)
+	if len(downgrades) > 0 && !opts.allowDowngrade {
+		descriptions := []string{}
+		for _, description := range downgrades {
+			descriptions = append(descriptions, description)
+		}
+		sort.Strings(descriptions)
+		util.Die("refusing to downgrade %s; pass --allow-downgrade to do it anyway", strings.Join(descriptions, ", "))
+	}
+
 	if util.Exists(b.Specfile) {
 		s := silenceSubroutines()
 		for name := range b.ListSpecfile() {
-			delete(normPkgs, b.NormalizePackageName(name))
+			normName := b.NormalizePackageName(name)
+			// A downgrade replaces the spec that is
+			// already there, rather than being skipped.
+			if _, ok := downgrades[normName]; ok {
+				continue
+			}
+			delete(normPkgs, normName)
 		}
 		s.restore()
 	}
 
-	if upgrade {
+	if violations := findPolicyViolations(b, normPkgs); len(violations) > 0 {
+		util.Die("refusing to add %s", strings.Join(violations, "; "))
+	}
+
+	if !confirmAdd(ctx, b, normPkgs, downgrades, flagged, opts) {
+		util.Die("aborted")
+	}
+
+	if opts.upgrade {
 		deleteLockfile(ctx, b)
 	}
 
@@ -326,30 +882,106 @@ func runAdd(
 			pkgs[nameAndSpec.name] = nameAndSpec.spec
 		}
 
-		b.Add(ctx, pkgs, name)
+		if opts.writeOnly {
+			b.AddToSpecfile(ctx, pkgs, opts.name)
+		} else {
+			b.Add(ctx, pkgs, opts.name)
+		}
+		maybeSortSpecfile(ctx, b)
+	}
+
+	// Leave the lockfile and the file hashes in the store alone,
+	// so that the next lock or install picks up the change.
+	if opts.writeOnly {
+		return
 	}
 
 	if len(normPkgs) == 0 || b.QuirksDoesAddRemoveNotAlsoLock() {
-		didLock := maybeLock(ctx, b, forceLock)
+		didLock := maybeLock(ctx, b, opts.forceLock)
 
 		if !(didLock && b.QuirksDoesLockAlsoInstall()) {
-			maybeInstall(ctx, b, forceInstall)
+			maybeInstall(ctx, b, opts.forceInstall)
 		}
 	} else if len(normPkgs) == 0 || b.QuirksDoesAddRemoveNotAlsoInstall() {
-		maybeInstall(ctx, b, forceInstall)
+		maybeInstall(ctx, b, opts.forceInstall)
 	}
 
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
 }
 
+// findDowngrades returns a description of each package in normPkgs
+// whose spec only allows versions lower than the one in the lockfile,
+// keyed by normalized name, for upm add to refuse without
+// --allow-downgrade.
+func findDowngrades(b api.LanguageBackend, normPkgs map[api.PkgName]pkgNameAndSpec) map[api.PkgName]string {
+	downgrades := map[api.PkgName]string{}
+	hasSpecs := false
+	for _, nameAndSpec := range normPkgs {
+		hasSpecs = hasSpecs || nameAndSpec.spec != ""
+	}
+	if !hasSpecs || b.Lockfile == "" || !util.Exists(b.Lockfile) {
+		return downgrades
+	}
+
+	s := silenceSubroutines()
+	locked := b.ListLockfile()
+	s.restore()
+	for name, version := range locked {
+		normName := b.NormalizePackageName(name)
+		nameAndSpec, ok := normPkgs[normName]
+		if !ok || !pkg.IsDowngrade(b.SpecSyntax, nameAndSpec.spec, version) {
+			continue
+		}
+		downgrades[normName] = fmt.Sprintf("%s from %s to %s", nameAndSpec.name, version, nameAndSpec.spec)
+	}
+	return downgrades
+}
+
+// findPolicyViolations returns a description of each package in
+// normPkgs that the policy of the project configuration file forbids,
+// sorted, for upm add to refuse. Version constraints of the policy
+// are checked against the version that the spec pins, if any.
+func findPolicyViolations(b api.LanguageBackend, normPkgs map[api.PkgName]pkgNameAndSpec) []string {
+	violations := []string{}
+	for _, nameAndSpec := range normPkgs {
+		v := pkg.PinnedVersion(b.SpecSyntax, nameAndSpec.spec)
+		reason := pkg.CheckPolicy(config.PackagePolicy, b.SpecSyntax, nameAndSpec.name, v, b.NormalizePackageName)
+		if reason == "" {
+			continue
+		}
+		description := string(nameAndSpec.name)
+		if v != "" {
+			description += " " + v
+		}
+		violations = append(violations, fmt.Sprintf("%s: %s", description, reason))
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// maybeSortSpecfile sorts the specfile after it has been written by
+// add or remove, if sort_on_write is enabled in the project
+// configuration and the backend knows how to.
+func maybeSortSpecfile(ctx context.Context, b api.LanguageBackend) {
+	if !config.SortOnWrite || b.SortSpecfile == nil || !util.Exists(b.Specfile) {
+		return
+	}
+	b.SortSpecfile(ctx)
+}
+
 // runRemove implements 'upm remove'.
 func runRemove(language string, args []string, upgrade bool,
-	forceLock bool, forceInstall bool) {
+	forceLock bool, forceInstall bool, unused bool, yes bool,
+	ignoredPackages []string) {
 	span, ctx := trace.StartSpanFromExistingContext("runRemove")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
 
+	if unused && len(args) > 0 {
+		util.Die("--unused can't be combined with package arguments")
+	}
+
 	if !util.Exists(b.Specfile) {
 		return
 	}
@@ -358,6 +990,10 @@ func runRemove(language string, args []string, upgrade bool,
 	specfilePkgs := b.ListSpecfile()
 	s.restore()
 
+	if unused {
+		args = selectUnusedPackages(ctx, b, specfilePkgs, ignoredPackages, yes)
+	}
+
 	// Map whose keys are normalized package names.
 	normSpecfilePkgs := map[api.PkgName]bool{}
 	for name := range specfilePkgs {
@@ -385,6 +1021,7 @@ func runRemove(language string, args []string, upgrade bool,
 			pkgs[name] = true
 		}
 		b.Remove(ctx, pkgs)
+		maybeSortSpecfile(ctx, b)
 	}
 
 	if len(normPkgs) == 0 || b.QuirksDoesAddRemoveNotAlsoLock() {
@@ -402,11 +1039,40 @@ func runRemove(language string, args []string, upgrade bool,
 }
 
 // runLock implements 'upm lock'.
-func runLock(language string, upgrade bool, forceLock bool, forceInstall bool) {
+func runLock(language string, upgrade bool, forceLock bool, forceInstall bool, check bool, catalog string) {
 	span, ctx := trace.StartSpanFromExistingContext("runLock")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
 
+	if catalog != "" {
+		if b.UpgradeCatalog == nil {
+			util.Die("catalogs are not supported for %s", b.Name)
+		}
+		// Only the catalog is upgraded, and the lockfile is
+		// updated for it, rather than relocking everything.
+		if upgradeCatalog(ctx, b, catalog, check) {
+			if check {
+				util.Die("catalog %s is out of date; run upm upgrade --catalog %s to update it", catalog, catalog)
+			}
+			forceLock = true
+		} else if check {
+			return
+		}
+		upgrade = false
+	}
+
+	if check {
+		if upgrade {
+			util.Die("--check can't be combined with --upgrade")
+		}
+		if !isLockfileCurrent(ctx, b) {
+			util.Die("%s is out of date with %s; run upm lock to update it", b.Lockfile, b.Specfile)
+		}
+		util.Log(b.Lockfile, "is up to date")
+		// Nothing was written, so the store is left alone.
+		return
+	}
+
 	if upgrade {
 		deleteLockfile(ctx, b)
 	}
@@ -421,23 +1087,101 @@ func runLock(language string, upgrade bool, forceLock bool, forceInstall bool) {
 	store.Write(ctx)
 }
 
+// upgradeCatalog bumps the entries of the named catalog that are
+// behind the latest versions, or with dryRun only reports them, and
+// returns whether there were any.
+func upgradeCatalog(ctx context.Context, b api.LanguageBackend, catalog string, dryRun bool) bool {
+	span, ctx := tracer.StartSpanFromContext(ctx, "upgradeCatalog")
+	defer span.Finish()
+	endPhase := util.StartPhase("catalog")
+	defer endPhase()
+	upgrades := b.UpgradeCatalog(ctx, catalog, dryRun)
+	if len(upgrades) == 0 {
+		util.Log(fmt.Sprintf("catalog %s is up to date", catalog))
+		return false
+	}
+	for _, upgrade := range upgrades {
+		if dryRun {
+			util.Log(fmt.Sprintf("%s %s is behind %s", upgrade.Name, upgrade.From, upgrade.To))
+		} else {
+			util.Log(fmt.Sprintf("%s %s -> %s", upgrade.Name, upgrade.From, upgrade.To))
+		}
+		util.Emit(util.Event{Event: util.EventPackage, Package: upgrade.Name, Version: upgrade.To})
+	}
+	return true
+}
+
 // runInstall implements 'upm install'.
-func runInstall(language string, force bool) {
+func runInstall(language string, force bool, args []string) {
 	span, ctx := trace.StartSpanFromExistingContext("runInstall")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
 
+	if config.Frozen {
+		checkFrozenLockfile(ctx, b)
+	}
+
+	if len(args) > 0 {
+		// A partial install leaves the rest of the project as
+		// it was, so the stored hashes aren't updated either.
+		pkgs := installablePackages(b, args)
+		installPhase(b, pkgs, func() { b.InstallPackages(ctx, pkgs) })
+		return
+	}
+
 	maybeInstall(ctx, b, force)
 
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
 }
 
+// installablePackages returns the packages named in the arguments
+// of 'upm install PACKAGE...', under the names the lockfile (or, if
+// the backend isn't reproducible, the specfile) gives them. It dies
+// if the backend can't install selectively, or if a package isn't
+// declared, since installing it would need upm add instead.
+func installablePackages(b api.LanguageBackend, args []string) map[api.PkgName]bool {
+	if b.InstallPackages == nil {
+		util.Die("installing specific packages is not supported for %s; run upm install to install everything", b.Name)
+	}
+
+	declaredIn := b.Specfile
+	declared := map[api.PkgName]api.PkgName{}
+	if b.QuirksIsReproducible() {
+		declaredIn = b.Lockfile
+		if !util.Exists(b.Lockfile) {
+			util.Die("%s does not exist; run upm lock first", b.Lockfile)
+		}
+		for name := range b.ListLockfile() {
+			declared[b.NormalizePackageName(name)] = name
+		}
+	} else {
+		if !util.Exists(b.Specfile) {
+			util.Die("%s does not exist", b.Specfile)
+		}
+		for name := range b.ListSpecfile() {
+			declared[b.NormalizePackageName(name)] = name
+		}
+	}
+
+	pkgs := map[api.PkgName]bool{}
+	for _, arg := range args {
+		name, ok := declared[b.NormalizePackageName(api.PkgName(arg))]
+		if !ok {
+			util.Die("%s is not in %s; use upm add to add it", arg, declaredIn)
+		}
+		pkgs[name] = true
+	}
+	return pkgs
+}
+
 // listSpecfileJSONEntry represents one entry in the JSON list emitted
 // by 'upm list'.
 type listSpecfileJSONEntry struct {
-	Name string `json:"name"`
-	Spec string `json:"spec"`
+	Name       string            `json:"name"`
+	Spec       string            `json:"spec"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Size       int64             `json:"size,omitempty"`
 }
 
 // listLockfileJSONEntry represents one entry in the JSON list emitted
@@ -445,19 +1189,268 @@ type listSpecfileJSONEntry struct {
 type listLockfileJSONEntry struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
+	Size    int64  `json:"size,omitempty"`
+}
+
+// specfileGroups organizes the given packages of the specfile by
+// dependency group, as given by their "group" attribute. Optional
+// packages among the main dependencies are put in the "optional"
+// group instead, and those exposed by extras also in an
+// "extra:NAME" group for each. The packages of each group are
+// sorted.
+func specfileGroups(pkgs map[api.PkgName]api.PkgSpec, attrs map[api.PkgName]map[string]string) map[string][]api.PkgName {
+	groups := map[string][]api.PkgName{}
+	for name := range pkgs {
+		pkgGroups := []string{"prod"}
+		if group := attrs[name]["group"]; group != "" {
+			pkgGroups = strings.Split(group, ", ")
+		}
+		optional := attrs[name]["optional"] == "yes" || attrs[name]["optional"] == "true"
+		for _, group := range pkgGroups {
+			if group == "prod" && optional {
+				group = "optional"
+			}
+			groups[group] = append(groups[group], name)
+		}
+		if extras := attrs[name]["extras"]; extras != "" {
+			for _, extra := range strings.Split(extras, ", ") {
+				groups["extra:"+extra] = append(groups["extra:"+extra], name)
+			}
+		}
+	}
+	for _, names := range groups {
+		sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	}
+	return groups
+}
+
+// sortedGroups returns the names of the given groups in the order
+// upm list --groups shows them: prod, dev and build first, then named
+// groups alphabetically, then optional packages and extras.
+func sortedGroups(groups map[string][]api.PkgName) []string {
+	rank := func(group string) int {
+		switch {
+		case group == "prod":
+			return 0
+		case group == "dev":
+			return 1
+		case group == "build":
+			return 2
+		case group == "optional":
+			return 4
+		case strings.HasPrefix(group, "extra:"):
+			return 5
+		default:
+			return 3
+		}
+	}
+	names := []string{}
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if rank(names[i]) != rank(names[j]) {
+			return rank(names[i]) < rank(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// runListGroups implements 'upm list --groups'.
+func runListGroups(b api.LanguageBackend, outputFormat outputFormat) {
+	var results map[api.PkgName]api.PkgSpec = nil
+	var attrs map[api.PkgName]map[string]string = nil
+	fileExists := util.Exists(b.Specfile)
+	if fileExists {
+		results = b.ListSpecfile()
+		attrs = b.ListSpecfileAttributes()
+	}
+	groups := specfileGroups(results, attrs)
+
+	switch outputFormat {
+	case outputFormatTable:
+		switch {
+		case !fileExists:
+			util.Log("no specfile")
+			return
+		case len(results) == 0:
+			util.Log("no packages in specfile")
+			return
+		}
+		t := table.New("group", "name", "spec")
+		for _, group := range sortedGroups(groups) {
+			for _, name := range groups[group] {
+				t.AddRow(group, string(name), string(results[name]))
+			}
+		}
+		t.Print()
+
+	case outputFormatJSON:
+		j := map[string][]listSpecfileJSONEntry{}
+		for group, names := range groups {
+			for _, name := range names {
+				j[group] = append(j[group], listSpecfileJSONEntry{
+					Name:       string(name),
+					Spec:       string(results[name]),
+					Attributes: attrs[name],
+				})
+			}
+		}
+		printJSON(j)
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
+
+// packageSizeWorkers is the number of sizes that packageSizes fetches
+// at once.
+const packageSizeWorkers = 8
+
+// packageSizes returns the sizes of the given packages at the given
+// versions, or the latest ones for those whose version is empty,
+// fetching them from the registry through the backend's PackageSize,
+// a few at a time. Packages whose size is unknown are left out.
+func packageSizes(ctx context.Context, b api.LanguageBackend, pkgs map[api.PkgName]api.PkgVersion) map[api.PkgName]int64 {
+	sizes := map[api.PkgName]int64{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, packageSizeWorkers)
+	for name, version := range pkgs {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(name api.PkgName, version api.PkgVersion) {
+			defer wg.Done()
+			defer func() { <-limiter }()
+			if size, ok := b.PackageSize(ctx, name, version); ok {
+				mu.Lock()
+				sizes[name] = size
+				mu.Unlock()
+			}
+		}(name, version)
+	}
+	wg.Wait()
+	return sizes
+}
+
+// formatSize returns a number of bytes in the units that npm uses,
+// e.g. "532 B", "17.4 kB" or "1.2 MB".
+func formatSize(bytes int64) string {
+	if bytes < 1000 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	size := float64(bytes) / 1000
+	for _, unit := range []string{"kB", "MB", "GB"} {
+		if size < 1000 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1000
+	}
+	panic("unreachable")
 }
 
-// runList implements 'upm list'.
-func runList(language string, all bool, outputFormat outputFormat) {
+// sortedForList returns names in the order 'upm list' shows them: by
+// name, or with sizes and bySize, largest first, with the packages
+// whose size is unknown last.
+func sortedForList(names []api.PkgName, sizes map[api.PkgName]int64, bySize bool) []api.PkgName {
+	sorted := append([]api.PkgName{}, names...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if bySize && sizes[sorted[i]] != sizes[sorted[j]] {
+			return sizes[sorted[i]] > sizes[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// printSizeTotal prints the total of the sizes of the count packages
+// listed by 'upm list --size', noting how many of them are of unknown
+// size.
+func printSizeTotal(sizes map[api.PkgName]int64, count int) {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	line := "total: " + formatSize(total)
+	if unknown := count - len(sizes); unknown > 0 {
+		line += fmt.Sprintf(" (%d of unknown size)", unknown)
+	}
+	fmt.Println()
+	fmt.Println(line)
+}
+
+// sizeCell returns the size of the named package for the table of
+// 'upm list --size', or "" if it is unknown.
+func sizeCell(sizes map[api.PkgName]int64, name api.PkgName) string {
+	if size, ok := sizes[name]; ok {
+		return formatSize(size)
+	}
+	return ""
+}
+
+// listSizes returns the sizes of the given packages of the specfile,
+// at their versions in the lockfile if there is one and otherwise
+// their latest ones, for 'upm list --size'.
+func listSizes(ctx context.Context, b api.LanguageBackend, pkgs map[api.PkgName]api.PkgSpec) map[api.PkgName]int64 {
+	locked := map[api.PkgName]api.PkgVersion{}
+	if b.QuirksIsReproducible() && util.Exists(b.Lockfile) {
+		for name, version := range b.ListLockfile() {
+			locked[b.NormalizePackageName(name)] = version
+		}
+	}
+	versions := map[api.PkgName]api.PkgVersion{}
+	for name := range pkgs {
+		versions[name] = locked[b.NormalizePackageName(name)]
+	}
+	return packageSizes(ctx, b, versions)
+}
+
+// runList implements 'upm list'. With groups, packages from the
+// specfile are organized by dependency group. With size, the size of
+// each package is shown along with the total, and with sortBy "size",
+// the largest packages come first.
+func runList(language string, all bool, groups bool, size bool, sortBy string, outputFormat outputFormat) {
 	span, ctx := trace.StartSpanFromExistingContext("runList")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
+	if warning, ok := lockfileDriftWarning(b); ok {
+		util.Warn(ctx, warning)
+	}
+	if groups {
+		runListGroups(b, outputFormat)
+		return
+	}
+	if size && b.PackageSize == nil {
+		util.Die("--size is not supported for %s", b.Name)
+	}
+	bySize := sortBy == "size"
 	if !all {
 		var results map[api.PkgName]api.PkgSpec = nil
+		var attrs map[api.PkgName]map[string]string = nil
+		var settings map[string]string = nil
+		var sizes map[api.PkgName]int64 = nil
 		fileExists := util.Exists(b.Specfile)
 		if fileExists {
 			results = b.ListSpecfile()
+			// Attributes and settings are left out of the
+			// table unless --verbose is given, to keep it
+			// compact.
+			if config.Verbose || outputFormat == outputFormatJSON {
+				attrs = b.ListSpecfileAttributes()
+			}
+			if config.Verbose && outputFormat == outputFormatTable {
+				settings = b.ListSpecfileSettings()
+			}
+			if size {
+				sizes = listSizes(ctx, b, results)
+			}
 		}
+		names := []api.PkgName{}
+		for name := range results {
+			names = append(names, name)
+		}
+		names = sortedForList(names, sizes, bySize)
 		switch outputFormat {
 		case outputFormatTable:
 			switch {
@@ -468,36 +1461,77 @@ func runList(language string, all bool, outputFormat outputFormat) {
 				util.Log("no packages in specfile")
 				return
 			}
-			t := table.New("name", "spec")
-			for name, spec := range results {
-				t.AddRow(string(name), string(spec))
+			attrNames := []string{}
+			seen := map[string]bool{}
+			for _, pkgAttrs := range attrs {
+				for attr := range pkgAttrs {
+					if !seen[attr] {
+						seen[attr] = true
+						attrNames = append(attrNames, attr)
+					}
+				}
+			}
+			sort.Strings(attrNames)
+			headers := append([]string{"name", "spec"}, attrNames...)
+			if size {
+				headers = append(headers, "size")
+			}
+			t := table.New(headers...)
+			for _, name := range names {
+				row := []string{string(name), string(results[name])}
+				for _, attr := range attrNames {
+					row = append(row, attrs[name][attr])
+				}
+				if size {
+					row = append(row, sizeCell(sizes, name))
+				}
+				t.AddRow(row...)
 			}
-			t.SortBy("name")
 			t.Print()
+			if size {
+				printSizeTotal(sizes, len(results))
+			}
+
+			if len(settings) > 0 {
+				fmt.Println()
+				t := table.New("setting", "value")
+				for name, value := range settings {
+					t.AddRow(name, value)
+				}
+				t.SortBy("setting")
+				t.Print()
+			}
 
 		case outputFormatJSON:
 			j := []listSpecfileJSONEntry{}
-			for name, spec := range results {
+			for _, name := range names {
 				j = append(j, listSpecfileJSONEntry{
-					Name: string(name),
-					Spec: string(spec),
+					Name:       string(name),
+					Spec:       string(results[name]),
+					Attributes: attrs[name],
+					Size:       sizes[name],
 				})
 			}
-			outputB, err := json.Marshal(j)
-			if err != nil {
-				panic("couldn't marshal json")
-			}
-			fmt.Println(string(outputB))
+			printJSON(j)
 
 		default:
 			util.Panicf("unknown output format %d", outputFormat)
 		}
 	} else {
 		var results map[api.PkgName]api.PkgVersion = nil
+		var sizes map[api.PkgName]int64 = nil
 		fileExists := util.Exists(b.Lockfile)
 		if fileExists {
 			results = b.ListLockfile()
+			if size {
+				sizes = packageSizes(ctx, b, results)
+			}
+		}
+		names := []api.PkgName{}
+		for name := range results {
+			names = append(names, name)
 		}
+		names = sortedForList(names, sizes, bySize)
 		switch outputFormat {
 		case outputFormatTable:
 			switch {
@@ -508,26 +1542,33 @@ func runList(language string, all bool, outputFormat outputFormat) {
 				util.Log("no packages in lockfile")
 				return
 			}
-			t := table.New("name", "version")
-			for name, version := range results {
-				t.AddRow(string(name), string(version))
+			headers := []string{"name", "version"}
+			if size {
+				headers = append(headers, "size")
+			}
+			t := table.New(headers...)
+			for _, name := range names {
+				row := []string{string(name), string(results[name])}
+				if size {
+					row = append(row, sizeCell(sizes, name))
+				}
+				t.AddRow(row...)
 			}
-			t.SortBy("name")
 			t.Print()
+			if size {
+				printSizeTotal(sizes, len(results))
+			}
 
 		case outputFormatJSON:
 			j := []listLockfileJSONEntry{}
-			for name, version := range results {
+			for _, name := range names {
 				j = append(j, listLockfileJSONEntry{
 					Name:    string(name),
-					Version: string(version),
+					Version: string(results[name]),
+					Size:    sizes[name],
 				})
 			}
-			outputB, err := json.Marshal(j)
-			if err != nil {
-				panic("couldn't marshal json")
-			}
-			fmt.Println(string(outputB))
+			printJSON(j)
 
 		default:
 			util.Panicf("unknown output format %d", outputFormat)
@@ -538,41 +1579,375 @@ func runList(language string, all bool, outputFormat outputFormat) {
 // runGuess implements 'upm guess'.
 func runGuess(
 	language string, all bool,
-	forceGuess bool, ignoredPackages []string) {
+	forceGuess bool, ignoredPackages []string, outputFormat outputFormat) {
 	span, ctx := trace.StartSpanFromExistingContext("runGuess")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
 	pkgs := store.GuessWithCache(ctx, b, forceGuess)
 
+	specfilePkgs := map[api.PkgName]api.PkgSpec{}
+	if !all && util.Exists(b.Specfile) {
+		specfilePkgs = b.ListSpecfile()
+	}
+	names := guessedPackages(b, pkgs, specfilePkgs, ignoredPackages)
+
+	switch outputFormat {
+	case outputFormatTable:
+		for _, name := range names {
+			fmt.Println(name)
+		}
+
+	case outputFormatJSON:
+		printJSON(names)
+	}
+
+	store.Write(ctx)
+}
+
+// guessedPackages returns the guessed packages that are neither in
+// the specfile nor ignored, deduplicated by normalized name and
+// sorted, so that the same guess always prints the same way. Where
+// several guessed names normalize to the same package, the first of
+// them in sorted order is used.
+func guessedPackages(b api.LanguageBackend, guessed map[api.PkgName]bool,
+	specfilePkgs map[api.PkgName]api.PkgSpec, ignoredPackages []string) []string {
 	// Map from normalized to original names.
 	normPkgs := map[api.PkgName]api.PkgName{}
-	for pkg := range pkgs {
-		normPkgs[b.NormalizePackageName(pkg)] = pkg
+	for pkg := range guessed {
+		norm := b.NormalizePackageName(pkg)
+		if prev, ok := normPkgs[norm]; !ok || pkg < prev {
+			normPkgs[norm] = pkg
+		}
+	}
+
+	for name := range specfilePkgs {
+		delete(normPkgs, b.NormalizePackageName(name))
+	}
+	for _, pkg := range ignoredPackages {
+		delete(normPkgs, b.NormalizePackageName(api.PkgName(pkg)))
+	}
+
+	names := []string{}
+	for _, pkg := range normPkgs {
+		names = append(names, string(pkg))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitPackageVersion splits an argument of the form
+// PACKAGE@VERSION. The last "@" is used, so that scoped names like
+// @types/node@18.0.0 work as expected.
+func splitPackageVersion(arg string) (api.PkgName, api.PkgVersion) {
+	idx := strings.LastIndex(arg, "@")
+	if idx <= 0 || idx == len(arg)-1 {
+		util.Die("expected PACKAGE@VERSION, got %q", arg)
+	}
+	return api.PkgName(arg[:idx]), api.PkgVersion(arg[idx+1:])
+}
+
+// runWhyNot implements 'upm why-not'.
+func runWhyNot(language string, arg string, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runWhyNot")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.WhyNot == nil {
+		util.Die("why-not is not supported for %s", b.Name)
+	}
+
+	name, version := splitPackageVersion(arg)
+	conflicts := b.WhyNot(ctx, name, version)
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(conflicts) == 0 {
+			util.Log(fmt.Sprintf("nothing blocks %s@%s", name, version))
+			return
+		}
+		fmt.Printf("%s@%s is blocked by:\n", name, version)
+		t := table.FromStructs(conflicts)
+		t.Print()
+
+	case outputFormatJSON:
+		printJSON(conflicts)
+	}
+}
+
+// lockfileGraph returns the dependency graph of the lockfile, with
+// every name normalized, and the normalized names of the direct
+// dependencies in the specfile, for upm why.
+func lockfileGraph(b api.LanguageBackend) (map[api.PkgName][]api.PkgName, []api.PkgName) {
+	graph := map[api.PkgName][]api.PkgName{}
+	for name, dependencies := range b.ListLockfileDependencies() {
+		normName := b.NormalizePackageName(name)
+		for _, dependency := range dependencies {
+			graph[normName] = append(graph[normName], b.NormalizePackageName(dependency))
+		}
+	}
+	direct := []api.PkgName{}
+	for name := range b.ListSpecfile() {
+		direct = append(direct, b.NormalizePackageName(name))
+	}
+	sort.Slice(direct, func(i, j int) bool { return direct[i] < direct[j] })
+	return graph, direct
+}
+
+// runWhy implements 'upm why'. With all, it reports the packages that
+// several direct dependencies pull in, most depended-upon first;
+// otherwise it reports the direct dependencies that pull in name.
+func runWhy(language string, name string, all bool, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runWhy")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.ListLockfileDependencies == nil {
+		util.Die("why is not supported for %s", b.Name)
+	}
+	if !util.Exists(b.Specfile) {
+		util.Die("%s does not exist", b.Specfile)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.Die("%s does not exist; run upm lock to create it", b.Lockfile)
 	}
 
+	s := silenceSubroutines()
+	graph, direct := lockfileGraph(b)
+	s.restore()
+
 	if !all {
-		if util.Exists(b.Specfile) {
-			for name := range b.ListSpecfile() {
-				delete(normPkgs, b.NormalizePackageName(name))
+		pulledInBy := pkg.PulledInBy(graph, direct, b.NormalizePackageName(api.PkgName(name)))
+		switch outputFormat {
+		case outputFormatTable:
+			if len(pulledInBy) == 0 {
+				util.Log(fmt.Sprintf("no direct dependency pulls in %s", name))
+				return
 			}
+			fmt.Printf("%s is pulled in by:\n", name)
+			for _, dependent := range pulledInBy {
+				fmt.Println(dependent)
+			}
+
+		case outputFormatJSON:
+			printJSON(pulledInBy)
 		}
+		return
 	}
 
-	for _, pkg := range ignoredPackages {
-		delete(normPkgs, b.NormalizePackageName(api.PkgName(pkg)))
+	shared := pkg.SharedDependencies(graph, direct)
+	switch outputFormat {
+	case outputFormatTable:
+		if len(shared) == 0 {
+			util.Log("no package is pulled in by more than one direct dependency")
+			return
+		}
+		t := table.New("name", "count", "pulled in by")
+		for _, dependency := range shared {
+			t.AddRow(dependency.Name, fmt.Sprint(dependency.Count), strings.Join(dependency.PulledInBy, ", "))
+		}
+		t.Print()
+
+	case outputFormatJSON:
+		printJSON(shared)
 	}
+}
 
-	lines := []string{}
-	for _, pkg := range normPkgs {
-		lines = append(lines, string(pkg))
+// runSBOM implements 'upm sbom'.
+func runSBOM(language string, format string) {
+	span, ctx := trace.StartSpanFromExistingContext("runSBOM")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.SBOM == nil {
+		util.Die("sbom is not supported for %s", b.Name)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.Die("%s does not exist; run upm lock to create it", b.Lockfile)
 	}
-	sort.Strings(lines)
 
-	for _, line := range lines {
-		fmt.Println(line)
+	s := silenceSubroutines()
+	sbom, err := b.SBOM(ctx, format)
+	s.restore()
+	if err != nil {
+		util.Die("%s", err)
 	}
+	os.Stdout.Write(sbom)
+}
 
-	store.Write(ctx)
+// runLicenses implements 'upm licenses'. With conflicts, it reports
+// the pairs of packages whose licenses are incompatible instead of
+// listing the license of each package.
+func runLicenses(language string, conflicts bool, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runLicenses")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.SBOM == nil {
+		util.Die("licenses is not supported for %s", b.Name)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.Die("%s does not exist; run upm lock to create it", b.Lockfile)
+	}
+
+	// The licenses and the dependency graph both come from the
+	// SBOM.
+	s := silenceSubroutines()
+	sbom, err := b.SBOM(ctx, pkg.SBOMFormatCycloneDX)
+	s.restore()
+	if err != nil {
+		util.Die("%s", err)
+	}
+	root, components, err := pkg.ParseCycloneDX(sbom)
+	if err != nil {
+		util.Die("%s", err)
+	}
+
+	var results interface{}
+	if conflicts {
+		util.Log("note: license conflicts are advisory, not legal advice; only well-known incompatibilities are checked")
+		licenseConflicts := pkg.LicenseConflicts(root, components)
+		if outputFormat == outputFormatTable && len(licenseConflicts) == 0 {
+			util.Log("no license conflicts found")
+			return
+		}
+		results = licenseConflicts
+	} else {
+		licenses := []api.PackageLicense{}
+		for _, component := range components {
+			licenses = append(licenses, api.PackageLicense{
+				Name:    component.Name,
+				Version: component.Version,
+				License: component.License,
+			})
+		}
+		sort.SliceStable(licenses, func(i, j int) bool {
+			if licenses[i].Name != licenses[j].Name {
+				return licenses[i].Name < licenses[j].Name
+			}
+			return licenses[i].Version < licenses[j].Version
+		})
+		if outputFormat == outputFormatTable && len(licenses) == 0 {
+			return
+		}
+		results = licenses
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		t := table.FromStructs(results)
+		t.Print()
+
+	case outputFormatJSON:
+		printJSON(results)
+	}
+}
+
+// lockfilePolicyViolations returns the packages in the lockfile that
+// the policy of the project configuration file forbids, with the
+// direct dependencies that pull them in if the backend knows the
+// dependency graph, sorted by name and version.
+func lockfilePolicyViolations(b api.LanguageBackend) []api.PolicyViolation {
+	s := silenceSubroutines()
+	locked := b.ListLockfile()
+	var graph map[api.PkgName][]api.PkgName
+	var direct []api.PkgName
+	if b.ListLockfileDependencies != nil && util.Exists(b.Specfile) {
+		graph, direct = lockfileGraph(b)
+	}
+	s.restore()
+
+	violations := []api.PolicyViolation{}
+	for name, v := range locked {
+		reason := pkg.CheckPolicy(config.PackagePolicy, b.SpecSyntax, name, string(v), b.NormalizePackageName)
+		if reason == "" {
+			continue
+		}
+		pulledInBy := []string{}
+		if graph != nil {
+			pulledInBy = pkg.PulledInBy(graph, direct, b.NormalizePackageName(name))
+		}
+		violations = append(violations, api.PolicyViolation{
+			Name:       string(name),
+			Version:    string(v),
+			Reason:     reason,
+			PulledInBy: pulledInBy,
+		})
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Name != violations[j].Name {
+			return violations[i].Name < violations[j].Name
+		}
+		return violations[i].Version < violations[j].Version
+	})
+	return violations
+}
+
+// runPolicyCheck implements 'upm policy-check', reporting the
+// packages in the lockfile that the policy of the project
+// configuration file forbids, whether direct or pulled in by other
+// packages, and exiting non-zero if there are any.
+func runPolicyCheck(language string, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runPolicyCheck")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if !b.QuirksIsReproducible() {
+		util.Die("policy-check is not supported for %s", b.Name)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.Die("%s does not exist; run upm lock to create it", b.Lockfile)
+	}
+
+	violations := lockfilePolicyViolations(b)
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(violations) == 0 {
+			util.Log("no policy violations found")
+			return
+		}
+		t := table.FromStructs(violations)
+		t.Print()
+
+	case outputFormatJSON:
+		printJSON(violations)
+	}
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+// execCmd returns the command that 'upm exec' runs for bin and its
+// args: the executable of that name in the backend's BinPath, or if
+// there is none and fetch is true, the backend's FetchCmd.
+func execCmd(ctx context.Context, b api.LanguageBackend, bin string, args []string, fetch bool) []string {
+	if b.BinPath == nil {
+		util.Die("exec is not supported for %s", b.Name)
+	}
+	if bin == "" || strings.ContainsRune(bin, filepath.Separator) {
+		util.Die("%q is not the name of an executable", bin)
+	}
+
+	dir := b.BinPath(ctx)
+	if path := filepath.Join(dir, bin); util.IsExecutable(path) {
+		// Keep the path relative, but make sure that it isn't
+		// looked up in PATH.
+		if !filepath.IsAbs(path) {
+			path = "." + string(filepath.Separator) + path
+		}
+		return append([]string{path}, args...)
+	}
+	if !fetch {
+		util.Die("%s is not provided by an installed package (looked in %s); install the package, or pass --fetch to download and run it", bin, dir)
+	}
+	if b.FetchCmd == nil {
+		util.Die("exec --fetch is not supported for %s", b.Name)
+	}
+	return b.FetchCmd(bin, args)
+}
+
+// runExec implements 'upm exec', returning the exit code of the
+// executable.
+func runExec(language string, bin string, args []string, fetch bool) int {
+	span, ctx := trace.StartSpanFromExistingContext("runExec")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	return util.RunCmdInteractive(execCmd(ctx, b, bin, args, fetch))
 }
 
 // runShowSpecfile implements 'upm show-specfile'.
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/util"
+)
+
+// lockfileDriftWarning returns a warning that the lockfile is out of
+// date with the specfile, if the specfile has changed since upm last
+// locked or installed the project while the lockfile hasn't. Unlike
+// upm lock --check, this doesn't run the package manager, so it is
+// cheap enough to check on every upm list.
+func lockfileDriftWarning(b api.LanguageBackend) (util.Warning, bool) {
+	if b.QuirksIsNotReproducible() || !store.HasLockfileDrifted(b) {
+		return util.Warning{}, false
+	}
+	return util.Warning{
+		Code:    util.WarningLockfileDrift,
+		Message: fmt.Sprintf("%s is out of date with %s; run upm lock to update it", b.Lockfile, b.Specfile),
+	}, true
+}
+
+// doctorWarnings returns the problems that 'upm doctor' finds with the
+// project, as of now: whether the project still targets a release of
+// the language runtime that is at or near its end of life, whether
+// the lockfile is out of date with the specfile, and whether the
+// packages installed from the lockfile are broken or incomplete.
+func doctorWarnings(ctx context.Context, b api.LanguageBackend, now time.Time) []util.Warning {
+	warnings := []util.Warning{}
+	if b.RuntimeConstraint != nil {
+		runtime, constraint := b.RuntimeConstraint()
+		if warning, ok := pkg.RuntimeEOLCheck(runtime, constraint, now); ok {
+			warnings = append(warnings, util.Warning{Code: util.WarningRuntimeEOL, Message: warning})
+		}
+	}
+	if warning, ok := lockfileDriftWarning(b); ok {
+		warnings = append(warnings, warning)
+	}
+	if b.InstallHealth != nil && b.Lockfile != "" && util.Exists(b.Lockfile) {
+		if ok, issues := b.InstallHealth(ctx); !ok {
+			for _, issue := range issues {
+				warnings = append(warnings, util.Warning{Code: util.WarningBrokenInstall, Message: "broken install: " + issue})
+			}
+			warnings = append(warnings, util.Warning{
+				Code:    util.WarningBrokenInstall,
+				Message: "the installed packages don't match the lockfile; run 'upm install --force' to reinstall them",
+			})
+		}
+	}
+	return warnings
+}
+
+// doctorJSON represents the JSON object emitted by 'upm doctor'.
+type doctorJSON struct {
+	Warnings []util.Warning `json:"warnings"`
+}
+
+// runDoctor implements 'upm doctor'.
+func runDoctor(language string, outputFormat outputFormat) {
+	ctx, warnings := util.WithWarnings(context.Background())
+	b := backends.GetBackend(ctx, language)
+	problems := doctorWarnings(ctx, b, time.Now())
+	for _, warning := range problems {
+		util.Warn(ctx, warning)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(problems) == 0 {
+			util.Log("no problems found")
+		}
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(doctorJSON{warnings.List()})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(outputB))
+	}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+)
+
+// jsonSchemaDialect is the version of JSON Schema that 'upm schema'
+// emits.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaOutput describes the JSON output of one command, for 'upm
+// schema'.
+type schemaOutput struct {
+	// What the output is, used as the title of the schema.
+	title string
+
+	// A value of the type that is marshalled to produce the
+	// output.
+	value interface{}
+}
+
+// schemaOutputs maps the arguments of 'upm schema' to the JSON output
+// they describe.
+var schemaOutputs = map[string]schemaOutput{
+	"pkginfo":           {"Output of upm info --format json", infoJSON{}},
+	"doctor":            {"Output of upm doctor --format json", doctorJSON{}},
+	"search":            {"Output of upm search --format json", []api.PkgInfo{}},
+	"list":              {"Output of upm list --format json", []listSpecfileJSONEntry{}},
+	"list-all":          {"Output of upm list --all --format json", []listLockfileJSONEntry{}},
+	"list-groups":       {"Output of upm list --groups --format json", map[string][]listSpecfileJSONEntry{}},
+	"guess":             {"Output of upm guess --format json", []string{}},
+	"why":               {"Output of upm why --format json", []string{}},
+	"why-all":           {"Output of upm why --all --format json", []api.SharedDependency{}},
+	"why-not":           {"Output of upm why-not --format json", []api.Conflict{}},
+	"languages":         {"Output of upm list-languages --format json", []backends.BackendInfo{}},
+	"licenses":          {"Output of upm licenses --format json", []api.PackageLicense{}},
+	"license-conflicts": {"Output of upm licenses --conflicts --format json", []api.LicenseConflict{}},
+	"policy-violations": {"Output of upm policy-check --format json", []api.PolicyViolation{}},
+}
+
+// schemaNames returns the valid arguments of 'upm schema', sorted.
+func schemaNames() []string {
+	names := []string{}
+	for name := range schemaOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonSchema returns a JSON Schema describing how encoding/json
+// marshals values of type t. The properties of structs are derived
+// from their json field tags, and fields without omitempty are
+// required; those of embedded structs are included as their own.
+// The pretty tags, where present, become titles.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": jsonSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": jsonSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+				embedded := jsonSchema(field.Type)
+				for name, property := range embedded["properties"].(map[string]interface{}) {
+					properties[name] = property
+				}
+				if embeddedRequired, ok := embedded["required"].([]string); ok {
+					required = append(required, embeddedRequired...)
+				}
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			omitempty := false
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				if tag == "-" {
+					continue
+				}
+				parts := strings.Split(tag, ",")
+				if parts[0] != "" {
+					name = parts[0]
+				}
+				for _, option := range parts[1:] {
+					omitempty = omitempty || option == "omitempty"
+				}
+			}
+			property := jsonSchema(field.Type)
+			if title, ok := field.Tag.Lookup("pretty"); ok {
+				property["title"] = title
+			}
+			properties[name] = property
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		util.Panicf("can't describe %s in a JSON schema", t)
+		return nil
+	}
+}
+
+// runSchema implements 'upm schema'.
+func runSchema(name string) {
+	output, ok := schemaOutputs[name]
+	if !ok {
+		util.Die("unknown schema %q (must be one of %s)", name, strings.Join(schemaNames(), ", "))
+	}
+	schema := jsonSchema(reflect.TypeOf(output.value))
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = output.title
+
+	outputB, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic("couldn't marshal json")
+	}
+	fmt.Println(string(outputB))
+}
@@ -1,7 +1,123 @@
 // Package config contains global variables that are set according to
-// the command line. They can be accessed from anywhere within a
-// language backend.
+// the command line and the project configuration file. They can be
+// accessed from anywhere within a language backend.
 package config
 
 // Quiet is true if --quiet was passed on the command line.
 var Quiet bool
+
+// Production is true if --production was passed on the command line,
+// requesting that development dependencies not be installed.
+var Production bool
+
+// Only is "prod" or "dev" if --only was passed on the command line,
+// and empty otherwise. It takes precedence over Production and over
+// any environment-based defaults, such as NODE_ENV for Node.js.
+var Only string
+
+// Frozen is true if --frozen was passed on the command line,
+// requesting that packages be installed exactly as locked, failing
+// rather than updating the lockfile if it is out of date.
+var Frozen bool
+
+// Strict is true if --strict was passed on the command line. It turns
+// warnings about unsupported file formats into fatal errors.
+var Strict bool
+
+// Offline is true if --offline was passed on the command line,
+// requesting that the network not be accessed, so that packages can
+// only come from the package manager's local cache.
+var Offline bool
+
+// PreferOffline is true if --prefer-offline was passed on the command
+// line, requesting that cached registry data and packages be used
+// whenever they are available, falling back to the network only when
+// they aren't. Unlike Offline, a cache miss is not an error.
+var PreferOffline bool
+
+// NoScripts is true if --no-scripts was passed on the command line,
+// requesting that package manager scripts (such as composer's
+// post-install-cmd) not be run during installation.
+var NoScripts bool
+
+// SaveCatalog is the name of the catalog given by --save-catalog, or
+// "" if it wasn't passed, requesting that the packages added be
+// declared in that catalog and referenced from it by the specfile.
+var SaveCatalog string
+
+// DependencyType is a kind of dependency that 'upm add' can declare
+// packages as. Its value is used in messages, e.g. "%s dependencies".
+type DependencyType string
+
+const (
+	// DependencyRegular is an ordinary runtime dependency.
+	DependencyRegular DependencyType = "regular"
+
+	// DependencyDev is a development dependency (--dev).
+	DependencyDev DependencyType = "dev"
+
+	// DependencyBuild is a dependency of the build script, as
+	// with Cargo (--build).
+	DependencyBuild DependencyType = "build"
+
+	// DependencyPeer is a peer dependency, which the consumer of
+	// the package is expected to provide (--peer).
+	DependencyPeer DependencyType = "peer"
+
+	// DependencyOptional is an optional dependency (--optional or
+	// --extra).
+	DependencyOptional DependencyType = "optional"
+
+	// DependencyOptionalPeer is a peer dependency which the
+	// consumer may leave out (--optional --peer).
+	DependencyOptionalPeer DependencyType = "optional peer"
+
+	// DependencyGroup is a dependency in the named group
+	// (--group).
+	DependencyGroup DependencyType = "group"
+)
+
+// Dependency is the kind of dependency that 'upm add' declares the
+// added packages as, according to --dev, --build, --peer,
+// --optional, --extra and --group.
+var Dependency = DependencyRegular
+
+// Extra is the name passed to 'upm add --extra', or empty. The added
+// packages are declared as optional and made part of that extra.
+var Extra string
+
+// Group is the name passed to 'upm add --group', or empty. It is set
+// whenever Dependency is DependencyGroup.
+var Group string
+
+// GitHub is the "user/repo" passed to 'upm add --github', or empty.
+// The added package is then sourced from that repository rather than
+// from the registry.
+var GitHub string
+
+// VCS is the repository URL passed to 'upm add --vcs', or empty. The
+// added package is then sourced from that version control repository,
+// which is declared in the specfile, rather than from the registry.
+var VCS string
+
+// Registry is the alternative registry passed to 'upm add
+// --registry', or empty. The added packages are then sourced from
+// that registry, as configured for the package manager (e.g. in
+// .cargo/config.toml), rather than from the default one.
+var Registry string
+
+// Omit is the kinds of dependency passed to 'upm add --omit' (or
+// --no-optional), whose packages are not to be installed by an add
+// that also installs. It may contain DependencyDev,
+// DependencyOptional and DependencyPeer.
+var Omit []DependencyType
+
+// RefuseIncompatible is true if --refuse-incompatible was passed to
+// 'upm add', turning the warning about a package that doesn't support
+// every runtime version the project allows (such as a Python package
+// whose requires_python excludes some of them) into an error.
+var RefuseIncompatible bool
+
+// Verbose is true if --verbose was passed to 'upm list', requesting
+// additional information about each package.
+var Verbose bool
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SortOnWrite is true if sort_on_write is enabled in the project
+// configuration file, requesting that the dependency sections of the
+// specfile be sorted after every add and remove.
+var SortOnWrite bool
+
+// PMPath lists the directories, relative to the project, in which a
+// package manager binary is looked for before PATH, so that a version
+// pinned by the project is used. It can be replaced by pm_path in the
+// project configuration file, and an empty list only uses PATH.
+var PMPath = []string{"node_modules/.bin", ".venv/bin", "bin"}
+
+// Env holds the environment variables given in the env table of the
+// project configuration file. They are set for the commands that upm
+// runs, taking precedence over the DefaultEnv of the backend but not
+// over variables that are already set in the environment.
+var Env = map[string]string{}
+
+// DefaultEnv holds the environment variables that the backend in use
+// sets by default for the commands that upm runs, so that its package
+// manager behaves well non-interactively. Variables that are set in
+// the environment or in Env take precedence.
+var DefaultEnv = map[string]string{}
+
+// ExternalBackend describes a backend for an ecosystem that upm has no
+// backend of its own for, whose operations are shell commands given
+// in the external table of the project configuration file. In the
+// commands, {specfile} and {lockfile} stand for the names of those
+// files, shell-quoted. A command that has {name} or {spec} in it is
+// run once for each package, with the name and spec of the package;
+// otherwise {packages} stands for the names of all the packages.
+type ExternalBackend struct {
+	// The name of the backend, as given to --lang. It is
+	// "external" if unset.
+	Name string `toml:"name"`
+
+	// The files that declare the packages of the project, and pin
+	// their versions. The lockfile is optional.
+	Specfile string `toml:"specfile"`
+	Lockfile string `toml:"lockfile"`
+
+	// The glob patterns of the source files of the ecosystem, by
+	// which the project is detected in the absence of a specfile
+	// or lockfile. They default to the name of the specfile.
+	FilenamePatterns []string `toml:"filename_patterns"`
+
+	// Where the packages are installed, relative to the project.
+	// It defaults to the project itself.
+	PackageDir string `toml:"package_dir"`
+
+	// The commands that add packages to the specfile, remove them
+	// from it, and install the packages it declares.
+	Add     string `toml:"add"`
+	Remove  string `toml:"remove"`
+	Install string `toml:"install"`
+
+	// The command that writes the lockfile, if there is one.
+	Lock string `toml:"lock"`
+
+	// The commands that print the packages of the specfile, and the
+	// lockfile if there is one, one per line: the name of the
+	// package, optionally followed by whitespace and its spec or
+	// version.
+	List         string `toml:"list"`
+	ListLockfile string `toml:"list_lockfile"`
+}
+
+// External is the external backend declared in the project
+// configuration file, or nil if it doesn't declare one.
+var External *ExternalBackend
+
+// PolicyRule matches packages for the policy table of the project
+// configuration file. The name is a glob, in which * stands for any
+// run of characters, including /, and ? for any one character.
+type PolicyRule struct {
+	// The name of the packages that the rule matches.
+	Name string `toml:"name"`
+
+	// The version constraint, in the syntax of any of the
+	// supported package managers, such as "<4.17.21" or
+	// ">=2,<3", that the version of a package must satisfy for the
+	// rule to match it. If unset, the rule matches every version.
+	// It only applies when the version is known: from the
+	// lockfile, or from the spec of a package being added if it
+	// pins one.
+	Version string `toml:"version"`
+
+	// Why packages that a deny rule matches are forbidden, for
+	// the message reporting them.
+	Reason string `toml:"reason"`
+}
+
+// Policy is the policy table of the project configuration file,
+// which restricts the packages that the project may depend on. A
+// package that a deny rule matches is forbidden, and so, if there are
+// any allow rules, is a package that none of them match.
+type Policy struct {
+	Allow []PolicyRule `toml:"allow"`
+	Deny  []PolicyRule `toml:"deny"`
+}
+
+// PackagePolicy is the policy declared in the project configuration
+// file, which upm add enforces and upm policy-check audits the
+// lockfile against. It is empty if the file doesn't declare one.
+var PackagePolicy Policy
+
+// projectConfig represents the project configuration file.
+type projectConfig struct {
+	SortOnWrite bool              `toml:"sort_on_write"`
+	PMPath      *[]string         `toml:"pm_path"`
+	Env         map[string]string `toml:"env"`
+	External    *ExternalBackend  `toml:"external"`
+	Policy      Policy            `toml:"policy"`
+}
+
+// getProjectConfigLocation returns the file path of the project
+// configuration file.
+func getProjectConfigLocation() string {
+	loc, ok := os.LookupEnv("UPM_CONFIG")
+	if ok {
+		return loc
+	} else {
+		return ".upm/config.toml"
+	}
+}
+
+// LoadProjectConfig reads the project configuration file, if there
+// is one, and sets the corresponding global variables. Unknown keys
+// are reported as an error so that typos don't go unnoticed.
+func LoadProjectConfig() error {
+	filename := getProjectConfigLocation()
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	var cfg projectConfig
+	md, err := toml.DecodeFile(filename, &cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := []string{}
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return fmt.Errorf("%s: unknown option %s", filename, strings.Join(keys, ", "))
+	}
+
+	SortOnWrite = cfg.SortOnWrite
+	if cfg.PMPath != nil {
+		PMPath = *cfg.PMPath
+	}
+	if cfg.Env != nil {
+		Env = cfg.Env
+	}
+	External = cfg.External
+	PackagePolicy = cfg.Policy
+	return nil
+}
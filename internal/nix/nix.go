@@ -10,6 +10,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
+	"strings"
 
 	"github.com/replit/upm/internal/api"
 	"github.com/replit/upm/internal/util"
@@ -32,12 +34,63 @@ type ReplitNixAdd struct {
 }
 
 var (
-	python_map_var map[string]ReplitNixAdd
-
-	python_map_var_loaded bool
-
 	//go:embed python_map.json
 	python_map_json []byte
+
+	//go:embed nodejs_map.json
+	nodejs_map_json []byte
+
+	//go:embed ruby_map.json
+	ruby_map_json []byte
+
+	//go:embed rust_map.json
+	rust_map_json []byte
+)
+
+// nixDepsMap maps the packages of one language that need system
+// libraries to build (or to run) to the Nix packages that provide
+// them. It is loaded from embedded JSON on first use, and looked up
+// by the names produced by normalize.
+type nixDepsMap struct {
+	json      []byte
+	normalize func(string) string
+
+	deps   map[string]ReplitNixAdd
+	loaded bool
+}
+
+// lookup returns the system dependencies of pack, which are empty if
+// none are known.
+func (m *nixDepsMap) lookup(pack string) ReplitNixAdd {
+	if !m.loaded {
+		var deps map[string]ReplitNixAdd
+		err := json.Unmarshal(m.json, &deps)
+		if err != nil {
+			log.Fatal("Error during Unmarshal(): ", err)
+		}
+		m.deps = map[string]ReplitNixAdd{}
+		for name, add := range deps {
+			m.deps[m.normalize(name)] = add
+		}
+		m.loaded = true
+	}
+	return m.deps[m.normalize(pack)]
+}
+
+// pythonNameSeparators matches the runs of characters that PEP 503
+// treats as equivalent in package names.
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+var (
+	python_map = &nixDepsMap{json: python_map_json, normalize: func(name string) string {
+		return pythonNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	}}
+	nodejs_map = &nixDepsMap{json: nodejs_map_json, normalize: func(name string) string { return name }}
+	ruby_map   = &nixDepsMap{json: ruby_map_json, normalize: func(name string) string { return name }}
+	// crates.io treats - and _ as the same.
+	rust_map = &nixDepsMap{json: rust_map_json, normalize: func(name string) string {
+		return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}}
 )
 
 func DefaultInstallReplitNixSystemDependencies(context.Context, []api.PkgName) {
@@ -45,24 +98,63 @@ func DefaultInstallReplitNixSystemDependencies(context.Context, []api.PkgName) {
 	// dependency mapping, there is no work to be done.
 }
 
-func python_map() map[string]ReplitNixAdd {
-	if python_map_var_loaded {
-		return python_map_var
-	}
-	err := json.Unmarshal(python_map_json, &python_map_var)
-	if err != nil {
-		log.Fatal("Error during Unmarshal(): ", err)
+func PythonNixDeps(pack string) ReplitNixAdd {
+	return python_map.lookup(pack)
+}
+
+// NodejsNixDeps returns the system dependencies of a Node.js package,
+// such as the libraries that canvas is built against.
+func NodejsNixDeps(pack string) ReplitNixAdd {
+	return nodejs_map.lookup(pack)
+}
+
+// RubyNixDeps returns the system dependencies of a gem with a native
+// extension, such as the PostgreSQL client library for pg.
+func RubyNixDeps(pack string) ReplitNixAdd {
+	return ruby_map.lookup(pack)
+}
+
+// RustNixDeps returns the system dependencies of a crate, such as
+// OpenSSL for openssl-sys.
+func RustNixDeps(pack string) ReplitNixAdd {
+	return rust_map.lookup(pack)
+}
+
+// SystemDependencyOps returns the nix-editor operations adding the
+// system dependencies, according to nixDeps, of each of pkgs. Each
+// Nix package is only added once, in the order in which it is first
+// needed.
+func SystemDependencyOps(nixDeps func(string) ReplitNixAdd, pkgs []api.PkgName) []NixEditorOp {
+	ops := []NixEditorOp{}
+	seen := map[string]bool{}
+	for _, pkg := range pkgs {
+		for _, op := range ReplitNixAddToNixEditorOps(nixDeps(string(pkg))) {
+			if seen[op.Dep] {
+				continue
+			}
+			seen[op.Dep] = true
+			ops = append(ops, op)
+		}
 	}
-	python_map_var_loaded = true
-	return python_map_var
+	return ops
 }
 
-func PythonNixDeps(pack string) ReplitNixAdd {
-	val, ok := python_map()[pack]
-	if !ok {
-		return ReplitNixAdd{}
+// MakeInstallReplitNixSystemDependencies returns an
+// InstallReplitNixSystemDependencies function for a language whose
+// system dependency mapping is nixDeps. It adds the system
+// dependencies of the packages it is given, followed by those of the
+// packages returned by listPackages, which should read the specfile
+// (and the lockfile, if it names packages that the specfile pulls in)
+// without failing if they're missing. Nothing is run if there are no
+// system dependencies to add.
+func MakeInstallReplitNixSystemDependencies(nixDeps func(string) ReplitNixAdd, listPackages func() []api.PkgName) func(context.Context, []api.PkgName) {
+	return func(ctx context.Context, pkgs []api.PkgName) {
+		ops := SystemDependencyOps(nixDeps, append(append([]api.PkgName{}, pkgs...), listPackages()...))
+		if len(ops) == 0 {
+			return
+		}
+		RunNixEditorOps(ops)
 	}
-	return val
 }
 
 func ReplitNixAddToNixEditorOps(replitNixAdd ReplitNixAdd) []NixEditorOp {
@@ -1,8 +1,11 @@
 package nix
 
 import (
+	"context"
 	"testing"
 
+	"github.com/replit/upm/internal/api"
+
 	assert "github.com/stretchr/testify/assert"
 )
 
@@ -37,3 +40,53 @@ func TestReplitNixAddToNixEditorCmds(t *testing.T) {
 
 	assert.Equal(t, expected, cmds)
 }
+
+func TestNixPythonMapNormalizesNames(t *testing.T) {
+	assert.Equal(t, []string{"pkgs.openssl", "pkgs.postgresql"}, PythonNixDeps("psycopg2").Deps)
+	assert.Equal(t, []string{"pkgs.libmysqlclient"}, PythonNixDeps("mysqlclient").Deps)
+	assert.Equal(t, PythonNixDeps("pillow"), PythonNixDeps("Pillow"))
+	assert.NotEmpty(t, PythonNixDeps("Pillow").Deps)
+	assert.Empty(t, PythonNixDeps("requests").Deps)
+}
+
+func TestNixNodejsMap(t *testing.T) {
+	assert.Equal(t, []string{"pkgs.postgresql"}, NodejsNixDeps("pg-native").Deps)
+	assert.Contains(t, NodejsNixDeps("canvas").Deps, "pkgs.cairo")
+	assert.Empty(t, NodejsNixDeps("left-pad").Deps)
+}
+
+func TestNixRubyMap(t *testing.T) {
+	assert.Equal(t, []string{"pkgs.postgresql"}, RubyNixDeps("pg").Deps)
+	assert.Equal(t, []string{"pkgs.libxml2", "pkgs.libxslt", "pkgs.pkg-config"}, RubyNixDeps("nokogiri").Deps)
+	assert.Empty(t, RubyNixDeps("rack").Deps)
+}
+
+func TestNixRustMap(t *testing.T) {
+	assert.Equal(t, []string{"pkgs.openssl", "pkgs.pkg-config"}, RustNixDeps("openssl-sys").Deps)
+	assert.Equal(t, RustNixDeps("openssl-sys"), RustNixDeps("openssl_sys"))
+	assert.Empty(t, RustNixDeps("serde").Deps)
+}
+
+func TestSystemDependencyOps(t *testing.T) {
+	ops := SystemDependencyOps(RubyNixDeps, []api.PkgName{"pg", "rack", "nokogiri", "ffi"})
+
+	expected := []NixEditorOp{
+		{Op: "add", DepType: Regular, Dep: "pkgs.postgresql"},
+		{Op: "add", DepType: Regular, Dep: "pkgs.libxml2"},
+		{Op: "add", DepType: Regular, Dep: "pkgs.libxslt"},
+		{Op: "add", DepType: Regular, Dep: "pkgs.pkg-config"},
+		{Op: "add", DepType: Regular, Dep: "pkgs.libffi"},
+	}
+
+	assert.Equal(t, expected, ops)
+}
+
+func TestMakeInstallReplitNixSystemDependenciesWithNothingToAdd(t *testing.T) {
+	// With no system dependencies to add, nix-editor isn't run, so
+	// this doesn't need REPL_HOME.
+	t.Setenv("REPL_HOME", "")
+	install := MakeInstallReplitNixSystemDependencies(RustNixDeps, func() []api.PkgName {
+		return []api.PkgName{"serde"}
+	})
+	install(context.Background(), []api.PkgName{"rand"})
+}
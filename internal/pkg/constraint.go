@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+)
+
+// satisfiesComparison reports whether v satisfies a single comparison
+// of a version constraint, as matched by specComparison, with its
+// operator as returned by specOperator. A partial version compared for
+// equality, as in npm's "1.2", or a wildcard, as in "3.8.*", stands
+// for the whole series.
+func satisfiesComparison(op string, spec string, v *version.Version) bool {
+	segments := []int{}
+	wildcard := false
+	for _, part := range strings.Split(spec, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			wildcard = true
+			break
+		}
+		segments = append(segments, n)
+	}
+	if len(segments) == 0 {
+		return true
+	}
+	base, err := version.NewVersion(strings.Join(strings.Split(spec, ".")[:len(segments)], "."))
+	if err != nil {
+		return true
+	}
+	inSeries := func(leading []int) bool {
+		return !v.LessThan(base) && v.LessThan(bumpVersion(leading))
+	}
+
+	switch op {
+	case "", "=", "==", "===":
+		if wildcard || (op == "" && len(segments) < 3) {
+			return inSeries(segments)
+		}
+		return v.Equal(base)
+	case "!=":
+		if wildcard {
+			return !inSeries(segments)
+		}
+		return !v.Equal(base)
+	case ">=":
+		return !v.LessThan(base)
+	case ">":
+		return v.GreaterThan(base)
+	case "<=":
+		return !v.GreaterThan(base)
+	case "<":
+		return v.LessThan(base)
+	case "^":
+		// The first nonzero segment can't change.
+		for i, segment := range segments {
+			if segment != 0 || i == len(segments)-1 {
+				return inSeries(segments[:i+1])
+			}
+		}
+	case "~":
+		if len(segments) >= 2 {
+			return inSeries(segments[:2])
+		}
+		return inSeries(segments[:1])
+	case "~>", "~=":
+		// All but the last segment given can't change.
+		if len(segments) >= 2 {
+			return inSeries(segments[:len(segments)-1])
+		}
+		return inSeries(segments)
+	}
+	return true
+}
+
+// SatisfiesConstraint reports whether v satisfies constraint, in the
+// given syntax, such as ">=3.8,<4", "^3.10", "!=3.0.*, >=2.7" or "~>
+// 2.7". Alternatives separated by || are each considered. A
+// constraint without any version in it, such as "*", is satisfied by
+// every version. What a bare version allows depends on the syntax:
+// npm reads "2.1" as the whole 2.1 series, Cargo as ^2.1, and Poetry
+// as 2.1.0 only.
+func SatisfiesConstraint(syntax api.SpecSyntax, constraint string, v *version.Version) bool {
+	for _, alternative := range strings.Split(constraint, "||") {
+		satisfied := true
+		for _, match := range specComparison.FindAllStringSubmatch(alternative, -1) {
+			satisfied = satisfied && satisfiesComparison(specOperator(syntax, match[1]), match[2], v)
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// pythonReleases are the Python releases that PythonIncompatibility
+// considers: 2.7 and the 3.x releases, past and future. There are no
+// plans for a Python 4, so the common "<4" bound is never a problem.
+var pythonReleases = func() []*version.Version {
+	releases := []*version.Version{version.Must(version.NewVersion("2.7"))}
+	for minor := 0; minor <= 30; minor++ {
+		releases = append(releases, version.Must(version.NewVersion(fmt.Sprintf("3.%d", minor))))
+	}
+	return releases
+}()
+
+// PythonIncompatibility compares the constraint that a project
+// places on its Python interpreter with the one that a package
+// requires (its requires_python). If the project allows a release
+// that the package doesn't support, so that a resolver that checks
+// every allowed release, such as Poetry's, would fail, it returns the
+// lowest such release, e.g. "3.8"; otherwise it returns false.
+// Releases are compared by their first patch release, e.g. 3.8.0.
+// Both constraints are read as Poetry and pip read them.
+func PythonIncompatibility(project string, required string) (string, bool) {
+	if strings.TrimSpace(project) == "" || strings.TrimSpace(required) == "" {
+		return "", false
+	}
+	for _, candidate := range pythonReleases {
+		if SatisfiesConstraint(api.SpecSyntaxExact, project, candidate) && !SatisfiesConstraint(api.SpecSyntaxExact, required, candidate) {
+			segments := candidate.Segments()
+			return fmt.Sprintf("%d.%d", segments[0], segments[1]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+)
+
+func TestSatisfiesConstraint(t *testing.T) {
+	cases := []struct {
+		syntax     api.SpecSyntax
+		constraint string
+		version    string
+		satisfied  bool
+	}{
+		{api.SpecSyntaxExact, ">=3.8", "3.8.0", true},
+		{api.SpecSyntaxExact, ">=3.8", "3.7.0", false},
+		{api.SpecSyntaxExact, ">=3.8,<4", "4.0.0", false},
+		{api.SpecSyntaxExact, ">=3.8, <3.12", "3.11.0", true},
+		{api.SpecSyntaxExact, "^3.10", "3.12.0", true},
+		{api.SpecSyntaxExact, "^3.10", "4.0.0", false},
+		{api.SpecSyntaxExact, "~3.10", "3.11.0", false},
+		{api.SpecSyntaxExact, "~=3.10", "3.14.0", true},
+		{api.SpecSyntaxExact, ">=2.7, !=3.0.*, !=3.1.*", "3.1.0", false},
+		{api.SpecSyntaxExact, ">=2.7, !=3.0.*, !=3.1.*", "3.2.0", true},
+		{api.SpecSyntaxExact, "3.10.*", "3.10.0", true},
+		{api.SpecSyntaxExact, "3.10.*", "3.11.0", false},
+		{api.SpecSyntaxExact, "==3.11", "3.11.0", true},
+		{api.SpecSyntaxExact, ">3.8", "3.8.0", false},
+		{api.SpecSyntaxExact, "<=3.9", "3.9.0", true},
+		{api.SpecSyntaxExact, "^2.7 || ^3.6", "3.9.0", true},
+		{api.SpecSyntaxExact, "^2.7 || ^3.6", "3.5.0", false},
+		{api.SpecSyntaxExact, "*", "3.12.0", true},
+		// A bare version is exact for Poetry, the whole series
+		// for npm, and a caret requirement for Cargo.
+		{api.SpecSyntaxExact, "2.1", "2.1.0", true},
+		{api.SpecSyntaxExact, "2.1", "2.1.5", false},
+		{api.SpecSyntaxNpm, "2.1", "2.1.5", true},
+		{api.SpecSyntaxNpm, "2.1", "2.2.0", false},
+		{api.SpecSyntaxCargo, "2.1", "2.9.0", true},
+		{api.SpecSyntaxCargo, "2.1", "3.0.0", false},
+		{api.SpecSyntaxComposer, "~1.2", "1.9.0", true},
+	}
+	for _, tc := range cases {
+		v := version.Must(version.NewVersion(tc.version))
+		if satisfied := SatisfiesConstraint(tc.syntax, tc.constraint, v); satisfied != tc.satisfied {
+			t.Errorf("SatisfiesConstraint(%d, %q, %s) = %t, expected %t", tc.syntax, tc.constraint, tc.version, satisfied, tc.satisfied)
+		}
+	}
+}
+
+func TestPythonIncompatibility(t *testing.T) {
+	cases := []struct {
+		project  string
+		required string
+		excluded string
+	}{
+		// The package needs a newer Python than the project
+		// allows.
+		{"^3.8", ">=3.10", "3.8"},
+		{">=3.8", ">=3.9", "3.8"},
+		// The package caps the Python version but the project
+		// doesn't.
+		{"^3.8", ">=3.8,<3.13", "3.13"},
+		{">=3.10,<3.13", ">=3.8", ""},
+		{"^3.10", ">=3.7", ""},
+		{"~3.11", ">=3.8, <3.12", ""},
+		{">=3.8", ">=3.8,<4", ""},
+		// Nothing to compare.
+		{"", ">=3.10", ""},
+		{"^3.8", "", ""},
+	}
+	for _, tc := range cases {
+		excluded, ok := PythonIncompatibility(tc.project, tc.required)
+		if excluded != tc.excluded || ok != (tc.excluded != "") {
+			t.Errorf("PythonIncompatibility(%q, %q) = %q, %t, expected %q", tc.project, tc.required, excluded, ok, tc.excluded)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+)
+
+// specComparison matches one comparison in a package spec, in the
+// syntax of any of the supported package managers (such as "1.0.0",
+// "==1.0.*", "^1.2", "~> 2.7" or "<3"). It captures the operator and
+// the version, and consumes any prerelease or build suffix so that it
+// isn't taken for another version.
+var specComparison = regexp.MustCompile(`(===|==|>=|<=|~=|~>|!=|\^|~|>|<|=)?\s*v?(\d+(?:\.(?:\d+|[xX*]))*)(?:[-+][0-9A-Za-z.-]*)?`)
+
+// bumpVersion returns the version that follows the release series
+// given by the leading segments, e.g. 1.3 for 1.2 or 2 for 1.
+func bumpVersion(segments []int) *version.Version {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = strconv.Itoa(segment)
+	}
+	parts[len(parts)-1] = strconv.Itoa(segments[len(segments)-1] + 1)
+	v, err := version.NewVersion(strings.Join(parts, "."))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// specOperator returns the operator of a comparison in the given
+// syntax as npm would write it, so that the comparison can be read
+// the same way whichever package manager it is for: "" for npm's
+// bare versions, which are exact unless partial, "==" for an exact
+// version, and otherwise op itself.
+func specOperator(syntax api.SpecSyntax, op string) string {
+	switch op {
+	case "":
+		switch syntax {
+		case api.SpecSyntaxCargo:
+			return "^"
+		case api.SpecSyntaxExact, api.SpecSyntaxComposer:
+			return "=="
+		}
+	case "=":
+		if syntax == api.SpecSyntaxExact || syntax == api.SpecSyntaxComposer {
+			return "=="
+		}
+		return ""
+	case "~":
+		if syntax == api.SpecSyntaxComposer {
+			return "~>"
+		}
+	}
+	return op
+}
+
+// excludesAbove reports whether a single comparison, with its
+// operator as returned by specOperator, excludes locked because it is
+// too high. Comparisons that only bound versions from below never do.
+func excludesAbove(op string, spec string, locked *version.Version) bool {
+	// The numeric segments before any wildcard.
+	segments := []int{}
+	wildcard := false
+	for _, part := range strings.Split(spec, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			wildcard = true
+			break
+		}
+		segments = append(segments, n)
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	v, err := version.NewVersion(strings.Join(strings.Split(spec, ".")[:len(segments)], "."))
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case "", "==", "===":
+		// A wildcard, as in "1.2.*", or a partial version
+		// without ==, as in npm's "1.2", stands for the
+		// whole series.
+		if wildcard || (op == "" && len(segments) < 3) {
+			return !locked.LessThan(bumpVersion(segments))
+		}
+		return locked.GreaterThan(v)
+	case "<":
+		return !locked.LessThan(v)
+	case "<=":
+		return locked.GreaterThan(v)
+	case "^":
+		// The first nonzero segment can't change.
+		for i, segment := range segments {
+			if segment != 0 || i == len(segments)-1 {
+				return !locked.LessThan(bumpVersion(segments[:i+1]))
+			}
+		}
+	case "~":
+		if len(segments) >= 2 {
+			return !locked.LessThan(bumpVersion(segments[:2]))
+		}
+		return !locked.LessThan(bumpVersion(segments[:1]))
+	case "~>", "~=":
+		// All but the last segment given can't change.
+		if len(segments) >= 2 {
+			return !locked.LessThan(bumpVersion(segments[:len(segments)-1]))
+		}
+		return !locked.LessThan(bumpVersion(segments))
+	}
+	return false
+}
+
+// IsDowngrade reports whether every version that spec, in the given
+// syntax, allows is lower than the locked one, so that adding the
+// package with that spec would downgrade it. Alternatives separated
+// by || are each considered, and specs that aren't version
+// constraints (such as URLs or npm dist-tags) are never downgrades.
+func IsDowngrade(syntax api.SpecSyntax, spec api.PkgSpec, locked api.PkgVersion) bool {
+	if strings.ContainsAny(string(spec), ":/@") {
+		return false
+	}
+	lockedVersion, err := version.NewVersion(string(locked))
+	if err != nil {
+		return false
+	}
+
+	found := false
+	for _, alternative := range strings.Split(string(spec), "||") {
+		matches := specComparison.FindAllStringSubmatch(alternative, -1)
+		if len(matches) == 0 {
+			return false
+		}
+		excluded := false
+		for _, match := range matches {
+			excluded = excluded || excludesAbove(specOperator(syntax, match[1]), match[2], lockedVersion)
+		}
+		if !excluded {
+			return false
+		}
+		found = true
+	}
+	return found
+}
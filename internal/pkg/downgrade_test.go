@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestIsDowngrade(t *testing.T) {
+	cases := []struct {
+		syntax    api.SpecSyntax
+		spec      api.PkgSpec
+		locked    api.PkgVersion
+		downgrade bool
+	}{
+		// npm
+		{api.SpecSyntaxNpm, "1.0.0", "2.0.0", true},
+		{api.SpecSyntaxNpm, "^1.0.0", "2.0.0", true},
+		{api.SpecSyntaxNpm, "^1.0.0", "1.4.2", false},
+		{api.SpecSyntaxNpm, "~1.2.0", "1.3.0", true},
+		{api.SpecSyntaxNpm, "~1.2.0", "1.2.9", false},
+		{api.SpecSyntaxNpm, "1.x", "2.1.0", true},
+		{api.SpecSyntaxNpm, "1", "1.9.0", false},
+		{api.SpecSyntaxNpm, "^0.2.0", "0.3.1", true},
+		{api.SpecSyntaxNpm, ">=1.0.0", "2.0.0", false},
+		{api.SpecSyntaxNpm, ">=1.0.0 <2.0.0", "2.0.0", true},
+		{api.SpecSyntaxNpm, "^1.0.0 || ^2.0.0", "2.0.0", false},
+		{api.SpecSyntaxNpm, "^1.0.0 || ^2.0.0", "3.0.0", true},
+		{api.SpecSyntaxNpm, "latest", "2.0.0", false},
+		{api.SpecSyntaxNpm, "file:../left-pad-1.0.0.tgz", "2.0.0", false},
+		{api.SpecSyntaxNpm, "1.0.0-beta.2", "1.1.0", true},
+		{api.SpecSyntaxNpm, "3.0.0", "2.0.0", false},
+		{api.SpecSyntaxNpm, "2.0.0", "2.0.0", false},
+		{api.SpecSyntaxNpm, "2.1", "2.1.5", false},
+		{api.SpecSyntaxNpm, "=2.1", "2.1.5", false},
+
+		// Poetry
+		{api.SpecSyntaxExact, "1.0", "2.0.0", true},
+		{api.SpecSyntaxExact, "^2.28", "2.31.0", false},
+		{api.SpecSyntaxExact, "^2.28", "3.0.1", true},
+		{api.SpecSyntaxExact, "~2.28", "2.31.0", true},
+		{api.SpecSyntaxExact, "<2.30", "2.31.0", true},
+		{api.SpecSyntaxExact, ">=2.0,<2.30", "2.31.0", true},
+		{api.SpecSyntaxExact, "*", "2.31.0", false},
+		{api.SpecSyntaxExact, "2.31", "2.31.0", false},
+		{api.SpecSyntaxExact, "2.1", "2.1.5", true},
+
+		// Cargo
+		{api.SpecSyntaxCargo, "1.2", "1.38.0", false},
+		{api.SpecSyntaxCargo, "1.2", "2.0.0", true},
+		{api.SpecSyntaxCargo, "0.3", "0.4.1", true},
+		{api.SpecSyntaxCargo, "=1.2", "1.2.9", false},
+		{api.SpecSyntaxCargo, "=1.2", "1.38.0", true},
+
+		// pip and Bundler
+		{api.SpecSyntaxExact, "==2.28.*", "2.31.0", true},
+		{api.SpecSyntaxExact, "~=2.28", "2.31.0", false},
+		{api.SpecSyntaxExact, "~=2.28.0", "2.31.0", true},
+		{api.SpecSyntaxExact, "~> 6.1", "7.0.4", true},
+		{api.SpecSyntaxExact, "~> 6.1", "6.1.7", false},
+		{api.SpecSyntaxExact, "@ https://example.com/requests-2.0.0.tar.gz", "2.31.0", false},
+
+		// Composer
+		{api.SpecSyntaxComposer, "1.2", "1.2.5", true},
+		{api.SpecSyntaxComposer, "~1.2", "1.9.0", false},
+		{api.SpecSyntaxComposer, "~1.2.0", "1.3.0", true},
+
+		// Versions that can't be compared.
+		{api.SpecSyntaxNpm, "1.0.0", "not-a-version", false},
+	}
+	for _, c := range cases {
+		if downgrade := IsDowngrade(c.syntax, c.spec, c.locked); downgrade != c.downgrade {
+			t.Errorf("IsDowngrade(%d, %q, %q) = %v, expected %v", c.syntax, c.spec, c.locked, downgrade, c.downgrade)
+		}
+	}
+}
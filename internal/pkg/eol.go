@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runtimeRelease identifies a release series of a language runtime.
+// The version is major.minor for Python, Ruby and PHP, and just the
+// major version for Node.js.
+type runtimeRelease struct {
+	runtime string
+	version string
+}
+
+// runtimeEndOfLife maps release series of the language runtimes to
+// the dates (YYYY-MM-DD) on which upstream support for them ends, as
+// announced by each project. Add new releases as they come out.
+var runtimeEndOfLife = map[runtimeRelease]string{
+	{"python", "2.7"}:  "2020-01-01",
+	{"python", "3.5"}:  "2020-09-30",
+	{"python", "3.6"}:  "2021-12-23",
+	{"python", "3.7"}:  "2023-06-27",
+	{"python", "3.8"}:  "2024-10-07",
+	{"python", "3.9"}:  "2025-10-31",
+	{"python", "3.10"}: "2026-10-31",
+	{"python", "3.11"}: "2027-10-31",
+	{"python", "3.12"}: "2028-10-31",
+	{"python", "3.13"}: "2029-10-31",
+	{"python", "3.14"}: "2030-10-31",
+
+	{"nodejs", "8"}:  "2019-12-31",
+	{"nodejs", "10"}: "2021-04-30",
+	{"nodejs", "12"}: "2022-04-30",
+	{"nodejs", "14"}: "2023-04-30",
+	{"nodejs", "15"}: "2021-06-01",
+	{"nodejs", "16"}: "2023-09-11",
+	{"nodejs", "17"}: "2022-06-01",
+	{"nodejs", "18"}: "2025-04-30",
+	{"nodejs", "19"}: "2023-06-01",
+	{"nodejs", "20"}: "2026-04-30",
+	{"nodejs", "21"}: "2024-06-01",
+	{"nodejs", "22"}: "2027-04-30",
+	{"nodejs", "23"}: "2025-06-01",
+	{"nodejs", "24"}: "2028-04-30",
+
+	{"ruby", "2.5"}: "2021-04-05",
+	{"ruby", "2.6"}: "2022-04-12",
+	{"ruby", "2.7"}: "2023-03-31",
+	{"ruby", "3.0"}: "2024-04-23",
+	{"ruby", "3.1"}: "2025-03-26",
+	{"ruby", "3.2"}: "2026-03-31",
+	{"ruby", "3.3"}: "2027-03-31",
+	{"ruby", "3.4"}: "2028-03-31",
+
+	{"php", "7.2"}: "2020-11-30",
+	{"php", "7.3"}: "2021-12-06",
+	{"php", "7.4"}: "2022-11-28",
+	{"php", "8.0"}: "2023-11-26",
+	{"php", "8.1"}: "2025-12-31",
+	{"php", "8.2"}: "2026-12-31",
+	{"php", "8.3"}: "2027-12-31",
+	{"php", "8.4"}: "2028-12-31",
+}
+
+// endOfLifeSoon is how far ahead RuntimeEOLCheck warns about a
+// release series whose support is about to end.
+const endOfLifeSoon = 180 * 24 * time.Hour
+
+// versionBound matches one comparison in a version constraint, in
+// the syntax of any of the supported package managers (such as
+// ">=3.8", "^14.17.0", "~> 2.7", "3.10.*" or "18.x"). It captures
+// the operator and the major and minor versions, and consumes the
+// rest of the version so that it isn't taken for another one.
+var versionBound = regexp.MustCompile(`(>=|<=|>|<|\^|~=|~>|~|===|==|=|!=)?\s*v?(\d+)(?:\.(\d+|[xX*]))?[\w.*+-]*`)
+
+// lowestRuntimeVersion returns the major and minor versions of the
+// lowest release that constraint allows. Alternatives separated by
+// || are each considered, and an upper bound (or an exclusion) never
+// raises the lowest version.
+func lowestRuntimeVersion(constraint string) (int, int, bool) {
+	found := false
+	lowestMajor, lowestMinor := 0, 0
+	for _, alternative := range strings.Split(constraint, "||") {
+		// In a hyphen range such as "14 - 16", the lower
+		// bound comes first.
+		alternative, _, _ = strings.Cut(alternative, " - ")
+		bound := false
+		major, minor := 0, 0
+		for _, match := range versionBound.FindAllStringSubmatch(alternative, -1) {
+			switch match[1] {
+			case "<", "<=", "!=":
+				continue
+			}
+			boundMajor, _ := strconv.Atoi(match[2])
+			boundMinor, _ := strconv.Atoi(match[3])
+			if !bound || boundMajor > major || (boundMajor == major && boundMinor > minor) {
+				major, minor = boundMajor, boundMinor
+			}
+			bound = true
+		}
+		if !bound {
+			continue
+		}
+		if !found || major < lowestMajor || (major == lowestMajor && minor < lowestMinor) {
+			lowestMajor, lowestMinor = major, minor
+		}
+		found = true
+	}
+	return lowestMajor, lowestMinor, found
+}
+
+// RuntimeEOLCheck compares the version constraint that a project
+// places on a language runtime ("python", "nodejs", "ruby" or "php")
+// against the end-of-life dates of its releases. If the lowest
+// release that the constraint allows is no longer supported as of
+// now, or will stop being supported soon, it returns a warning
+// saying so; otherwise it returns false.
+func RuntimeEOLCheck(runtime string, constraint string, now time.Time) (string, bool) {
+	major, minor, ok := lowestRuntimeVersion(constraint)
+	if !ok {
+		return "", false
+	}
+	version := fmt.Sprintf("%d.%d", major, minor)
+	if runtime == "nodejs" {
+		version = strconv.Itoa(major)
+	}
+	date, ok := runtimeEndOfLife[runtimeRelease{runtime, version}]
+	if !ok {
+		return "", false
+	}
+	eol, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+
+	switch {
+	case !now.Before(eol):
+		return fmt.Sprintf("%s %s allows %s %s, which reached end of life on %s", runtime, constraint, runtime, version, date), true
+	case eol.Sub(now) <= endOfLifeSoon:
+		return fmt.Sprintf("%s %s allows %s %s, which reaches end of life on %s", runtime, constraint, runtime, version, date), true
+	}
+	return "", false
+}
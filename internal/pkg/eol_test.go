@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLowestRuntimeVersion(t *testing.T) {
+	cases := []struct {
+		constraint   string
+		major, minor int
+		ok           bool
+	}{
+		{">=3.7", 3, 7, true},
+		{"^3.8", 3, 8, true},
+		{">=3.8,<4.0", 3, 8, true},
+		{"~=3.10.2", 3, 10, true},
+		{"3.9.*", 3, 9, true},
+		{">=14.17.0", 14, 17, true},
+		{"^16 || ^18 || >=20", 16, 0, true},
+		{"14.x", 14, 0, true},
+		{"14 - 18", 14, 0, true},
+		{"~> 2.7", 2, 7, true},
+		{"3.0.0-rc1", 3, 0, true},
+		{">=7.4 <8.3", 7, 4, true},
+		{"<4.0", 0, 0, false},
+		{"", 0, 0, false},
+		{"*", 0, 0, false},
+	}
+	for _, c := range cases {
+		major, minor, ok := lowestRuntimeVersion(c.constraint)
+		if major != c.major || minor != c.minor || ok != c.ok {
+			t.Errorf("lowestRuntimeVersion(%q) = %d, %d, %v, expected %d, %d, %v",
+				c.constraint, major, minor, ok, c.major, c.minor, c.ok)
+		}
+	}
+}
+
+func TestRuntimeEOLCheck(t *testing.T) {
+	now := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	eol := []struct{ runtime, constraint, warning string }{
+		{"python", ">=3.7", "python >=3.7 allows python 3.7, which reached end of life on 2023-06-27"},
+		{"nodejs", ">=14", "nodejs >=14 allows nodejs 14, which reached end of life on 2023-04-30"},
+		{"ruby", "~> 2.7", "ruby ~> 2.7 allows ruby 2.7, which reached end of life on 2023-03-31"},
+		{"php", "^7.4 || ^8.0", "php ^7.4 || ^8.0 allows php 7.4, which reached end of life on 2022-11-28"},
+		{"nodejs", "^20.11.0", "nodejs ^20.11.0 allows nodejs 20, which reaches end of life on 2026-04-30"},
+	}
+	for _, c := range eol {
+		warning, ok := RuntimeEOLCheck(c.runtime, c.constraint, now)
+		if !ok || warning != c.warning {
+			t.Errorf("RuntimeEOLCheck(%q, %q) = %q, %v, expected %q", c.runtime, c.constraint, warning, ok, c.warning)
+		}
+	}
+
+	supported := []struct{ runtime, constraint string }{
+		{"python", "^3.12"},
+		{"nodejs", ">=22"},
+		{"ruby", "3.4.1"},
+		{"php", ">=8.3"},
+		// Releases that aren't in the table are left alone,
+		// rather than guessed at.
+		{"python", ">=3.99"},
+		{"nodejs", ""},
+		{"elixir", "~> 1.10"},
+	}
+	for _, c := range supported {
+		if warning, ok := RuntimeEOLCheck(c.runtime, c.constraint, now); ok {
+			t.Errorf("RuntimeEOLCheck(%q, %q) unexpectedly warned: %s", c.runtime, c.constraint, warning)
+		}
+	}
+}
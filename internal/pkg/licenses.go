@@ -0,0 +1,368 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// ParseLicense parses an SPDX license expression, such as "MIT" or
+// "(MIT OR Apache-2.0) AND BSD-3-Clause", into the sets of licenses
+// that the package can be used under: the expression holds if all the
+// licenses of any one set are complied with. The licenses are in the
+// canonical form of canonicalLicense, with a "WITH" exception, if
+// any, kept as part of the license it applies to. Operators are
+// accepted in any case, and AND binds tighter than OR.
+//
+// See https://spdx.github.io/spdx-spec/v2.3/SPDX-license-expressions/
+func ParseLicense(expression string) ([][]string, error) {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty license expression")
+	}
+	p := licenseParser{tokens: tokens}
+	choices, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", expression, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%q: unexpected %q", expression, p.tokens[p.pos])
+	}
+	return choices, nil
+}
+
+// licenseParser is the state of ParseLicense: the tokens of the
+// expression, and the position of the next one.
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+// peek returns the next token, with operators in upper case, or ""
+// at the end of the expression.
+func (p *licenseParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	token := p.tokens[p.pos]
+	switch upper := strings.ToUpper(token); upper {
+	case "AND", "OR", "WITH":
+		return upper
+	}
+	return token
+}
+
+// or parses a sequence of AND expressions joined by OR, each of which
+// adds its choices.
+func (p *licenseParser) or() ([][]string, error) {
+	choices, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		more, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		choices = append(choices, more...)
+	}
+	return choices, nil
+}
+
+// and parses a sequence of licenses or parenthesized expressions
+// joined by AND, each choice of which combines one choice of each.
+func (p *licenseParser) and() ([][]string, error) {
+	choices, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" {
+		p.pos++
+		more, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		combined := [][]string{}
+		for _, choice := range choices {
+			for _, other := range more {
+				combined = append(combined, append(append([]string{}, choice...), other...))
+			}
+		}
+		choices = combined
+	}
+	return choices, nil
+}
+
+// term parses a parenthesized expression, or a license optionally
+// followed by WITH and an exception.
+func (p *licenseParser) term() ([][]string, error) {
+	switch token := p.peek(); token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(":
+		p.pos++
+		choices, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return choices, nil
+	case ")", "AND", "OR", "WITH":
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	default:
+		p.pos++
+		license := canonicalLicense(token)
+		if p.peek() == "WITH" {
+			p.pos++
+			exception := p.peek()
+			switch exception {
+			case "", "(", ")", "AND", "OR", "WITH":
+				return nil, fmt.Errorf("missing exception after WITH")
+			}
+			p.pos++
+			license += " WITH " + exception
+		}
+		return [][]string{{license}}, nil
+	}
+}
+
+// canonicalLicense returns the SPDX identifier of a license in the
+// form used by licenseRules: the deprecated GNU identifiers, such as
+// "GPL-3.0" and "GPL-3.0+", become "GPL-3.0-only" and
+// "GPL-3.0-or-later".
+func canonicalLicense(id string) string {
+	for _, gnu := range []string{"AGPL-3.0", "GPL-2.0", "GPL-3.0", "LGPL-2.1", "LGPL-3.0"} {
+		switch id {
+		case gnu:
+			return gnu + "-only"
+		case gnu + "+":
+			return gnu + "-or-later"
+		}
+	}
+	return id
+}
+
+// Groups of licenses, for licenseRules.
+var (
+	permissiveLicenses = []string{
+		"0BSD", "Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC",
+		"MIT", "Unlicense", "Zlib",
+	}
+	gpl2OnlyLicenses = []string{"GPL-2.0-only"}
+	gpl3Licenses     = []string{
+		"GPL-3.0-only", "GPL-3.0-or-later",
+		"AGPL-3.0-only", "AGPL-3.0-or-later",
+	}
+	copyleftLicenses = append([]string{"GPL-2.0-only", "GPL-2.0-or-later"}, gpl3Licenses...)
+)
+
+// licenseRules is the compatibility matrix that LicenseConflicts
+// checks: a package under one of the dependency licenses can't be
+// part of a work under one of the dependent licenses, for the given
+// reason. It only covers well-known cases. Licenses it doesn't
+// mention, including those with exceptions, are assumed to be
+// compatible with everything.
+var licenseRules = []struct {
+	dependencies []string
+	dependents   []string
+	reason       string
+}{
+	{
+		copyleftLicenses,
+		append(append([]string{}, permissiveLicenses...), "MPL-2.0"),
+		"a work that includes %[1]s code must be distributed under %[1]s, not %[2]s",
+	},
+	{
+		[]string{"Apache-2.0"},
+		gpl2OnlyLicenses,
+		"%[1]s's patent terms are incompatible with %[2]s",
+	},
+	{
+		gpl3Licenses,
+		gpl2OnlyLicenses,
+		"%[1]s code can't be distributed under %[2]s",
+	},
+	{
+		gpl2OnlyLicenses,
+		gpl3Licenses,
+		"%[1]s code can't be distributed under %[2]s",
+	},
+}
+
+// licenseIncompatibility returns why a package under the dependency
+// license can't be part of a work under the dependent one, or "" if
+// licenseRules doesn't know of a reason.
+func licenseIncompatibility(dependency string, dependent string) string {
+	for _, rule := range licenseRules {
+		if containsString(rule.dependencies, dependency) && containsString(rule.dependents, dependent) {
+			return fmt.Sprintf(rule.reason, dependency, dependent)
+		}
+	}
+	return ""
+}
+
+// containsString reports whether s is one of list.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// choicesConflict returns why the dependency, which can be used under
+// any of the choices of licenses dependencyChoices, can't be part of
+// the dependent, likewise under dependentChoices, whichever choices
+// are made. It returns "" if some combination of choices works.
+func choicesConflict(dependencyChoices [][]string, dependentChoices [][]string) string {
+	firstReason := ""
+	for _, dependencyChoice := range dependencyChoices {
+		for _, dependentChoice := range dependentChoices {
+			reason := ""
+			for _, dependency := range dependencyChoice {
+				for _, dependent := range dependentChoice {
+					if reason == "" {
+						reason = licenseIncompatibility(dependency, dependent)
+					}
+				}
+			}
+			if reason == "" {
+				return ""
+			}
+			if firstReason == "" {
+				firstReason = reason
+			}
+		}
+	}
+	return firstReason
+}
+
+// LicenseConflicts returns the pairs of packages among the root, if
+// not nil, and components where one depends on the other, directly or
+// through other packages, under licenses that licenseRules says are
+// incompatible. Packages whose licenses are unknown or not valid SPDX
+// expressions are skipped. This is advisory: the matrix only covers
+// well-known cases and knows nothing of how the packages are used.
+func LicenseConflicts(root *SBOMComponent, components []SBOMComponent) []api.LicenseConflict {
+	all := append([]SBOMComponent{}, components...)
+	if root != nil {
+		all = append([]SBOMComponent{*root}, all...)
+	}
+	byPURL := map[string]SBOMComponent{}
+	choices := map[string][][]string{}
+	for _, component := range all {
+		byPURL[component.PURL] = component
+		if component.License == "" {
+			continue
+		}
+		if parsed, err := ParseLicense(component.License); err == nil {
+			choices[component.PURL] = parsed
+		}
+	}
+
+	conflicts := []api.LicenseConflict{}
+	for _, dependent := range all {
+		dependentChoices, ok := choices[dependent.PURL]
+		if !ok {
+			continue
+		}
+		// Visit the packages that the dependent pulls in,
+		// breadth-first so that each is reached through the
+		// shortest path.
+		via := map[string]string{dependent.PURL: ""}
+		queue := []string{dependent.PURL}
+		for len(queue) > 0 {
+			purl := queue[0]
+			queue = queue[1:]
+			for _, dependency := range byPURL[purl].DependsOn {
+				if _, seen := via[dependency]; seen {
+					continue
+				}
+				if _, listed := byPURL[dependency]; !listed {
+					continue
+				}
+				via[dependency] = purl
+				queue = append(queue, dependency)
+
+				dependencyChoices, ok := choices[dependency]
+				if !ok {
+					continue
+				}
+				reason := choicesConflict(dependencyChoices, dependentChoices)
+				if reason == "" {
+					continue
+				}
+				through := []string{}
+				for step := purl; step != dependent.PURL; step = via[step] {
+					through = append([]string{byPURL[step].Name}, through...)
+				}
+				conflicts = append(conflicts, api.LicenseConflict{
+					Package:           dependent.Name,
+					License:           dependent.License,
+					Dependency:        byPURL[dependency].Name,
+					DependencyLicense: byPURL[dependency].License,
+					Through:           through,
+					Reason:            reason,
+				})
+			}
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Package != conflicts[j].Package {
+			return conflicts[i].Package < conflicts[j].Package
+		}
+		return conflicts[i].Dependency < conflicts[j].Dependency
+	})
+	return conflicts
+}
+
+// ParseCycloneDX returns the components of a CycloneDX BOM, as written
+// by SBOM, along with the subject of the BOM as the root if it has
+// one.
+func ParseCycloneDX(sbom []byte) (*SBOMComponent, []SBOMComponent, error) {
+	var bom cycloneDXBOM
+	if err := json.Unmarshal(sbom, &bom); err != nil {
+		return nil, nil, err
+	}
+	dependsOn := map[string][]string{}
+	for _, dependency := range bom.Dependencies {
+		dependsOn[dependency.Ref] = dependency.DependsOn
+	}
+	component := func(c cycloneDXComponent) SBOMComponent {
+		licenses := []string{}
+		for _, license := range c.Licenses {
+			switch {
+			case license.Expression != "":
+				licenses = append(licenses, license.Expression)
+			case license.License != nil:
+				licenses = append(licenses, license.License.Name)
+			}
+		}
+		return SBOMComponent{
+			Name:      c.Name,
+			Version:   c.Version,
+			License:   strings.Join(licenses, " AND "),
+			PURL:      c.PURL,
+			DependsOn: dependsOn[c.BOMRef],
+		}
+	}
+
+	var root *SBOMComponent
+	if bom.Metadata != nil {
+		c := component(bom.Metadata.Component)
+		root = &c
+	}
+	components := []SBOMComponent{}
+	for _, c := range bom.Components {
+		components = append(components, component(c))
+	}
+	return root, components, nil
+}
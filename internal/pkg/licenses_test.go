@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestParseLicense(t *testing.T) {
+	cases := []struct {
+		expression string
+		expected   [][]string
+	}{
+		{"MIT", [][]string{{"MIT"}}},
+		{"GPL-3.0+", [][]string{{"GPL-3.0-or-later"}}},
+		{"(MIT OR Apache-2.0)", [][]string{{"MIT"}, {"Apache-2.0"}}},
+		{"MIT or GPL-2.0", [][]string{{"MIT"}, {"GPL-2.0-only"}}},
+		{"MIT AND BSD-3-Clause OR ISC", [][]string{{"MIT", "BSD-3-Clause"}, {"ISC"}}},
+		{"(MIT OR ISC) AND Zlib", [][]string{{"MIT", "Zlib"}, {"ISC", "Zlib"}}},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", [][]string{{"GPL-2.0-only WITH Classpath-exception-2.0"}}},
+	}
+	for _, c := range cases {
+		choices, err := ParseLicense(c.expression)
+		if err != nil {
+			t.Errorf("ParseLicense(%q) failed: %s", c.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(choices, c.expected) {
+			t.Errorf("ParseLicense(%q) = %v, expected %v", c.expression, choices, c.expected)
+		}
+	}
+
+	for _, expression := range []string{"", "MIT OR", "(MIT", "MIT)", "AND MIT", "MIT WITH", "MIT Apache-2.0"} {
+		if _, err := ParseLicense(expression); err == nil {
+			t.Errorf("ParseLicense(%q) succeeded, expected an error", expression)
+		}
+	}
+}
+
+func TestLicenseConflicts(t *testing.T) {
+	// An MIT project that pulls in a GPL-3.0 package through an
+	// Apache-2.0 one, a GPL-2.0-only package that depends on an
+	// Apache-2.0 one, and packages that can be used under a
+	// compatible choice of license or under licenses that aren't
+	// known to conflict.
+	root := &SBOMComponent{
+		Name:      "my-app",
+		License:   "MIT",
+		PURL:      "pkg:npm/my-app@1.0.0",
+		DependsOn: []string{"pkg:npm/http-client@2.0.0", "pkg:npm/dual@1.0.0", "pkg:npm/legacy@0.9.0", "pkg:npm/custom@1.0.0"},
+	}
+	components := []SBOMComponent{
+		{Name: "http-client", License: "Apache-2.0", PURL: "pkg:npm/http-client@2.0.0", DependsOn: []string{"pkg:npm/readline-gpl@3.1.0"}},
+		{Name: "readline-gpl", License: "GPL-3.0-or-later", PURL: "pkg:npm/readline-gpl@3.1.0"},
+		{Name: "dual", License: "(MIT OR GPL-3.0)", PURL: "pkg:npm/dual@1.0.0"},
+		{Name: "legacy", License: "GPL-2.0", PURL: "pkg:npm/legacy@0.9.0", DependsOn: []string{"pkg:npm/apache-util@1.0.0"}},
+		{Name: "apache-util", License: "Apache-2.0", PURL: "pkg:npm/apache-util@1.0.0"},
+		{Name: "custom", License: "SEE LICENSE IN LICENSE.txt", PURL: "pkg:npm/custom@1.0.0"},
+	}
+
+	expected := []api.LicenseConflict{
+		{
+			Package:           "http-client",
+			License:           "Apache-2.0",
+			Dependency:        "readline-gpl",
+			DependencyLicense: "GPL-3.0-or-later",
+			Through:           []string{},
+			Reason:            "a work that includes GPL-3.0-or-later code must be distributed under GPL-3.0-or-later, not Apache-2.0",
+		},
+		{
+			Package:           "legacy",
+			License:           "GPL-2.0",
+			Dependency:        "apache-util",
+			DependencyLicense: "Apache-2.0",
+			Through:           []string{},
+			Reason:            "Apache-2.0's patent terms are incompatible with GPL-2.0-only",
+		},
+		{
+			Package:           "my-app",
+			License:           "MIT",
+			Dependency:        "legacy",
+			DependencyLicense: "GPL-2.0",
+			Through:           []string{},
+			Reason:            "a work that includes GPL-2.0-only code must be distributed under GPL-2.0-only, not MIT",
+		},
+		{
+			Package:           "my-app",
+			License:           "MIT",
+			Dependency:        "readline-gpl",
+			DependencyLicense: "GPL-3.0-or-later",
+			Through:           []string{"http-client"},
+			Reason:            "a work that includes GPL-3.0-or-later code must be distributed under GPL-3.0-or-later, not MIT",
+		},
+	}
+	if conflicts := LicenseConflicts(root, components); !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("LicenseConflicts() =\n%+v\nexpected\n%+v", conflicts, expected)
+	}
+
+	if conflicts := LicenseConflicts(nil, components[2:3]); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts without dependencies, got %+v", conflicts)
+	}
+}
+
+func TestParseCycloneDX(t *testing.T) {
+	root := &SBOMComponent{
+		Name:      "my-app",
+		Version:   "1.0.0",
+		License:   "MIT",
+		PURL:      "pkg:npm/my-app@1.0.0",
+		DependsOn: []string{"pkg:npm/left-pad@1.3.0"},
+	}
+	components := []SBOMComponent{
+		{Name: "left-pad", Version: "1.3.0", License: "WTFPL", PURL: "pkg:npm/left-pad@1.3.0", DependsOn: []string{}},
+	}
+	output, err := SBOM(SBOMFormatCycloneDX, root, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedRoot, parsedComponents, err := ParseCycloneDX(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsedRoot, root) {
+		t.Errorf("expected root %+v, got %+v", root, parsedRoot)
+	}
+	if !reflect.DeepEqual(parsedComponents, components) {
+		t.Errorf("expected components %+v, got %+v", components, parsedComponents)
+	}
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+// globRegexp returns the regexp that matches the whole of the names
+// that the glob of a PolicyRule matches.
+func globRegexp(glob string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, `.*`)
+	pattern = strings.ReplaceAll(pattern, `\?`, `.`)
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// matchesRule reports whether rule matches the package of the given
+// normalized name and version, which is "" if unknown. The version
+// constraint of the rule, if any, is in the given syntax. A rule with
+// a version constraint matches a package of unknown version by name
+// alone if loose is true, and otherwise not at all.
+func matchesRule(rule config.PolicyRule, syntax api.SpecSyntax, name api.PkgName, v string, normalizePackageName func(api.PkgName) api.PkgName, loose bool) bool {
+	if !globRegexp(string(normalizePackageName(api.PkgName(rule.Name)))).MatchString(string(name)) {
+		return false
+	}
+	if rule.Version == "" {
+		return true
+	}
+	parsed, err := version.NewVersion(v)
+	if err != nil {
+		return loose
+	}
+	return SatisfiesConstraint(syntax, rule.Version, parsed)
+}
+
+// CheckPolicy returns why policy forbids the named package at version
+// v, which is "" if unknown, or "" if it doesn't. The version
+// constraints of the rules are read in the given syntax, that of the
+// backend. Rules with a version constraint only apply to packages
+// whose version is known, so that such a deny rule doesn't forbid a
+// package of unknown version, and such an allow rule allows it.
+func CheckPolicy(policy config.Policy, syntax api.SpecSyntax, name api.PkgName, v string, normalizePackageName func(api.PkgName) api.PkgName) string {
+	name = normalizePackageName(name)
+	for _, rule := range policy.Deny {
+		if !matchesRule(rule, syntax, name, v, normalizePackageName, false) {
+			continue
+		}
+		if rule.Reason != "" {
+			return rule.Reason
+		}
+		if rule.Version != "" {
+			return fmt.Sprintf("denied by the policy (%s %s)", rule.Name, rule.Version)
+		}
+		return fmt.Sprintf("denied by the policy (%s)", rule.Name)
+	}
+	if len(policy.Allow) == 0 {
+		return ""
+	}
+	for _, rule := range policy.Allow {
+		if matchesRule(rule, syntax, name, v, normalizePackageName, true) {
+			return ""
+		}
+	}
+	return "not in the policy's allowlist"
+}
+
+// PinnedVersion returns the version that spec, in the given syntax,
+// pins, such as "1.2.3" for npm's "1.2.3" or "=1.2.3", or pip's
+// "==1.2", or "" if it allows a range of versions or isn't a version
+// constraint at all. Whether a bare version is pinned depends on the
+// syntax: npm reads "1.2" as the whole 1.2 series, and Cargo reads
+// "1.2.3" as ^1.2.3.
+func PinnedVersion(syntax api.SpecSyntax, spec api.PkgSpec) string {
+	trimmed := strings.TrimSpace(string(spec))
+	match := specComparison.FindStringSubmatch(trimmed)
+	if match == nil || match[0] != trimmed || strings.ContainsAny(trimmed, "xX*+-") {
+		return ""
+	}
+	switch specOperator(syntax, match[1]) {
+	case "==", "===":
+		return match[2]
+	case "":
+		if strings.Count(match[2], ".") >= 2 {
+			return match[2]
+		}
+	}
+	return ""
+}
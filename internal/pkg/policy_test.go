@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	normalize := func(name api.PkgName) api.PkgName {
+		return api.PkgName(strings.ToLower(string(name)))
+	}
+	policy := config.Policy{
+		Allow: []config.PolicyRule{
+			{Name: "@acme/*"},
+			{Name: "react*"},
+			{Name: "lodash", Version: ">=4.17.21"},
+			{Name: "event-stream"},
+		},
+		Deny: []config.PolicyRule{
+			{Name: "event-stream", Version: "3.3.6", Reason: "compromised release"},
+			{Name: "@acme/legacy-?"},
+		},
+	}
+	tcs := []struct {
+		name     api.PkgName
+		version  string
+		expected string
+	}{
+		{"@acme/ui", "1.0.0", ""},
+		{"@ACME/deep/path", "", ""},
+		{"react-dom", "18.3.1", ""},
+		{"lodash", "4.17.21", ""},
+		{"lodash", "4.17.20", "not in the policy's allowlist"},
+		{"lodash", "", ""},
+		{"event-stream", "3.3.6", "compromised release"},
+		{"event-stream", "4.0.1", ""},
+		{"event-stream", "", ""},
+		{"@acme/legacy-a", "1.0.0", "denied by the policy (@acme/legacy-?)"},
+		{"@acme/legacy-ab", "1.0.0", ""},
+		{"left-pad", "1.3.0", "not in the policy's allowlist"},
+	}
+	for _, tc := range tcs {
+		if reason := CheckPolicy(policy, api.SpecSyntaxNpm, tc.name, tc.version, normalize); reason != tc.expected {
+			t.Errorf("%s %s: expected %q, got %q", tc.name, tc.version, tc.expected, reason)
+		}
+	}
+
+	// Without allow rules, only denied packages are forbidden.
+	if reason := CheckPolicy(config.Policy{}, api.SpecSyntaxNpm, "left-pad", "1.3.0", normalize); reason != "" {
+		t.Errorf("expected an empty policy to allow everything, got %q", reason)
+	}
+
+	// A bare version denies the whole series for npm, but only that
+	// version for Poetry.
+	series := config.Policy{Deny: []config.PolicyRule{{Name: "requests", Version: "2.31", Reason: "broken"}}}
+	if reason := CheckPolicy(series, api.SpecSyntaxNpm, "requests", "2.31.1", normalize); reason != "broken" {
+		t.Errorf("expected npm to deny the 2.31 series, got %q", reason)
+	}
+	if reason := CheckPolicy(series, api.SpecSyntaxExact, "requests", "2.31.1", normalize); reason != "" {
+		t.Errorf("expected Poetry to only deny 2.31.0, got %q", reason)
+	}
+	if reason := CheckPolicy(series, api.SpecSyntaxExact, "requests", "2.31.0", normalize); reason != "broken" {
+		t.Errorf("expected Poetry to deny 2.31.0, got %q", reason)
+	}
+}
+
+func TestPinnedVersion(t *testing.T) {
+	tcs := []struct {
+		syntax   api.SpecSyntax
+		spec     api.PkgSpec
+		expected string
+	}{
+		{api.SpecSyntaxNpm, "1.2.3", "1.2.3"},
+		{api.SpecSyntaxNpm, "=1.2.3", "1.2.3"},
+		{api.SpecSyntaxNpm, " v1.2.3 ", "1.2.3"},
+		{api.SpecSyntaxNpm, "1.2", ""},
+		{api.SpecSyntaxNpm, "^1.2.3", ""},
+		{api.SpecSyntaxNpm, ">=1.2.3", ""},
+		{api.SpecSyntaxNpm, "1.2.x", ""},
+		{api.SpecSyntaxNpm, "1.0.0-beta.1", ""},
+		{api.SpecSyntaxNpm, "latest", ""},
+		{api.SpecSyntaxNpm, "", ""},
+		{api.SpecSyntaxExact, "==1.2", "1.2"},
+		{api.SpecSyntaxExact, "==1.2.*", ""},
+		{api.SpecSyntaxExact, "1.2", "1.2"},
+		{api.SpecSyntaxCargo, "1.2.3", ""},
+		{api.SpecSyntaxCargo, "=1.2.3", "1.2.3"},
+		{api.SpecSyntaxCargo, "=1.2", ""},
+	}
+	for _, tc := range tcs {
+		if v := PinnedVersion(tc.syntax, tc.spec); v != tc.expected {
+			t.Errorf("%d %q: expected %q, got %q", tc.syntax, tc.spec, tc.expected, v)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The formats that an SBOM can be written in, as passed to 'upm
+// sbom --format'.
+const (
+	SBOMFormatCycloneDX = "cyclonedx"
+	SBOMFormatSPDX      = "spdx"
+)
+
+// SBOMComponent is a package listed in a software bill of materials.
+type SBOMComponent struct {
+	Name    string
+	Version string
+
+	// The license of the package, preferably as an SPDX license
+	// expression such as "MIT" or "(MIT OR Apache-2.0)", or
+	// empty if unknown.
+	License string
+
+	// The package URL of the package, see PackageURL. It also
+	// identifies the component within the SBOM.
+	PURL string
+
+	// The package URLs of the components that the package
+	// depends on.
+	DependsOn []string
+}
+
+// PackageURL returns the package URL (purl) of a package of the
+// given type, such as "npm" or "pypi", as specified by
+// https://github.com/package-url/purl-spec. An npm scope becomes the
+// namespace, and PyPI names are normalized as the spec requires.
+func PackageURL(purlType string, name string, version string) string {
+	namespace := ""
+	switch purlType {
+	case "npm":
+		if scope, rest, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+			namespace, name = scope, rest
+		}
+	case "pypi":
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+
+	purl := "pkg:" + purlType + "/"
+	if namespace != "" {
+		purl += purlEscape(namespace) + "/"
+	}
+	purl += purlEscape(name)
+	if version != "" {
+		purl += "@" + purlEscape(version)
+	}
+	return purl
+}
+
+// purlEscape percent-encodes one part of a package URL. Unlike in
+// other URL paths, "@" (which introduces the version) and "+" have to
+// be encoded too.
+func purlEscape(part string) string {
+	return strings.NewReplacer("@", "%40", "+", "%2B").Replace(url.PathEscape(part))
+}
+
+// licenseExpression matches licenses that can be written as an SPDX
+// license expression rather than just named.
+var licenseExpression = regexp.MustCompile(`^\(?[A-Za-z0-9.+-]+(?:\)?\s+(?:AND|OR|WITH)\s+\(?[A-Za-z0-9.+-]+)*\)?$`)
+
+// cycloneDXLicense is an entry of the licenses of a CycloneDX
+// component, which either has an SPDX expression or names a license.
+type cycloneDXLicense struct {
+	Expression string                 `json:"expression,omitempty"`
+	License    *cycloneDXNamedLicense `json:"license,omitempty"`
+}
+
+// cycloneDXNamedLicense is a license that isn't given as an SPDX
+// expression.
+type cycloneDXNamedLicense struct {
+	Name string `json:"name"`
+}
+
+// cycloneDXComponent is a component of a CycloneDX BOM.
+type cycloneDXComponent struct {
+	Type     string             `json:"type"`
+	BOMRef   string             `json:"bom-ref"`
+	Name     string             `json:"name"`
+	Version  string             `json:"version,omitempty"`
+	PURL     string             `json:"purl"`
+	Licenses []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+// cycloneDXDependency records the dependencies of a component of a
+// CycloneDX BOM.
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cycloneDXMetadata describes what a CycloneDX BOM is about.
+type cycloneDXMetadata struct {
+	Component cycloneDXComponent `json:"component"`
+}
+
+// cycloneDXBOM is a CycloneDX BOM, in its JSON format.
+type cycloneDXBOM struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     *cycloneDXMetadata    `json:"metadata,omitempty"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+// newCycloneDXComponent converts component to its CycloneDX form.
+func newCycloneDXComponent(componentType string, component SBOMComponent) cycloneDXComponent {
+	result := cycloneDXComponent{
+		Type:    componentType,
+		BOMRef:  component.PURL,
+		Name:    component.Name,
+		Version: component.Version,
+		PURL:    component.PURL,
+	}
+	switch {
+	case component.License == "":
+	case licenseExpression.MatchString(component.License):
+		result.Licenses = []cycloneDXLicense{{Expression: component.License}}
+	default:
+		result.Licenses = []cycloneDXLicense{{License: &cycloneDXNamedLicense{component.License}}}
+	}
+	return result
+}
+
+// SBOM returns a software bill of materials listing the components,
+// in the given format, for 'upm sbom'. The root, if not nil, is the
+// project itself, described as the subject of the SBOM. Only
+// CycloneDX (version 1.5, as JSON) is supported so far. Components
+// are sorted, and dependencies on components that aren't listed are
+// dropped, so that the result only depends on its input.
+func SBOM(format string, root *SBOMComponent, components []SBOMComponent) ([]byte, error) {
+	switch format {
+	case SBOMFormatCycloneDX:
+	case SBOMFormatSPDX:
+		return nil, fmt.Errorf("SBOM format %s is not supported yet", format)
+	default:
+		return nil, fmt.Errorf("unknown SBOM format %q (must be %q or %q)", format, SBOMFormatCycloneDX, SBOMFormatSPDX)
+	}
+
+	components = append([]SBOMComponent{}, components...)
+	sort.Slice(components, func(i, j int) bool { return components[i].PURL < components[j].PURL })
+	listed := map[string]bool{}
+	for _, component := range components {
+		listed[component.PURL] = true
+	}
+	dependencies := func(component SBOMComponent) cycloneDXDependency {
+		dependsOn := []string{}
+		seen := map[string]bool{}
+		for _, purl := range component.DependsOn {
+			if listed[purl] && !seen[purl] {
+				seen[purl] = true
+				dependsOn = append(dependsOn, purl)
+			}
+		}
+		sort.Strings(dependsOn)
+		return cycloneDXDependency{Ref: component.PURL, DependsOn: dependsOn}
+	}
+
+	bom := cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		Version:      1,
+		Components:   []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{},
+	}
+	if root != nil {
+		bom.Metadata = &cycloneDXMetadata{newCycloneDXComponent("application", *root)}
+		bom.Dependencies = append(bom.Dependencies, dependencies(*root))
+	}
+	for _, component := range components {
+		if root != nil && component.PURL == root.PURL {
+			continue
+		}
+		bom.Components = append(bom.Components, newCycloneDXComponent("library", component))
+		bom.Dependencies = append(bom.Dependencies, dependencies(component))
+	}
+
+	output, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(output, '\n'), nil
+}
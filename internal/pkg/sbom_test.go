@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestPackageURL(t *testing.T) {
+	cases := []struct {
+		purlType string
+		name     string
+		version  string
+		expected string
+	}{
+		{"npm", "left-pad", "1.3.0", "pkg:npm/left-pad@1.3.0"},
+		{"npm", "@types/node", "18.0.0", "pkg:npm/%40types/node@18.0.0"},
+		{"pypi", "Django_Rest", "3.14.0", "pkg:pypi/django-rest@3.14.0"},
+		{"pypi", "torch", "2.1.0+cpu", "pkg:pypi/torch@2.1.0%2Bcpu"},
+		{"npm", "my-app", "", "pkg:npm/my-app"},
+	}
+	for _, c := range cases {
+		if purl := PackageURL(c.purlType, c.name, c.version); purl != c.expected {
+			t.Errorf("PackageURL(%q, %q, %q) = %q, expected %q", c.purlType, c.name, c.version, purl, c.expected)
+		}
+	}
+}
+
+// purlPattern matches the general syntax of a package URL.
+var purlPattern = regexp.MustCompile(`^pkg:[a-z][a-z0-9.+-]*/[^@]+(@[^@]+)?$`)
+
+// validateCycloneDX checks output against the requirements of the
+// CycloneDX 1.5 JSON schema that apply to what SBOM writes: the
+// required properties and their types, the enumerated component
+// types, the form of licenses, unique bom-refs, and dependencies
+// that only refer to those bom-refs.
+func validateCycloneDX(t *testing.T, output []byte) map[string]interface{} {
+	var bom map[string]interface{}
+	if err := json.Unmarshal(output, &bom); err != nil {
+		t.Fatalf("SBOM is not valid JSON: %s", err)
+	}
+	if bom["bomFormat"] != "CycloneDX" {
+		t.Errorf("bomFormat is %v", bom["bomFormat"])
+	}
+	if bom["specVersion"] != "1.5" {
+		t.Errorf("specVersion is %v", bom["specVersion"])
+	}
+	if version, ok := bom["version"].(float64); !ok || version < 1 {
+		t.Errorf("version is %v", bom["version"])
+	}
+
+	refs := map[string]bool{}
+	checkComponent := func(component map[string]interface{}) {
+		switch component["type"] {
+		case "application", "framework", "library", "container", "platform",
+			"operating-system", "device", "device-driver", "firmware", "file",
+			"machine-learning-model", "data":
+		default:
+			t.Errorf("component has invalid type %v", component["type"])
+		}
+		if name, ok := component["name"].(string); !ok || name == "" {
+			t.Errorf("component has no name: %v", component)
+		}
+		purl, _ := component["purl"].(string)
+		if !purlPattern.MatchString(purl) {
+			t.Errorf("component has invalid purl %q", purl)
+		}
+		ref, _ := component["bom-ref"].(string)
+		if ref == "" || refs[ref] {
+			t.Errorf("component has missing or duplicate bom-ref %q", ref)
+		}
+		refs[ref] = true
+		licenses, _ := component["licenses"].([]interface{})
+		for _, license := range licenses {
+			license := license.(map[string]interface{})
+			_, hasExpression := license["expression"].(string)
+			named, hasLicense := license["license"].(map[string]interface{})
+			if hasExpression == hasLicense {
+				t.Errorf("license must have exactly one of expression and license: %v", license)
+			}
+			if hasLicense && named["name"] == nil && named["id"] == nil {
+				t.Errorf("license has neither id nor name: %v", license)
+			}
+		}
+	}
+	if metadata, ok := bom["metadata"].(map[string]interface{}); ok {
+		checkComponent(metadata["component"].(map[string]interface{}))
+	}
+	components, ok := bom["components"].([]interface{})
+	if !ok {
+		t.Fatalf("SBOM has no components array")
+	}
+	for _, component := range components {
+		checkComponent(component.(map[string]interface{}))
+	}
+
+	dependencies, ok := bom["dependencies"].([]interface{})
+	if !ok {
+		t.Fatalf("SBOM has no dependencies array")
+	}
+	for _, dependency := range dependencies {
+		dependency := dependency.(map[string]interface{})
+		if !refs[dependency["ref"].(string)] {
+			t.Errorf("dependency refers to unknown bom-ref %v", dependency["ref"])
+		}
+		for _, dependsOn := range dependency["dependsOn"].([]interface{}) {
+			if !refs[dependsOn.(string)] {
+				t.Errorf("%v depends on unknown bom-ref %v", dependency["ref"], dependsOn)
+			}
+		}
+	}
+	return bom
+}
+
+func TestSBOMCycloneDX(t *testing.T) {
+	root := &SBOMComponent{
+		Name:      "my-app",
+		Version:   "1.0.0",
+		PURL:      PackageURL("npm", "my-app", "1.0.0"),
+		DependsOn: []string{PackageURL("npm", "express", "4.18.2")},
+	}
+	components := []SBOMComponent{
+		{
+			Name:      "express",
+			Version:   "4.18.2",
+			License:   "MIT",
+			PURL:      PackageURL("npm", "express", "4.18.2"),
+			DependsOn: []string{PackageURL("npm", "@types/qs", "6.9.7"), PackageURL("npm", "missing", "1.0.0")},
+		},
+		{
+			Name:    "@types/qs",
+			Version: "6.9.7",
+			License: "(MIT OR Apache-2.0)",
+			PURL:    PackageURL("npm", "@types/qs", "6.9.7"),
+		},
+		{
+			Name:    "odd",
+			Version: "0.1.0",
+			License: "SEE LICENSE IN LICENSE.txt",
+			PURL:    PackageURL("npm", "odd", "0.1.0"),
+		},
+	}
+
+	output, err := SBOM(SBOMFormatCycloneDX, root, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom := validateCycloneDX(t, output)
+
+	listed := bom["components"].([]interface{})
+	if len(listed) != 3 {
+		t.Fatalf("expected 3 components, got %d", len(listed))
+	}
+	// Components are sorted by purl.
+	first := listed[0].(map[string]interface{})
+	if first["purl"] != "pkg:npm/%40types/qs@6.9.7" {
+		t.Errorf("expected @types/qs first, got %v", first["purl"])
+	}
+	licenses := first["licenses"].([]interface{})
+	if licenses[0].(map[string]interface{})["expression"] != "(MIT OR Apache-2.0)" {
+		t.Errorf("expected an SPDX expression, got %v", licenses)
+	}
+	odd := listed[2].(map[string]interface{})
+	named := odd["licenses"].([]interface{})[0].(map[string]interface{})["license"]
+	if named.(map[string]interface{})["name"] != "SEE LICENSE IN LICENSE.txt" {
+		t.Errorf("expected a named license, got %v", odd["licenses"])
+	}
+
+	// The dependency on a component that isn't listed is dropped.
+	for _, dependency := range bom["dependencies"].([]interface{}) {
+		dependency := dependency.(map[string]interface{})
+		if dependency["ref"] == "pkg:npm/express@4.18.2" {
+			dependsOn := dependency["dependsOn"].([]interface{})
+			if len(dependsOn) != 1 || dependsOn[0] != "pkg:npm/%40types/qs@6.9.7" {
+				t.Errorf("unexpected dependencies of express: %v", dependsOn)
+			}
+		}
+	}
+}
+
+func TestSBOMUnsupportedFormat(t *testing.T) {
+	if _, err := SBOM(SBOMFormatSPDX, nil, nil); err == nil {
+		t.Error("expected SPDX to be reported as unsupported")
+	}
+	if _, err := SBOM("xml", nil, nil); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// recentPublishWindow is how recently a package must have first been
+// published for it to count as new in RegistryCheck.
+const recentPublishWindow = 30 * 24 * time.Hour
+
+// fewDownloads is the download count below which a new package is
+// considered obscure in RegistryCheck.
+const fewDownloads = 1000
+
+// LoadPopularPackages reads a bundled list of popular package names
+// from the given resource. The list has one name per line; blank
+// lines and lines starting with "#" are ignored.
+func LoadPopularPackages(resource string) []api.PkgName {
+	names := []api.PkgName{}
+	for _, line := range strings.Split(util.GetResource(resource), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, api.PkgName(line))
+	}
+	return names
+}
+
+// editDistance returns the optimal string alignment distance between
+// a and b: the number of single-character insertions, deletions,
+// substitutions and transpositions of adjacent characters needed to
+// turn one into the other.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// SimilarPopularPackage returns the popular package whose name is
+// suspiciously close to name, if there is one. Names are compared
+// after normalization, and a name that is itself popular is never
+// suspicious. Short names tolerate a single edit, longer ones two.
+func SimilarPopularPackage(name api.PkgName, popular []api.PkgName, normalizePackageName func(api.PkgName) api.PkgName) (api.PkgName, bool) {
+	needle := string(normalizePackageName(name))
+	for _, candidate := range popular {
+		if string(normalizePackageName(candidate)) == needle {
+			return "", false
+		}
+	}
+
+	var closest api.PkgName
+	closestDistance := -1
+	for _, candidate := range popular {
+		normal := string(normalizePackageName(candidate))
+		threshold := 1
+		if len(normal) > 6 {
+			threshold = 2
+		}
+		distance := editDistance(needle, normal)
+		if distance <= threshold && (closestDistance < 0 || distance < closestDistance) {
+			closest = candidate
+			closestDistance = distance
+		}
+	}
+	return closest, closestDistance >= 0
+}
+
+// RegistryCheck returns the reasons why adding the named package
+// looks like it might be a typosquatting mistake, or an empty slice
+// if nothing looks wrong. info is what the backend's Info method
+// returned for it, and now is the current time.
+func RegistryCheck(name api.PkgName, info api.PkgInfo, popular []api.PkgName, normalizePackageName func(api.PkgName) api.PkgName, now time.Time) []string {
+	reasons := []string{}
+
+	if similar, ok := SimilarPopularPackage(name, popular, normalizePackageName); ok {
+		reasons = append(reasons, fmt.Sprintf("name is very similar to the popular package %s", similar))
+	}
+
+	if info.Name == "" {
+		reasons = append(reasons, "package was not found in the registry")
+		return reasons
+	}
+
+	published, err := time.Parse(time.RFC3339, info.FirstPublished)
+	if err != nil || now.Sub(published) > recentPublishWindow {
+		return reasons
+	}
+	age := fmt.Sprintf("first published %d days ago", int(now.Sub(published).Hours()/24))
+	if downloads, err := strconv.Atoi(info.Downloads); err == nil {
+		if downloads < fewDownloads {
+			reasons = append(reasons, fmt.Sprintf("%s and only downloaded %d times", age, downloads))
+		}
+	} else {
+		reasons = append(reasons, age)
+	}
+
+	return reasons
+}
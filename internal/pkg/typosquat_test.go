@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+)
+
+var testPopular = []api.PkgName{"requests", "react", "lodash", "express"}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"react", "react", 0},
+		{"reqeusts", "requests", 1},
+		{"requets", "requests", 1},
+		{"lodash", "lodahs", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, c := range cases {
+		if d := editDistance(c.a, c.b); d != c.distance {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", c.a, c.b, d, c.distance)
+		}
+	}
+}
+
+func TestSimilarPopularPackage(t *testing.T) {
+	similar, ok := SimilarPopularPackage("requets", testPopular, simpleNormalizePackageName)
+	if !ok || similar != "requests" {
+		t.Errorf("expected requets to be flagged as similar to requests, got %q, %v", similar, ok)
+	}
+
+	similar, ok = SimilarPopularPackage("lodahs", testPopular, simpleNormalizePackageName)
+	if !ok || similar != "lodash" {
+		t.Errorf("expected lodahs to be flagged as similar to lodash, got %q, %v", similar, ok)
+	}
+
+	similar, ok = SimilarPopularPackage("Expres", testPopular, simpleNormalizePackageName)
+	if !ok || similar != "express" {
+		t.Errorf("expected Expres to be flagged as similar to express, got %q, %v", similar, ok)
+	}
+
+	if _, ok := SimilarPopularPackage("React", testPopular, simpleNormalizePackageName); ok {
+		t.Errorf("expected a popular package not to be flagged")
+	}
+
+	if _, ok := SimilarPopularPackage("left-pad", testPopular, simpleNormalizePackageName); ok {
+		t.Errorf("expected an unrelated package not to be flagged")
+	}
+}
+
+func TestRegistryCheck(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	reasons := RegistryCheck("requets", api.PkgInfo{
+		Name:           "requets",
+		FirstPublished: "2024-05-29T12:00:00Z",
+		Downloads:      "12",
+	}, testPopular, simpleNormalizePackageName, now)
+	expected := []string{
+		"name is very similar to the popular package requests",
+		"first published 2 days ago and only downloaded 12 times",
+	}
+	if len(reasons) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, reasons)
+	}
+	for i := range expected {
+		if reasons[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], reasons[i])
+		}
+	}
+
+	reasons = RegistryCheck("left-pad", api.PkgInfo{
+		Name:           "left-pad",
+		FirstPublished: "2014-03-25T00:00:00Z",
+	}, testPopular, simpleNormalizePackageName, now)
+	if len(reasons) != 0 {
+		t.Errorf("expected an established package to pass, got %v", reasons)
+	}
+
+	reasons = RegistryCheck("left-pad", api.PkgInfo{
+		Name:           "left-pad",
+		FirstPublished: "2024-05-20T00:00:00Z",
+		Downloads:      "250000",
+	}, testPopular, simpleNormalizePackageName, now)
+	if len(reasons) != 0 {
+		t.Errorf("expected a new but widely downloaded package to pass, got %v", reasons)
+	}
+}
+
+func TestLoadPopularPackages(t *testing.T) {
+	for _, resource := range []string{"/popular/npm.txt", "/popular/pypi.txt", "/popular/crates.txt"} {
+		names := LoadPopularPackages(resource)
+		if len(names) == 0 {
+			t.Errorf("%s: expected some packages", resource)
+		}
+		for _, name := range names {
+			if name == "" || name[0] == '#' {
+				t.Errorf("%s: unexpected entry %q", resource, name)
+			}
+		}
+	}
+}
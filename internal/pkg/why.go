@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// pulledInBy returns, for each package in graph that the direct
+// dependencies depend on, directly or through other packages, the set
+// of direct dependencies that pull it in. A direct dependency doesn't
+// count as pulling in itself, but may pull in another one. Cycles in
+// the graph are tolerated.
+func pulledInBy(graph map[api.PkgName][]api.PkgName, direct []api.PkgName) map[api.PkgName]map[api.PkgName]bool {
+	result := map[api.PkgName]map[api.PkgName]bool{}
+	for _, root := range direct {
+		seen := map[api.PkgName]bool{root: true}
+		queue := append([]api.PkgName{}, graph[root]...)
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if result[name] == nil {
+				result[name] = map[api.PkgName]bool{}
+			}
+			result[name][root] = true
+			queue = append(queue, graph[name]...)
+		}
+	}
+	return result
+}
+
+// sortedNames returns the names in set, sorted.
+func sortedNames(set map[api.PkgName]bool) []string {
+	names := []string{}
+	for name := range set {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PulledInBy returns the sorted names of the direct dependencies that
+// pull in the named package according to graph, which maps the
+// packages of a lockfile to their dependencies.
+func PulledInBy(graph map[api.PkgName][]api.PkgName, direct []api.PkgName, name api.PkgName) []string {
+	return sortedNames(pulledInBy(graph, direct)[name])
+}
+
+// SharedDependencies returns the packages in graph, which maps the
+// packages of a lockfile to their dependencies, that more than one of
+// the direct dependencies pull in. The most depended-upon packages
+// come first, and ties are broken by name.
+func SharedDependencies(graph map[api.PkgName][]api.PkgName, direct []api.PkgName) []api.SharedDependency {
+	shared := []api.SharedDependency{}
+	for name, roots := range pulledInBy(graph, direct) {
+		if len(roots) < 2 {
+			continue
+		}
+		shared = append(shared, api.SharedDependency{
+			Name:       string(name),
+			Count:      len(roots),
+			PulledInBy: sortedNames(roots),
+		})
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].Count != shared[j].Count {
+			return shared[i].Count > shared[j].Count
+		}
+		return shared[i].Name < shared[j].Name
+	})
+	return shared
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// whyGraph is a lockfile in which the direct dependencies app-a,
+// app-b and app-c share transitive dependencies to different extents.
+var whyGraph = map[api.PkgName][]api.PkgName{
+	"app-a":  {"common", "logger"},
+	"app-b":  {"common", "parser"},
+	"app-c":  {"parser", "app-a"},
+	"common": {"util"},
+	"parser": {"util", "common"},
+	"logger": {},
+	"util":   {"common"}, // a cycle
+}
+
+var whyDirect = []api.PkgName{"app-a", "app-b", "app-c"}
+
+func TestSharedDependencies(t *testing.T) {
+	expected := []api.SharedDependency{
+		{Name: "common", Count: 3, PulledInBy: []string{"app-a", "app-b", "app-c"}},
+		{Name: "util", Count: 3, PulledInBy: []string{"app-a", "app-b", "app-c"}},
+		{Name: "logger", Count: 2, PulledInBy: []string{"app-a", "app-c"}},
+		{Name: "parser", Count: 2, PulledInBy: []string{"app-b", "app-c"}},
+	}
+
+	shared := SharedDependencies(whyGraph, whyDirect)
+	if !reflect.DeepEqual(shared, expected) {
+		t.Errorf("SharedDependencies returned %v, expected %v", shared, expected)
+	}
+}
+
+func TestPulledInBy(t *testing.T) {
+	cases := []struct {
+		name     api.PkgName
+		expected []string
+	}{
+		{"util", []string{"app-a", "app-b", "app-c"}},
+		{"logger", []string{"app-a", "app-c"}},
+		{"app-a", []string{"app-c"}},
+		{"app-b", []string{}},
+		{"missing", []string{}},
+	}
+	for _, c := range cases {
+		pulledInBy := PulledInBy(whyGraph, whyDirect, c.name)
+		if !reflect.DeepEqual(pulledInBy, c.expected) {
+			t.Errorf("PulledInBy(%s) returned %v, expected %v", c.name, pulledInBy, c.expected)
+		}
+	}
+}
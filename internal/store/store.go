@@ -140,6 +140,21 @@ func HasLockfileChanged(b api.LanguageBackend) bool {
 	return hashFile(b.Lockfile) != getLanguageCache(b.Name, b.Alias).LockfileHash
 }
 
+// HasLockfileDrifted returns true if the specfile has changed since
+// the last time UpdateFileHashes was called while the lockfile, which
+// existed then, has not, meaning that the lockfile is likely out of
+// date with the specfile. It returns false if UpdateFileHashes was
+// never called for the backend.
+func HasLockfileDrifted(b api.LanguageBackend) bool {
+	readMaybe()
+	initLanguage(b.Name, b.Alias)
+	cache := getLanguageCache(b.Name, b.Alias)
+	if cache.SpecfileHash == "" || cache.LockfileHash == "" {
+		return false
+	}
+	return hashFile(b.Specfile) != cache.SpecfileHash && hashFile(b.Lockfile) == cache.LockfileHash
+}
+
 // GuessWithCache returns b.Guess(), but re-uses a cached return value
 // if possible. The cache is used if the matches of b.GuessRegexps
 // against b.FilenamePatterns has not changed since the last time
@@ -0,0 +1,135 @@
+// Package testutil holds the helpers that the tests of several
+// packages share: changing into a project directory, and standing in
+// for the registries that api.HttpClient talks to.
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// Chdir changes into dir for the rest of the test. If an earlier
+// test left the working directory deleted, there's nothing to go back
+// to afterwards.
+func Chdir(t *testing.T, dir string) {
+	t.Helper()
+	if cwd, err := os.Getwd(); err == nil {
+		t.Cleanup(func() { _ = os.Chdir(cwd) })
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Transport stands in for the registries in a test. It answers each
+// request whose URL, without any credentials, is in Routes with the
+// body it maps to, and any other request with Fallback, or a 404 if
+// Fallback is nil. The requests it answers are recorded in Requests.
+type Transport struct {
+	Routes   map[string]string
+	Fallback *string
+
+	mu       sync.Mutex
+	Requests []*http.Request
+}
+
+// RoundTrip implements http.RoundTripper.
+func (tr *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr.mu.Lock()
+	tr.Requests = append(tr.Requests, req)
+	tr.mu.Unlock()
+
+	u := *req.URL
+	u.User = nil
+	if body, ok := tr.Routes[u.String()]; ok {
+		return Response(req, http.StatusOK, body), nil
+	}
+	if tr.Fallback != nil {
+		return Response(req, http.StatusOK, *tr.Fallback), nil
+	}
+	return Response(req, http.StatusNotFound, ""), nil
+}
+
+// URLs returns the URLs of the requests made so far.
+func (tr *Transport) URLs() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	urls := []string{}
+	for _, req := range tr.Requests {
+		urls = append(urls, req.URL.String())
+	}
+	return urls
+}
+
+// Response returns a response to req with the given status and body.
+func Response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// Serve makes api.HttpClient answer requests from routes for the
+// rest of the test, as a Transport. It returns the Transport.
+func Serve(t *testing.T, routes map[string]string) *Transport {
+	t.Helper()
+	tr := &Transport{Routes: routes}
+	setTransport(t, tr)
+	return tr
+}
+
+// ServeFiles is like Serve, but routes map URLs to the files whose
+// contents are the bodies of their responses.
+func ServeFiles(t *testing.T, routes map[string]string) *Transport {
+	t.Helper()
+	bodies := map[string]string{}
+	for url, name := range routes {
+		contents, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[url] = string(contents)
+	}
+	return Serve(t, bodies)
+}
+
+// ServeAll makes api.HttpClient answer every request with body for
+// the rest of the test. It returns the Transport.
+func ServeAll(t *testing.T, body string) *Transport {
+	t.Helper()
+	tr := &Transport{Fallback: &body}
+	setTransport(t, tr)
+	return tr
+}
+
+// Offline makes every request of api.HttpClient fail the test, for
+// the rest of the test.
+func Offline(t *testing.T) {
+	t.Helper()
+	setTransport(t, offlineTransport{t})
+}
+
+type offlineTransport struct {
+	t *testing.T
+}
+
+func (o offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.t.Errorf("unexpected request to %s", req.URL)
+	return nil, errors.New("network access is disabled in this test")
+}
+
+func setTransport(t *testing.T, transport http.RoundTripper) {
+	previous := api.HttpClient.Transport
+	api.HttpClient.Transport = transport
+	t.Cleanup(func() { api.HttpClient.Transport = previous })
+}
@@ -1,11 +1,16 @@
 package util
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/kballard/go-shellquote"
+	"github.com/replit/upm/internal/config"
 )
 
 // quoteCmd escapes shell characters in a command. Additionally, it
@@ -21,11 +26,95 @@ func quoteCmd(cmd []string) string {
 	return shellquote.Join(cleanedCmd...)
 }
 
+// packageManagers are the programs that localCommand looks for in
+// the project. Other programs that upm runs, such as sh, git or
+// python3, always come from PATH, so that a script or virtualenv of
+// the project can't stand in for them.
+var packageManagers = map[string]bool{
+	"bun":         true,
+	"bundle":      true,
+	"cargo":       true,
+	"cask":        true,
+	"composer":    true,
+	"dart":        true,
+	"dotnet":      true,
+	"gleam":       true,
+	"mvn":         true,
+	"npm":         true,
+	"pip":         true,
+	"pip-compile": true,
+	"pip-sync":    true,
+	"pnpm":        true,
+	"poetry":      true,
+	"uv":          true,
+	"yarn":        true,
+}
+
+// localCommand returns cmd with the package manager replaced by the
+// executable of the same name in the first of the config.PMPath
+// directories that has one, so that a package manager pinned by the
+// project is preferred over the global one. Other programs, and
+// programs given as paths, are left alone.
+func localCommand(cmd []string) []string {
+	if !packageManagers[cmd[0]] {
+		return cmd
+	}
+	for _, dir := range config.PMPath {
+		if path := filepath.Join(dir, cmd[0]); IsExecutable(path) {
+			return append([]string{path}, cmd[1:]...)
+		}
+	}
+	return cmd
+}
+
+// newCommand returns the exec.Cmd that runs cmd, in an environment
+// where the variables of config.Env and config.DefaultEnv are set
+// unless the environment of upm already sets them.
+func newCommand(cmd []string) *exec.Cmd {
+	command := exec.Command(cmd[0], cmd[1:]...)
+	command.Env = commandEnv()
+	return command
+}
+
+// commandEnv returns the environment of upm with the variables of
+// config.DefaultEnv and config.Env, the latter taking precedence,
+// added where it doesn't already set them.
+func commandEnv() []string {
+	vars := map[string]string{}
+	for key, value := range config.DefaultEnv {
+		vars[key] = value
+	}
+	for key, value := range config.Env {
+		vars[key] = value
+	}
+	keys := []string{}
+	for key := range vars {
+		if _, ok := os.LookupEnv(key); !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	env := os.Environ()
+	for _, key := range keys {
+		env = append(env, key+"="+vars[key])
+	}
+	return env
+}
+
+// IsExecutable returns true if path is a regular file (or a link to
+// one) that can be executed.
+func IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0
+}
+
 // RunCmd prints and runs the given command, exiting the process on
 // error or command failure. Stdout and stderr go to the terminal.
 func RunCmd(cmd []string) {
+	cmd = localCommand(cmd)
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
+	command := newCommand(cmd)
 	command.Stdout = os.Stderr
 	command.Stderr = os.Stderr
 	if err := command.Run(); err != nil {
@@ -33,17 +122,65 @@ func RunCmd(cmd []string) {
 	}
 }
 
+// RunCmdInteractive prints and runs the given command with the
+// terminal as its stdin, stdout and stderr, and returns its exit
+// code. It exits the process if the command can't be run at all.
+func RunCmdInteractive(cmd []string) int {
+	cmd = localCommand(cmd)
+	ProgressMsg(quoteCmd(cmd))
+	command := newCommand(cmd)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		Die("%s", err)
+	}
+	return 0
+}
+
+// RunCmdFallible prints and runs the given command like RunCmd, with
+// stdout and stderr going to the terminal, and also returns them
+// interleaved so that the caller can diagnose a failure.
+// RunCmdFallible does not exit the process on error or command
+// failure, but instead returns an error.
+func RunCmdFallible(cmd []string) ([]byte, error) {
+	cmd = localCommand(cmd)
+	ProgressMsg(quoteCmd(cmd))
+	var output bytes.Buffer
+	command := newCommand(cmd)
+	command.Stdout = io.MultiWriter(os.Stderr, &output)
+	command.Stderr = command.Stdout
+	err := command.Run()
+	return output.Bytes(), err
+}
+
 // GetCmdOutputFallible prints and runs the given command, returning its
 // stdout as a string. Stderr goes to the terminal. GetCmdOutputFallible
 // does not exit the process on error or command failure, but instead
 // returns an error.
 func GetCmdOutputFallible(cmd []string) ([]byte, error) {
+	cmd = localCommand(cmd)
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
+	command := newCommand(cmd)
 	command.Stderr = os.Stderr
 	return command.Output()
 }
 
+// GetCmdCombinedOutputFallible prints and runs the given command,
+// returning its stdout and stderr interleaved as a single string.
+// This is useful for commands that report diagnostics on stderr.
+// GetCmdCombinedOutputFallible does not exit the process on error or
+// command failure, but instead returns an error.
+func GetCmdCombinedOutputFallible(cmd []string) ([]byte, error) {
+	cmd = localCommand(cmd)
+	ProgressMsg(quoteCmd(cmd))
+	command := newCommand(cmd)
+	return command.CombinedOutput()
+}
+
 // GetCmdOutput prints and runs the given command, returning its
 // stdout as a string. Stderr goes to the terminal. GetCmdOutput exits
 // the process on error or command failure.
@@ -58,8 +195,9 @@ func GetCmdOutput(cmd []string) []byte {
 // GetExitCode runs a commands, and optionally prints the output to
 // stdout and/or stderr, and it returns the exit code afterwards.
 func GetExitCode(cmd []string, printStdout bool, printStderr bool) int {
+	cmd = localCommand(cmd)
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
+	command := newCommand(cmd)
 	if printStdout {
 		command.Stdout = os.Stdout
 	}
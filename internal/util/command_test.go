@@ -0,0 +1,103 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// writeTool writes an executable script named tool into dir that
+// prints output.
+func writeTool(t *testing.T, dir string, tool string, output string) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho " + output + "\n"
+	if err := os.WriteFile(filepath.Join(dir, tool), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalCommand(t *testing.T) {
+	global := t.TempDir()
+	writeTool(t, global, "npm", "global")
+	writeTool(t, global, "tool", "global")
+	t.Setenv("PATH", global+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	project := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+
+	previous := config.PMPath
+	t.Cleanup(func() { config.PMPath = previous })
+
+	if output := string(GetCmdOutput([]string{"npm"})); output != "global\n" {
+		t.Errorf("expected the global npm without a local one, got %q", output)
+	}
+
+	writeTool(t, filepath.Join("node_modules", ".bin"), "npm", "local")
+	if output := string(GetCmdOutput([]string{"npm"})); output != "local\n" {
+		t.Errorf("expected node_modules/.bin/npm to be preferred, got %q", output)
+	}
+
+	// Only package managers are looked for in the project.
+	writeTool(t, filepath.Join("node_modules", ".bin"), "tool", "local")
+	if output := string(GetCmdOutput([]string{"tool"})); output != "global\n" {
+		t.Errorf("expected the global tool, which isn't a package manager, got %q", output)
+	}
+
+	config.PMPath = []string{}
+	if output := string(GetCmdOutput([]string{"npm"})); output != "global\n" {
+		t.Errorf("expected the global npm with an empty pm_path, got %q", output)
+	}
+
+	// Programs given as paths are run as they are.
+	config.PMPath = previous
+	if output := string(GetCmdOutput([]string{filepath.Join(global, "npm")})); output != "global\n" {
+		t.Errorf("expected the npm at the given path, got %q", output)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	defaults, env := config.DefaultEnv, config.Env
+	t.Cleanup(func() { config.DefaultEnv, config.Env = defaults, env })
+	for _, key := range []string{"UPM_TEST_DEFAULT", "UPM_TEST_CONFIG", "UPM_TEST_USER"} {
+		t.Setenv(key, "")
+		if err := os.Unsetenv(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	printEnv := []string{"sh", "-c", "echo $UPM_TEST_DEFAULT $UPM_TEST_CONFIG $UPM_TEST_USER"}
+
+	config.DefaultEnv = map[string]string{
+		"UPM_TEST_DEFAULT": "default",
+		"UPM_TEST_CONFIG":  "default",
+		"UPM_TEST_USER":    "default",
+	}
+	config.Env = map[string]string{}
+	if output := string(GetCmdOutput(printEnv)); output != "default default default\n" {
+		t.Errorf("expected the defaults to be set, got %q", output)
+	}
+
+	// The project configuration overrides the defaults, and the
+	// environment overrides both.
+	config.Env = map[string]string{"UPM_TEST_CONFIG": "config", "UPM_TEST_USER": "config"}
+	t.Setenv("UPM_TEST_USER", "user")
+	if output := string(GetCmdOutput(printEnv)); output != "default config user\n" {
+		t.Errorf("expected the configuration and environment to take precedence, got %q", output)
+	}
+
+	// A variable set to the empty string is still set.
+	t.Setenv("UPM_TEST_DEFAULT", "")
+	if output := string(GetCmdOutput(printEnv)); output != "config user\n" {
+		t.Errorf("expected an empty variable to be left alone, got %q", output)
+	}
+}
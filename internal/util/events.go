@@ -0,0 +1,118 @@
+package util
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Kinds of the events that are streamed with --format ndjson.
+const (
+	// A phase of the command, such as "lock" or "install", began
+	// or ended.
+	EventPhaseStart = "phase-start"
+	EventPhaseEnd   = "phase-end"
+
+	// A step of the command, such as running a program, with the
+	// message that is printed for it.
+	EventProgress = "progress"
+
+	// A package was handled by the phase, such as installed.
+	EventPackage = "package"
+
+	// A warning was reported, with its code and message.
+	EventWarning = "warning"
+
+	// The command finished, with status "ok" or "error" and, for
+	// the latter, the error message, along with the warnings it
+	// reported. It is always the last event.
+	EventResult = "result"
+)
+
+// Event is one line of the NDJSON stream of a command run with
+// --format ndjson.
+type Event struct {
+	// What happened, one of the Event* kinds.
+	Event string `json:"event"`
+
+	// The phase that the event belongs to, if any.
+	Phase string `json:"phase,omitempty"`
+
+	// The package that the event is about, if any, and its version
+	// if known.
+	Package string `json:"package,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	// The code of a warning.
+	Code string `json:"code,omitempty"`
+
+	// "ok" or "error", for the result.
+	Status string `json:"status,omitempty"`
+
+	// The message of a progress event, warning or error.
+	Message string `json:"message,omitempty"`
+
+	// The warnings reported while running the command, for the
+	// result.
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// events is where events are streamed, or nil if they aren't, and
+// phase is the phase in progress.
+var (
+	eventsMu sync.Mutex
+	events   *json.Encoder
+	phase    string
+)
+
+// StreamEvents makes the events of the command be written to w as
+// they occur, as NDJSON. A nil w stops streaming them.
+func StreamEvents(w io.Writer) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	events = nil
+	phase = ""
+	if w != nil {
+		events = json.NewEncoder(w)
+	}
+}
+
+// Emit streams the event if StreamEvents was called, and otherwise
+// does nothing. Events other than the start and end of a phase are
+// attributed to the phase in progress, if any.
+func Emit(e Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if events == nil {
+		return
+	}
+	if e.Phase == "" {
+		e.Phase = phase
+	}
+	// There is nowhere left to report a failure to write.
+	_ = events.Encode(e)
+}
+
+// StartPhase emits the start of the named phase of the command, and
+// returns the function that emits its end.
+func StartPhase(name string) func() {
+	Emit(Event{Event: EventPhaseStart, Phase: name})
+	eventsMu.Lock()
+	previous := phase
+	phase = name
+	eventsMu.Unlock()
+	return func() {
+		eventsMu.Lock()
+		phase = previous
+		eventsMu.Unlock()
+		Emit(Event{Event: EventPhaseEnd, Phase: name})
+	}
+}
+
+// IsStreamingEvents reports whether events are being streamed, for
+// callers that would have to do extra work to emit them.
+func IsStreamingEvents() bool {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return events != nil
+}
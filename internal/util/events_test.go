@@ -0,0 +1,36 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	// Nothing is emitted until events are streamed.
+	Emit(Event{Event: EventProgress, Message: "dropped"})
+
+	var out bytes.Buffer
+	StreamEvents(&out)
+	t.Cleanup(func() { StreamEvents(nil) })
+
+	endLock := StartPhase("lock")
+	endInstall := StartPhase("install")
+	ProgressMsg("npm ci")
+	endInstall()
+	Warn(context.Background(), Warning{Code: WarningDeprecated, Message: "request is deprecated", Package: "request"})
+	endLock()
+	Emit(Event{Event: EventResult, Status: "ok"})
+
+	expected := `{"event":"phase-start","phase":"lock"}
+{"event":"phase-start","phase":"install"}
+{"event":"progress","phase":"install","message":"npm ci"}
+{"event":"phase-end","phase":"install"}
+{"event":"warning","phase":"lock","package":"request","code":"deprecated","message":"request is deprecated"}
+{"event":"phase-end","phase":"lock"}
+{"event":"result","status":"ok"}
+`
+	if out.String() != expected {
+		t.Errorf("expected events\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -50,6 +50,45 @@ func AddIngoredPaths(paths []string) {
 	IgnoredPaths = append(IgnoredPaths, paths...)
 }
 
+// gitSubmodulePath matches a path line in .gitmodules, capturing the
+// path, and gitConfigSection matches a section header, capturing the
+// section's name.
+var (
+	gitSubmodulePath = regexp.MustCompile(`^\s*path\s*=\s*(.*?)\s*$`)
+	gitConfigSection = regexp.MustCompile(`^\s*\[\s*([^\s\]]+)`)
+)
+
+// GitSubmodulePaths returns the set of paths, relative to dir and
+// slash-separated, of the git submodules declared in dir/.gitmodules.
+// Projects that vendor their dependencies as submodules don't want
+// the imports in them guessed, so the searches below skip these
+// directories, just like IgnoredPaths. Only the path lines of
+// [submodule "..."] sections are read. A missing or unreadable
+// .gitmodules declares no submodules.
+func GitSubmodulePaths(dir string) map[string]bool {
+	paths := map[string]bool{}
+	contentsB, err := os.ReadFile(filepath.Join(dir, ".gitmodules"))
+	if err != nil {
+		return paths
+	}
+	inSubmodule := false
+	for _, line := range strings.Split(string(contentsB), "\n") {
+		if match := gitConfigSection.FindStringSubmatch(line); match != nil {
+			inSubmodule = strings.EqualFold(match[1], "submodule")
+			continue
+		}
+		match := gitSubmodulePath.FindStringSubmatch(line)
+		if !inSubmodule || match == nil {
+			continue
+		}
+		submodule := strings.Trim(match[1], `"`)
+		if submodule != "" {
+			paths[path.Clean(filepath.ToSlash(submodule))] = true
+		}
+	}
+	return paths
+}
+
 // TryWriteAtomic tries to write contents to filename atomically,
 // retrying non-atomically if it can't. If both attempts fail,
 // TryWriteAtomic terminates the process.
@@ -88,14 +127,18 @@ func PatternExists(pattern string) bool {
 // directory. Only files whose basenames match one of the globs in
 // patterns will be searched. The return value is a list of matches as
 // would be returned by regexp.FindAllStringSubmatch. Matches are
-// returned in a deterministic order. If an I/O error occurs,
-// SearchRecursive terminates the process.
+// returned in a deterministic order. Git submodules are skipped. If
+// an I/O error occurs, SearchRecursive terminates the process.
 func SearchRecursive(r *regexp.Regexp, patterns []string) [][]string {
 	matches := [][]string{}
+	submodules := GitSubmodulePaths(".")
 	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			Die("%s: %s", path, err)
 		}
+		if info.IsDir() && submodules[filepath.ToSlash(path)] {
+			return filepath.SkipDir
+		}
 		for _, name := range IgnoredPaths {
 			if filepath.Base(path) == name {
 				return filepath.SkipDir
@@ -204,13 +247,18 @@ func WriteResource(url string, tempdir string) string {
 	return filename
 }
 
-// ChdirToUPM traverses upwards in the filesystem from the current
-// directory until it finds a directory entry named .upm, and changes
-// to the directory containing it. If it doesn't find any such
-// directory entry, ChdirToUPM doesn't do anything.  If UPM_PROJECT is
-// set, it is used as the directory to which to change.
-func ChdirToUPM() {
-	if dir := os.Getenv("UPM_PROJECT"); dir != "" {
+// ChdirToUPM changes to the root of the project. If root is
+// nonempty, or else UPM_PROJECT_ROOT or UPM_PROJECT is set, that is
+// the directory to which to change. Otherwise, ChdirToUPM traverses
+// upwards in the filesystem from the current directory until it
+// finds a directory entry named .upm, and changes to the directory
+// containing it. If it doesn't find any such directory entry,
+// ChdirToUPM doesn't do anything.
+func ChdirToUPM(root string) {
+	for _, dir := range []string{root, os.Getenv("UPM_PROJECT_ROOT"), os.Getenv("UPM_PROJECT")} {
+		if dir == "" {
+			continue
+		}
 		if err := os.Chdir(dir); err != nil {
 			Die("%s", err)
 		}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChdirToUPM(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"flag", "root", "project", filepath.Join("found", ".upm"), filepath.Join("found", "sub")} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		flag, projectRoot, project string
+		expected                   string
+	}{
+		{"", "", "", "found"},
+		{"", "", "project", "project"},
+		{"", "root", "project", "root"},
+		{"flag", "root", "project", "flag"},
+	}
+	for _, tc := range tcs {
+		abs := func(dir string) string {
+			if dir == "" {
+				return ""
+			}
+			return filepath.Join(root, dir)
+		}
+		t.Setenv("UPM_PROJECT_ROOT", abs(tc.projectRoot))
+		t.Setenv("UPM_PROJECT", abs(tc.project))
+		if err := os.Chdir(filepath.Join(root, "found", "sub")); err != nil {
+			t.Fatal(err)
+		}
+		ChdirToUPM(abs(tc.flag))
+		dir, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir != abs(tc.expected) {
+			t.Errorf("with --cwd=%q, UPM_PROJECT_ROOT=%q and UPM_PROJECT=%q: expected %s, got %s",
+				tc.flag, tc.projectRoot, tc.project, abs(tc.expected), dir)
+		}
+	}
+}
+
+func TestGitSubmodulePaths(t *testing.T) {
+	dir := t.TempDir()
+	gitmodules := "[submodule \"vendor-lib\"]\n\tpath = lib/vendored\n\turl = https://example.com/vendored.git\n" +
+		"[submodule \"extern\"]\n\tpath = extern\n[lfs]\n\tpath = lib/own\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the paths of submodule sections count.
+	expected := map[string]bool{"lib/vendored": true, "extern": true}
+	if paths := GitSubmodulePaths(dir); !reflect.DeepEqual(expected, paths) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+	if paths := GitSubmodulePaths(t.TempDir()); len(paths) != 0 {
+		t.Errorf("expected no submodules without .gitmodules, got %v", paths)
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// LockfileVersionError returns an error if the format version of the
+// given lockfile is outside the range from min to max (inclusive)
+// that the backend knows how to parse, and nil otherwise.
+func LockfileVersionError(lockfile string, version int, min int, max int) error {
+	if version >= min && version <= max {
+		return nil
+	}
+	return fmt.Errorf(
+		"%s: lockfile version %d is not supported (expected %d to %d); results may be incomplete",
+		lockfile, version, min, max,
+	)
+}
+
+// WarnOrDie reports err, a lockfile version error, as a warning, or
+// terminates the process if --strict was passed on the command line.
+// If err is nil, WarnOrDie does nothing.
+func WarnOrDie(err error) {
+	if err == nil {
+		return
+	}
+	if config.Strict {
+		Die("%s", err)
+	}
+	Warn(context.Background(), Warning{Code: WarningLockfileVersion, Message: err.Error()})
+}
+
+// LockfileWouldChange copies the given files from the current
+// directory into a temporary directory, runs lock there, and reports
+// whether that changed (or created) the lockfile, which must be one
+// of the files. Files may be in subdirectories, which are created as
+// needed, and files that don't exist are not copied. Nothing in the
+// current directory is modified.
+func LockfileWouldChange(files []string, lockfile string, lock func()) bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		Die("%s", err)
+	}
+	tempdir := TempDir()
+	defer os.RemoveAll(tempdir)
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			Die("%s", err)
+		}
+		if err := os.MkdirAll(filepath.Join(tempdir, filepath.Dir(file)), 0o777); err != nil {
+			Die("%s", err)
+		}
+		if err := os.WriteFile(filepath.Join(tempdir, file), contents, 0o666); err != nil {
+			Die("%s", err)
+		}
+	}
+	before, beforeErr := os.ReadFile(lockfile)
+
+	if err := os.Chdir(tempdir); err != nil {
+		Die("%s", err)
+	}
+	defer func() {
+		if err := os.Chdir(cwd); err != nil {
+			Die("%s", err)
+		}
+	}()
+	lock()
+
+	after, err := os.ReadFile(lockfile)
+	if err != nil {
+		return true
+	}
+	return beforeErr != nil || !bytes.Equal(before, after)
+}
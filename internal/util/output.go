@@ -16,15 +16,19 @@ func Log(a ...interface{}) {
 }
 
 // ProgressMsg prints the given message to stderr with a prefix. The
-// message is inhibited in --quiet mode, however.
+// message is inhibited in --quiet mode, however. It is also emitted
+// as a progress event, regardless of --quiet.
 func ProgressMsg(msg string) {
 	Log("-->", msg)
+	Emit(Event{Event: EventProgress, Message: msg})
 }
 
 // Die is like fmt.Printf, but writes to stderr, adds a newline, and
-// terminates the process.
+// terminates the process. The message is also emitted as the error
+// result of the command.
 func Die(format string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	Emit(Event{Event: EventResult, Status: "error", Message: fmt.Sprintf(format, a...), Warnings: commandWarningsList()})
 	os.Exit(1)
 }
 
@@ -0,0 +1,509 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// jsonMember is one key-value pair of a JSON object, with the value
+// left unparsed so that it can be written back out as it was.
+type jsonMember struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// decodeJSONObject parses a JSON object into its members, in the
+// order they appear.
+func decodeJSONObject(contents []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	members := []jsonMember{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a key, got %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, jsonMember{key, value})
+	}
+	return members, nil
+}
+
+// encodeJSONObject is the inverse of decodeJSONObject, writing each
+// member on its own line with the given indentation.
+func encodeJSONObject(members []jsonMember, prefix string, indent string) ([]byte, error) {
+	if len(members) == 0 {
+		return []byte("{}"), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, member := range members {
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		var value bytes.Buffer
+		if err := json.Indent(&value, member.Value, prefix+indent, indent); err != nil {
+			return nil, err
+		}
+		buf.WriteString(prefix + indent)
+		buf.Write(key)
+		buf.WriteString(": ")
+		buf.Write(value.Bytes())
+		if i < len(members)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(prefix + "}")
+	return buf.Bytes(), nil
+}
+
+// jsonIndentPattern matches the indentation of the first member of a
+// JSON object.
+var jsonIndentPattern = regexp.MustCompile(`\{\s*?\n([ \t]+)"`)
+
+// jsonIndent returns the indentation used by contents, a JSON
+// object, defaulting to two spaces.
+func jsonIndent(contents []byte) string {
+	if match := jsonIndentPattern.FindSubmatch(contents); match != nil {
+		return string(match[1])
+	}
+	return "  "
+}
+
+// SortJSONObjects returns contents, a JSON object, with the members
+// of each of the objects under the given keys sorted by name. The
+// whole document is rewritten with one member per line, indented the
+// same way as contents, and ends with a newline. Keys that are
+// missing or don't hold objects are left alone.
+func SortJSONObjects(contents []byte, keys []string) ([]byte, error) {
+	indent := jsonIndent(contents)
+	members, err := decodeJSONObject(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, member := range members {
+		sortable := false
+		for _, key := range keys {
+			if member.Key == key {
+				sortable = true
+			}
+		}
+		if !sortable || !bytes.HasPrefix(bytes.TrimSpace(member.Value), []byte("{")) {
+			continue
+		}
+
+		inner, err := decodeJSONObject(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", member.Key, err)
+		}
+		sort.SliceStable(inner, func(a, b int) bool { return inner[a].Key < inner[b].Key })
+		members[i].Value, err = encodeJSONObject(inner, "", indent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := encodeJSONObject(members, "", indent)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, '\n'), nil
+}
+
+// SetJSONObjectEntries returns contents, a JSON object, with the
+// given string entries set in the object under key (which is created
+// if necessary). Existing members keep their order, and new entries
+// are added at the end in sorted order. The result is indented the
+// same way as contents, defaulting to two spaces, and ends with a
+// newline. Empty contents are treated as an empty object.
+func SetJSONObjectEntries(contents []byte, key string, entries map[string]string) ([]byte, error) {
+	values := map[string]interface{}{}
+	for name, value := range entries {
+		values[name] = value
+	}
+	return SetJSONObjectValues(contents, key, values)
+}
+
+// SetJSONObjectValues is like SetJSONObjectEntries, but the entries
+// may be any values that can be marshalled to JSON.
+func SetJSONObjectValues(contents []byte, key string, entries map[string]interface{}) ([]byte, error) {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		contents = []byte("{}")
+	}
+	indent := jsonIndent(contents)
+
+	members, err := decodeJSONObject(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	inner := []jsonMember{}
+	for i, member := range members {
+		if member.Key == key {
+			index = i
+			inner, err = decodeJSONObject(member.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			break
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := json.Marshal(entries[name])
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i := range inner {
+			if inner[i].Key == name {
+				inner[i].Value = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			inner = append(inner, jsonMember{name, value})
+		}
+	}
+
+	innerB, err := encodeJSONObject(inner, "", indent)
+	if err != nil {
+		return nil, err
+	}
+	if index >= 0 {
+		members[index].Value = innerB
+	} else {
+		members = append(members, jsonMember{key, innerB})
+	}
+
+	result, err := encodeJSONObject(members, "", indent)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, '\n'), nil
+}
+
+// bareTOMLKey matches keys that don't need to be quoted in TOML.
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlTableHeader matches the header of any TOML table or array of
+// tables.
+var tomlTableHeader = regexp.MustCompile(`^\s*\[`)
+
+// TOMLKey returns key in a form suitable for the left-hand side of a
+// TOML key-value pair, quoting it if necessary.
+func TOMLKey(key string) string {
+	if bareTOMLKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+// SetTOMLTableEntries returns contents, a TOML document, with the
+// given entries set in the named table (e.g. "tool.poetry.dependencies"),
+// which is created at the end of the document if necessary. The
+// entries map keys to TOML values, which are written out verbatim,
+// so strings must already be quoted. Only lines for the affected
+// keys are touched, so the rest of the document keeps its
+// formatting. Entries whose current value spans several lines are
+// not supported.
+func SetTOMLTableEntries(contents []byte, table string, entries map[string]string) ([]byte, error) {
+	headerPattern := regexp.MustCompile(`^\s*\[\s*` + regexp.QuoteMeta(table) + `\s*\]\s*(#.*)?$`)
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := strings.TrimRight(string(contents), "\n")
+	lines := []string{}
+	if text != "" {
+		lines = strings.Split(text, "\n")
+	}
+
+	header := -1
+	for i, line := range lines {
+		if headerPattern.MatchString(line) {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+table+"]")
+		header = len(lines) - 1
+	}
+
+	for _, name := range names {
+		entry := TOMLKey(name) + " = " + entries[name]
+		keyPattern := regexp.MustCompile(
+			`^\s*("` + regexp.QuoteMeta(name) + `"|'` + regexp.QuoteMeta(name) + `'|` + regexp.QuoteMeta(name) + `)\s*=`,
+		)
+
+		end := len(lines)
+		for i := header + 1; i < len(lines); i++ {
+			if tomlTableHeader.MatchString(lines[i]) {
+				end = i
+				break
+			}
+		}
+
+		replaced := false
+		last := header
+		for i := header + 1; i < end; i++ {
+			if keyPattern.MatchString(lines[i]) {
+				lines[i] = entry
+				replaced = true
+				break
+			}
+			if strings.TrimSpace(lines[i]) != "" {
+				last = i
+			}
+		}
+		if replaced {
+			continue
+		}
+
+		// Add the entry after the last one in the table, ahead
+		// of any blank lines separating it from the next one.
+		lines = append(lines[:last+1], append([]string{entry}, lines[last+1:]...)...)
+	}
+
+	edited := []byte(strings.Join(lines, "\n") + "\n")
+
+	// Make sure that the edit produced a valid document.
+	var check map[string]interface{}
+	if _, err := toml.Decode(string(UndotTOMLKeys(edited)), &check); err != nil {
+		return nil, fmt.Errorf("could not add to [%s]: %s", table, err)
+	}
+	return edited, nil
+}
+
+// tomlKeyLine matches a line that starts a key-value pair, capturing
+// the key.
+var tomlKeyLine = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|[A-Za-z0-9_.-]+)\s*=`)
+
+// SortTOMLTables returns contents, a TOML document, with the entries
+// of each of the named tables sorted by key, ignoring case as package
+// names usually do, except that the keys in first (such as "python"
+// for Poetry) are kept at the top, in that order. Comments directly
+// above an entry move with it, values that span several lines are
+// kept whole, and blank lines between entries are removed. Tables
+// that don't exist are skipped.
+func SortTOMLTables(contents []byte, tables []string, first []string) ([]byte, error) {
+	var before map[string]interface{}
+	if _, err := toml.Decode(string(UndotTOMLKeys(contents)), &before); err != nil {
+		return nil, err
+	}
+
+	rank := map[string]int{}
+	for i, key := range first {
+		rank[key] = i + 1
+	}
+
+	lines := strings.Split(string(contents), "\n")
+	for _, table := range tables {
+		headerPattern := regexp.MustCompile(`^\s*\[\s*` + regexp.QuoteMeta(table) + `\s*\]\s*(#.*)?$`)
+		header := -1
+		for i, line := range lines {
+			if headerPattern.MatchString(line) {
+				header = i
+				break
+			}
+		}
+		if header < 0 {
+			continue
+		}
+		end := len(lines)
+		for i := header + 1; i < len(lines); i++ {
+			if tomlTableHeader.MatchString(lines[i]) {
+				end = i
+				break
+			}
+		}
+		// Blank lines and comments separating the table from
+		// the next one stay where they are.
+		last := end
+		for last > header+1 && (strings.TrimSpace(lines[last-1]) == "" || strings.HasPrefix(strings.TrimSpace(lines[last-1]), "#")) {
+			last--
+		}
+
+		type entry struct {
+			key   string
+			lines []string
+		}
+		entries := []entry{}
+		pending := []string{}
+		for _, line := range lines[header+1 : last] {
+			trimmed := strings.TrimSpace(line)
+			switch {
+			case trimmed == "":
+				continue
+			case strings.HasPrefix(trimmed, "#"):
+				pending = append(pending, line)
+			case tomlKeyLine.MatchString(line) && (len(entries) == 0 || !continues(entries[len(entries)-1].lines)):
+				key := tomlKeyLine.FindStringSubmatch(line)[1]
+				key = strings.Trim(key, `"'`)
+				entries = append(entries, entry{key, append(pending, line)})
+				pending = []string{}
+			default:
+				if len(entries) == 0 {
+					return nil, fmt.Errorf("[%s]: unexpected line %q", table, line)
+				}
+				entries[len(entries)-1].lines = append(entries[len(entries)-1].lines, append(pending, line)...)
+				pending = []string{}
+			}
+		}
+		if len(pending) > 0 {
+			return nil, fmt.Errorf("[%s]: could not sort around trailing comments", table)
+		}
+
+		sort.SliceStable(entries, func(a, b int) bool {
+			rankA, rankB := rank[entries[a].key], rank[entries[b].key]
+			if rankA != 0 || rankB != 0 {
+				return rankA != 0 && (rankB == 0 || rankA < rankB)
+			}
+			return strings.ToLower(entries[a].key) < strings.ToLower(entries[b].key)
+		})
+
+		sorted := []string{}
+		for _, entry := range entries {
+			sorted = append(sorted, entry.lines...)
+		}
+		rest := append(sorted, lines[last:]...)
+		lines = append(lines[:header+1], rest...)
+	}
+
+	edited := []byte(strings.Join(lines, "\n"))
+
+	// Make sure that sorting didn't change what the document says.
+	var after map[string]interface{}
+	if _, err := toml.Decode(string(UndotTOMLKeys(edited)), &after); err != nil {
+		return nil, fmt.Errorf("could not sort: %s", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		return nil, fmt.Errorf("could not sort without changing the document")
+	}
+	return edited, nil
+}
+
+// continues returns true if the last of the given lines of a
+// key-value pair leaves a multi-line array or string open, so that
+// the next line belongs to the same value.
+func continues(lines []string) bool {
+	text := strings.Join(lines, "\n")
+	if strings.Count(text, `"""`)%2 == 1 || strings.Count(text, `'''`)%2 == 1 {
+		return true
+	}
+	return strings.Count(text, "[") > strings.Count(text, "]")
+}
+
+// dottedTOMLKeyLine matches a line that starts a key-value pair whose
+// key is made of two bare keys joined by a dot, capturing them and
+// the value.
+var dottedTOMLKeyLine = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*\.\s*([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+
+// UndotTOMLKeys returns contents, a TOML document, with each group of
+// dotted keys sharing a first key in the same table (such as
+// version.workspace = true) rewritten as an inline table under that
+// key, so that it can be decoded by our TOML library, which predates
+// dotted keys. Keys with more than one dot are left alone. The result
+// is only meant for decoding, since the layout and comments of the
+// rewritten lines aren't kept.
+func UndotTOMLKeys(contents []byte) []byte {
+	lines := strings.Split(string(contents), "\n")
+	result := []string{}
+	// For each first key in the current table, the index in
+	// result of the inline table that collects its entries.
+	groups := map[string]int{}
+	entries := map[int][]string{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if tomlTableHeader.MatchString(line) {
+			groups = map[string]int{}
+			result = append(result, line)
+			continue
+		}
+		match := dottedTOMLKeyLine.FindStringSubmatch(line)
+		if match == nil {
+			result = append(result, line)
+			continue
+		}
+		value := []string{match[3]}
+		for continues(value) && i+1 < len(lines) {
+			i++
+			value = append(value, lines[i])
+		}
+		value[len(value)-1] = stripTOMLComment(value[len(value)-1])
+		entry := match[2] + " = " + strings.TrimSpace(strings.Join(value, "\n"))
+
+		group, ok := groups[match[1]]
+		if !ok {
+			group = len(result)
+			groups[match[1]] = group
+			result = append(result, "")
+		}
+		entries[group] = append(entries[group], entry)
+		result[group] = match[1] + " = { " + strings.Join(entries[group], ", ") + " }"
+	}
+	return []byte(strings.Join(result, "\n"))
+}
+
+// stripTOMLComment returns line without any comment at its end.
+func stripTOMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
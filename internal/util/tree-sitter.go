@@ -26,6 +26,7 @@ type importPragma struct {
 // GuessWithTreeSitter guesses the imports of a directory using tree-sitter.
 // For every file in dir that matches a pattern in searchGlobPatterns, but
 // not in ignoreGlobPatterns, it will parse the file using lang and queryImports.
+// Files in git submodules are skipped.
 // When there's a capture tagged as `@import`, it reports the capture as an import.
 // If there's a capture tagged as `@pragma` that's on the same line as an import,
 // it will include the pragma in the results.
@@ -33,32 +34,9 @@ func GuessWithTreeSitter(ctx context.Context, dir string, lang *sitter.Language,
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "GuessWithTreeSitter")
 	defer span.Finish()
-	dirFS := os.DirFS(dir)
-
-	ignoredPaths := map[string]bool{}
-	for _, pattern := range ignoreGlobPatterns {
-		globIgnorePaths, err := fs.Glob(dirFS, pattern)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, gPath := range globIgnorePaths {
-			ignoredPaths[gPath] = true
-		}
-	}
-
-	pathsToSearch := []string{}
-	for _, pattern := range searchGlobPatterns {
-		globSearchPaths, err := fs.Glob(dirFS, pattern)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, gPath := range globSearchPaths {
-			if !ignoredPaths[gPath] {
-				pathsToSearch = append(pathsToSearch, path.Join(dir, gPath))
-			}
-		}
+	pathsToSearch, err := GuessPaths(dir, searchGlobPatterns, ignoreGlobPatterns)
+	if err != nil {
+		return nil, err
 	}
 
 	query, err := sitter.NewQuery([]byte(queryImports), lang)
@@ -100,6 +78,55 @@ func GuessWithTreeSitter(ctx context.Context, dir string, lang *sitter.Language,
 	return imports, err
 }
 
+// GuessPaths returns the files that GuessWithTreeSitter parses for
+// the given patterns: those in dir that match a pattern in
+// searchGlobPatterns, but not in ignoreGlobPatterns, and aren't in a
+// git submodule. Backends that find imports by other means use it so
+// that they read the same files.
+func GuessPaths(dir string, searchGlobPatterns, ignoreGlobPatterns []string) ([]string, error) {
+	dirFS := os.DirFS(dir)
+
+	ignoredPaths := map[string]bool{}
+	for _, pattern := range ignoreGlobPatterns {
+		globIgnorePaths, err := fs.Glob(dirFS, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, gPath := range globIgnorePaths {
+			ignoredPaths[gPath] = true
+		}
+	}
+	submodules := GitSubmodulePaths(dir)
+
+	pathsToSearch := []string{}
+	for _, pattern := range searchGlobPatterns {
+		globSearchPaths, err := fs.Glob(dirFS, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, gPath := range globSearchPaths {
+			if !ignoredPaths[gPath] && !inSubmodule(gPath, submodules) {
+				pathsToSearch = append(pathsToSearch, path.Join(dir, gPath))
+			}
+		}
+	}
+
+	return pathsToSearch, nil
+}
+
+// inSubmodule returns true if the slash-separated relPath is inside
+// one of the given submodules.
+func inSubmodule(relPath string, submodules map[string]bool) bool {
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if submodules[dir] {
+			return true
+		}
+	}
+	return false
+}
+
 func queryFile(lang *sitter.Language, query *sitter.Query, file string) queryImportsResult {
 	qc := sitter.NewQueryCursor()
 
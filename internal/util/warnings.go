@@ -0,0 +1,119 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Codes of the warnings that upm reports, for JSON consumers to tell
+// them apart.
+const (
+	WarningDeprecated    = "deprecated"
+	WarningRuntimeEOL    = "runtime-eol"
+	WarningBrokenInstall = "broken-install"
+	WarningTyposquat     = "typosquat"
+
+	// A lockfile is in a format version that upm may not parse
+	// completely, or is out of date with the specfile.
+	WarningLockfileVersion = "lockfile-version"
+	WarningLockfileDrift   = "lockfile-drift"
+
+	// An option of the command isn't supported by the backend or
+	// its package manager, and is ignored.
+	WarningUnsupportedOption = "unsupported-option"
+
+	// A package doesn't support the project's version of the
+	// language runtime.
+	WarningIncompatible = "incompatible"
+
+	// A package index or repository couldn't be queried, so its
+	// packages are missing from the results.
+	WarningRegistry = "registry"
+
+	// A package is declared from a catalog that doesn't have it.
+	WarningCatalog = "catalog"
+)
+
+// Warning is a warning about the project or a package, as included
+// in the JSON output of a command.
+type Warning struct {
+	// What kind of warning this is, one of the Warning* codes.
+	Code string `json:"code"`
+
+	// The warning as printed on stderr, without the "warning: "
+	// prefix.
+	Message string `json:"message"`
+
+	// The package the warning is about, if any.
+	Package string `json:"package,omitempty"`
+}
+
+// Warnings collects the warnings reported while running a command.
+type Warnings struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+type warningsKey struct{}
+
+// commandWarnings is the Warnings most recently returned by
+// WithWarnings, which those warnings reported without a context of
+// their own are added to.
+var (
+	commandWarningsMu sync.Mutex
+	commandWarnings   *Warnings
+)
+
+// WithWarnings returns a context whose warnings, as reported by
+// Warn, are collected in the returned Warnings. Warnings reported
+// with a context that has none, such as those of backend code that
+// isn't passed one, are collected there too, until WithWarnings is
+// called again.
+func WithWarnings(ctx context.Context) (context.Context, *Warnings) {
+	w := &Warnings{warnings: []Warning{}}
+	commandWarningsMu.Lock()
+	defer commandWarningsMu.Unlock()
+	commandWarnings = w
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+// Warn prints the warning to stderr, emits it as an event and adds it
+// to the Warnings of ctx, or, if it has none, to those most recently
+// returned by WithWarnings.
+func Warn(ctx context.Context, w Warning) {
+	fmt.Fprintf(os.Stderr, "warning: %s\n", w.Message)
+	Emit(Event{Event: EventWarning, Code: w.Code, Package: w.Package, Message: w.Message})
+	collected, ok := ctx.Value(warningsKey{}).(*Warnings)
+	if !ok {
+		commandWarningsMu.Lock()
+		collected = commandWarnings
+		commandWarningsMu.Unlock()
+	}
+	if collected != nil {
+		collected.mu.Lock()
+		defer collected.mu.Unlock()
+		collected.warnings = append(collected.warnings, w)
+	}
+}
+
+// commandWarningsList returns the warnings collected so far in the
+// Warnings most recently returned by WithWarnings, if any.
+func commandWarningsList() []Warning {
+	commandWarningsMu.Lock()
+	collected := commandWarnings
+	commandWarningsMu.Unlock()
+	if collected == nil {
+		return nil
+	}
+	return collected.List()
+}
+
+// List returns the warnings collected so far, in the order they were
+// reported.
+func (w *Warnings) List() []Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Warning{}, w.warnings...)
+}
@@ -0,0 +1,85 @@
+# This is a Python script which finds the modules imported by the
+# Python files in a project, using the ast module so that imports
+# nested inside functions, conditionals and try blocks are found too.
+# It takes the paths of the files to read as its arguments. It outputs
+# a JSON object with an "imports" key, a list of module names (or
+# package names, when the import carries a "upm package(...)"
+# pragma), and an "errors" key, a list of files that could not be
+# parsed.
+
+from __future__ import print_function
+import ast
+import json
+import re
+import sys
+
+pragma = re.compile(r"#.*upm package\((.*)\)")
+
+
+def dynamic_import(node):
+    """Return the module name of an importlib.import_module("x") or
+    __import__("x") call with a literal argument, or None."""
+    if not isinstance(node, ast.Call) or not node.args:
+        return None
+    func = node.func
+    if isinstance(func, ast.Name):
+        name = func.id
+    elif isinstance(func, ast.Attribute):
+        name = func.attr
+    else:
+        return None
+    if name not in ("import_module", "__import__"):
+        return None
+    arg = node.args[0]
+    if hasattr(ast, "Constant") and isinstance(arg, ast.Constant):
+        value = arg.value
+    elif isinstance(arg, getattr(ast, "Str", ())):
+        value = arg.s
+    else:
+        return None
+    if isinstance(value, str) and not value.startswith("."):
+        return value
+    return None
+
+
+def modules(node):
+    if isinstance(node, ast.Import):
+        return [alias.name for alias in node.names]
+    if isinstance(node, ast.ImportFrom):
+        if node.level == 0 and node.module:
+            return [node.module]
+        return []
+    module = dynamic_import(node)
+    if module:
+        return [module]
+    return []
+
+
+imports = set()
+errors = []
+for path in sys.argv[1:]:
+    try:
+        with open(path, "rb") as f:
+            source = f.read()
+        tree = ast.parse(source, path)
+    except (SyntaxError, ValueError, IOError, OSError):
+        errors.append(path)
+        continue
+    lines = source.decode("utf-8", "replace").splitlines()
+    for node in ast.walk(tree):
+        found = modules(node)
+        if not found:
+            continue
+        # The pragma may sit after the module name or at the
+        # end of a multiline statement.
+        match = None
+        for lineno in (node.lineno, getattr(node, "end_lineno", None)):
+            if lineno and 0 < lineno <= len(lines) and not match:
+                match = pragma.search(lines[lineno - 1])
+        if match:
+            imports.add(match.group(1))
+        else:
+            imports.update(found)
+
+json.dump({"imports": sorted(imports), "errors": errors}, sys.stdout)
+print()
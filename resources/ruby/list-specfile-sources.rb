@@ -0,0 +1,44 @@
+# This is a Ruby script which dumps the source of each gem in the
+# Gemfile to stdout in JSON format. The JSON is a map from gem names
+# to sources, both strings. A gem from a gem server (the top-level
+# source, or that of an enclosing source block) maps to the server's
+# URL. A gem from a git repository (including github: shorthands)
+# maps to "git:URL", followed by "@REF" if a branch, tag or ref is
+# given, and one from a local directory maps to "path:PATH".
+
+require 'bundler'
+require 'json'
+
+dsl = Bundler::Dsl.new
+dsl.eval_gemfile("Gemfile")
+
+sources = dsl.instance_variable_get(:@sources)
+default_source =
+  if sources.respond_to?(:global_rubygems_source)
+    sources.global_rubygems_source
+  else
+    sources.rubygems_sources.last
+  end
+
+def describe(source)
+  case source
+  when Bundler::Source::Git
+    ref = source.options["branch"] || source.options["tag"] || source.options["ref"]
+    description = "git:#{source.uri}"
+    description += "@#{ref}" if ref
+    description
+  when Bundler::Source::Path
+    "path:#{source.path}"
+  when Bundler::Source::Rubygems
+    source.remotes.map { |remote| remote.to_s.chomp("/") }.join(", ")
+  else
+    ""
+  end
+end
+
+result = {}
+dsl.dependencies.each do |dep|
+  result[dep.name] = describe(dep.source || default_source)
+end
+
+puts result.to_json